@@ -5,6 +5,7 @@ package main
 import (
     "fmt"
     "flag"
+    "encoding/json"
     "os"
     "strings"
     "path/filepath"
@@ -45,13 +46,124 @@ func displayRoms(mapper uint32) {
     }
 }
 
+/* print rom database entries for the given roms, using the values from their headers */
+func displayRomDatabase(paths []string) error {
+    var entries []nes.RomInfo
+    for _, path := range paths {
+        nesFile, err := nes.ParseNesFile(path, false)
+        if err != nil {
+            return fmt.Errorf("could not parse %v: %v", path, err)
+        }
+
+        crc, sha := nes.RomHashes(&nesFile)
+
+        mirroring := "horizontal"
+        if nesFile.VerticalMirror {
+            mirroring = "vertical"
+        }
+        if nesFile.FourScreen {
+            mirroring = "four-screen"
+        }
+
+        entries = append(entries, nes.RomInfo{
+            Title: strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)),
+            CRC32: fmt.Sprintf("%08x", crc),
+            SHA1: sha,
+            Mapper: &nesFile.Mapper,
+            Submapper: &nesFile.Submapper,
+            Mirroring: mirroring,
+            Region: nesFile.Region.String(),
+            Battery: &nesFile.Battery,
+        })
+    }
+
+    data, err := json.MarshalIndent(entries, "", "    ")
+    if err != nil {
+        return err
+    }
+
+    fmt.Printf("%s\n", data)
+    return nil
+}
+
+/* print rom database entries for every game in the nes 2.0 header database */
+/* entries from the json rom databases in keep are added after the nes20db games, unless nes20db
+ * already has a game with the same hash. this keeps roms that nes20db doesn't know about, such as
+ * test roms, when the bundled database is regenerated
+ */
+func displayNes20Database(path string, keep []string) error {
+    file, err := os.Open(path)
+    if err != nil {
+        return err
+    }
+    defer file.Close()
+
+    entries, err := nes.ReadNes20Database(file)
+    if err != nil {
+        return err
+    }
+
+    hashes := make(map[string]bool)
+    for _, entry := range entries {
+        hashes[strings.ToLower(entry.CRC32)] = true
+        hashes[strings.ToLower(entry.SHA1)] = true
+    }
+    /* a missing hash doesn't match anything */
+    delete(hashes, "")
+
+    for _, keepPath := range keep {
+        data, err := os.ReadFile(keepPath)
+        if err != nil {
+            return err
+        }
+
+        var kept []*nes.RomInfo
+        err = json.Unmarshal(data, &kept)
+        if err != nil {
+            return fmt.Errorf("could not read %v: %v", keepPath, err)
+        }
+
+        for _, entry := range kept {
+            if !hashes[strings.ToLower(entry.CRC32)] && !hashes[strings.ToLower(entry.SHA1)] {
+                entries = append(entries, entry)
+            }
+        }
+    }
+
+    data, err := json.MarshalIndent(entries, "", "    ")
+    if err != nil {
+        return err
+    }
+
+    fmt.Printf("%s\n", data)
+    return nil
+}
+
 func main(){
 
     findMapper := flag.Int("find", -1, "Find all ROMs with a specific mapper")
+    romDatabase := flag.Bool("romdb", false, "Print rom database entries for the given ROMs")
+    nes20Database := flag.String("nes20db", "", "Print rom database entries for the games in the given nes20db.xml, followed by the entries of the json rom databases given as arguments")
 
     flag.Parse()
 
     if *findMapper != -1 {
         displayRoms(uint32(*findMapper))
     }
+
+    if *romDatabase {
+        err := displayRomDatabase(flag.Args())
+        if err != nil {
+            fmt.Printf("Error: %v\n", err)
+            os.Exit(1)
+        }
+    }
+
+    if *nes20Database != "" {
+        err := displayNes20Database(*nes20Database, flag.Args())
+        if err != nil {
+            fmt.Printf("Error: %v\n", err)
+            os.Exit(1)
+        }
+    }
 }
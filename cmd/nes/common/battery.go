@@ -0,0 +1,168 @@
+package common
+
+import (
+    "os"
+    "path/filepath"
+    "bytes"
+    "log"
+    "fmt"
+    "sync"
+    nes "github.com/kazzmir/nes/lib"
+)
+
+/* battery backed prg ram is stored next to the save state, in <config>/<sha256>/battery.sav */
+func batteryPath(sha256 string) (string, error) {
+    path, err := GetOrCreateConfigDir()
+    if err != nil {
+        return "", err
+    }
+
+    return filepath.Join(path, sha256, "battery.sav"), nil
+}
+
+func getPRGRam(mapper nes.Mapper) []byte {
+    ramMapper, ok := mapper.(nes.PRGRamMapper)
+    if !ok {
+        return nil
+    }
+
+    return ramMapper.GetPRGRam()
+}
+
+/* copy the contents of the .sav file into the mapper's prg ram. a missing file is not an error */
+func LoadBatteryRam(mapper nes.Mapper, sha256 string) error {
+    ram := getPRGRam(mapper)
+    if ram == nil {
+        return fmt.Errorf("mapper does not have prg ram")
+    }
+
+    path, err := batteryPath(sha256)
+    if err != nil {
+        return err
+    }
+
+    data, err := os.ReadFile(path)
+    if err != nil {
+        if os.IsNotExist(err) {
+            return nil
+        }
+        return err
+    }
+
+    if len(data) != len(ram) {
+        log.Printf("Warning: battery save %v is %v bytes but prg ram is %v bytes", path, len(data), len(ram))
+    }
+
+    copy(ram, data)
+
+    return nil
+}
+
+func SaveBatteryRam(ram []byte, sha256 string) error {
+    path, err := batteryPath(sha256)
+    if err != nil {
+        return err
+    }
+
+    return writeSaveFile(path, ram)
+}
+
+func writeSaveFile(path string, data []byte) error {
+    err := os.MkdirAll(filepath.Dir(path), 0755)
+    if err != nil {
+        return err
+    }
+
+    /* write to a temporary file first so a crash while writing doesn't lose the old save */
+    temporary := path + ".tmp"
+    err = os.WriteFile(temporary, data, 0644)
+    if err != nil {
+        return err
+    }
+
+    return os.Rename(temporary, path)
+}
+
+/* keeps track of the last prg ram that was written to disk so that the file
+ * is only rewritten when the game actually changed something. disk system games
+ * save the changes made to the disk instead, see MakeDiskSaver
+ */
+type BatterySaver struct {
+    /* the data to save, which is nil if there is nothing to save */
+    data func(cpu *nes.CPUState) []byte
+    write func(data []byte) error
+    last []byte
+    /* incremented every time the ram changes, so an older background save
+     * can't overwrite a newer one
+     */
+    generation uint64
+    written uint64
+    lock sync.Mutex
+}
+
+func MakeBatterySaver(cpu *nes.CPUState, sha256 string) *BatterySaver {
+    if _, ok := cpu.Mapper.Mapper.(nes.DiskMapper); ok {
+        return MakeDiskSaver(cpu, sha256)
+    }
+
+    err := LoadBatteryRam(cpu.Mapper.Mapper, sha256)
+    if err != nil {
+        log.Printf("Unable to load battery ram: %v", err)
+    }
+
+    return &BatterySaver{
+        /* the mapper can be replaced by loading a save state, so always get the ram from the cpu */
+        data: func(cpu *nes.CPUState) []byte {
+            return getPRGRam(cpu.Mapper.Mapper)
+        },
+        write: func(data []byte) error {
+            return SaveBatteryRam(data, sha256)
+        },
+        last: bytes.Clone(getPRGRam(cpu.Mapper.Mapper)),
+    }
+}
+
+/* returns a copy of the data if it changed since the last call, or nil */
+func (saver *BatterySaver) changed(cpu *nes.CPUState) []byte {
+    data := saver.data(cpu)
+    if data == nil || bytes.Equal(data, saver.last) {
+        return nil
+    }
+
+    saver.last = bytes.Clone(data)
+    saver.generation += 1
+    return saver.last
+}
+
+func (saver *BatterySaver) save(data []byte, generation uint64){
+    saver.lock.Lock()
+    defer saver.lock.Unlock()
+
+    if generation <= saver.written {
+        return
+    }
+
+    err := saver.write(data)
+    if err != nil {
+        log.Printf("Unable to save battery ram: %v", err)
+        return
+    }
+
+    saver.written = generation
+}
+
+/* write the save data in the background if it changed. called periodically while the game runs */
+func (saver *BatterySaver) Update(cpu *nes.CPUState){
+    data := saver.changed(cpu)
+    if data != nil {
+        go saver.save(data, saver.generation)
+    }
+}
+
+/* write the save data and wait for it to finish. called when the game stops */
+func (saver *BatterySaver) Flush(cpu *nes.CPUState){
+    data := saver.changed(cpu)
+    if data != nil {
+        saver.save(data, saver.generation)
+    }
+}
@@ -40,6 +40,10 @@ type ConfigKeys struct {
     SaveState string
     LoadState string
     Console string
+    Rewind string
+    SwitchDisk string
+    InsertCoin1 string
+    InsertCoin2 string
 
     ButtonA string
     ButtonB string
@@ -57,6 +61,59 @@ type ConfigData struct {
     Version int `json:"version,omitempty"`
     Player1Joystick ConfigJoystickData `json:"player1-joystick,omitempty"`
     Player1Keys ConfigKeys `json:"player1-keys,omitempty"`
+    Player2Joystick ConfigJoystickData `json:"player2-joystick,omitempty"`
+    /* only the Button* keys are used for player 2 */
+    Player2Keys ConfigKeys `json:"player2-keys,omitempty"`
+    Rewind ConfigRewind `json:"rewind,omitempty"`
+    /* per game settings, keyed by the sha256 of the rom */
+    Games map[string]ConfigGame `json:"games,omitempty"`
+}
+
+type ConfigGame struct {
+    /* overrides the region from the rom header. empty means use the header */
+    Region string `json:"region,omitempty"`
+    /* vs. system games, dip switch 1 is bit 0 */
+    DipSwitches byte `json:"dipswitches,omitempty"`
+    SwapControllers bool `json:"swapcontrollers,omitempty"`
+}
+
+type ConfigRewind struct {
+    /* maximum memory used by rewind snapshots in megabytes. 0 uses the default and a negative value disables rewind */
+    Memory int `json:"memory,omitempty"`
+    /* take a snapshot every this many frames */
+    Frames int `json:"frames,omitempty"`
+}
+
+const DefaultRewindMemory = 64
+const DefaultRewindFrames = 2
+
+func (rewind ConfigRewind) GetMemory() int {
+    if rewind.Memory == 0 {
+        return DefaultRewindMemory
+    }
+    return rewind.Memory
+}
+
+func (rewind ConfigRewind) GetFrames() int {
+    if rewind.Frames <= 0 {
+        return DefaultRewindFrames
+    }
+    return rewind.Frames
+}
+
+func (data *ConfigData) GetJoystick(port int) ConfigJoystickData {
+    if port == Port2 {
+        return data.Player2Joystick
+    }
+    return data.Player1Joystick
+}
+
+func (data *ConfigData) SetJoystick(port int, joystick ConfigJoystickData) {
+    if port == Port2 {
+        data.Player2Joystick = joystick
+    } else {
+        data.Player1Joystick = joystick
+    }
 }
 
 /* make the directory where the config file lives, which is ~/.config/jon-nes on linux */
@@ -125,3 +182,26 @@ func SaveConfigData(data ConfigData) error {
     encoder.SetIndent("", "  ")
     return encoder.Encode(data)
 }
+
+/* change the settings of one game. games that end up with no settings are removed from the config */
+func UpdateConfigGame(sha256 string, update func(*ConfigGame)) error {
+    config, err := LoadConfigData()
+    if err != nil {
+        config = DefaultConfigData()
+    }
+
+    game := config.Games[sha256]
+    update(&game)
+
+    if config.Games == nil {
+        config.Games = make(map[string]ConfigGame)
+    }
+
+    if game == (ConfigGame{}) {
+        delete(config.Games, sha256)
+    } else {
+        config.Games[sha256] = game
+    }
+
+    return SaveConfigData(config)
+}
@@ -0,0 +1,120 @@
+package common
+
+import (
+    "os"
+    "path/filepath"
+    "log"
+    "fmt"
+    nes "github.com/kazzmir/nes/lib"
+)
+
+/* the disk system bios can't be distributed with the emulator, so the user has to put it
+ * next to the disk image or in the config directory
+ */
+const DiskSystemBiosName = "disksys.rom"
+
+func LoadDiskSystemBios(romPath string) ([]byte, error) {
+    var paths []string
+    if romPath != "" {
+        paths = append(paths, filepath.Join(filepath.Dir(romPath), DiskSystemBiosName))
+    }
+
+    configDir, err := GetOrCreateConfigDir()
+    if err == nil {
+        paths = append(paths, filepath.Join(configDir, DiskSystemBiosName))
+    }
+
+    for _, path := range paths {
+        data, err := os.ReadFile(path)
+        if err == nil {
+            return data, nil
+        }
+    }
+
+    return nil, fmt.Errorf("could not find the disk system bios %v in %v", DiskSystemBiosName, paths)
+}
+
+/* the changes a game makes to its disk are kept as an ips patch against the original image,
+ * in <config>/<sha256>/disk.ips
+ */
+func diskPatchPath(sha256 string) (string, error) {
+    path, err := GetOrCreateConfigDir()
+    if err != nil {
+        return "", err
+    }
+
+    return filepath.Join(path, sha256, "disk.ips"), nil
+}
+
+/* apply the saved changes to the disk in the mapper. a missing file is not an error */
+func LoadDiskPatch(disk nes.DiskMapper, sha256 string) error {
+    path, err := diskPatchPath(sha256)
+    if err != nil {
+        return err
+    }
+
+    patch, err := os.ReadFile(path)
+    if err != nil {
+        if os.IsNotExist(err) {
+            return nil
+        }
+        return err
+    }
+
+    image, err := nes.ApplyIPSPatch(disk.GetDiskImage(), patch)
+    if err != nil {
+        return err
+    }
+
+    disk.SetDiskImage(image)
+
+    return nil
+}
+
+func SaveDiskPatch(patch []byte, sha256 string) error {
+    path, err := diskPatchPath(sha256)
+    if err != nil {
+        return err
+    }
+
+    return writeSaveFile(path, patch)
+}
+
+/* like MakeBatterySaver, but saves the differences between the original disk and the disk in
+ * the mapper
+ */
+func MakeDiskSaver(cpu *nes.CPUState, sha256 string) *BatterySaver {
+    /* the disk hasn't been written to yet, so this is the original image */
+    var original []byte
+    if disk, ok := cpu.Mapper.Mapper.(nes.DiskMapper); ok {
+        original = disk.GetDiskImage()
+
+        err := LoadDiskPatch(disk, sha256)
+        if err != nil {
+            log.Printf("Unable to load disk changes: %v", err)
+        }
+    }
+
+    data := func(cpu *nes.CPUState) []byte {
+        disk, ok := cpu.Mapper.Mapper.(nes.DiskMapper)
+        if !ok || original == nil {
+            return nil
+        }
+
+        patch, err := nes.MakeIPSPatch(original, disk.GetDiskImage())
+        if err != nil {
+            log.Printf("Unable to save disk changes: %v", err)
+            return nil
+        }
+
+        return patch
+    }
+
+    return &BatterySaver{
+        data: data,
+        write: func(patch []byte) error {
+            return SaveDiskPatch(patch, sha256)
+        },
+        last: data(cpu),
+    }
+}
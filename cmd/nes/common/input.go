@@ -23,6 +23,12 @@ type JoystickManager struct {
     Lock sync.Mutex
 }
 
+/* the controller ports, used to choose between Player1 and Player2 */
+const (
+    Port1 = 1
+    Port2 = 2
+)
+
 func NewJoystickManager() *JoystickManager {
     manager := JoystickManager{
         Joysticks: make(map[ebiten.GamepadID]*JoystickButtons),
@@ -31,10 +37,31 @@ func NewJoystickManager() *JoystickManager {
     return &manager
 }
 
-func (manager *JoystickManager) ScanForJoysticks() {
-    loadedConfig := false
-    var configData ConfigData
+func (manager *JoystickManager) GetPlayer(port int) *JoystickButtons {
+    switch port {
+        case Port1: return manager.Player1
+        case Port2: return manager.Player2
+    }
+
+    return nil
+}
+
+/* assign a joystick to a port and load the configuration for that port */
+func (manager *JoystickManager) setPlayer(port int, joystick *JoystickButtons) {
+    switch port {
+        case Port1: manager.Player1 = joystick
+        case Port2: manager.Player2 = joystick
+    }
 
+    if joystick != nil {
+        configData, err := LoadConfigData()
+        if err == nil {
+            joystick.Load(configData.GetJoystick(port))
+        }
+    }
+}
+
+func (manager *JoystickManager) ScanForJoysticks() {
     gamepadIds := inpututil.AppendJustConnectedGamepadIDs(nil)
     for _, gamepadId := range gamepadIds {
         _, exists := manager.Joysticks[gamepadId]
@@ -48,14 +75,6 @@ func (manager *JoystickManager) ScanForJoysticks() {
             continue
         }
 
-        if !loadedConfig {
-            loadedConfig = true
-            configData, err = LoadConfigData()
-            if err == nil {
-                input.Load(configData.Player1Joystick)
-            }
-        }
-
         log.Printf("Found joystick: %v\n", input.Name)
 
         manager.Joysticks[gamepadId] = input
@@ -64,93 +83,121 @@ func (manager *JoystickManager) ScanForJoysticks() {
 
     // FIXME: also handle removed joysticks
 
+    /* the first joystick goes to player 1 and the second to player 2 */
     if manager.Player1 == nil && len(manager.Joysticks) > 0 {
-        // choose a random one
-        manager.Player1 = manager.Joysticks[manager.JoystickOrder[0]]
+        manager.setPlayer(Port1, manager.Joysticks[manager.JoystickOrder[0]])
+    }
+
+    if manager.Player2 == nil {
+        for _, id := range manager.JoystickOrder {
+            if manager.Joysticks[id] != manager.Player1 {
+                manager.setPlayer(Port2, manager.Joysticks[id])
+                break
+            }
+        }
     }
 }
 
 func (manager *JoystickManager) Update() []EmulatorActionValue {
+    var actions []EmulatorActionValue
     if manager.Player1 != nil {
-        return manager.Player1.Update()
+        actions = append(actions, manager.Player1.Update()...)
     }
 
-    return nil
+    /* the same joystick could be plugged into both ports */
+    if manager.Player2 != nil && manager.Player2 != manager.Player1 {
+        actions = append(actions, manager.Player2.Update()...)
+    }
+
+    return actions
 }
 
-func (manager *JoystickManager) NextJoystick() {
-    if manager.Player1 != nil {
-        index := slices.Index(manager.JoystickOrder, manager.Player1.gamepad)
-        if index >= 0 {
-            index = (index + 1) % len(manager.JoystickOrder)
-            manager.Player1 = manager.Joysticks[manager.JoystickOrder[index]]
-        }
+/* move the joystick in the given port forward or backward through the list of joysticks */
+func (manager *JoystickManager) cycleJoystick(port int, direction int) {
+    if len(manager.JoystickOrder) == 0 {
+        return
     }
-}
 
-func (manager *JoystickManager) PreviousJoystick() {
-    if manager.Player1 != nil {
-        index := slices.Index(manager.JoystickOrder, manager.Player1.gamepad)
-        if index >= 0 {
-            index = (index - 1 + len(manager.JoystickOrder)) % len(manager.JoystickOrder)
-            manager.Player1 = manager.Joysticks[manager.JoystickOrder[index]]
-        }
+    index := -1
+    current := manager.GetPlayer(port)
+    if current != nil {
+        index = slices.Index(manager.JoystickOrder, current.gamepad)
+    }
+
+    if index < 0 {
+        index = 0
+    } else {
+        index = (index + direction + len(manager.JoystickOrder)) % len(manager.JoystickOrder)
     }
+
+    manager.setPlayer(port, manager.Joysticks[manager.JoystickOrder[index]])
 }
 
-func (manager *JoystickManager) CurrentName() string {
+func (manager *JoystickManager) NextJoystick(port int) {
+    manager.cycleJoystick(port, 1)
+}
+
+func (manager *JoystickManager) PreviousJoystick(port int) {
+    manager.cycleJoystick(port, -1)
+}
+
+func (manager *JoystickManager) CurrentName(port int) string {
     manager.Lock.Lock()
     defer manager.Lock.Unlock()
 
-    if manager.Player1 != nil {
-        return manager.Player1.Name
+    player := manager.GetPlayer(port)
+    if player != nil {
+        return player.Name
     }
 
     return "No joystick found"
 }
 
-func (manager *JoystickManager) SaveInput() error {
+func (manager *JoystickManager) SaveInput(port int) error {
     manager.Lock.Lock()
     defer manager.Lock.Unlock()
 
-    if manager.Player1 != nil {
+    player := manager.GetPlayer(port)
+    if player != nil {
         data, err := LoadConfigData()
         if err != nil {
             log.Printf("Warning: could not load config. Creating new config")
         }
-        data.Player1Joystick = ConfigJoystickData{
-            A: manager.Player1.Inputs[nes.ButtonIndexA].Serialize(),
-            B: manager.Player1.Inputs[nes.ButtonIndexB].Serialize(),
-            Select: manager.Player1.Inputs[nes.ButtonIndexSelect].Serialize(),
-            Start: manager.Player1.Inputs[nes.ButtonIndexStart].Serialize(),
-            Up: manager.Player1.Inputs[nes.ButtonIndexUp].Serialize(),
-            Down: manager.Player1.Inputs[nes.ButtonIndexDown].Serialize(),
-            Left: manager.Player1.Inputs[nes.ButtonIndexLeft].Serialize(),
-            Right: manager.Player1.Inputs[nes.ButtonIndexRight].Serialize(),
-            Guid: ebiten.GamepadSDLID(manager.Player1.gamepad),
-            Name: strings.TrimSpace(manager.Player1.Name),
+        joystickData := ConfigJoystickData{
+            A: player.Inputs[nes.ButtonIndexA].Serialize(),
+            B: player.Inputs[nes.ButtonIndexB].Serialize(),
+            Select: player.Inputs[nes.ButtonIndexSelect].Serialize(),
+            Start: player.Inputs[nes.ButtonIndexStart].Serialize(),
+            Up: player.Inputs[nes.ButtonIndexUp].Serialize(),
+            Down: player.Inputs[nes.ButtonIndexDown].Serialize(),
+            Left: player.Inputs[nes.ButtonIndexLeft].Serialize(),
+            Right: player.Inputs[nes.ButtonIndexRight].Serialize(),
+            Guid: ebiten.GamepadSDLID(player.gamepad),
+            Name: strings.TrimSpace(player.Name),
         }
 
-        turboA := manager.Player1.TurboA
+        turboA := player.TurboA
         if turboA != nil {
-            data.Player1Joystick.TurboA = turboA.Serialize()
+            joystickData.TurboA = turboA.Serialize()
         }
 
-        turboB := manager.Player1.TurboB
+        turboB := player.TurboB
         if turboB != nil {
-            data.Player1Joystick.TurboB = turboB.Serialize()
+            joystickData.TurboB = turboB.Serialize()
         }
 
-        turboButton, ok := manager.Player1.ExtraInputs[EmulatorTurbo]
+        turboButton, ok := player.ExtraInputs[EmulatorTurbo]
         if ok {
-            data.Player1Joystick.Turbo = turboButton.Serialize()
+            joystickData.Turbo = turboButton.Serialize()
         }
 
-        pauseButton, ok := manager.Player1.ExtraInputs[EmulatorTogglePause]
+        pauseButton, ok := player.ExtraInputs[EmulatorTogglePause]
         if ok {
-            data.Player1Joystick.Pause = pauseButton.Serialize()
+            joystickData.Pause = pauseButton.Serialize()
         }
 
+        data.SetJoystick(port, joystickData)
+
         return SaveConfigData(data)
     }
 
@@ -235,12 +282,13 @@ func (manager *JoystickManager) Close() {
     */
 }
 
-func (manager *JoystickManager) Get() nes.ButtonMapping {
+func (manager *JoystickManager) GetPort(port int) nes.ButtonMapping {
     manager.Lock.Lock()
     defer manager.Lock.Unlock()
 
-    if manager.Player1 != nil {
-        return manager.Player1.Get()
+    player := manager.GetPlayer(port)
+    if player != nil {
+        return player.Get()
     }
 
     mapping := make(nes.ButtonMapping)
@@ -257,8 +305,23 @@ func (manager *JoystickManager) Get() nes.ButtonMapping {
     return mapping
 }
 
+/* the joystick manager itself is the input for player 1 */
+func (manager *JoystickManager) Get() nes.ButtonMapping {
+    return manager.GetPort(Port1)
+}
+
+/* a HostInput that reads from the joystick in the given port */
+type JoystickPortInput struct {
+    Manager *JoystickManager
+    Port int
+}
+
+func (input *JoystickPortInput) Get() nes.ButtonMapping {
+    return input.Manager.GetPort(input.Port)
+}
+
 type KeyboardButtons struct {
-    Keys *EmulatorKeys
+    Keys *ControllerKeys
 
     /* true if held down, false if not */
     ButtonA bool
@@ -784,6 +847,20 @@ func (combine *CombineButtons) Get() nes.ButtonMapping {
     return mapping
 }
 
+/* the keys that make up one nes controller */
+type ControllerKeys struct {
+    ButtonA ebiten.Key
+    ButtonB ebiten.Key
+    ButtonTurboA ebiten.Key
+    ButtonTurboB ebiten.Key
+    ButtonSelect ebiten.Key
+    ButtonStart ebiten.Key
+    ButtonUp ebiten.Key
+    ButtonDown ebiten.Key
+    ButtonLeft ebiten.Key
+    ButtonRight ebiten.Key
+}
+
 type EmulatorKeys struct {
     Turbo ebiten.Key
     Pause ebiten.Key
@@ -797,17 +874,16 @@ type EmulatorKeys struct {
     SaveState ebiten.Key
     LoadState ebiten.Key
     Console ebiten.Key
-
-    ButtonA ebiten.Key
-    ButtonB ebiten.Key
-    ButtonTurboA ebiten.Key
-    ButtonTurboB ebiten.Key
-    ButtonSelect ebiten.Key
-    ButtonStart ebiten.Key
-    ButtonUp ebiten.Key
-    ButtonDown ebiten.Key
-    ButtonLeft ebiten.Key
-    ButtonRight ebiten.Key
+    /* hold to rewind */
+    Rewind ebiten.Key
+    /* flip the disk in disk system games */
+    SwitchDisk ebiten.Key
+    /* drop a coin into the slots of a vs. system cabinet */
+    InsertCoin1 ebiten.Key
+    InsertCoin2 ebiten.Key
+
+    /* player 1 */
+    ControllerKeys
 }
 
 type EmulatorKey struct {
@@ -815,7 +891,7 @@ type EmulatorKey struct {
     Code ebiten.Key
 }
 
-func (keys *EmulatorKeys) Update(key string, value ebiten.Key) {
+func (keys *ControllerKeys) Update(key string, value ebiten.Key) {
     switch key {
         case "A": keys.ButtonA = value
         case "B": keys.ButtonB = value
@@ -827,6 +903,26 @@ func (keys *EmulatorKeys) Update(key string, value ebiten.Key) {
         case "Down": keys.ButtonDown = value
         case "Left": keys.ButtonLeft = value
         case "Right": keys.ButtonRight = value
+    }
+}
+
+func (keys ControllerKeys) AllKeys() []EmulatorKey {
+    return []EmulatorKey{
+        EmulatorKey{Name: "A", Code: keys.ButtonA},
+        EmulatorKey{Name: "B", Code: keys.ButtonB},
+        EmulatorKey{Name: "TurboA", Code: keys.ButtonTurboA},
+        EmulatorKey{Name: "TurboB", Code: keys.ButtonTurboB},
+        EmulatorKey{Name: "Select", Code: keys.ButtonSelect},
+        EmulatorKey{Name: "Start", Code: keys.ButtonStart},
+        EmulatorKey{Name: "Up", Code: keys.ButtonUp},
+        EmulatorKey{Name: "Down", Code: keys.ButtonDown},
+        EmulatorKey{Name: "Left", Code: keys.ButtonLeft},
+        EmulatorKey{Name: "Right", Code: keys.ButtonRight},
+    }
+}
+
+func (keys *EmulatorKeys) Update(key string, value ebiten.Key) {
+    switch key {
         case "Turbo": keys.Turbo = value
         case "Pause": keys.Pause = value
         case "HardReset": keys.HardReset = value
@@ -839,7 +935,11 @@ func (keys *EmulatorKeys) Update(key string, value ebiten.Key) {
         case "SaveState": keys.SaveState = value
         case "LoadState": keys.LoadState = value
         case "Console": keys.Console = value
-
+        case "Rewind": keys.Rewind = value
+        case "SwitchDisk": keys.SwitchDisk = value
+        case "InsertCoin1": keys.InsertCoin1 = value
+        case "InsertCoin2": keys.InsertCoin2 = value
+        default: keys.ControllerKeys.Update(key, value)
     }
 }
 
@@ -848,18 +948,7 @@ func (keys *EmulatorKeys) UpdateAll(other EmulatorKeys){
 }
 
 func (keys EmulatorKeys) AllKeys() []EmulatorKey {
-    return []EmulatorKey{
-        EmulatorKey{Name: "A", Code: keys.ButtonA},
-        EmulatorKey{Name: "B", Code: keys.ButtonB},
-        EmulatorKey{Name: "TurboA", Code: keys.ButtonTurboA},
-        EmulatorKey{Name: "TurboB", Code: keys.ButtonTurboB},
-        EmulatorKey{Name: "Select", Code: keys.ButtonSelect},
-        EmulatorKey{Name: "Start", Code: keys.ButtonStart},
-        EmulatorKey{Name: "Up", Code: keys.ButtonUp},
-        EmulatorKey{Name: "Down", Code: keys.ButtonDown},
-        EmulatorKey{Name: "Left", Code: keys.ButtonLeft},
-        EmulatorKey{Name: "Right", Code: keys.ButtonRight},
-
+    return append(keys.ControllerKeys.AllKeys(),
         EmulatorKey{Name: "Turbo", Code: keys.Turbo},
         EmulatorKey{Name: "Pause", Code: keys.Pause},
         EmulatorKey{Name: "HardReset", Code: keys.HardReset},
@@ -872,7 +961,11 @@ func (keys EmulatorKeys) AllKeys() []EmulatorKey {
         EmulatorKey{Name: "SaveState", Code: keys.SaveState},
         EmulatorKey{Name: "LoadState", Code: keys.LoadState},
         EmulatorKey{Name: "Console", Code: keys.Console},
-    }
+        EmulatorKey{Name: "Rewind", Code: keys.Rewind},
+        EmulatorKey{Name: "SwitchDisk", Code: keys.SwitchDisk},
+        EmulatorKey{Name: "InsertCoin1", Code: keys.InsertCoin1},
+        EmulatorKey{Name: "InsertCoin2", Code: keys.InsertCoin2},
+    )
 }
 
 func LoadEmulatorKeys() EmulatorKeys {
@@ -880,54 +973,94 @@ func LoadEmulatorKeys() EmulatorKeys {
 
     out := DefaultEmulatorKeys()
 
-    convert := func(key string, default_ ebiten.Key) ebiten.Key {
-        if key != "" {
-            var out ebiten.Key
-            err := out.UnmarshalText([]byte(key))
-            if err == nil {
-                return out
-            }
+    out.Turbo = convertKey(data.Player1Keys.Turbo, out.Turbo)
+    out.Pause = convertKey(data.Player1Keys.Pause, out.Pause)
+    out.HardReset = convertKey(data.Player1Keys.HardReset, out.HardReset)
+    out.PPUDebug = convertKey(data.Player1Keys.PPUDebug, out.PPUDebug)
+    out.SlowDown = convertKey(data.Player1Keys.SlowDown, out.SlowDown)
+    out.SpeedUp = convertKey(data.Player1Keys.SpeedUp, out.SpeedUp)
+    out.Normal = convertKey(data.Player1Keys.Normal, out.Normal)
+    out.StepFrame = convertKey(data.Player1Keys.StepFrame, out.StepFrame)
+    out.Record = convertKey(data.Player1Keys.Record, out.Record)
+    out.SaveState = convertKey(data.Player1Keys.SaveState, out.SaveState)
+    out.LoadState = convertKey(data.Player1Keys.LoadState, out.LoadState)
+    out.Console = convertKey(data.Player1Keys.Console, out.Console)
+    out.Rewind = convertKey(data.Player1Keys.Rewind, out.Rewind)
+    out.SwitchDisk = convertKey(data.Player1Keys.SwitchDisk, out.SwitchDisk)
+    out.InsertCoin1 = convertKey(data.Player1Keys.InsertCoin1, out.InsertCoin1)
+    out.InsertCoin2 = convertKey(data.Player1Keys.InsertCoin2, out.InsertCoin2)
+    out.ControllerKeys = convertControllerKeys(data.Player1Keys, out.ControllerKeys)
+
+    return out
+}
+
+func convertKey(key string, default_ ebiten.Key) ebiten.Key {
+    if key != "" {
+        var out ebiten.Key
+        err := out.UnmarshalText([]byte(key))
+        if err == nil {
+            return out
         }
-        return default_
-    }
-
-    out.Turbo = convert(data.Player1Keys.Turbo, out.Turbo)
-    out.Pause = convert(data.Player1Keys.Pause, out.Pause)
-    out.HardReset = convert(data.Player1Keys.HardReset, out.HardReset)
-    out.PPUDebug = convert(data.Player1Keys.PPUDebug, out.PPUDebug)
-    out.SlowDown = convert(data.Player1Keys.SlowDown, out.SlowDown)
-    out.SpeedUp = convert(data.Player1Keys.SpeedUp, out.SpeedUp)
-    out.Normal = convert(data.Player1Keys.Normal, out.Normal)
-    out.StepFrame = convert(data.Player1Keys.StepFrame, out.StepFrame)
-    out.Record = convert(data.Player1Keys.Record, out.Record)
-    out.SaveState = convert(data.Player1Keys.SaveState, out.SaveState)
-    out.LoadState = convert(data.Player1Keys.LoadState, out.LoadState)
-    out.Console = convert(data.Player1Keys.Console, out.Console)
-    out.ButtonA = convert(data.Player1Keys.ButtonA, out.ButtonA)
-    out.ButtonB = convert(data.Player1Keys.ButtonB, out.ButtonB)
-    out.ButtonTurboA = convert(data.Player1Keys.ButtonTurboA, out.ButtonTurboA)
-    out.ButtonTurboB = convert(data.Player1Keys.ButtonTurboB, out.ButtonTurboB)
-    out.ButtonSelect = convert(data.Player1Keys.ButtonSelect, out.ButtonSelect)
-    out.ButtonStart = convert(data.Player1Keys.ButtonStart, out.ButtonStart)
-    out.ButtonUp = convert(data.Player1Keys.ButtonUp, out.ButtonUp)
-    out.ButtonDown = convert(data.Player1Keys.ButtonDown, out.ButtonDown)
-    out.ButtonLeft = convert(data.Player1Keys.ButtonLeft, out.ButtonLeft)
-    out.ButtonRight = convert(data.Player1Keys.ButtonRight, out.ButtonRight)
+    }
+    return default_
+}
 
+/* read the controller keys out of the config, using the keys in defaults for anything that isn't set */
+func convertControllerKeys(data ConfigKeys, defaults ControllerKeys) ControllerKeys {
+    out := defaults
+    out.ButtonA = convertKey(data.ButtonA, out.ButtonA)
+    out.ButtonB = convertKey(data.ButtonB, out.ButtonB)
+    out.ButtonTurboA = convertKey(data.ButtonTurboA, out.ButtonTurboA)
+    out.ButtonTurboB = convertKey(data.ButtonTurboB, out.ButtonTurboB)
+    out.ButtonSelect = convertKey(data.ButtonSelect, out.ButtonSelect)
+    out.ButtonStart = convertKey(data.ButtonStart, out.ButtonStart)
+    out.ButtonUp = convertKey(data.ButtonUp, out.ButtonUp)
+    out.ButtonDown = convertKey(data.ButtonDown, out.ButtonDown)
+    out.ButtonLeft = convertKey(data.ButtonLeft, out.ButtonLeft)
+    out.ButtonRight = convertKey(data.ButtonRight, out.ButtonRight)
     return out
 }
 
-func SaveEmulatorKeys(keys EmulatorKeys){
+func LoadPlayer2Keys() ControllerKeys {
     data, _ := LoadConfigData()
+    return convertControllerKeys(data.Player2Keys, DefaultPlayer2Keys())
+}
 
-    marshalKey := func(key ebiten.Key) string {
-        text, err := key.MarshalText()
-        if err != nil {
-            log.Printf("Warning: could not marshal key: %v\n", err)
-            return ""
-        }
-        return string(text)
+func SavePlayer2Keys(keys ControllerKeys){
+    data, _ := LoadConfigData()
+
+    saveControllerKeys(&data.Player2Keys, keys)
+
+    err := SaveConfigData(data)
+    if err != nil {
+        log.Printf("Warning: could not save config: %v", err)
     }
+}
+
+func marshalKey(key ebiten.Key) string {
+    text, err := key.MarshalText()
+    if err != nil {
+        log.Printf("Warning: could not marshal key: %v\n", err)
+        return ""
+    }
+    return string(text)
+}
+
+func saveControllerKeys(data *ConfigKeys, keys ControllerKeys){
+    data.ButtonA = marshalKey(keys.ButtonA)
+    data.ButtonB = marshalKey(keys.ButtonB)
+    data.ButtonTurboA = marshalKey(keys.ButtonTurboA)
+    data.ButtonTurboB = marshalKey(keys.ButtonTurboB)
+    data.ButtonSelect = marshalKey(keys.ButtonSelect)
+    data.ButtonStart = marshalKey(keys.ButtonStart)
+    data.ButtonUp = marshalKey(keys.ButtonUp)
+    data.ButtonDown = marshalKey(keys.ButtonDown)
+    data.ButtonLeft = marshalKey(keys.ButtonLeft)
+    data.ButtonRight = marshalKey(keys.ButtonRight)
+}
+
+func SaveEmulatorKeys(keys EmulatorKeys){
+    data, _ := LoadConfigData()
 
     data.Player1Keys.Turbo = marshalKey(keys.Turbo)
     data.Player1Keys.Pause = marshalKey(keys.Pause)
@@ -942,17 +1075,12 @@ func SaveEmulatorKeys(keys EmulatorKeys){
     data.Player1Keys.SaveState = marshalKey(keys.SaveState)
     data.Player1Keys.LoadState = marshalKey(keys.LoadState)
     data.Player1Keys.Console = marshalKey(keys.Console)
+    data.Player1Keys.Rewind = marshalKey(keys.Rewind)
+    data.Player1Keys.SwitchDisk = marshalKey(keys.SwitchDisk)
+    data.Player1Keys.InsertCoin1 = marshalKey(keys.InsertCoin1)
+    data.Player1Keys.InsertCoin2 = marshalKey(keys.InsertCoin2)
 
-    data.Player1Keys.ButtonA = marshalKey(keys.ButtonA)
-    data.Player1Keys.ButtonB = marshalKey(keys.ButtonB)
-    data.Player1Keys.ButtonTurboA = marshalKey(keys.ButtonTurboA)
-    data.Player1Keys.ButtonTurboB = marshalKey(keys.ButtonTurboB)
-    data.Player1Keys.ButtonSelect = marshalKey(keys.ButtonSelect)
-    data.Player1Keys.ButtonStart = marshalKey(keys.ButtonStart)
-    data.Player1Keys.ButtonUp = marshalKey(keys.ButtonUp)
-    data.Player1Keys.ButtonDown = marshalKey(keys.ButtonDown)
-    data.Player1Keys.ButtonLeft = marshalKey(keys.ButtonLeft)
-    data.Player1Keys.ButtonRight = marshalKey(keys.ButtonRight)
+    saveControllerKeys(&data.Player1Keys, keys.ControllerKeys)
 
     err := SaveConfigData(data)
     if err != nil {
@@ -974,16 +1102,38 @@ func DefaultEmulatorKeys() EmulatorKeys {
         SaveState: ebiten.Key1,
         LoadState: ebiten.Key2,
         Console: ebiten.KeyTab,
+        Rewind: ebiten.KeyBackspace,
+        SwitchDisk: ebiten.KeyF2,
+        InsertCoin1: ebiten.KeyF3,
+        InsertCoin2: ebiten.KeyF4,
+
+        ControllerKeys: ControllerKeys{
+            ButtonA: ebiten.KeyA,
+            ButtonB: ebiten.KeyS,
+            ButtonTurboA: ebiten.KeyD,
+            ButtonTurboB: ebiten.KeyF,
+            ButtonSelect: ebiten.KeyQ,
+            ButtonStart: ebiten.KeyEnter,
+            ButtonUp:  ebiten.KeyUp,
+            ButtonDown: ebiten.KeyDown,
+            ButtonLeft: ebiten.KeyLeft,
+            ButtonRight: ebiten.KeyRight,
+        },
+    }
+}
 
-        ButtonA: ebiten.KeyA,
-        ButtonB: ebiten.KeyS,
-        ButtonTurboA: ebiten.KeyD,
-        ButtonTurboB: ebiten.KeyF,
-        ButtonSelect: ebiten.KeyQ,
-        ButtonStart: ebiten.KeyEnter,
-        ButtonUp:  ebiten.KeyUp,
-        ButtonDown: ebiten.KeyDown,
-        ButtonLeft: ebiten.KeyLeft,
-        ButtonRight: ebiten.KeyRight,
+/* player 2 keys are on the right side of the keyboard so they don't overlap with player 1 or the hotkeys */
+func DefaultPlayer2Keys() ControllerKeys {
+    return ControllerKeys{
+        ButtonA: ebiten.KeyPeriod,
+        ButtonB: ebiten.KeyComma,
+        ButtonTurboA: ebiten.KeySlash,
+        ButtonTurboB: ebiten.KeyN,
+        ButtonSelect: ebiten.KeyY,
+        ButtonStart: ebiten.KeyU,
+        ButtonUp: ebiten.KeyI,
+        ButtonDown: ebiten.KeyK,
+        ButtonLeft: ebiten.KeyJ,
+        ButtonRight: ebiten.KeyL,
     }
 }
@@ -6,12 +6,8 @@ import (
     "log"
     "time"
     "sync"
-    "path/filepath"
     "io/fs"
-    "os"
     "fmt"
-    "compress/gzip"
-    "encoding/json"
     nes "github.com/kazzmir/nes/lib"
     "github.com/kazzmir/nes/lib/coroutine"
     "github.com/kazzmir/nes/cmd/nes/debug"
@@ -115,6 +111,10 @@ const (
     EmulatorLoadState
     EmulatorGetInfo
     EmulatorGetDebugger
+    EmulatorRewind // go back to the previous rewind snapshot
+    EmulatorExportState
+    EmulatorSwitchDisk // flip the disk over, or insert the next disk, for disk system games
+    EmulatorInsertCoin // vs. system games
 )
 
 type EmulatorAction interface {
@@ -156,17 +156,86 @@ func (action EmulatorActionGetInfo) Value() EmulatorActionValue {
     return EmulatorGetInfo
 }
 
-func SetupCPU(nesFile nes.NESFile, debugCpu bool, debugPpu bool) (nes.CPUState, error) {
+/* save or load a specific slot. EmulatorSaveState/EmulatorLoadState on their own use the quick save slot */
+type EmulatorActionSaveStateSlot struct {
+    Slot int
+}
+
+func (action EmulatorActionSaveStateSlot) Value() EmulatorActionValue {
+    return EmulatorSaveState
+}
+
+type EmulatorActionLoadStateSlot struct {
+    Slot int
+}
+
+func (action EmulatorActionLoadStateSlot) Value() EmulatorActionValue {
+    return EmulatorLoadState
+}
+
+/* write the current state as json for debugging */
+type EmulatorActionExportState struct {
+    Path string
+    /* receives the error, or nil if the state was written */
+    Response chan<- error
+}
+
+func (action EmulatorActionExportState) Value() EmulatorActionValue {
+    return EmulatorExportState
+}
+
+type EmulatorActionInsertCoin struct {
+    /* 0 or 1 */
+    Slot int
+}
+
+func (action EmulatorActionInsertCoin) Value() EmulatorActionValue {
+    return EmulatorInsertCoin
+}
+
+/* the rom database may fix up the header of nesFile, so callers should use the corrected
+ * values (such as Battery) afterwards
+ */
+func SetupCPU(nesFile *nes.NESFile, debugCpu bool, debugPpu bool) (nes.CPUState, error) {
     cpu := nes.StartupState()
 
+    if ApplyRomDatabase(nesFile) {
+        log.Printf("Found '%v' in the rom database", nesFile.Title)
+    }
+
+    cpu.SetRegion(GetGameRegion(*nesFile))
+
     if nesFile.HorizontalMirror {
         cpu.PPU.SetHorizontalMirror()
     }
     if nesFile.VerticalMirror {
         cpu.PPU.SetVerticalMirror()
     }
+    if nesFile.FourScreen {
+        cpu.PPU.SetFourScreenMirror()
+    }
 
-    mapper, err := nes.MakeMapper(nesFile.Mapper, nesFile.ProgramRom, nesFile.CharacterRom)
+    if model := nesFile.PPUModel(); model != nes.PPU2C02 {
+        log.Printf("%v with a %v ppu", nesFile.Console, model)
+        cpu.PPU.SetModel(model)
+    }
+
+    if nesFile.Console == nes.ConsoleVsSystem {
+        cpu.Vs = MakeVsSystem(*nesFile)
+    }
+
+    var mapper nes.Mapper
+    var err error
+    if nesFile.IsDisk() {
+        /* the bios loads the game from the disk */
+        var bios []byte
+        bios, err = LoadDiskSystemBios(nesFile.Path)
+        if err == nil {
+            mapper, err = nes.MakeMapperFDS(bios, nesFile.DiskSides)
+        }
+    } else {
+        mapper, err = nes.MakeMapper(nesFile.MapperInfo(), nesFile.ProgramRom, nesFile.CharacterRom)
+    }
     if err != nil {
         return cpu, err
     }
@@ -191,111 +260,28 @@ func SetupCPU(nesFile nes.NESFile, debugCpu bool, debugPpu bool) (nes.CPUState,
     return cpu, nil
 }
 
-const SaveStateVersion = 1
-
-type SaveState struct {
-    State *nes.CPUState `json:"state"`
-    Version int `json:"version"`
-    Date time.Time `json:"time"`
-}
-
-func doSerializeState(quit context.Context, state *nes.CPUState, sha256 string){
-    path, err := GetOrCreateConfigDir()
-    if err != nil {
-        log.Printf("Unable to serialize saved state: %v", err)
-        return
-    }
-
-    path2 := filepath.Join(path, sha256)
-    os.MkdirAll(path2, 0755)
-
-    full := filepath.Join(path2, "state.gz")
-    output, err := os.Create(full)
-    if err != nil {
-        log.Printf("Unable to serialize saved state: %v", err)
-        return
-    }
-    defer output.Close()
-
-    compressor := gzip.NewWriter(output)
-    defer compressor.Close()
-
-    encoder := json.NewEncoder(compressor)
-    err = encoder.Encode(SaveState{
-        State: state,
-        Version: SaveStateVersion,
-        Date: time.Now(),
-    })
-
-    if err != nil {
-        log.Printf("Unable to serialize saved state: %v", err)
-    }
-}
-
-func serializeState(quit context.Context, state *nes.CPUState, sha256 string){
-    doSerializeState(quit, state, sha256)
-
-    /* for debugging */
-
-    /*
-    state2, err := loadCpuState()
-    if err != nil {
-        log.Printf("Unable to load just saved state: %v", err)
-    } else {
-        err = state.Compare(state2)
-        if err != nil {
-            log.Printf("deserialized state doesn't match: %v", err)
-        }
-    }
-    */
-}
-
-func loadCpuState(sha256 string) (*nes.CPUState, error) {
-    path, err := GetOrCreateConfigDir()
-    if err != nil {
-        return nil, err
-    }
-
-    full := filepath.Join(path, sha256, "state.gz")
-    input, err := os.Open(full)
-    if err != nil {
-        return nil, err
-    }
-    defer input.Close()
-
-    decompress, err := gzip.NewReader(input)
-    if err != nil {
-        return nil, err
-    }
-    defer decompress.Close()
-
-    var out SaveState
-    decoder := json.NewDecoder(decompress)
-    err = decoder.Decode(&out)
-    if err != nil {
-        return nil, err
-    }
-    if out.Version != SaveStateVersion {
-        return nil, fmt.Errorf("invalid save state version: %v vs %v", out.Version, SaveStateVersion)
-    }
-    return out.State, nil
-}
-
 type OverlayMessage interface {
     Add(string)
 }
 
 var MaxCyclesReached error = errors.New("maximum cycles reached")
-func RunNES(romPath string, cpu *nes.CPUState, maxCycles uint64, quit context.Context,
+/* battery should be true if the game's prg ram should be loaded from and saved to disk */
+func RunNES(romPath string, cpu *nes.CPUState, battery bool, maxCycles uint64, quit context.Context,
             bufferReady chan<- bool, buffer nes.VirtualScreen,
             emulatorActions <-chan EmulatorAction, screenListeners *ScreenListeners,
             renderOverlayUpdate OverlayMessage,
             sampleRate float32, verbose int, debugger debug.Debugger, yield coroutine.YieldFunc) error {
-    instructionTable := nes.MakeInstructionDescriptiontable()
+    machine := nes.MakeMachine(cpu, sampleRate)
+    machine.FrameComplete = func(screen nes.VirtualScreen){
+        screenListeners.ObserveVideo(screen)
 
-    screen := nes.MakeVirtualScreen(nes.VideoWidth, nes.VideoHeight)
+        buffer.CopyFrom(&screen)
 
-    var cycleCounter float64
+        select {
+            case bufferReady <- true:
+            default:
+        }
+    }
 
     /* run the host timer at this frequency (in ms) so that the counter
      * doesn't tick too fast
@@ -306,7 +292,11 @@ func RunNES(romPath string, cpu *nes.CPUState, maxCycles uint64, quit context.Co
     // cycleDiff := nes.CPUSpeed / (1000.0 / float64(hostTickSpeed))
 
     /* about 20.292 */
-    baseCyclesPerSample := nes.CPUSpeed / 2 / float64(sampleRate)
+    baseCyclesPerSample := machine.CyclesPerSample
+
+    /* the frontend calls yield UpdateRate() times a second, so run that fraction of a second each time */
+    cpuSpeed := cpu.GetRegion().Timing().CPUSpeed
+    cyclesPerUpdate := cpuSpeed / float64(UpdateRate(cpu.GetRegion()))
 
     /*
     cycleTimer := time.NewTicker(time.Duration(hostTickSpeed) * time.Millisecond)
@@ -315,8 +305,6 @@ func RunNES(romPath string, cpu *nes.CPUState, maxCycles uint64, quit context.Co
 
     turboMultiplier := float64(1)
 
-    lastCpuCycle := cpu.Cycle
-
     paused := false
 
     stepFrame := false
@@ -344,6 +332,26 @@ func RunNES(romPath string, cpu *nes.CPUState, maxCycles uint64, quit context.Co
         return sha256
     }
 
+    /* periodically write battery backed ram to disk, and once more when the game stops */
+    var batteryTimer <-chan time.Time
+    var batterySaver *BatterySaver
+    if battery {
+        batterySaver = MakeBatterySaver(cpu, getSha256())
+        defer batterySaver.Flush(cpu)
+
+        ticker := time.NewTicker(time.Second * 5)
+        defer ticker.Stop()
+        batteryTimer = ticker.C
+    }
+
+    var rewind *nes.RewindBuffer
+    config, _ := LoadConfigData()
+    if config.Rewind.GetMemory() > 0 {
+        rewind = nes.MakeRewindBuffer(config.Rewind.GetMemory() * 1024 * 1024, config.Rewind.GetFrames())
+    }
+    /* set by the rewind action, and handled instead of running the next frame */
+    rewindStep := false
+
     start := time.Now()
     cycleCheck := time.NewTicker(time.Second * 2)
     defer cycleCheck.Stop()
@@ -365,10 +373,10 @@ func RunNES(romPath string, cpu *nes.CPUState, maxCycles uint64, quit context.Co
                     diff := time.Now().Sub(start)
                     cycleDiff := cpu.Cycle - cycleStart
                     cyclesPerSecond := float64(cycleDiff) / (float64(diff)/float64(time.Second))
-                    xdiff := cyclesPerSecond - nes.CPUSpeed
-                    cycleXDiff := float64(cycleDiff) - float64(nes.CPUSpeed) * float64(diff) / float64(time.Second)
+                    xdiff := cyclesPerSecond - cpuSpeed
+                    cycleXDiff := float64(cycleDiff) - cpuSpeed * float64(diff) / float64(time.Second)
                     /* cycle diffs should be as close to 0 as possible */
-                    log.Printf("Time=%v Cycles=%v. Expected=%v. Diff=%v Cycles/s=%v. Expected=%v. Diff=%v", diff, cycleDiff, int64(nes.CPUSpeed * float64(diff) / float64(time.Second)), cycleXDiff, cyclesPerSecond, nes.CPUSpeed, xdiff)
+                    log.Printf("Time=%v Cycles=%v. Expected=%v. Diff=%v Cycles/s=%v. Expected=%v. Diff=%v", diff, cycleDiff, int64(cpuSpeed * float64(diff) / float64(time.Second)), cycleXDiff, cyclesPerSecond, cpuSpeed, xdiff)
 
                     start = time.Now()
                     cycleStart = cpu.Cycle
@@ -378,7 +386,6 @@ func RunNES(romPath string, cpu *nes.CPUState, maxCycles uint64, quit context.Co
 
         /* always run the system */
         if infiniteSpeed {
-            cycleCounter = 1
 
             /* ignore anything on the emulatorActions channel, but dont let it fill up */
             select {
@@ -390,18 +397,37 @@ func RunNES(romPath string, cpu *nes.CPUState, maxCycles uint64, quit context.Co
         handleAction := func(action EmulatorAction){
             switch action.Value() {
                 case EmulatorSaveState:
+                    slot := QuickSaveSlot
+                    if save, ok := action.(EmulatorActionSaveStateSlot); ok {
+                        slot = save.Slot
+                    }
                     value := cpu.Copy()
-                    go serializeState(quit, &value, getSha256())
-                    log.Printf("State saved")
+                    go serializeState(quit, &value, buffer.Copy(), getSha256(), slot)
+                    log.Printf("State saved to %v", SaveSlotName(slot))
                 case EmulatorLoadState:
-                    loadedState, err := loadCpuState(getSha256())
+                    slot := QuickSaveSlot
+                    if load, ok := action.(EmulatorActionLoadStateSlot); ok {
+                        slot = load.Slot
+                    }
+                    loadedState, err := loadCpuState(getSha256(), slot)
                     if err != nil {
                         log.Printf("Unable to load saved state: %v", err)
                     } else {
                         cpu.Load(loadedState)
-                        lastCpuCycle = cpu.Cycle
-                        log.Printf("State loaded")
+                        machine.Sync()
+                        if rewind != nil {
+                            rewind.Clear()
+                        }
+                        log.Printf("State loaded from %v", SaveSlotName(slot))
                     }
+                case EmulatorExportState:
+                    export := action.(EmulatorActionExportState)
+                    // export.Response had better be a buffered channel
+                    select {
+                        case export.Response <- ExportState(cpu, export.Path):
+                        default:
+                    }
+                    close(export.Response)
                 case EmulatorGetInfo:
                     info := action.(EmulatorActionGetInfo)
                     data := EmulatorInfo{
@@ -466,6 +492,20 @@ func RunNES(romPath string, cpu *nes.CPUState, maxCycles uint64, quit context.Co
                     renderOverlayUpdate.Add("Unpaused")
                 case EmulatorTogglePPUDebug:
                     cpu.PPU.ToggleDebug()
+                case EmulatorSwitchDisk:
+                    disk, ok := cpu.Mapper.Mapper.(nes.DiskMapper)
+                    if ok {
+                        side := disk.SwitchDiskSide()
+                        renderOverlayUpdate.Add(fmt.Sprintf("Disk %v side %c", side / 2 + 1, 'A' + side % 2))
+                    }
+                case EmulatorInsertCoin:
+                    if cpu.Vs != nil {
+                        coin := action.(EmulatorActionInsertCoin)
+                        cpu.Vs.InsertCoin(coin.Slot, cpu.Cycle)
+                        renderOverlayUpdate.Add(fmt.Sprintf("Coin %v", coin.Slot + 1))
+                    }
+                case EmulatorRewind:
+                    rewindStep = true
                 case EmulatorGetDebugger:
                     info := action.(EmulatorActionGetDebugger)
                     select {
@@ -496,14 +536,11 @@ func RunNES(romPath string, cpu *nes.CPUState, maxCycles uint64, quit context.Co
         select {
             case action := <-emulatorActions:
                 handleAction(action)
+            case <-batteryTimer:
+                batterySaver.Update(cpu)
             default:
         }
 
-        cycleCounter += nes.CPUSpeed / 60 * turboMultiplier
-        if paused {
-            cycleCounter = 0
-        }
-
         if debugger != nil {
             if !debugger.Handle(cpu) {
                 select {
@@ -515,47 +552,45 @@ func RunNES(romPath string, cpu *nes.CPUState, maxCycles uint64, quit context.Co
                     case <-time.After(1 * time.Millisecond):
                 }
 
-                cycleCounter = 0
+                machine.Sync()
                 continue
             } else {
-                debugger.Update(cpu, instructionTable)
+                debugger.Update(cpu, machine.Table)
             }
         }
 
-        // log.Printf("Cycle counter %v\n", cycleCounter)
-
-        for cycleCounter > 0 {
-            err := cpu.Run(instructionTable)
+        if rewindStep {
+            rewindStep = false
+            if rewind != nil {
+                ok, err := rewind.Rewind(cpu)
+                if err != nil {
+                    log.Printf("Unable to rewind: %v", err)
+                    rewind.Clear()
+                } else if ok {
+                    machine.Sync()
+                    /* run one frame so the screen shows the restored state */
+                    err = machine.StepFrame()
+                    if err != nil {
+                        return err
+                    }
+                }
+            }
+        } else if paused {
+            machine.Sync()
+        } else {
+            machine.CyclesPerSample = turboMultiplier * baseCyclesPerSample
+            err := machine.RunCycles(cyclesPerUpdate * turboMultiplier)
             if err != nil {
                 return err
             }
-            usedCycles := cpu.Cycle
-
-            cycleCounter -= float64(usedCycles - lastCpuCycle)
-
-            cpu.APU.Run((float64(usedCycles) - float64(lastCpuCycle)) / 2.0, turboMultiplier * baseCyclesPerSample, cpu)
-
-            /* ppu runs 3 times faster than cpu */
-            nmi, drawn := cpu.PPU.Run((usedCycles - lastCpuCycle) * 3, screen, cpu.Mapper.Mapper)
-
-            if drawn {
-                screenListeners.ObserveVideo(screen)
-
-                buffer.CopyFrom(&screen)
-
-                select {
-                    case bufferReady <- true:
-                    default:
-                }
-            }
-
-            lastCpuCycle = usedCycles
 
-            if nmi {
-                if cpu.Debug > 0 && verbose > 0 {
-                    log.Printf("Cycle %v Do NMI\n", cpu.Cycle)
+            /* rewinding doesn't make sense when running as fast as possible */
+            if rewind != nil && !infiniteSpeed {
+                err = rewind.Frame(cpu)
+                if err != nil {
+                    log.Printf("Unable to take rewind snapshot, disabling rewind: %v", err)
+                    rewind = nil
                 }
-                cpu.NMI()
             }
         }
 
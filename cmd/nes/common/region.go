@@ -0,0 +1,59 @@
+package common
+
+import (
+    "log"
+    "math"
+    nes "github.com/kazzmir/nes/lib"
+)
+
+/* the region the user picked for a game, or false if the game should use the region from its rom */
+func GetRegionOverride(sha256 string) (nes.Region, bool) {
+    config, err := LoadConfigData()
+    if err != nil {
+        return nes.RegionNTSC, false
+    }
+
+    game, ok := config.Games[sha256]
+    if !ok || game.Region == "" {
+        return nes.RegionNTSC, false
+    }
+
+    region, err := nes.ParseRegion(game.Region)
+    if err != nil {
+        log.Printf("Ignoring region override for %v: %v", sha256, err)
+        return nes.RegionNTSC, false
+    }
+
+    return region, true
+}
+
+/* if override is false then the game goes back to using the region from its rom */
+func SetRegionOverride(sha256 string, region nes.Region, override bool) error {
+    return UpdateConfigGame(sha256, func(game *ConfigGame){
+        if override {
+            game.Region = region.String()
+        } else {
+            game.Region = ""
+        }
+    })
+}
+
+/* the per game override if there is one, otherwise whatever the rom says */
+func GetGameRegion(nesFile nes.NESFile) nes.Region {
+    if nesFile.Path != "" {
+        sha256, err := GetSha256(nesFile.Path)
+        if err == nil {
+            region, ok := GetRegionOverride(sha256)
+            if ok {
+                return region
+            }
+        }
+    }
+
+    return nesFile.Region
+}
+
+/* how many times per second the emulator should be updated. each update runs one frame */
+func UpdateRate(region nes.Region) int {
+    return int(math.Round(region.Timing().FrameRate))
+}
@@ -0,0 +1,40 @@
+package common
+
+import (
+    "log"
+    "sync"
+    nes "github.com/kazzmir/nes/lib"
+    "github.com/kazzmir/nes/data"
+)
+
+var romDatabase *nes.RomDatabase
+var romDatabaseOnce sync.Once
+
+/* the rom database that is bundled with the emulator, loaded the first time it is needed */
+func GetRomDatabase() *nes.RomDatabase {
+    romDatabaseOnce.Do(func(){
+        romDatabase = nes.MakeRomDatabase()
+
+        file, err := data.OpenFile("romdb.json")
+        if err != nil {
+            log.Printf("Warning: could not open rom database: %v", err)
+            return
+        }
+        defer file.Close()
+
+        database, err := nes.LoadRomDatabase(file)
+        if err != nil {
+            log.Printf("Warning: could not load rom database: %v", err)
+            return
+        }
+
+        romDatabase = database
+    })
+
+    return romDatabase
+}
+
+/* fix the header of a rom that is in the rom database. returns true if the rom was found */
+func ApplyRomDatabase(nesFile *nes.NESFile) bool {
+    return GetRomDatabase().Apply(nesFile)
+}
@@ -0,0 +1,290 @@
+package common
+
+import (
+    "context"
+    "log"
+    "time"
+    "path/filepath"
+    "os"
+    "fmt"
+    "image"
+    "image/color"
+    "image/png"
+    "io"
+    "compress/gzip"
+    "encoding/json"
+    nes "github.com/kazzmir/nes/lib"
+)
+
+/* Save states live in <config>/<sha256>/. The quick save slot, used by the save/load
+ * state keys, is state.gz so that states from older versions still load. The numbered
+ * slots are state-<n>.gz. Each slot also has a png thumbnail of the screen and a small
+ * json file with the date and play time so the menu doesn't have to decode the whole state.
+ *
+ * The .gz file holds the binary encoding of the cpu state. States saved before the binary
+ * format existed are a json SaveState, and are still loaded.
+ */
+
+/* the version of the cpu state inside a json save state. older states are migrated when they are loaded */
+const SaveStateVersion = nes.StateVersion
+
+const QuickSaveSlot = 0
+/* numbered slots go from 1 to MaxSaveSlot */
+const MaxSaveSlot = 8
+
+type SaveState struct {
+    State *nes.CPUState `json:"state"`
+    Version int `json:"version"`
+    Date time.Time `json:"time"`
+    PlayTime time.Duration `json:"play-time"`
+}
+
+type SaveStateInfo struct {
+    Slot int `json:"slot"`
+    Date time.Time `json:"time"`
+    /* how long the game had been running when the state was saved */
+    PlayTime time.Duration `json:"play-time"`
+    /* path of the png thumbnail, or empty if there isn't one */
+    Thumbnail string `json:"-"`
+}
+
+func SaveSlotName(slot int) string {
+    if slot == QuickSaveSlot {
+        return "Quick save"
+    }
+
+    return fmt.Sprintf("Slot %v", slot)
+}
+
+/* path to the slot's files without an extension */
+func saveStateBase(sha256 string, slot int) (string, error) {
+    path, err := GetOrCreateConfigDir()
+    if err != nil {
+        return "", err
+    }
+
+    name := "state"
+    if slot != QuickSaveSlot {
+        name = fmt.Sprintf("state-%v", slot)
+    }
+
+    return filepath.Join(path, sha256, name), nil
+}
+
+/* emulated time since power on */
+func playTime(cpu *nes.CPUState) time.Duration {
+    return time.Duration(float64(cpu.Cycle) / cpu.GetRegion().Timing().CPUSpeed * float64(time.Second))
+}
+
+func screenToImage(screen nes.VirtualScreen) image.Image {
+    out := image.NewRGBA(image.Rect(0, 0, screen.Width, screen.Height))
+
+    for x := 0; x < screen.Width; x++ {
+        for y := 0; y < screen.Height; y++ {
+            r, g, b, a := screen.GetRGBA(x, y)
+            out.Set(x, y, color.RGBA{R: r, G: g, B: b, A: a})
+        }
+    }
+
+    return out
+}
+
+func writeThumbnail(path string, screen nes.VirtualScreen) error {
+    output, err := os.Create(path)
+    if err != nil {
+        return err
+    }
+    defer output.Close()
+
+    return png.Encode(output, screenToImage(screen))
+}
+
+func writeSaveStateInfo(path string, info SaveStateInfo) error {
+    data, err := json.Marshal(info)
+    if err != nil {
+        return err
+    }
+
+    return os.WriteFile(path, data, 0644)
+}
+
+func doSerializeState(quit context.Context, state *nes.CPUState, screen nes.VirtualScreen, sha256 string, slot int){
+    base, err := saveStateBase(sha256, slot)
+    if err != nil {
+        log.Printf("Unable to serialize saved state: %v", err)
+        return
+    }
+
+    os.MkdirAll(filepath.Dir(base), 0755)
+
+    data, err := nes.EncodeBinaryState(state)
+    if err != nil {
+        log.Printf("Unable to serialize saved state: %v", err)
+        return
+    }
+
+    output, err := os.Create(base + ".gz")
+    if err != nil {
+        log.Printf("Unable to serialize saved state: %v", err)
+        return
+    }
+    defer output.Close()
+
+    compressor := gzip.NewWriter(output)
+    defer compressor.Close()
+
+    _, err = compressor.Write(data)
+    if err != nil {
+        log.Printf("Unable to serialize saved state: %v", err)
+        return
+    }
+
+    now := time.Now()
+
+    /* the thumbnail and info are only for the menu, so failing to write them isn't fatal */
+    err = writeThumbnail(base + ".png", screen)
+    if err != nil {
+        log.Printf("Unable to save thumbnail: %v", err)
+    }
+
+    err = writeSaveStateInfo(base + ".json", SaveStateInfo{
+        Slot: slot,
+        Date: now,
+        PlayTime: playTime(state),
+    })
+    if err != nil {
+        log.Printf("Unable to save state info: %v", err)
+    }
+}
+
+func serializeState(quit context.Context, state *nes.CPUState, screen nes.VirtualScreen, sha256 string, slot int){
+    doSerializeState(quit, state, screen, sha256, slot)
+
+    /* for debugging */
+
+    /*
+    state2, err := loadCpuState()
+    if err != nil {
+        log.Printf("Unable to load just saved state: %v", err)
+    } else {
+        err = state.Compare(state2)
+        if err != nil {
+            log.Printf("deserialized state doesn't match: %v", err)
+        }
+    }
+    */
+}
+
+func loadCpuState(sha256 string, slot int) (*nes.CPUState, error) {
+    base, err := saveStateBase(sha256, slot)
+    if err != nil {
+        return nil, err
+    }
+
+    input, err := os.Open(base + ".gz")
+    if err != nil {
+        return nil, err
+    }
+    defer input.Close()
+
+    decompress, err := gzip.NewReader(input)
+    if err != nil {
+        return nil, err
+    }
+    defer decompress.Close()
+
+    data, err := io.ReadAll(decompress)
+    if err != nil {
+        return nil, err
+    }
+
+    if nes.IsBinaryState(data) {
+        state, err := nes.DecodeBinaryState(data)
+        if err != nil {
+            return nil, fmt.Errorf("invalid save state: %v", err)
+        }
+        return state, nil
+    }
+
+    /* the state is decoded after it has been upgraded to the current version */
+    var out struct {
+        State json.RawMessage `json:"state"`
+        Version int `json:"version"`
+    }
+    err = json.Unmarshal(data, &out)
+    if err != nil {
+        return nil, err
+    }
+
+    state, err := nes.DecodeState(out.Version, out.State)
+    if err != nil {
+        return nil, fmt.Errorf("invalid save state: %v", err)
+    }
+
+    return state, nil
+}
+
+/* returns false if nothing is saved in the slot */
+func GetSaveStateInfo(sha256 string, slot int) (SaveStateInfo, bool) {
+    base, err := saveStateBase(sha256, slot)
+    if err != nil {
+        return SaveStateInfo{}, false
+    }
+
+    stat, err := os.Stat(base + ".gz")
+    if err != nil {
+        return SaveStateInfo{}, false
+    }
+
+    info := SaveStateInfo{
+        Slot: slot,
+        Date: stat.ModTime(),
+    }
+
+    /* states saved before slots existed don't have an info file, so just use the file time for those */
+    data, err := os.ReadFile(base + ".json")
+    if err == nil {
+        err = json.Unmarshal(data, &info)
+        if err != nil {
+            log.Printf("Unable to read save state info %v: %v", base + ".json", err)
+        }
+    }
+
+    if FileExists(base + ".png") {
+        info.Thumbnail = base + ".png"
+    }
+
+    return info, true
+}
+
+/* write the state as indented json, which is easier to inspect than the binary save state */
+func ExportState(state *nes.CPUState, path string) error {
+    data, err := json.MarshalIndent(SaveState{
+        State: state,
+        Version: SaveStateVersion,
+        Date: time.Now(),
+        PlayTime: playTime(state),
+    }, "", "  ")
+    if err != nil {
+        return err
+    }
+
+    return os.WriteFile(path, data, 0644)
+}
+
+func DeleteSaveState(sha256 string, slot int) error {
+    base, err := saveStateBase(sha256, slot)
+    if err != nil {
+        return err
+    }
+
+    err = os.Remove(base + ".gz")
+    if err != nil {
+        return err
+    }
+
+    os.Remove(base + ".png")
+    os.Remove(base + ".json")
+
+    return nil
+}
@@ -0,0 +1,38 @@
+package common
+
+import (
+    nes "github.com/kazzmir/nes/lib"
+)
+
+/* the dip switches and controller order the user picked for a vs. system game */
+func GetVsSettings(sha256 string) (byte, bool) {
+    config, err := LoadConfigData()
+    if err != nil {
+        return 0, false
+    }
+
+    game := config.Games[sha256]
+    return game.DipSwitches, game.SwapControllers
+}
+
+func SetVsSettings(sha256 string, dipSwitches byte, swapControllers bool) error {
+    return UpdateConfigGame(sha256, func(game *ConfigGame){
+        game.DipSwitches = dipSwitches
+        game.SwapControllers = swapControllers
+    })
+}
+
+/* the cabinet with the switches from the config. games only read the dip switches when they
+ * start, so changing them means restarting the game
+ */
+func MakeVsSystem(nesFile nes.NESFile) *nes.VsSystem {
+    vs := &nes.VsSystem{}
+    if nesFile.Path != "" {
+        sha256, err := GetSha256(nesFile.Path)
+        if err == nil {
+            vs.DipSwitches, vs.SwapControllers = GetVsSettings(sha256)
+        }
+    }
+
+    return vs
+}
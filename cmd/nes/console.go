@@ -47,6 +47,7 @@ exit, quit: quit the program
 clear: clear console text
 info: show emulator info
 reload, restart: reload the current rom
+export-state <file>: write the emulator state to a json file
 `
 // debug: open debug window
 
@@ -181,6 +182,32 @@ func (console *Console) Update(mainCancel context.CancelFunc, emulatorActions ch
                                         }()
                                     default:
                                 }
+                            case "export-state":
+                                if len(parts) < 2 {
+                                    console.AddLine("Usage: export-state <file>")
+                                    break
+                                }
+                                path := parts[1]
+                                response := make(chan error, 1)
+                                export := common.EmulatorActionExportState{
+                                    Path: path,
+                                    Response: response,
+                                }
+                                select {
+                                    case emulatorActions<-export:
+                                        go func() {
+                                            err, ok := <-response
+                                            if !ok {
+                                                console.AddLine("No ROM loaded")
+                                            } else if err != nil {
+                                                console.AddLine(fmt.Sprintf("Unable to export state: %v", err))
+                                            } else {
+                                                console.AddLine(fmt.Sprintf("State written to %v", path))
+                                            }
+                                        }()
+                                    default:
+                                        console.AddLine("Error: input dropped. Try again")
+                                }
                             case "help", "?":
                                 help := strings.Split(helpText, "\n")
                                 for _, line := range help {
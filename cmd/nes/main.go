@@ -291,6 +291,12 @@ func loadFontSource() (*text.GoTextFaceSource, error) {
 type ProgramState struct {
     loadRom chan common.ProgramLoadRom
     audioEnabled bool
+    emulatorActions chan<- common.EmulatorAction
+    nesActions chan<- NesAction
+    /* path of the running rom, empty if nothing is running */
+    romPath string
+    /* true if the running rom is a vs. system game */
+    vsSystem bool
 }
 
 func (state *ProgramState) IsSoundEnabled() bool {
@@ -309,6 +315,94 @@ func (state *ProgramState) SetSoundEnabled(enabled bool) {
     state.audioEnabled = enabled
 }
 
+func (state *ProgramState) SaveState(slot int) {
+    select {
+        case state.emulatorActions <- common.EmulatorActionSaveStateSlot{Slot: slot}:
+        default:
+            log.Printf("Warning: could not send save state request")
+    }
+}
+
+func (state *ProgramState) LoadState(slot int) {
+    select {
+        case state.emulatorActions <- common.EmulatorActionLoadStateSlot{Slot: slot}:
+        default:
+            log.Printf("Warning: could not send load state request")
+    }
+}
+
+func (state *ProgramState) GetRomSha256() (string, bool) {
+    if state.romPath == "" {
+        return "", false
+    }
+
+    sha256, err := common.GetSha256(state.romPath)
+    if err != nil {
+        return "", false
+    }
+
+    return sha256, true
+}
+
+func (state *ProgramState) GetRegionOverride() (nes.Region, bool) {
+    sha256, ok := state.GetRomSha256()
+    if !ok {
+        return nes.RegionNTSC, false
+    }
+
+    return common.GetRegionOverride(sha256)
+}
+
+/* save the region for the running game and restart it so the new region takes effect */
+func (state *ProgramState) SetRegionOverride(region nes.Region, override bool) {
+    sha256, ok := state.GetRomSha256()
+    if !ok {
+        return
+    }
+
+    err := common.SetRegionOverride(sha256, region, override)
+    if err != nil {
+        log.Printf("Unable to save region: %v", err)
+        return
+    }
+
+    select {
+        case state.nesActions <- &NesActionRestart{}:
+        default:
+            log.Printf("Warning: could not restart the game")
+    }
+}
+
+func (state *ProgramState) GetVsSettings() (byte, bool, bool) {
+    sha256, ok := state.GetRomSha256()
+    if !ok || !state.vsSystem {
+        return 0, false, false
+    }
+
+    dipSwitches, swapControllers := common.GetVsSettings(sha256)
+    return dipSwitches, swapControllers, true
+}
+
+/* save the settings for the running game and restart it, since games only read the dip switches when they start */
+func (state *ProgramState) SetVsSettings(dipSwitches byte, swapControllers bool) {
+    sha256, ok := state.GetRomSha256()
+    if !ok {
+        return
+    }
+
+    err := common.SetVsSettings(sha256, dipSwitches, swapControllers)
+    if err != nil {
+        log.Printf("Unable to save vs. system settings: %v", err)
+        return
+    }
+
+    select {
+        case state.nesActions <- &NesActionRestart{}:
+        default:
+            log.Printf("Warning: could not restart the game")
+    }
+}
+
 type MessageTime struct {
     Message string
     Time time.Time
@@ -409,6 +503,7 @@ func RunNES(path string, debugCpu bool, debugPpu bool, maxCycles uint64, windowS
     programActions := ProgramState{
         loadRom: make(chan common.ProgramLoadRom, 1),
         audioEnabled: true,
+        nesActions: nesChannel,
     }
 
     if path != "" {
@@ -537,6 +632,7 @@ func RunNES(path string, debugCpu bool, debugPpu bool, maxCycles uint64, windowS
     emulatorActions := make(chan common.EmulatorAction, 50)
     emulatorActionsInput := (<-chan common.EmulatorAction)(emulatorActions)
     emulatorActionsOutput := (chan<- common.EmulatorAction)(emulatorActions)
+    programActions.emulatorActions = emulatorActionsOutput
 
     var screenListeners common.ScreenListeners
 
@@ -546,19 +642,25 @@ func RunNES(path string, debugCpu bool, debugPpu bool, maxCycles uint64, windowS
 
     emulatorKeys := common.LoadEmulatorKeys()
     input := &common.KeyboardButtons{
-        Keys: &emulatorKeys,
+        Keys: &emulatorKeys.ControllerKeys,
+    }
+
+    player2Keys := common.LoadPlayer2Keys()
+    input2 := &common.KeyboardButtons{
+        Keys: &player2Keys,
     }
 
     debugWindow := debug.MakeDebugWindow(mainQuit, font, smallFont)
     console := MakeConsole(mainCancel, mainQuit, emulatorActionsOutput, nesChannel)
 
     startNES := func(nesFile nes.NESFile, quit context.Context, yield coroutine.YieldFunc){
-        cpu, err := common.SetupCPU(nesFile, debugCpu, debugPpu)
+        cpu, err := common.SetupCPU(&nesFile, debugCpu, debugPpu)
 
         debugger := debug.MakeDebugger(&cpu, debugWindow)
         defer debugger.Close()
 
         input.Reset()
+        input2.Reset()
         if replayKeys != "" {
             replay, err := makeReplayKeys(&cpu, replayKeys)
             if err != nil {
@@ -572,6 +674,9 @@ func RunNES(path string, debugCpu bool, debugPpu bool, maxCycles uint64, windowS
         } else {
             combined := common.MakeCombineButtons(input, joystickManager)
             cpu.Input = nes.MakeInput(&combined)
+
+            combined2 := common.MakeCombineButtons(input2, &common.JoystickPortInput{Manager: joystickManager, Port: common.Port2})
+            cpu.Input2 = nes.MakeInput(&combined2)
         }
 
         if recordInput {
@@ -615,6 +720,11 @@ func RunNES(path string, debugCpu bool, debugPpu bool, maxCycles uint64, windowS
             /* make sure no message appears on the screen in front of the nes output */
             log.Printf("Run NES")
 
+            log.Printf("Region: %v", cpu.GetRegion())
+            /* pal and dendy games run at 50 frames per second */
+            ebiten.SetTPS(common.UpdateRate(cpu.GetRegion()))
+            defer ebiten.SetTPS(ebiten.DefaultTPS)
+
             nesQuit, nesCancel := context.WithCancel(mainQuit)
             defer nesCancel()
 
@@ -682,8 +792,15 @@ func RunNES(path string, debugCpu bool, debugPpu bool, maxCycles uint64, windowS
                 }
             }
 
+            programActions.romPath = nesFile.Path
+            programActions.vsSystem = nesFile.Console == nes.ConsoleVsSystem
+            defer func(){
+                programActions.romPath = ""
+                programActions.vsSystem = false
+            }()
+
             runNes := func(nesYield coroutine.YieldFunc) error {
-                return common.RunNES(nesFile.Path, &cpu, maxCycles, quit, bufferReady, buffer, emulatorActionsInput, &screenListeners, &overlayMessages, AudioSampleRate, verbose, debugger, nesYield)
+                return common.RunNES(nesFile.Path, &cpu, nesFile.Battery, maxCycles, quit, bufferReady, buffer, emulatorActionsInput, &screenListeners, &overlayMessages, AudioSampleRate, verbose, debugger, nesYield)
             }
 
             nesCoroutine := coroutine.MakeCoroutine(runNes)
@@ -816,6 +933,20 @@ func RunNES(path string, debugCpu bool, debugPpu bool, maxCycles uint64, windowS
                                     case emulatorActionsOutput <- common.MakeEmulatorAction(common.EmulatorTogglePPUDebug):
                                     default:
                                 }
+                            case emulatorKeys.SwitchDisk:
+                                select {
+                                    case emulatorActionsOutput <- common.MakeEmulatorAction(common.EmulatorSwitchDisk):
+                                    default:
+                                }
+                            case emulatorKeys.InsertCoin1, emulatorKeys.InsertCoin2:
+                                slot := 0
+                                if key == emulatorKeys.InsertCoin2 {
+                                    slot = 1
+                                }
+                                select {
+                                    case emulatorActionsOutput <- common.EmulatorActionInsertCoin{Slot: slot}:
+                                    default:
+                                }
                             case emulatorKeys.SlowDown:
                                 select {
                                     case emulatorActionsOutput <- common.MakeEmulatorAction(common.EmulatorSlowDown):
@@ -845,6 +976,7 @@ func RunNES(path string, debugCpu bool, debugPpu bool, maxCycles uint64, windowS
                         }
 
                         input.HandleEvent(key, true)
+                        input2.HandleEvent(key, true)
                     }
 
                     keys = inpututil.AppendJustReleasedKeys(keys[:0])
@@ -858,6 +990,15 @@ func RunNES(path string, debugCpu bool, debugPpu bool, maxCycles uint64, windowS
                         }
 
                         input.HandleEvent(key, false)
+                        input2.HandleEvent(key, false)
+                    }
+
+                    /* step back once per frame for as long as the key is held */
+                    if ebiten.IsKeyPressed(emulatorKeys.Rewind) {
+                        select {
+                            case emulatorActionsOutput <- common.MakeEmulatorAction(common.EmulatorRewind):
+                            default:
+                        }
                     }
 
                     joystickActions := joystickManager.Update()
@@ -978,7 +1119,7 @@ func RunNES(path string, debugCpu bool, debugPpu bool, maxCycles uint64, windowS
 
                     activeMenu := menu.MakeMenu(mainQuit, font, audioManager)
                     // emulatorActionsOutput <- common.MakeEmulatorAction(common.EmulatorSetPause)
-                    activeMenu.Run(mainCancel, font, smallFont, &programActions, joystickManager, &emulatorKeys, yield, &engine)
+                    activeMenu.Run(mainCancel, font, smallFont, &programActions, joystickManager, &emulatorKeys, &player2Keys, yield, &engine)
                     // emulatorActionsOutput <- common.MakeEmulatorAction(common.EmulatorUnpause)
 
                     select {
@@ -1201,7 +1342,7 @@ func main(){
         defer pprof.StopCPUProfile()
     }
 
-    if nes.IsNESFile(arguments.NESPath) {
+    if nes.IsRomFile(arguments.NESPath) {
         err := RunNES(arguments.NESPath, arguments.Debug || arguments.DebugCpu, arguments.Debug || arguments.DebugPpu, arguments.MaxCycles, arguments.WindowSizeMultiple, arguments.Record, arguments.DesiredFps, arguments.RecordKeys, arguments.ReplayKeys)
         if err != nil {
             log.Printf("Error: %v\n", err)
@@ -64,25 +64,26 @@ func convertInput(input JoystickInputType) common.JoystickInput {
     return nil
 }
 
-func (mapping *JoystickButtonMapping) UpdateJoystick(manager *common.JoystickManager){
-    if manager.Player1 != nil {
+func (mapping *JoystickButtonMapping) UpdateJoystick(manager *common.JoystickManager, port int){
+    player := manager.GetPlayer(port)
+    if player != nil {
         for name, input := range mapping.Inputs {
-            manager.Player1.SetButton(convertButton(name), convertInput(input))
+            player.SetButton(convertButton(name), convertInput(input))
         }
 
         for name, input := range mapping.ExtraInputs {
             switch name {
                 case "Turbo A":
-                    manager.Player1.SetTurboA(convertInput(input))
+                    player.SetTurboA(convertInput(input))
                 case "Turbo B":
-                    manager.Player1.SetTurboB(convertInput(input))
+                    player.SetTurboB(convertInput(input))
                 default:
-                    manager.Player1.SetExtraButton(convertExtraButton(name), convertInput(input))
+                    player.SetExtraButton(convertExtraButton(name), convertInput(input))
             }
         }
 
 
-        err := manager.SaveInput()
+        err := manager.SaveInput(port)
         if err != nil {
             log.Printf("Warning: could not save joystick input: %v", err)
         }
@@ -333,6 +334,8 @@ type JoystickMenu struct {
     Released chan int
     ConfigurePrevious context.CancelFunc
     JoystickManager *common.JoystickManager
+    /* which controller port is being configured, common.Port1 or common.Port2 */
+    Port int
     AudioManager AudioManager
 
     ConfigureCoroutine *coroutine.Coroutine
@@ -350,8 +353,8 @@ func (menu *JoystickMenu) UpdateWindowSize(x int, y int){
 
 func (menu *JoystickMenu) FinishConfigure() {
     menu.Configuring = false
-    menu.Mapping.UpdateJoystick(menu.JoystickManager)
-    err := menu.JoystickManager.SaveInput()
+    menu.Mapping.UpdateJoystick(menu.JoystickManager, menu.Port)
+    err := menu.JoystickManager.SaveInput(menu.Port)
     if err != nil {
         log.Printf("Warning: could not save joystick configuration: %v", err)
     }
@@ -639,8 +642,9 @@ func (menu *JoystickMenu) DoConfigure(joystick *common.JoystickButtons, yield co
 
 func (menu *JoystickMenu) Update(){
 
-    if menu.JoystickManager.Player1 != nil {
-        gamepadID := menu.JoystickManager.Player1.GetGamepadID()
+    player := menu.JoystickManager.GetPlayer(menu.Port)
+    if player != nil {
+        gamepadID := player.GetGamepadID()
         for _, input := range menu.Mapping.Inputs {
             input.Update(gamepadID)
         }
@@ -702,7 +706,7 @@ func (menu *JoystickMenu) MakeRenderer(font text.Face, smallFont text.Face, cloc
     _ = fontWidth
 
     return func(screen *ebiten.Image) error {
-        name := fmt.Sprintf("Joystick: %v", menu.JoystickManager.CurrentName())
+        name := fmt.Sprintf("Player %v joystick: %v", menu.Port, menu.JoystickManager.CurrentName(menu.Port))
 
         menu.Lock.Lock()
         defer menu.Lock.Unlock()
@@ -906,7 +910,7 @@ func (joystickMenu *JoystickMenu) UpdateMapping() {
         ExtraInputs: make(map[string]JoystickInputType),
     }
 
-    joystick := joystickMenu.JoystickManager.Player1
+    joystick := joystickMenu.JoystickManager.GetPlayer(joystickMenu.Port)
     if joystick != nil {
         for button, input := range joystick.Inputs {
             name := nes.ButtonName(button)
@@ -993,6 +997,7 @@ func MakeJoystickMenu(parent SubMenu, joystickStateChanges <-chan JoystickState,
         Released: make(chan int, 4),
         ConfigurePrevious: nil,
         JoystickManager: joystickManager,
+        Port: common.Port1,
     }
 
     menu.UpdateMapping()
@@ -1041,13 +1046,28 @@ func MakeJoystickMenu(parent SubMenu, joystickStateChanges <-chan JoystickState,
     menu.Buttons.Add(&SubMenuButton{Name: "Back", Func: func() SubMenu{ return parent } })
 
     menu.Buttons.Add(&MenuNextLine{})
+    menu.Buttons.Add(&ToggleButton{
+        State1: "Player 1",
+        State2: "Player 2",
+        state: true,
+        Func: func(value bool){
+            menu.Lock.Lock()
+            if value {
+                menu.Port = common.Port1
+            } else {
+                menu.Port = common.Port2
+            }
+            menu.Lock.Unlock()
+            menu.UpdateMapping()
+        },
+    })
     menu.Buttons.Add(&SubMenuButton{Name: "Previous Joystick", Func: func() SubMenu {
-        joystickManager.PreviousJoystick()
+        joystickManager.PreviousJoystick(menu.Port)
         menu.UpdateMapping()
         return menu
     }})
     menu.Buttons.Add(&SubMenuButton{Name: "Next Joystick", Func: func() SubMenu {
-        joystickManager.NextJoystick()
+        joystickManager.NextJoystick(menu.Port)
         menu.UpdateMapping()
         return menu
     }})
@@ -1059,7 +1079,8 @@ func MakeJoystickMenu(parent SubMenu, joystickStateChanges <-chan JoystickState,
         menu.Lock.Lock()
         defer menu.Lock.Unlock()
 
-        if joystickManager.Player1 != nil {
+        joystick := joystickManager.GetPlayer(menu.Port)
+        if joystick != nil {
 
             menu.ConfigureButton = 0
             menu.ConfigureButtonEnd = menu.Mapping.TotalButtons()
@@ -1067,7 +1088,6 @@ func MakeJoystickMenu(parent SubMenu, joystickStateChanges <-chan JoystickState,
             menu.Mapping.Inputs = make(map[string]JoystickInputType)
             menu.Mapping.ExtraInputs = make(map[string]JoystickInputType)
 
-            joystick := joystickManager.Player1
             menu.ConfigureCoroutine = coroutine.MakeCoroutine(func(yield coroutine.YieldFunc) error {
                 menu.DoConfigure(joystick, yield, append(menu.Mapping.ButtonList(), menu.Mapping.ExtraButtonList()...))
                 return nil
@@ -1081,13 +1101,13 @@ func MakeJoystickMenu(parent SubMenu, joystickStateChanges <-chan JoystickState,
         menu.Lock.Lock()
         defer menu.Lock.Unlock()
 
-        if joystickManager.Player1 != nil {
+        joystick := joystickManager.GetPlayer(menu.Port)
+        if joystick != nil {
             menu.Configuring = true
             menu.ConfigureButton = 0
             menu.ConfigureButtonEnd = len(menu.Mapping.ButtonList())
             menu.Mapping.Inputs = make(map[string]JoystickInputType)
 
-            joystick := joystickManager.Player1
             menu.ConfigureCoroutine = coroutine.MakeCoroutine(func(yield coroutine.YieldFunc) error {
                 menu.DoConfigure(joystick, yield, menu.Mapping.ButtonList())
                 return nil
@@ -1100,13 +1120,13 @@ func MakeJoystickMenu(parent SubMenu, joystickStateChanges <-chan JoystickState,
         menu.Lock.Lock()
         defer menu.Lock.Unlock()
 
-        if joystickManager.Player1 != nil {
+        joystick := joystickManager.GetPlayer(menu.Port)
+        if joystick != nil {
             menu.Configuring = true
             menu.ConfigureButton = len(menu.Mapping.ButtonList())
             menu.ConfigureButtonEnd = menu.Mapping.TotalButtons()
             menu.Mapping.ExtraInputs = make(map[string]JoystickInputType)
 
-            joystick := joystickManager.Player1
             menu.ConfigureCoroutine = coroutine.MakeCoroutine(func(yield coroutine.YieldFunc) error {
                 menu.DoConfigure(joystick, yield, menu.Mapping.ExtraButtonList())
                 return nil
@@ -98,6 +98,17 @@ type ProgramActions interface {
     LoadRom(name string, file common.MakeFile)
     SetSoundEnabled(enabled bool)
     IsSoundEnabled() bool
+    /* save to or load from a save state slot of the running game */
+    SaveState(slot int)
+    LoadState(slot int)
+    /* sha256 of the running game, or false if no game is running */
+    GetRomSha256() (string, bool)
+    /* the region chosen for the running game, false if it uses the region from the rom */
+    GetRegionOverride() (nes.Region, bool)
+    SetRegionOverride(region nes.Region, override bool)
+    /* the dip switches and controller order of the running game, false if it isn't a vs. system game */
+    GetVsSettings() (byte, bool, bool)
+    SetVsSettings(dipSwitches byte, swapControllers bool)
 }
 
 type AudioManager interface {
@@ -858,6 +869,7 @@ func (loadRomMenu *LoadRomMenu) Input(input MenuInput) SubMenu {
                 mapper := -1
                 nesFile, err := nes.ParseNesFile(info.Path, false)
                 if err == nil {
+                    common.ApplyRomDatabase(&nesFile)
                     mapper = int(nesFile.Mapper)
                 }
 
@@ -1030,7 +1042,13 @@ func (loader *LoadRomInfoMenu) MakeRenderer(font text.Face, smallFont text.Face,
         var textOptions text.DrawOptions
         textOptions.GeoM.Translate(float64(textX), float64(textY))
 
-        text.Draw(out, filepath.Base(loader.Info.Path), font, &textOptions)
+        text.Draw(out, loader.Info.Name(), font, &textOptions)
+
+        if loader.Info.Title != "" {
+            textY += float32(fontHeight + 2)
+            textOptions.GeoM.Translate(0, fontHeight + 2)
+            text.Draw(out, filepath.Base(loader.Info.Path), font, &textOptions)
+        }
 
         textY += float32(fontHeight + 2)
 
@@ -1113,6 +1131,10 @@ Down: {{n .ButtonDown}}{{"\t"}}Record: {{n .Record}}
 Left: {{n .ButtonLeft}}{{"\t"}}Save state: {{n .SaveState}}
 Right: {{n .ButtonRight}}{{"\t"}}Load state: {{n .LoadState}}
 {{"\t"}}Console: {{n .Console}}
+{{"\t"}}Rewind: {{n .Rewind}}
+{{"\t"}}Switch disk: {{n .SwitchDisk}}
+{{"\t"}}Coin 1: {{n .InsertCoin1}}
+{{"\t"}}Coin 2: {{n .InsertCoin2}}
 {{"\t"}}Menu: ESC
 `)
 
@@ -1130,6 +1152,12 @@ Right: {{n .ButtonRight}}{{"\t"}}Load state: {{n .LoadState}}
     return data.String()
 }
 
+/* a set of keys that can be changed in a ChangeKeyMenu */
+type KeyBindings interface {
+    AllKeys() []common.EmulatorKey
+    Update(name string, key ebiten.Key)
+}
+
 type ChangeKeyMenu struct {
     MenuQuit context.Context
     Quit MenuQuitFunc
@@ -1151,7 +1179,11 @@ type ChangeKeyMenu struct {
 
     AudioManager AudioManager
 
-    Keys *common.EmulatorKeys
+    Keys KeyBindings
+    /* keys that are not changed by this menu, but are still checked when warning about a key in use */
+    Others []KeyBindings
+    /* write the keys to the config after one changes */
+    Save func()
 }
 
 func (menu *ChangeKeyMenu) PlayBeep() {
@@ -1186,6 +1218,14 @@ func (menu *ChangeKeyMenu) Update(){
                     }
                 }
 
+                for _, other := range menu.Others {
+                    for _, check := range other.AllKeys() {
+                        if key == check.Code {
+                            menu.Warning = fmt.Sprintf("%v already in use", check.Name)
+                        }
+                    }
+                }
+
             }
         }
 
@@ -1201,7 +1241,7 @@ func (menu *ChangeKeyMenu) Update(){
         if !menu.LastTime.IsZero() && time.Since(menu.LastTime) >= 700 * time.Millisecond {
             menu.Keys.Update(menu.ChoosingKey, menu.TempChoice)
             menu.ChoosingButton.Update(menu.ChoosingKey, menu.TempChoice.String())
-            common.SaveEmulatorKeys(*menu.Keys)
+            menu.Save()
             menu.SetChoosing(false, "", nil)
         }
     }
@@ -1403,34 +1443,25 @@ func (choose *ChooseButton) Enable() {
     choose.SetEnabled(true)
 }
 
-func MakeKeysMenu(menu *Menu, parentMenu SubMenu, update func(common.EmulatorKeys), keys *common.EmulatorKeys) SubMenu {
-
-    /*
-    var items []string
-
-    for _, key := range keys.AllKeys() {
-        items = append(items, fmt.Sprintf("%v: %v", key.Name, key.Code.String()))
-    }
-    */
-
-    // chooseButton := &ChooseButton{Items: items}
-
+/* a menu that changes each of the given keys. reset puts the keys back to their defaults, and
+ * extra items are shown after the reset button
+ */
+func makeChangeKeyMenu(menu *Menu, parentMenu SubMenu, keys KeyBindings, others []KeyBindings, save func(), reset func(), quit func(), extra ...MenuItem) *ChangeKeyMenu {
     chooseDone, chooseCancel := context.WithCancel(menu.quit)
 
     keyMenu := &ChangeKeyMenu{
         MenuQuit: menu.quit,
         Quit: func(current SubMenu) SubMenu {
-            update(*keys)
+            quit()
             return parentMenu
         },
         AudioManager: menu.AudioManager,
-        // ExtraInfo: keysInfo(keys),
-        // Beep: menu.Beep,
         ChooseDone: chooseDone,
         ChooseCancel: chooseCancel,
-        // Chooser: chooseButton,
         Choosing: false,
         Keys: keys,
+        Others: others,
+        Save: save,
     }
 
     back := &SubMenuButton{Name: "Back", Func: func() SubMenu { return parentMenu } }
@@ -1444,7 +1475,6 @@ func MakeKeysMenu(menu *Menu, parentMenu SubMenu, update func(common.EmulatorKey
         button := &StaticFixedWidthButton{
             Width: 200,
             Parts: []string{name, code.String()},
-            // Name: fmt.Sprintf("%v: %v", name, sdl.GetKeyCode(code)),
             Func: func(self *StaticFixedWidthButton){
                 keyMenu.SetChoosing(true, name, self)
             },
@@ -1456,35 +1486,26 @@ func MakeKeysMenu(menu *Menu, parentMenu SubMenu, update func(common.EmulatorKey
     defaults := &StaticButton{
         Name: "Reset to defaults",
         Func: func(self *StaticButton){
-            keyMenu.Keys.UpdateAll(common.DefaultEmulatorKeys())
-            common.SaveEmulatorKeys(*keyMenu.Keys)
+            reset()
+            save()
 
-            for _, key := range keyMenu.Keys.AllKeys() {
+            for _, key := range keys.AllKeys() {
                 button := changeButtons[key.Name]
-                button.Update(fmt.Sprintf("%v: %v", key.Name, key.Code.String()))
+                button.Update(key.Name, key.Code.String())
             }
         },
     }
 
     keyMenu.Buttons.Add(defaults)
 
-    /*
-    keyMenu.Buttons.Add(&StaticButton{Name: "Change key", Func: func(){
-        if chooseButton.Toggle() {
-            keyMenu.Buttons.Select(chooseButton)
-        } else {
-            keyMenu.Buttons.Select(back)
-        }
-    }})
-    */
+    for _, item := range extra {
+        keyMenu.Buttons.Add(item)
+    }
 
     keyMenu.Buttons.Add(&MenuNextLine{})
     keyMenu.Buttons.Add(&MenuLabel{Label: "Select a key to change", Color: color.RGBA{R: 255, G: 255, B: 0, A: 255}})
     keyMenu.Buttons.Add(&MenuNextLine{})
 
-    // keyMenu.Buttons.Add(&MenuSpace{Space: 60})
-    // keyMenu.Buttons.Add(chooseButton)
-
     count := 0
     for _, key := range keys.AllKeys() {
         name := key.Name
@@ -1499,7 +1520,74 @@ func MakeKeysMenu(menu *Menu, parentMenu SubMenu, update func(common.EmulatorKey
     return keyMenu
 }
 
-func MakeMainMenu(menu *Menu, mainCancel context.CancelFunc, programActions ProgramActions, joystickStateChanges <-chan JoystickState, joystickManager *common.JoystickManager, keys *common.EmulatorKeys) SubMenu {
+/* the player 1 and hotkey keys, with a sub menu for the player 2 keys */
+func MakeKeysMenu(menu *Menu, parentMenu SubMenu, update func(common.EmulatorKeys), keys *common.EmulatorKeys, player2Keys *common.ControllerKeys) SubMenu {
+    var keyMenu *ChangeKeyMenu
+
+    player2 := &SubMenuButton{Name: "Player 2 keys", Func: func() SubMenu {
+        return makeChangeKeyMenu(menu, keyMenu, player2Keys, []KeyBindings{keys},
+            func(){ common.SavePlayer2Keys(*player2Keys) },
+            func(){ *player2Keys = common.DefaultPlayer2Keys() },
+            func(){})
+    }}
+
+    keyMenu = makeChangeKeyMenu(menu, parentMenu, keys, []KeyBindings{player2Keys},
+        func(){ common.SaveEmulatorKeys(*keys) },
+        func(){ keys.UpdateAll(common.DefaultEmulatorKeys()) },
+        func(){ update(*keys) },
+        player2)
+
+    return keyMenu
+}
+
+/* dip switches and controller order for vs. system games */
+func MakeVsMenu(menu *Menu, parentMenu SubMenu, programActions ProgramActions) SubMenu {
+    vsMenu := &StaticMenu{
+        Quit: func(current SubMenu) SubMenu {
+            return parentMenu
+        },
+        AudioManager: menu.AudioManager,
+    }
+
+    vsMenu.Buttons.Add(&SubMenuButton{Name: "Back", Func: func() SubMenu { return parentMenu } })
+
+    dipSwitches, swapControllers, _ := programActions.GetVsSettings()
+
+    vsMenu.Buttons.Add(&ToggleButton{
+        State1: "Controllers swapped",
+        State2: "Controllers normal",
+        state: swapControllers,
+        Func: func(value bool){
+            swapControllers = value
+            programActions.SetVsSettings(dipSwitches, swapControllers)
+        },
+    })
+
+    vsMenu.Buttons.Add(&MenuNextLine{})
+    vsMenu.Buttons.Add(&MenuLabel{Label: "Dip switches, the game restarts when one changes", Color: color.RGBA{R: 255, G: 255, B: 0, A: 255}})
+    vsMenu.Buttons.Add(&MenuNextLine{})
+
+    for i := range 8 {
+        bit := byte(1) << i
+        vsMenu.Buttons.Add(&ToggleButton{
+            State1: fmt.Sprintf("%v: On", i + 1),
+            State2: fmt.Sprintf("%v: Off", i + 1),
+            state: dipSwitches & bit != 0,
+            Func: func(value bool){
+                if value {
+                    dipSwitches |= bit
+                } else {
+                    dipSwitches &= ^bit
+                }
+                programActions.SetVsSettings(dipSwitches, swapControllers)
+            },
+        })
+    }
+
+    return vsMenu
+}
+
+func MakeMainMenu(menu *Menu, mainCancel context.CancelFunc, programActions ProgramActions, joystickStateChanges <-chan JoystickState, joystickManager *common.JoystickManager, keys *common.EmulatorKeys, player2Keys *common.ControllerKeys) SubMenu {
     main := &StaticMenu{
         Quit: func(current SubMenu) SubMenu {
             /* quit the entire menu system if the user presses escape at the top level */
@@ -1544,6 +1632,64 @@ func MakeMainMenu(menu *Menu, mainCancel context.CancelFunc, programActions Prog
         }
     }})
 
+    makeSaveStateMenu := func(mode SaveStateMode) SubMenu {
+        sha256, _ := programActions.GetRomSha256()
+        back := func(current SubMenu) SubMenu {
+            return main
+        }
+        return MakeSaveStateMenu(mode, sha256, back, func(slot int){
+            /* the game is stopped while the menu is open, so the state is saved/loaded once the menu closes */
+            if mode == SaveStateModeSave {
+                programActions.SaveState(slot)
+            } else {
+                programActions.LoadState(slot)
+            }
+            menu.cancel()
+        }, menu.AudioManager)
+    }
+
+    main.Buttons.Add(&SubMenuButton{Name: "Save State", Func: func() SubMenu {
+        return makeSaveStateMenu(SaveStateModeSave)
+    }})
+
+    main.Buttons.Add(&SubMenuButton{Name: "Load State", Func: func() SubMenu {
+        return makeSaveStateMenu(SaveStateModeLoad)
+    }})
+
+    /* cycles through auto, ntsc, pal and dendy for the running game */
+    regionName := func(region nes.Region, override bool) string {
+        if !override {
+            return "Region: Auto"
+        }
+        return fmt.Sprintf("Region: %v", region)
+    }
+
+    main.Buttons.Add(&StaticButton{Name: regionName(programActions.GetRegionOverride()), Func: func(button *StaticButton){
+        if _, ok := programActions.GetRomSha256(); !ok {
+            return
+        }
+
+        regions := nes.AllRegions()
+        region, override := programActions.GetRegionOverride()
+        if !override {
+            region = regions[0]
+            override = true
+        } else if int(region) + 1 < len(regions) {
+            region = regions[region + 1]
+        } else {
+            override = false
+        }
+
+        programActions.SetRegionOverride(region, override)
+        button.Update(regionName(region, override))
+    }})
+
+    if _, _, ok := programActions.GetVsSettings(); ok {
+        main.Buttons.Add(&SubMenuButton{Name: "VS. System", Func: func() SubMenu {
+            return MakeVsMenu(menu, main, programActions)
+        }})
+    }
+
     main.Buttons.Add(&ToggleButton{
         State1: "Sound enabled",
         State2: "Sound disabled",
@@ -1557,7 +1703,7 @@ func MakeMainMenu(menu *Menu, mainCancel context.CancelFunc, programActions Prog
     /* FIXME: this callback to update ExtraInfo feels a bit hacky */
     keysMenu := MakeKeysMenu(menu, main, func (newKeys common.EmulatorKeys){
         main.ExtraInfo = keysInfo(&newKeys)
-    }, keys)
+    }, keys, player2Keys)
 
     main.Buttons.Add(&SubMenuButton{Name: "Keys", Func: func() SubMenu {
         return keysMenu
@@ -1589,7 +1735,7 @@ type DrawManager interface {
     GetWindowSize() common.WindowSize
 }
 
-func (menu *Menu) Run(mainCancel context.CancelFunc, font text.Face, smallFont text.Face, programActions ProgramActions, joystickManager *common.JoystickManager, emulatorKeys *common.EmulatorKeys, yield coroutine.YieldFunc, drawManager DrawManager){
+func (menu *Menu) Run(mainCancel context.CancelFunc, font text.Face, smallFont text.Face, programActions ProgramActions, joystickManager *common.JoystickManager, emulatorKeys *common.EmulatorKeys, player2Keys *common.ControllerKeys, yield coroutine.YieldFunc, drawManager DrawManager){
     userInput := make(chan MenuInput, 3)
     defer close(userInput)
 
@@ -1721,7 +1867,7 @@ func (menu *Menu) Run(mainCancel context.CancelFunc, font text.Face, smallFont t
 
     var clock uint64 = 0
 
-    currentMenu := MakeMainMenu(menu, mainCancel, programActions, joystickStateChanges, joystickManager, emulatorKeys)
+    currentMenu := MakeMainMenu(menu, mainCancel, programActions, joystickStateChanges, joystickManager, emulatorKeys, player2Keys)
 
     draw := func(screen *ebiten.Image){
         /* Draw a reddish overlay on the screen */
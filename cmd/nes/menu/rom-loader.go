@@ -36,6 +36,8 @@ type RomId uint64
 type RomLoaderAdd struct {
     Id RomId
     Path string
+    /* the name from the rom database, if the rom is in it */
+    Title string
     File common.MakeFile
 }
 
@@ -46,10 +48,19 @@ type RomLoaderFrame struct {
 
 type RomLoaderInfo struct {
     Path string
+    Title string
     Frames []*ebiten.Image
     ShowFrame int
 }
 
+/* the title of the game if it is known, otherwise the filename */
+func (info *RomLoaderInfo) Name() string {
+    if info.Title != "" {
+        return info.Title
+    }
+    return filepath.Base(info.Path)
+}
+
 func (info *RomLoaderInfo) GetFrame() (*ebiten.Image, bool) {
     // FIXME: might need a lock here
     if len(info.Frames) > 0 {
@@ -405,7 +416,7 @@ func generateThumbnails(loaderQuit context.Context, cpu nes.CPUState, romId RomI
     const maxCycles = uint64(30 * nes.CPUSpeed)
 
     log.Printf("Start loading %v", path)
-    err = common.RunNES(path, &cpu, maxCycles, quit, bufferReady, buffer, emulatorActionsInput, &screenListeners, &IgnoreMessages{}, AudioSampleRate, 0, nil, handleDraw)
+    err = common.RunNES(path, &cpu, false, maxCycles, quit, bufferReady, buffer, emulatorActionsInput, &screenListeners, &IgnoreMessages{}, AudioSampleRate, 0, nil, handleDraw)
     if err == common.MaxCyclesReached {
         log.Printf("%v complete", path)
     }
@@ -463,7 +474,7 @@ func romLoader(mainQuit context.Context, romLoaderState *RomLoaderState) error {
                     continue
                 }
 
-                cpu, err := common.SetupCPU(nesFile, false, false)
+                cpu, err := common.SetupCPU(&nesFile, false, false)
                 if err != nil {
                     log.Printf("Unable to setup cpu for %v: %v", possibleRom.Path, err)
                     continue
@@ -474,6 +485,7 @@ func romLoader(mainQuit context.Context, romLoaderState *RomLoaderState) error {
                 add := RomLoaderAdd{
                     Id: romId,
                     Path: possibleRom.Path,
+                    Title: nesFile.Title,
                     File: possibleRom.File,
                 }
 
@@ -543,7 +555,7 @@ func romLoader(mainQuit context.Context, romLoaderState *RomLoaderState) error {
         romLoaderState.CurrentScan = path
         romLoaderState.CurrentScanLock.Unlock()
 
-        if nes.IsNESFile(path){
+        if nes.IsRomFile(path) {
             romId += 1
             // log.Printf("Possible nes file %v", path)
             open := func() (fs.File, error){
@@ -771,6 +783,7 @@ func (data SortRomIds) Less(left, right int) bool {
 type RomIdAndPath struct {
     Id RomId
     Path string
+    Title string
     File common.MakeFile
 }
 
@@ -779,7 +792,8 @@ func (info *RomIdAndPath) Less(other *RomIdAndPath) bool {
 }
 
 func (info *RomIdAndPath) Contains(filter string) bool {
-    return strings.Contains(strings.ToLower(filepath.Base(info.Path)), strings.ToLower(filter))
+    lower := strings.ToLower(filter)
+    return strings.Contains(strings.ToLower(filepath.Base(info.Path)), lower) || strings.Contains(strings.ToLower(info.Title), lower)
 }
 
 func (info *RomIdAndPath) SortKey() string {
@@ -957,10 +971,14 @@ func (loader *RomLoaderState) Render(font text.Face, smallFont text.Face, screen
         selectedX := 100
         selectedY := fontHeight + 3
 
-        // show the filename of the selected rom
+        // show the filename of the selected rom, and its title if it is in the rom database
+        selectedName := showTiles[selectedIndex].Path
+        if showTiles[selectedIndex].Title != "" {
+            selectedName = fmt.Sprintf("%v (%v)", selectedName, showTiles[selectedIndex].Title)
+        }
         var options text.DrawOptions
         options.GeoM.Translate(float64(selectedX), float64(selectedY))
-        text.Draw(screen, showTiles[selectedIndex].Path, font, &options)
+        text.Draw(screen, selectedName, font, &options)
 
         if loader.RomIdsAndPaths.Filter() != "" {
             path := showTiles[selectedIndex].Path
@@ -1070,7 +1088,7 @@ func (loader *RomLoaderState) Render(font text.Face, smallFont text.Face, screen
         options.GeoM.Translate(float64(x), float64(y))
         screen.DrawImage(frame, &options)
 
-        name := filepath.Base(info.Path)
+        name := info.Name()
         if len(name) > MaxNameSize {
             name = fmt.Sprintf("%v..", name[0:MaxNameSize-2])
         }
@@ -1114,6 +1132,7 @@ func (loader *RomLoaderState) AddNewRom(rom RomLoaderAdd) {
 
     loader.Roms[rom.Id] = &RomLoaderInfo{
         Path: rom.Path,
+        Title: rom.Title,
         Frames: nil,
     }
 
@@ -1124,7 +1143,7 @@ func (loader *RomLoaderState) AddNewRom(rom RomLoaderAdd) {
         distanceToMin = selectedIndex - loader.MinRenderIndex
     }
 
-    newRomIdAndPath := RomIdAndPath{Id: rom.Id, Path: rom.Path, File: rom.File}
+    newRomIdAndPath := RomIdAndPath{Id: rom.Id, Path: rom.Path, Title: rom.Title, File: rom.File}
     loader.RomIdsAndPaths.Add(&newRomIdAndPath)
 
     if loader.SelectedRomKey == "" {
@@ -0,0 +1,285 @@
+package menu
+
+import (
+    "fmt"
+    "log"
+    "time"
+    "image"
+    "image/color"
+
+    "github.com/kazzmir/nes/cmd/nes/common"
+    "github.com/kazzmir/nes/cmd/nes/gfx"
+    nes "github.com/kazzmir/nes/lib"
+
+    "github.com/hajimehoshi/ebiten/v2"
+    "github.com/hajimehoshi/ebiten/v2/inpututil"
+    "github.com/hajimehoshi/ebiten/v2/text/v2"
+    "github.com/hajimehoshi/ebiten/v2/vector"
+)
+
+type SaveStateMode int
+const (
+    SaveStateModeSave SaveStateMode = iota
+    SaveStateModeLoad
+)
+
+type saveStateSlot struct {
+    Slot int
+    /* false if nothing is saved in this slot */
+    Used bool
+    Info common.SaveStateInfo
+    Thumbnail *ebiten.Image
+
+    /* where the slot was last drawn, for the mouse */
+    Rect image.Rectangle
+}
+
+/* shows the quick save slot and all the numbered slots of the running game in a grid.
+ * the selected slot can be saved to or loaded from depending on the mode, and deleted
+ * with the delete key
+ */
+type SaveStateMenu struct {
+    Mode SaveStateMode
+    /* sha256 of the running game, empty if no game is running */
+    Sha256 string
+    Back MenuQuitFunc
+    /* invoked when the user picks a slot */
+    Choose func(slot int)
+    AudioManager AudioManager
+
+    Slots []saveStateSlot
+    Selection int
+}
+
+const saveStateColumns = 3
+
+func MakeSaveStateMenu(mode SaveStateMode, sha256 string, back MenuQuitFunc, choose func(int), audioManager AudioManager) *SaveStateMenu {
+    menu := &SaveStateMenu{
+        Mode: mode,
+        Sha256: sha256,
+        Back: back,
+        Choose: choose,
+        AudioManager: audioManager,
+    }
+
+    menu.Refresh()
+
+    return menu
+}
+
+/* reload the slot info and thumbnails from disk */
+func (menu *SaveStateMenu) Refresh() {
+    menu.Slots = nil
+
+    for slot := common.QuickSaveSlot; slot <= common.MaxSaveSlot; slot++ {
+        current := saveStateSlot{
+            Slot: slot,
+        }
+
+        if menu.Sha256 != "" {
+            current.Info, current.Used = common.GetSaveStateInfo(menu.Sha256, slot)
+            if current.Used && current.Info.Thumbnail != "" {
+                thumbnail, err := loadPng(current.Info.Thumbnail)
+                if err != nil {
+                    log.Printf("Unable to load save state thumbnail %v: %v", current.Info.Thumbnail, err)
+                } else {
+                    current.Thumbnail = ebiten.NewImageFromImage(thumbnail)
+                }
+            }
+        }
+
+        menu.Slots = append(menu.Slots, current)
+    }
+}
+
+func (menu *SaveStateMenu) PlayBeep() {
+    menu.AudioManager.PlayBeep()
+}
+
+func (menu *SaveStateMenu) UpdateWindowSize(x int, y int){
+}
+
+func (menu *SaveStateMenu) Delete() {
+    if menu.Sha256 == "" || !menu.Slots[menu.Selection].Used {
+        return
+    }
+
+    err := common.DeleteSaveState(menu.Sha256, menu.Slots[menu.Selection].Slot)
+    if err != nil {
+        log.Printf("Unable to delete save state: %v", err)
+    }
+
+    menu.Refresh()
+}
+
+func (menu *SaveStateMenu) Update(){
+    if inpututil.IsKeyJustPressed(ebiten.KeyDelete) {
+        menu.Delete()
+    }
+}
+
+func (menu *SaveStateMenu) MouseMove(x int, y int){
+    for i, slot := range menu.Slots {
+        if image.Pt(x, y).In(slot.Rect) {
+            menu.Selection = i
+        }
+    }
+}
+
+func (menu *SaveStateMenu) MouseWheel(dy int){
+}
+
+func (menu *SaveStateMenu) MouseClick(x int, y int) SubMenu {
+    for i, slot := range menu.Slots {
+        if image.Pt(x, y).In(slot.Rect) {
+            menu.Selection = i
+            return menu.Input(MenuSelect)
+        }
+    }
+
+    return menu
+}
+
+func (menu *SaveStateMenu) move(amount int){
+    menu.Selection = (menu.Selection + amount + len(menu.Slots)) % len(menu.Slots)
+    menu.PlayBeep()
+}
+
+func (menu *SaveStateMenu) Input(input MenuInput) SubMenu {
+    switch input {
+        case MenuNext:
+            menu.move(1)
+        case MenuPrevious:
+            menu.move(-1)
+        case MenuUp:
+            menu.move(-saveStateColumns)
+        case MenuDown:
+            menu.move(saveStateColumns)
+        case MenuQuit:
+            return menu.Back(menu)
+        case MenuSelect:
+            if menu.Sha256 == "" {
+                return menu
+            }
+
+            slot := menu.Slots[menu.Selection]
+            /* can't load an empty slot */
+            if menu.Mode == SaveStateModeLoad && !slot.Used {
+                return menu
+            }
+
+            menu.Choose(slot.Slot)
+    }
+
+    return menu
+}
+
+/* format as h:mm:ss */
+func formatPlayTime(playTime time.Duration) string {
+    seconds := int(playTime.Seconds())
+    return fmt.Sprintf("%v:%02d:%02d", seconds / 3600, (seconds / 60) % 60, seconds % 60)
+}
+
+func (menu *SaveStateMenu) MakeRenderer(font text.Face, smallFont text.Face, clock uint64) gfx.RenderFunction {
+    return func(out *ebiten.Image) error {
+        white := color.RGBA{R: 255, G: 255, B: 255, A: 255}
+        yellow := color.RGBA{R: 255, G: 255, B: 0, A: 255}
+        red := color.RGBA{R: 255, G: 0, B: 0, A: 255}
+        gray := color.RGBA{R: 64, G: 64, B: 64, A: 255}
+
+        _, fontHeight := text.Measure("A", font, 1)
+        _, smallHeight := text.Measure("A", smallFont, 1)
+
+        maxWidth := float64(out.Bounds().Dx())
+        maxHeight := float64(out.Bounds().Dy())
+
+        x := 50.0
+        y := 50.0
+
+        title := "Save state"
+        hint := "Enter: save to slot    Delete: delete slot    Escape: back"
+        if menu.Mode == SaveStateModeLoad {
+            title = "Load state"
+            hint = "Enter: load slot    Delete: delete slot    Escape: back"
+        }
+
+        var textOptions text.DrawOptions
+        textOptions.GeoM.Translate(x, y)
+        text.Draw(out, title, font, &textOptions)
+
+        if menu.Sha256 == "" {
+            textOptions.GeoM.Translate(0, fontHeight * 2)
+            text.Draw(out, "No game is running", font, &textOptions)
+            return nil
+        }
+
+        y += fontHeight * 2
+
+        textOptions.GeoM.Reset()
+        textOptions.GeoM.Translate(x, maxHeight - smallHeight * 3)
+        text.Draw(out, hint, smallFont, &textOptions)
+
+        rows := (len(menu.Slots) + saveStateColumns - 1) / saveStateColumns
+
+        /* each slot shows a thumbnail with three lines of text below it */
+        const padding = 10
+        textLines := (smallHeight + 2) * 3
+        tileWidth := (maxWidth - x * 2) / saveStateColumns
+        tileHeight := (maxHeight - y - smallHeight * 4) / float64(rows)
+
+        screenHeight := float64(nes.VideoHeight - nes.OverscanPixels * 2)
+        thumbnailHeight := tileHeight - textLines - padding * 2
+        thumbnailWidth := thumbnailHeight * float64(nes.VideoWidth) / screenHeight
+        if thumbnailWidth > tileWidth - padding * 2 {
+            thumbnailWidth = tileWidth - padding * 2
+            thumbnailHeight = thumbnailWidth * screenHeight / float64(nes.VideoWidth)
+        }
+
+        for i := range menu.Slots {
+            slot := &menu.Slots[i]
+
+            tileX := x + float64(i % saveStateColumns) * tileWidth
+            tileY := y + float64(i / saveStateColumns) * tileHeight
+
+            slot.Rect = image.Rect(int(tileX), int(tileY), int(tileX + tileWidth), int(tileY + tileHeight))
+
+            thumbX := tileX + padding
+            thumbY := tileY + padding
+
+            if slot.Thumbnail != nil {
+                /* don't show the overscan area */
+                view := slot.Thumbnail.SubImage(image.Rect(0, nes.OverscanPixels, slot.Thumbnail.Bounds().Dx(), slot.Thumbnail.Bounds().Dy() - nes.OverscanPixels)).(*ebiten.Image)
+
+                var draw ebiten.DrawImageOptions
+                draw.GeoM.Scale(thumbnailWidth / float64(view.Bounds().Dx()), thumbnailHeight / float64(view.Bounds().Dy()))
+                draw.GeoM.Translate(thumbX, thumbY)
+                out.DrawImage(view, &draw)
+            } else {
+                vector.FillRect(out, float32(thumbX), float32(thumbY), float32(thumbnailWidth), float32(thumbnailHeight), gray, false)
+            }
+
+            var outline color.Color = white
+            width := float32(1)
+            if i == menu.Selection {
+                outline = gfx.Glow(red, yellow, 40, clock)
+                width = 3
+            }
+            vector.StrokeRect(out, float32(thumbX), float32(thumbY), float32(thumbnailWidth), float32(thumbnailHeight), width, outline, false)
+
+            textOptions.GeoM.Reset()
+            textOptions.GeoM.Translate(thumbX, thumbY + thumbnailHeight + 4)
+            text.Draw(out, common.SaveSlotName(slot.Slot), smallFont, &textOptions)
+
+            textOptions.GeoM.Translate(0, smallHeight + 2)
+            if slot.Used {
+                text.Draw(out, slot.Info.Date.Format("2006-01-02 15:04:05"), smallFont, &textOptions)
+                textOptions.GeoM.Translate(0, smallHeight + 2)
+                text.Draw(out, fmt.Sprintf("Play time: %v", formatPlayTime(slot.Info.PlayTime)), smallFont, &textOptions)
+            } else {
+                text.Draw(out, "Empty", smallFont, &textOptions)
+            }
+        }
+
+        return nil
+    }
+}
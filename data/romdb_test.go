@@ -0,0 +1,50 @@
+package data
+
+import (
+    "bytes"
+    "os"
+    "testing"
+
+    nes "github.com/kazzmir/nes/lib"
+)
+
+/* the rom database embedded in the emulator finds a rom by its hash and fixes its header */
+func TestEmbeddedRomDatabase(test *testing.T){
+    file, err := OpenFile("romdb.json")
+    if err != nil {
+        test.Fatalf("could not open the embedded rom database: %v", err)
+    }
+    defer file.Close()
+
+    database, err := nes.LoadRomDatabase(file)
+    if err != nil {
+        test.Fatalf("could not load the embedded rom database: %v", err)
+    }
+
+    rom, err := os.ReadFile("../test-roms/nestest.nes")
+    if err != nil {
+        test.Fatalf("could not read nestest: %v", err)
+    }
+
+    /* a bad dump of nestest whose header says mmc3 with vertical mirroring and a battery */
+    rom[6] = 0x43
+    rom[7] = 0x00
+
+    nesFile, err := nes.ParseNes(bytes.NewReader(rom), false, "bad.nes")
+    if err != nil {
+        test.Fatalf("could not parse the bad nestest: %v", err)
+    }
+    if nesFile.Mapper != 4 || !nesFile.VerticalMirror || !nesFile.Battery {
+        test.Fatalf("the header was not broken: mapper %v", nesFile.Mapper)
+    }
+
+    info, ok := database.Lookup(&nesFile)
+    if !ok {
+        test.Fatalf("nestest was not found by its hash")
+    }
+
+    info.Apply(&nesFile)
+    if nesFile.Title != "nestest" || nesFile.Mapper != 0 || !nesFile.HorizontalMirror || nesFile.VerticalMirror {
+        test.Fatalf("the header was not fixed: '%v' mapper %v horizontal %v", nesFile.Title, nesFile.Mapper, nesFile.HorizontalMirror)
+    }
+}
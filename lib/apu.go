@@ -406,7 +406,7 @@ func MakeAudioStream(size int) *AudioStream {
         Main: stream{
             Samples: make([]float32, size),
         },
-        // A second stream, mainly for VRC6 audio. This is mixed into the main stream
+        // A second stream that is mixed into the main stream
         Second: stream{
             Samples: make([]float32, size),
         },
@@ -477,6 +477,8 @@ func (stream *AudioStream) Read(out []byte) (int, error) {
 }
 
 type APUState struct {
+    /* selects the frame counter rate and the noise/dmc period tables */
+    Region Region `json:"region"`
     /* APU cycles, 1 apu cycle for every 2 cpu cycles */
     Cycles float64 `json:"cycles"`
     /* frame sequencer clock, ticks at 240hz */
@@ -509,6 +511,7 @@ type APUState struct {
 
 func (apu *APUState) Copy() APUState {
     return APUState{
+        Region: apu.Region,
         Cycles: apu.Cycles,
         Clock: apu.Clock,
         FrameMode: apu.FrameMode,
@@ -586,7 +589,10 @@ func (apu *APUState) HalfFrame() {
     apu.Triangle.TickLengthCounter()
 }
 
-func (apu *APUState) Run(apuCycles float64, cyclesPerSample float64, cpu *CPUState) {
+/* returns the sample that was generated, and how many times it was emitted. count will be
+ * 0 if not enough cycles have passed to produce a sample
+ */
+func (apu *APUState) Run(apuCycles float64, cyclesPerSample float64, cpu *CPUState) (float32, int) {
     apu.Pulse1.Run(apuCycles)
     apu.Pulse2.Run(apuCycles)
     apu.Triangle.Run(apuCycles)
@@ -618,7 +624,7 @@ func (apu *APUState) Run(apuCycles float64, cyclesPerSample float64, cpu *CPUSta
      * apu hz = cpu hz / 2
      * 1.789773e6 / 2 / 3728.5 = 240.01247
      */
-    apuCounter := 3728.75
+    apuCounter := apu.Region.Timing().FrameCounterPeriod
     for apu.Cycles >= apuCounter {
         apu.Clock += 1
         apu.Cycles -= apuCounter
@@ -658,7 +664,12 @@ func (apu *APUState) Run(apuCycles float64, cyclesPerSample float64, cpu *CPUSta
     // var out []float32
     if apu.SampleCycles > cyclesPerSample {
         sample := apu.GenerateSample()
+        if mixed, ok := cpu.Mapper.Mapper.(MixedAudioMapper); ok {
+            sample += mixed.AudioOutput()
+        }
+        count := 0
         for apu.SampleCycles >= cyclesPerSample {
+            count += 1
             apu.SampleCycles -= cyclesPerSample
             /*
             apu.SampleBuffer[apu.SamplePosition] = sample
@@ -675,9 +686,11 @@ func (apu *APUState) Run(apuCycles float64, cyclesPerSample float64, cpu *CPUSta
                 stream.AddSample(sample)
             }
         }
+
+        return sample, count
     }
 
-    // return out
+    return 0, 0
 }
 
 type DMC struct {
@@ -717,29 +730,11 @@ func (dmc *DMC) GenerateSample() byte {
     return dmc.OutputLevel
 }
 
-/* http://wiki.nesdev.org/w/index.php/APU_DMC */
-func dmcNTSCRate(value byte) uint16 {
-    switch value & 0xf {
-        case 0x0: return 428 /* low frequency, 4181.71hz */
-        case 0x1: return 380
-        case 0x2: return 340
-        case 0x3: return 320
-        case 0x4: return 286
-        case 0x5: return 254
-        case 0x6: return 226
-        case 0x7: return 214
-        case 0x8: return 190
-        case 0x9: return 160
-        case 0xa: return 142
-        case 0xb: return 128
-        case 0xc: return 106
-        case 0xd: return 84
-        case 0xe: return 72
-        case 0xf: return 54  /* high frequency, 33143.94hz */
-    }
-
-    /* can't get here */
-    return 428
+/* http://wiki.nesdev.org/w/index.php/APU_DMC
+ * on ntsc the rates go from 428 (4181.71hz) to 54 (33143.94hz)
+ */
+func dmcRate(region Region, value byte) uint16 {
+    return region.Timing().DMCRates[value & 0xf]
 }
 
 func (apu *APUState) WriteDMCEnable(value byte) {
@@ -756,7 +751,7 @@ func (apu *APUState) WriteDMCEnable(value byte) {
     /* these periods are all even numbers because there are 2 CPU cycles in an APU cycle.
      * A rate of 428 means the output level changes every 214 APU cycles.
      */
-    apu.DMC.Frequency = float64(dmcNTSCRate(frequency)) / 2.0
+    apu.DMC.Frequency = float64(dmcRate(apu.Region, frequency)) / 2.0
     apu.DMC.Counter = 0
 }
 
@@ -1042,29 +1037,8 @@ func (apu *APUState) WriteTriangleTimerHigh(value byte){
 }
 
 /* http://wiki.nesdev.org/w/index.php/APU_Noise */
-func noisePeriod(period byte) uint16 {
-    /* NTSC */
-    switch period & 0xf {
-        case 0: return 4
-        case 1: return 8
-        case 2: return 16
-        case 3: return 32
-        case 4: return 64
-        case 5: return 96
-        case 6: return 128
-        case 7: return 160
-        case 8: return 202
-        case 9: return 254
-        case 0xa: return 380
-        case 0xb: return 508
-        case 0xc: return 762
-        case 0xd: return 1016
-        case 0xe: return 2034
-        case 0xf: return 4068
-    }
-
-    /* it should not be possible to get here */
-    return 4
+func noisePeriod(region Region, period byte) uint16 {
+    return region.Timing().NoisePeriods[period & 0xf]
 }
 
 func (apu *APUState) WriteNoiseMode(value byte){
@@ -1075,7 +1049,7 @@ func (apu *APUState) WriteNoiseMode(value byte){
     }
 
     apu.Noise.Mode = mode
-    apu.Noise.Timer.SetPeriod(noisePeriod(period))
+    apu.Noise.Timer.SetPeriod(noisePeriod(apu.Region, period))
 }
 
 func (apu *APUState) WriteNoiseEnvelope(value byte){
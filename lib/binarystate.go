@@ -0,0 +1,750 @@
+package lib
+
+import (
+    "bytes"
+    "encoding/binary"
+    "fmt"
+    "math"
+)
+
+/* A compact binary encoding of the emulator state. Every type writes its fields in a
+ * fixed order with a StateWriter and reads them back in the same order with a StateReader,
+ * so encoding is just appending bytes to a slice. Integers are little endian, ints are
+ * varints, and byte slices are length prefixed.
+ *
+ * The format is versioned separately from the json form. When a field is added, bump
+ * BinaryStateVersion, write the field unconditionally and only read it when
+ * reader.Version is new enough, leaving a sensible default otherwise.
+ */
+
+/* 1: initial version
+ * 2: ppu and apu region
+ * 3: mapper0 prg ram
+ * 4: mapper4 a12 irq state
+ * 5: mapper9 chr latches
+ * 6: mapper1 mmc1a and consecutive write state
+ * 7: ppu model and vs system
+ * 8: ppu secondary oam and sprite evaluation
+ * 9: unused, vrc6 states from version 3 with the sample cycles are recognized by their size
+ * 10: vrc4 prg ram enable
+ * 11: sprite evaluation overflow reads
+ * 12: mmc5 audio region
+ */
+const BinaryStateVersion = 12
+
+/* every binary state starts with this, followed by the version */
+var binaryStateMagic = []byte("NESS")
+
+/* mappers that can be saved in the binary format */
+type BinaryMapper interface {
+    SaveBinary(writer *StateWriter)
+    LoadBinary(reader *StateReader)
+}
+
+type StateWriter struct {
+    data []byte
+    /* offsets where each byte slice starts and ends. rewind uses these to split the state
+     * so that large memory regions can be shared between snapshots
+     */
+    marks []int
+}
+
+func (writer *StateWriter) Data() []byte {
+    return writer.data
+}
+
+func (writer *StateWriter) Byte(value byte){
+    writer.data = append(writer.data, value)
+}
+
+func (writer *StateWriter) Bool(value bool){
+    if value {
+        writer.Byte(1)
+    } else {
+        writer.Byte(0)
+    }
+}
+
+func (writer *StateWriter) Uint16(value uint16){
+    writer.data = binary.LittleEndian.AppendUint16(writer.data, value)
+}
+
+func (writer *StateWriter) Uint32(value uint32){
+    writer.data = binary.LittleEndian.AppendUint32(writer.data, value)
+}
+
+func (writer *StateWriter) Uint64(value uint64){
+    writer.data = binary.LittleEndian.AppendUint64(writer.data, value)
+}
+
+func (writer *StateWriter) Int(value int){
+    writer.data = binary.AppendVarint(writer.data, int64(value))
+}
+
+func (writer *StateWriter) Float32(value float32){
+    writer.Uint32(math.Float32bits(value))
+}
+
+func (writer *StateWriter) Float64(value float64){
+    writer.Uint64(math.Float64bits(value))
+}
+
+/* the length is stored plus one so that a nil slice comes back as nil */
+func (writer *StateWriter) Bytes(value []byte){
+    if value == nil {
+        writer.data = binary.AppendUvarint(writer.data, 0)
+        return
+    }
+
+    writer.data = binary.AppendUvarint(writer.data, uint64(len(value)) + 1)
+    writer.marks = append(writer.marks, len(writer.data))
+    writer.data = append(writer.data, value...)
+    writer.marks = append(writer.marks, len(writer.data))
+}
+
+func (writer *StateWriter) String(value string){
+    writer.data = binary.AppendUvarint(writer.data, uint64(len(value)))
+    writer.data = append(writer.data, value...)
+}
+
+/* reads values in the same order they were written. the first error is remembered and
+ * every read after that returns a zero value, so callers only have to check Err() at the end
+ */
+type StateReader struct {
+    /* the BinaryStateVersion the data was written with */
+    Version int
+    data []byte
+    err error
+}
+
+func (reader *StateReader) Err() error {
+    return reader.err
+}
+
+func (reader *StateReader) fail(err error){
+    if reader.err == nil {
+        reader.err = err
+    }
+}
+
+func (reader *StateReader) take(size int) []byte {
+    if reader.err != nil {
+        return nil
+    }
+
+    if size < 0 || len(reader.data) < size {
+        reader.fail(fmt.Errorf("binary state is truncated"))
+        return nil
+    }
+
+    out := reader.data[:size]
+    reader.data = reader.data[size:]
+    return out
+}
+
+func (reader *StateReader) Byte() byte {
+    data := reader.take(1)
+    if data == nil {
+        return 0
+    }
+    return data[0]
+}
+
+func (reader *StateReader) Bool() bool {
+    return reader.Byte() != 0
+}
+
+func (reader *StateReader) Uint16() uint16 {
+    data := reader.take(2)
+    if data == nil {
+        return 0
+    }
+    return binary.LittleEndian.Uint16(data)
+}
+
+func (reader *StateReader) Uint32() uint32 {
+    data := reader.take(4)
+    if data == nil {
+        return 0
+    }
+    return binary.LittleEndian.Uint32(data)
+}
+
+func (reader *StateReader) Uint64() uint64 {
+    data := reader.take(8)
+    if data == nil {
+        return 0
+    }
+    return binary.LittleEndian.Uint64(data)
+}
+
+func (reader *StateReader) Int() int {
+    if reader.err != nil {
+        return 0
+    }
+
+    value, size := binary.Varint(reader.data)
+    if size <= 0 {
+        reader.fail(fmt.Errorf("invalid integer in binary state"))
+        return 0
+    }
+    reader.data = reader.data[size:]
+    return int(value)
+}
+
+func (reader *StateReader) uvarint() uint64 {
+    if reader.err != nil {
+        return 0
+    }
+
+    value, size := binary.Uvarint(reader.data)
+    if size <= 0 {
+        reader.fail(fmt.Errorf("invalid length in binary state"))
+        return 0
+    }
+    reader.data = reader.data[size:]
+    return value
+}
+
+func (reader *StateReader) Float32() float32 {
+    return math.Float32frombits(reader.Uint32())
+}
+
+func (reader *StateReader) Float64() float64 {
+    return math.Float64frombits(reader.Uint64())
+}
+
+func (reader *StateReader) Bytes() []byte {
+    length := reader.uvarint()
+    if length == 0 {
+        return nil
+    }
+
+    if length - 1 > uint64(len(reader.data)) {
+        reader.fail(fmt.Errorf("binary state is truncated"))
+        return nil
+    }
+
+    return bytes.Clone(reader.take(int(length - 1)))
+}
+
+func (reader *StateReader) String() string {
+    length := reader.uvarint()
+    if length > uint64(len(reader.data)) {
+        reader.fail(fmt.Errorf("binary state is truncated"))
+        return ""
+    }
+
+    return string(reader.take(int(length)))
+}
+
+/* guard against a corrupt length allocating a huge slice */
+func (reader *StateReader) count() int {
+    count := reader.Int()
+    if count < 0 || count > len(reader.data) {
+        reader.fail(fmt.Errorf("invalid count %v in binary state", count))
+        return 0
+    }
+    return count
+}
+
+func (sprite *Sprite) SaveBinary(writer *StateWriter){
+    writer.Byte(sprite.Tile)
+    writer.Byte(sprite.X)
+    writer.Byte(sprite.Y)
+    writer.Bool(sprite.Flip_horizontal)
+    writer.Bool(sprite.Flip_vertical)
+    writer.Byte(sprite.Palette)
+    writer.Byte(sprite.Priority)
+    writer.Bool(sprite.Sprite0)
+}
+
+func (sprite *Sprite) LoadBinary(reader *StateReader){
+    sprite.Tile = reader.Byte()
+    sprite.X = reader.Byte()
+    sprite.Y = reader.Byte()
+    sprite.Flip_horizontal = reader.Bool()
+    sprite.Flip_vertical = reader.Bool()
+    sprite.Palette = reader.Byte()
+    sprite.Priority = reader.Byte()
+    sprite.Sprite0 = reader.Bool()
+}
+
+func (ppu *PPUState) SaveBinary(writer *StateWriter){
+    writer.Byte(ppu.Flags)
+    writer.Byte(ppu.Mask)
+    writer.Byte(ppu.Status)
+    writer.Int(ppu.Scanline)
+    writer.Int(ppu.ScanlineCycle)
+    writer.Uint16(ppu.TemporaryVideoAddress)
+    writer.Uint16(ppu.VideoAddress)
+    writer.Byte(ppu.WriteState)
+    writer.Int(int(ppu.NametableMirror))
+    writer.Byte(ppu.FineX)
+
+    writer.Int(len(ppu.Palette))
+    for _, color := range ppu.Palette {
+        writer.Bytes(color)
+    }
+
+    writer.Int(len(ppu.CurrentSprites))
+    for i := range ppu.CurrentSprites {
+        ppu.CurrentSprites[i].SaveBinary(writer)
+    }
+
+    writer.Bytes(ppu.VideoMemory)
+    writer.Bytes(ppu.NametableMemory)
+    writer.Bytes(ppu.OAM)
+    writer.Int(ppu.OAMAddress)
+    writer.Byte(ppu.InternalVideoBuffer)
+    writer.Byte(ppu.Shifts)
+    writer.Uint64(ppu.BackgroundPixels)
+    writer.Uint32(ppu.RawBackgroundPixels)
+    writer.Bool(ppu.HasSetSprite0)
+    writer.Int(int(ppu.Region))
+    writer.Byte(byte(ppu.Model))
+    writer.Bytes(ppu.SecondaryOAM[:])
+    ppu.SpriteEvaluation.SaveBinary(writer)
+}
+
+func (ppu *PPUState) LoadBinary(reader *StateReader){
+    ppu.Flags = reader.Byte()
+    ppu.Mask = reader.Byte()
+    ppu.Status = reader.Byte()
+    ppu.Scanline = reader.Int()
+    ppu.ScanlineCycle = reader.Int()
+    ppu.TemporaryVideoAddress = reader.Uint16()
+    ppu.VideoAddress = reader.Uint16()
+    ppu.WriteState = reader.Byte()
+    ppu.NametableMirror = NametableMirrorConfiguration(reader.Int())
+    ppu.FineX = reader.Byte()
+
+    ppu.emphasisPalette = nil
+    ppu.Palette = make([][]uint8, reader.count())
+    for i := range ppu.Palette {
+        ppu.Palette[i] = reader.Bytes()
+    }
+
+    sprites := reader.count()
+    ppu.CurrentSprites = nil
+    for range sprites {
+        var sprite Sprite
+        sprite.LoadBinary(reader)
+        ppu.CurrentSprites = append(ppu.CurrentSprites, sprite)
+    }
+
+    ppu.VideoMemory = reader.Bytes()
+    ppu.NametableMemory = reader.Bytes()
+    ppu.OAM = reader.Bytes()
+    ppu.OAMAddress = reader.Int()
+    ppu.InternalVideoBuffer = reader.Byte()
+    ppu.Shifts = reader.Byte()
+    ppu.BackgroundPixels = reader.Uint64()
+    ppu.RawBackgroundPixels = reader.Uint32()
+    ppu.HasSetSprite0 = reader.Bool()
+
+    ppu.Region = RegionNTSC
+    if reader.Version >= 2 {
+        ppu.Region = Region(reader.Int())
+    }
+
+    ppu.Model = PPU2C02
+    if reader.Version >= 7 {
+        ppu.Model = PPUModel(reader.Byte())
+    }
+
+    ppu.SecondaryOAM = [32]byte{}
+    ppu.SpriteEvaluation = SpriteEvaluation{}
+    if reader.Version >= 8 {
+        copy(ppu.SecondaryOAM[:], reader.Bytes())
+        ppu.SpriteEvaluation.LoadBinary(reader)
+    }
+}
+
+func (eval *SpriteEvaluation) SaveBinary(writer *StateWriter){
+    writer.Byte(eval.Latch)
+    writer.Int(eval.SecondaryAddress)
+    writer.Bool(eval.InRange)
+    writer.Bool(eval.Done)
+    writer.Bool(eval.Sprite0)
+    writer.Int(eval.OverflowReads)
+}
+
+func (eval *SpriteEvaluation) LoadBinary(reader *StateReader){
+    eval.Latch = reader.Byte()
+    /* indexes secondary oam, so keep a corrupt state from going out of bounds */
+    eval.SecondaryAddress = min(max(reader.Int(), 0), 32)
+    eval.InRange = reader.Bool()
+    eval.Done = reader.Bool()
+    eval.Sprite0 = reader.Bool()
+    if reader.Version >= 11 {
+        eval.OverflowReads = reader.Int()
+    }
+}
+
+func (divider *Divider) SaveBinary(writer *StateWriter){
+    writer.Uint16(divider.ClockPeriod)
+    writer.Uint16(uint16(divider.Count))
+}
+
+func (divider *Divider) LoadBinary(reader *StateReader){
+    divider.ClockPeriod = reader.Uint16()
+    divider.Count = int16(reader.Uint16())
+}
+
+func (timer *Timer) SaveBinary(writer *StateWriter){
+    timer.Divider.SaveBinary(writer)
+    writer.Float64(timer.Cycles)
+    writer.Uint16(timer.Low)
+    writer.Uint16(timer.High)
+}
+
+func (timer *Timer) LoadBinary(reader *StateReader){
+    timer.Divider.LoadBinary(reader)
+    timer.Cycles = reader.Float64()
+    timer.Low = reader.Uint16()
+    timer.High = reader.Uint16()
+}
+
+func (envelope *EnvelopeGenerator) SaveBinary(writer *StateWriter){
+    envelope.Divider.SaveBinary(writer)
+    writer.Bool(envelope.Loop)
+    writer.Bool(envelope.Disable)
+    writer.Byte(envelope.Value)
+    writer.Byte(envelope.Counter)
+}
+
+func (envelope *EnvelopeGenerator) LoadBinary(reader *StateReader){
+    envelope.Divider.LoadBinary(reader)
+    envelope.Loop = reader.Bool()
+    envelope.Disable = reader.Bool()
+    envelope.Value = reader.Byte()
+    envelope.Counter = reader.Byte()
+}
+
+func (length *LengthCounter) SaveBinary(writer *StateWriter){
+    writer.Bool(length.Halt)
+    writer.Byte(length.Length)
+}
+
+func (length *LengthCounter) LoadBinary(reader *StateReader){
+    length.Halt = reader.Bool()
+    length.Length = reader.Byte()
+}
+
+func (pulse *Pulse) SaveBinary(writer *StateWriter){
+    writer.String(pulse.Name)
+    pulse.Sweep.Divider.SaveBinary(writer)
+    writer.Bool(pulse.Sweep.Enabled)
+    writer.Bool(pulse.Sweep.Negate)
+    writer.Byte(pulse.Sweep.ShiftCount)
+    pulse.Timer.SaveBinary(writer)
+    pulse.Envelope.SaveBinary(writer)
+    pulse.Length.SaveBinary(writer)
+    writer.Float32(pulse.Frequency)
+    writer.Float32(pulse.Phase)
+    writer.Byte(pulse.Duty)
+    writer.Byte(pulse.Sequencer.Duty)
+    writer.Byte(pulse.Sequencer.Position)
+}
+
+func (pulse *Pulse) LoadBinary(reader *StateReader){
+    pulse.Name = reader.String()
+    pulse.Sweep.Divider.LoadBinary(reader)
+    pulse.Sweep.Enabled = reader.Bool()
+    pulse.Sweep.Negate = reader.Bool()
+    pulse.Sweep.ShiftCount = reader.Byte()
+    pulse.Timer.LoadBinary(reader)
+    pulse.Envelope.LoadBinary(reader)
+    pulse.Length.LoadBinary(reader)
+    pulse.Frequency = reader.Float32()
+    pulse.Phase = reader.Float32()
+    pulse.Duty = reader.Byte()
+    pulse.Sequencer.Duty = reader.Byte()
+    pulse.Sequencer.Position = reader.Byte()
+}
+
+func (noise *Noise) SaveBinary(writer *StateWriter){
+    noise.Length.SaveBinary(writer)
+    noise.Envelope.SaveBinary(writer)
+    writer.Byte(noise.Mode)
+    noise.Timer.SaveBinary(writer)
+    writer.Uint16(noise.ShiftRegister)
+}
+
+func (noise *Noise) LoadBinary(reader *StateReader){
+    noise.Length.LoadBinary(reader)
+    noise.Envelope.LoadBinary(reader)
+    noise.Mode = reader.Byte()
+    noise.Timer.LoadBinary(reader)
+    noise.ShiftRegister = reader.Uint16()
+}
+
+func (triangle *Triangle) SaveBinary(writer *StateWriter){
+    triangle.Timer.SaveBinary(writer)
+    writer.Int(triangle.Phase)
+    triangle.Length.SaveBinary(writer)
+    writer.Bool(triangle.ControlFlag)
+    writer.Bool(triangle.LinearCounterReloadFlag)
+    writer.Int(triangle.LinearCounterReload)
+    writer.Int(triangle.LinearCounter)
+}
+
+func (triangle *Triangle) LoadBinary(reader *StateReader){
+    triangle.Timer.LoadBinary(reader)
+    triangle.Phase = reader.Int()
+    triangle.Length.LoadBinary(reader)
+    triangle.ControlFlag = reader.Bool()
+    triangle.LinearCounterReloadFlag = reader.Bool()
+    triangle.LinearCounterReload = reader.Int()
+    triangle.LinearCounter = reader.Int()
+}
+
+func (dmc *DMC) SaveBinary(writer *StateWriter){
+    writer.Bool(dmc.Irq)
+    writer.Bool(dmc.Loop)
+    writer.Float64(dmc.Frequency)
+    writer.Float64(dmc.Counter)
+    writer.Uint16(dmc.StartingAddress)
+    writer.Uint16(dmc.Address)
+    writer.Uint16(dmc.Length)
+    writer.Uint16(dmc.BytesRemaining)
+    writer.Byte(dmc.OutputLevel)
+    writer.Bool(dmc.IRQAsserted)
+    writer.Bool(dmc.Silence)
+    writer.Byte(dmc.ShiftRegister)
+    writer.Byte(dmc.BitsRemaining)
+    writer.Byte(dmc.SampleBuffer)
+}
+
+func (dmc *DMC) LoadBinary(reader *StateReader){
+    dmc.Irq = reader.Bool()
+    dmc.Loop = reader.Bool()
+    dmc.Frequency = reader.Float64()
+    dmc.Counter = reader.Float64()
+    dmc.StartingAddress = reader.Uint16()
+    dmc.Address = reader.Uint16()
+    dmc.Length = reader.Uint16()
+    dmc.BytesRemaining = reader.Uint16()
+    dmc.OutputLevel = reader.Byte()
+    dmc.IRQAsserted = reader.Bool()
+    dmc.Silence = reader.Bool()
+    dmc.ShiftRegister = reader.Byte()
+    dmc.BitsRemaining = reader.Byte()
+    dmc.SampleBuffer = reader.Byte()
+}
+
+func (apu *APUState) SaveBinary(writer *StateWriter){
+    writer.Float64(apu.Cycles)
+    writer.Uint64(apu.Clock)
+    writer.Bool(apu.FrameMode)
+    writer.Float64(apu.UpdatedFrameCounter)
+    writer.Bool(apu.InterruptInhibit)
+    writer.Bool(apu.FrameIRQAsserted)
+    writer.Float64(apu.SampleCycles)
+
+    writer.Int(len(apu.SampleBuffer))
+    for _, sample := range apu.SampleBuffer {
+        writer.Float32(sample)
+    }
+    writer.Int(apu.SamplePosition)
+
+    apu.Pulse1.SaveBinary(writer)
+    apu.Pulse2.SaveBinary(writer)
+    apu.Triangle.SaveBinary(writer)
+    apu.Noise.SaveBinary(writer)
+    apu.DMC.SaveBinary(writer)
+
+    writer.Bool(apu.EnableNoise)
+    writer.Bool(apu.EnableTriangle)
+    writer.Bool(apu.EnablePulse2)
+    writer.Bool(apu.EnablePulse1)
+    writer.Int(int(apu.Region))
+}
+
+func (apu *APUState) LoadBinary(reader *StateReader){
+    apu.Cycles = reader.Float64()
+    apu.Clock = reader.Uint64()
+    apu.FrameMode = reader.Bool()
+    apu.UpdatedFrameCounter = reader.Float64()
+    apu.InterruptInhibit = reader.Bool()
+    apu.FrameIRQAsserted = reader.Bool()
+    apu.SampleCycles = reader.Float64()
+
+    apu.SampleBuffer = make([]float32, reader.count())
+    for i := range apu.SampleBuffer {
+        apu.SampleBuffer[i] = reader.Float32()
+    }
+    apu.SamplePosition = reader.Int()
+
+    apu.Pulse1.LoadBinary(reader)
+    apu.Pulse2.LoadBinary(reader)
+    apu.Triangle.LoadBinary(reader)
+    apu.Noise.LoadBinary(reader)
+    apu.DMC.LoadBinary(reader)
+
+    apu.EnableNoise = reader.Bool()
+    apu.EnableTriangle = reader.Bool()
+    apu.EnablePulse2 = reader.Bool()
+    apu.EnablePulse1 = reader.Bool()
+
+    apu.Region = RegionNTSC
+    if reader.Version >= 2 {
+        apu.Region = Region(reader.Int())
+    }
+}
+
+func (state *MapperState) SaveBinary(writer *StateWriter) error {
+    mapper, ok := state.Mapper.(BinaryMapper)
+    if !ok {
+        return fmt.Errorf("mapper %v cannot be saved", state.Kind)
+    }
+
+    writer.Int(state.Kind)
+    mapper.SaveBinary(writer)
+    return nil
+}
+
+func (state *MapperState) LoadBinary(reader *StateReader) error {
+    state.Kind = reader.Int()
+
+    var mapper BinaryMapper
+    switch state.Kind {
+        case 0: mapper = &Mapper0{}
+        case 1, 155: mapper = &Mapper1{}
+        case 2: mapper = &Mapper2{}
+        case 3: mapper = &Mapper3{}
+        case 4: mapper = &Mapper4{}
+        case 5: mapper = &Mapper5{}
+        case 7: mapper = &Mapper7{}
+        case 9: mapper = &Mapper9{}
+        case 19: mapper = &Mapper19{}
+        case 20: mapper = &MapperFDS{}
+        case 21, 22, 23, 25: mapper = &MapperVRC4{}
+        case 24: mapper = &Mapper24{}
+        case 26: mapper = &Mapper26{}
+        case 69: mapper = &Mapper69{}
+        case 11: mapper = &Mapper11{}
+        case 34: mapper = &Mapper34{}
+        case 66: mapper = &Mapper66{}
+        case 71: mapper = &Mapper71{}
+        case 79: mapper = &Mapper79{}
+        case 99: mapper = &Mapper99{}
+        case 206: mapper = &Mapper206{}
+        case 232: mapper = &Mapper232{}
+        case 85: mapper = &Mapper85{}
+        default:
+            return fmt.Errorf("could not load mapper. unknown mapper type %v", state.Kind)
+    }
+
+    mapper.LoadBinary(reader)
+    state.Mapper = mapper.(Mapper)
+    return nil
+}
+
+/* serialize everything that json would, except the debug flag */
+func (cpu *CPUState) SaveBinary(writer *StateWriter) error {
+    writer.Byte(cpu.A)
+    writer.Byte(cpu.X)
+    writer.Byte(cpu.Y)
+    writer.Byte(cpu.SP)
+    writer.Uint16(cpu.PC)
+    writer.Byte(cpu.Status)
+    writer.Uint64(cpu.Cycle)
+    writer.Bytes(cpu.Ram)
+    writer.Uint16(cpu.StackBase)
+    cpu.PPU.SaveBinary(writer)
+    cpu.APU.SaveBinary(writer)
+    writer.Int(cpu.StallCycles)
+    err := cpu.Mapper.SaveBinary(writer)
+    if err != nil {
+        return err
+    }
+
+    writer.Bool(cpu.Vs != nil)
+    if cpu.Vs != nil {
+        cpu.Vs.SaveBinary(writer)
+    }
+
+    return nil
+}
+
+func (cpu *CPUState) LoadBinary(reader *StateReader) error {
+    cpu.A = reader.Byte()
+    cpu.X = reader.Byte()
+    cpu.Y = reader.Byte()
+    cpu.SP = reader.Byte()
+    cpu.PC = reader.Uint16()
+    cpu.Status = reader.Byte()
+    cpu.Cycle = reader.Uint64()
+    cpu.Ram = reader.Bytes()
+    cpu.StackBase = reader.Uint16()
+    cpu.PPU.LoadBinary(reader)
+    cpu.APU.LoadBinary(reader)
+    cpu.StallCycles = reader.Int()
+    err := cpu.Mapper.LoadBinary(reader)
+    if err != nil {
+        return err
+    }
+
+    cpu.Vs = nil
+    if reader.Version >= 7 && reader.Bool() {
+        cpu.Vs = &VsSystem{}
+        cpu.Vs.LoadBinary(reader)
+    }
+
+    return reader.Err()
+}
+
+func encodeBinaryState(cpu *CPUState) (*StateWriter, error) {
+    var writer StateWriter
+    writer.data = append(writer.data, binaryStateMagic...)
+    writer.Uint16(BinaryStateVersion)
+
+    err := cpu.SaveBinary(&writer)
+    if err != nil {
+        return nil, err
+    }
+
+    return &writer, nil
+}
+
+/* the binary form of a cpu state, including the header */
+func EncodeBinaryState(cpu *CPUState) ([]byte, error) {
+    writer, err := encodeBinaryState(cpu)
+    if err != nil {
+        return nil, err
+    }
+
+    return writer.Data(), nil
+}
+
+func IsBinaryState(data []byte) bool {
+    return bytes.HasPrefix(data, binaryStateMagic)
+}
+
+func DecodeBinaryState(data []byte) (*CPUState, error) {
+    if !IsBinaryState(data) {
+        return nil, fmt.Errorf("not a binary state")
+    }
+
+    reader := StateReader{
+        data: data[len(binaryStateMagic):],
+    }
+    reader.Version = int(reader.Uint16())
+    if reader.Version > BinaryStateVersion {
+        return nil, fmt.Errorf("binary state version %v is newer than the supported version %v", reader.Version, BinaryStateVersion)
+    }
+
+    var state CPUState
+    err := state.LoadBinary(&reader)
+    if err != nil {
+        return nil, err
+    }
+
+    if len(reader.data) != 0 {
+        return nil, fmt.Errorf("binary state has %v extra bytes", len(reader.data))
+    }
+
+    return &state, nil
+}
@@ -729,6 +729,10 @@ type Input struct {
     Buttons []bool
     NextRead byte
     Host HostInput
+    /* while the strobe bit is set the controller keeps reloading its buttons,
+     * and reads always return the state of A
+     */
+    Strobe bool
 
     LastButtons []bool
     RecordInput bool
@@ -748,12 +752,31 @@ func (input *Input) Reset() {
     input.Buttons[ButtonIndexRight] = mapping[ButtonIndexRight]
 }
 
+/* a write to 0x4016. polls the host for the current buttons and restarts the shift register */
+func (input *Input) Write(value byte) {
+    input.Reset()
+    input.NextRead = 0
+    input.Strobe = value & 1 == 1
+}
+
 func (input *Input) Read() byte {
+    if input.Strobe {
+        if input.Buttons[ButtonIndexA] {
+            return 1
+        }
+        return 0
+    }
+
+    /* a standard controller returns 1 after all 8 buttons have been read */
+    if input.NextRead >= 8 {
+        return 1
+    }
+
     var out byte
     if input.Buttons[input.NextRead] {
         out = 1
     }
-    input.NextRead = (input.NextRead + 1) % 8
+    input.NextRead += 1
     return out
 }
 
@@ -840,21 +863,28 @@ type CPUState struct {
 
     /* controller input */
     Input *Input `json:"-"`
+    /* second controller, read from 0x4017. can be nil if nothing is plugged in */
+    Input2 *Input `json:"-"`
 
     Mapper MapperState `json:"mapper"`
 
+    /* the coin slots and dip switches of a vs. system cabinet, nil for other consoles */
+    Vs *VsSystem `json:"vs,omitempty"`
+
     // a single allocated instruction that is reused for each Run() call
     instruction Instruction
 }
 
 func (cpu *CPUState) Load(other *CPUState){
     input := cpu.Input
+    input2 := cpu.Input2
     audioStreams := cpu.APU.AudioStreams
     for _, stream := range audioStreams {
         stream.Clear()
     }
     *cpu = other.Copy()
     cpu.Input = input
+    cpu.Input2 = input2
     cpu.APU.AudioStreams = audioStreams
     cpu.Maps = make([][]byte, 256)
 
@@ -885,10 +915,25 @@ func (cpu *CPUState) Copy() CPUState {
         Debug: cpu.Debug,
         StallCycles: cpu.StallCycles,
         Input: nil,
+        Input2: nil,
         Mapper: mapper,
+        Vs: cpu.Vs.Copy(),
     }
 }
 
+/* the ppu and apu both need to know the region, so they each keep a copy of it */
+func (cpu *CPUState) SetRegion(region Region){
+    cpu.PPU.Region = region
+    cpu.APU.Region = region
+    if regional, ok := cpu.Mapper.Mapper.(RegionMapper); ok {
+        regional.SetRegion(region)
+    }
+}
+
+func (cpu *CPUState) GetRegion() Region {
+    return cpu.PPU.Region
+}
+
 func (cpu *CPUState) Compare(other *CPUState) error {
     return cpu.Mapper.Compare(other.Mapper)
 }
@@ -956,6 +1001,25 @@ func (cpu *CPUState) PopStack() byte {
     return cpu.LoadStack(cpu.SP)
 }
 
+/* $4016 reads the first controller and $4017 the second, unless a vs. system game has them swapped */
+func (cpu *CPUState) readController(address uint16) byte {
+    input := cpu.Input
+    if (address == JOYPAD2) != (cpu.Vs != nil && cpu.Vs.SwapControllers) {
+        input = cpu.Input2
+    }
+
+    var value byte
+    if input != nil {
+        value = input.Read()
+    }
+
+    if cpu.Vs != nil {
+        return cpu.Vs.Read(address, value, cpu.Cycle)
+    }
+
+    return value
+}
+
 func (cpu *CPUState) LoadMemory(address uint16) byte {
     // large := uint64(address)
 
@@ -971,11 +1035,11 @@ func (cpu *CPUState) LoadMemory(address uint16) byte {
                 log.Printf("Warning: reading from PPUMASK location is not allowed\n")
                 return 0
             case PPUDATA:
-                return cpu.PPU.ReadVideoMemory()
+                return cpu.PPU.ReadVideoMemory(cpu.Mapper.Mapper)
             case PPUSTATUS:
                 return cpu.PPU.ReadStatus()
             case OAMDATA:
-                return cpu.PPU.ReadOAM(byte(address))
+                return cpu.PPU.ReadOAM()
         }
 
         log.Printf("Unhandled PPU read to 0x%x\n", address)
@@ -983,15 +1047,19 @@ func (cpu *CPUState) LoadMemory(address uint16) byte {
     }
 
     switch address {
-        case JOYPAD1:
-            return cpu.Input.Read()
-        case JOYPAD2:
-            /* FIXME: handle player 2 input */
-            return 0
+        case JOYPAD1, JOYPAD2:
+            return cpu.readController(address)
         case APUStatus:
             return cpu.APU.ReadStatus()
     }
 
+    if address >= 0x4020 && page < 0x60 {
+        expansion, ok := cpu.Mapper.Mapper.(ExpansionMapper)
+        if ok {
+            return expansion.ReadExpansion(address)
+        }
+    }
+
     if page >= 0x60 {
         if cpu.Mapper.Mapper == nil {
             log.Printf("No mapper set, cannot read from mapper memory: 0x%x", address)
@@ -1070,6 +1138,9 @@ const (
 
 func (cpu *CPUState) SetMapper(mapper Mapper){
     cpu.Mapper.Set(mapper)
+    if regional, ok := mapper.(RegionMapper); ok {
+        regional.SetRegion(cpu.GetRegion())
+    }
     // mapper.Initialize(cpu)
 }
 
@@ -1131,8 +1202,7 @@ func (cpu *CPUState) StoreMemory(address uint16, value byte) {
     page := address >> 8
     if page >= 0x20 && page < 0x40 {
         /* every 8 bytes is mirrored, so only consider the last 3-bits of the address */
-        use := address & 0x7
-        switch 0x2000 | use {
+        switch cpu.PPU.registerAddress(address) {
             case PPUCTRL:
                 if cpu.Cycle > ignore_ppu_write_cycle {
                     cpu.PPU.SetControllerFlags(value)
@@ -1166,7 +1236,7 @@ func (cpu *CPUState) StoreMemory(address uint16, value byte) {
                 }
                 return
             case PPUDATA:
-                cpu.PPU.WriteVideoMemory(value)
+                cpu.PPU.WriteVideoMemory(value, cpu.Mapper.Mapper)
                 return
             case OAMADDR:
                 cpu.PPU.SetOAMAddress(value)
@@ -1252,7 +1322,14 @@ func (cpu *CPUState) StoreMemory(address uint16, value byte) {
             cpu.APU.WriteDMCLength(value)
             return
         case INPUT_POLL:
-            cpu.Input.Reset()
+            /* both controllers share the strobe line */
+            if cpu.Input2 != nil {
+                cpu.Input2.Write(value)
+            }
+            cpu.Input.Write(value)
+            if poll, ok := cpu.Mapper.Mapper.(InputPollMapper); ok {
+                poll.WriteInputPoll(cpu, value)
+            }
             if cpu.Input.RecordInput {
                 // showInputDifference(cpu.Cycle, cpu.Input.LastButtons, cpu.Input.Buttons)
                 out := make(map[Button]bool)
@@ -1279,6 +1356,19 @@ func (cpu *CPUState) StoreMemory(address uint16, value byte) {
             return
     }
 
+    if address == 0x4020 && cpu.Vs != nil {
+        cpu.Vs.CoinCounter = value
+        return
+    }
+
+    if address >= 0x4020 && address < 0x6000 {
+        expansion, ok := cpu.Mapper.Mapper.(ExpansionMapper)
+        if ok {
+            expansion.WriteExpansion(cpu, address, value)
+            return
+        }
+    }
+
     if address >= 0x6000 || (cpu.Mapper.Mapper != nil && cpu.Mapper.Mapper.IsNSF() && address >= 0x5ff6 && address < 0x6000) {
         err := cpu.Mapper.Mapper.Write(cpu, address, value)
         if err != nil {
@@ -1561,6 +1651,17 @@ func (cpu *CPUState) doInc(value byte) byte {
     return value
 }
 
+/* read-modify-write instructions write the unmodified value back one cycle before writing the
+ * result. only the cartridge can tell the difference, the mmc1 for example ignores the second
+ * write, so the extra write is only made to mapper addresses.
+ */
+func (cpu *CPUState) storeModified(address uint16, old byte, value byte){
+    if address >= 0x4020 {
+        cpu.StoreMemory(address, old)
+    }
+    cpu.StoreMemory(address, value)
+}
+
 func (cpu *CPUState) doDec(value byte) byte {
     value = value - 1
     cpu.SetNegativeFlag(int8(value) < 0)
@@ -3221,7 +3322,7 @@ func (cpu *CPUState) Execute(instruction Instruction) error {
             }
             address := uint16(zero + cpu.X)
             value := cpu.LoadMemory(address)
-            cpu.StoreMemory(address, cpu.doLsr(value))
+            cpu.storeModified(address, value, cpu.doLsr(value))
             cpu.Cycle += 6
             cpu.PC += instruction.Length()
             return nil
@@ -3231,7 +3332,7 @@ func (cpu *CPUState) Execute(instruction Instruction) error {
                 return err
             }
             value := cpu.LoadMemory(uint16(address))
-            cpu.StoreMemory(uint16(address), cpu.doLsr(value))
+            cpu.storeModified(uint16(address), value, cpu.doLsr(value))
             cpu.PC += instruction.Length()
             cpu.Cycle += 5
             return nil
@@ -3242,7 +3343,7 @@ func (cpu *CPUState) Execute(instruction Instruction) error {
             }
             full := address + uint16(cpu.X)
             value := cpu.LoadMemory(full)
-            cpu.StoreMemory(full, cpu.doLsr(value))
+            cpu.storeModified(full, value, cpu.doLsr(value))
             cpu.PC += instruction.Length()
             cpu.Cycle += 7
             return nil
@@ -3252,7 +3353,7 @@ func (cpu *CPUState) Execute(instruction Instruction) error {
                 return err
             }
             value := cpu.LoadMemory(address)
-            cpu.StoreMemory(address, cpu.doLsr(value))
+            cpu.storeModified(address, value, cpu.doLsr(value))
             cpu.PC += instruction.Length()
             cpu.Cycle += 6
             return nil
@@ -3268,7 +3369,7 @@ func (cpu *CPUState) Execute(instruction Instruction) error {
             }
             full := address + uint16(cpu.X)
             value := cpu.LoadMemory(full)
-            cpu.StoreMemory(full, cpu.doAsl(value))
+            cpu.storeModified(full, value, cpu.doAsl(value))
             cpu.PC += instruction.Length()
             cpu.Cycle += 7
             return nil
@@ -3278,7 +3379,7 @@ func (cpu *CPUState) Execute(instruction Instruction) error {
                 return err
             }
             value := cpu.LoadMemory(address)
-            cpu.StoreMemory(address, cpu.doAsl(value))
+            cpu.storeModified(address, value, cpu.doAsl(value))
             cpu.PC += instruction.Length()
             cpu.Cycle += 6
             return nil
@@ -3289,7 +3390,7 @@ func (cpu *CPUState) Execute(instruction Instruction) error {
             }
             address := uint16(zero + cpu.X)
             value := cpu.LoadMemory(address)
-            cpu.StoreMemory(address, cpu.doAsl(value))
+            cpu.storeModified(address, value, cpu.doAsl(value))
             cpu.PC += instruction.Length()
             cpu.Cycle += 6
             return nil
@@ -3299,7 +3400,7 @@ func (cpu *CPUState) Execute(instruction Instruction) error {
                 return err
             }
             value := cpu.LoadMemory(uint16(address))
-            cpu.StoreMemory(uint16(address), cpu.doAsl(value))
+            cpu.storeModified(uint16(address), value, cpu.doAsl(value))
             cpu.PC += instruction.Length()
             cpu.Cycle += 5
             return nil
@@ -3525,7 +3626,7 @@ func (cpu *CPUState) Execute(instruction Instruction) error {
             }
             full := address + uint16(cpu.X)
             value := cpu.LoadMemory(full)
-            cpu.StoreMemory(full, cpu.doDec(value))
+            cpu.storeModified(full, value, cpu.doDec(value))
             cpu.PC += instruction.Length()
             cpu.Cycle += 7
             return nil
@@ -3535,7 +3636,7 @@ func (cpu *CPUState) Execute(instruction Instruction) error {
                 return err
             }
             value := cpu.LoadMemory(address)
-            cpu.StoreMemory(address, cpu.doDec(value))
+            cpu.storeModified(address, value, cpu.doDec(value))
             cpu.PC += instruction.Length()
             cpu.Cycle += 6
             return nil
@@ -3546,7 +3647,7 @@ func (cpu *CPUState) Execute(instruction Instruction) error {
             }
             address := uint16(zero + cpu.X)
             value := cpu.LoadMemory(address)
-            cpu.StoreMemory(address, cpu.doDec(value))
+            cpu.storeModified(address, value, cpu.doDec(value))
             cpu.Cycle += 6
             cpu.PC += instruction.Length()
             return nil
@@ -3556,7 +3657,7 @@ func (cpu *CPUState) Execute(instruction Instruction) error {
                 return err
             }
             value := cpu.LoadMemory(uint16(address))
-            cpu.StoreMemory(uint16(address), cpu.doDec(value))
+            cpu.storeModified(uint16(address), value, cpu.doDec(value))
             cpu.PC += instruction.Length()
             cpu.Cycle += 5
             return nil
@@ -3567,7 +3668,7 @@ func (cpu *CPUState) Execute(instruction Instruction) error {
             }
             full := address + uint16(cpu.X)
             value := cpu.LoadMemory(full)
-            cpu.StoreMemory(full, cpu.doInc(value))
+            cpu.storeModified(full, value, cpu.doInc(value))
             cpu.PC += instruction.Length()
             cpu.Cycle += 7
             return nil
@@ -3577,7 +3678,7 @@ func (cpu *CPUState) Execute(instruction Instruction) error {
                 return err
             }
             value := cpu.LoadMemory(address)
-            cpu.StoreMemory(address, cpu.doInc(value))
+            cpu.storeModified(address, value, cpu.doInc(value))
             cpu.PC += instruction.Length()
             cpu.Cycle += 6
             return nil
@@ -3588,7 +3689,7 @@ func (cpu *CPUState) Execute(instruction Instruction) error {
             }
             address := uint16(zero + cpu.X)
             value := cpu.LoadMemory(address)
-            cpu.StoreMemory(address, cpu.doInc(value))
+            cpu.storeModified(address, value, cpu.doInc(value))
             cpu.Cycle += 6
             cpu.PC += instruction.Length()
             return nil
@@ -3598,7 +3699,7 @@ func (cpu *CPUState) Execute(instruction Instruction) error {
                 return err
             }
             value := cpu.LoadMemory(uint16(address))
-            cpu.StoreMemory(uint16(address), cpu.doInc(value))
+            cpu.storeModified(uint16(address), value, cpu.doInc(value))
             cpu.PC += instruction.Length()
             cpu.Cycle += 5
             return nil
@@ -3609,7 +3710,7 @@ func (cpu *CPUState) Execute(instruction Instruction) error {
             }
             full := address + uint16(cpu.X)
             value := cpu.LoadMemory(full)
-            cpu.StoreMemory(full, cpu.doRol(value))
+            cpu.storeModified(full, value, cpu.doRol(value))
             cpu.PC += instruction.Length()
             cpu.Cycle += 7
             return nil
@@ -3619,7 +3720,7 @@ func (cpu *CPUState) Execute(instruction Instruction) error {
                 return err
             }
             value := cpu.LoadMemory(address)
-            cpu.StoreMemory(address, cpu.doRol(value))
+            cpu.storeModified(address, value, cpu.doRol(value))
             cpu.PC += instruction.Length()
             cpu.Cycle += 6
             return nil
@@ -3630,7 +3731,7 @@ func (cpu *CPUState) Execute(instruction Instruction) error {
             }
             address := uint16(zero + cpu.X)
             value := cpu.LoadMemory(address)
-            cpu.StoreMemory(address, cpu.doRol(value))
+            cpu.storeModified(address, value, cpu.doRol(value))
             cpu.Cycle += 6
             cpu.PC += instruction.Length()
             return nil
@@ -3640,7 +3741,7 @@ func (cpu *CPUState) Execute(instruction Instruction) error {
                 return err
             }
             value := cpu.LoadMemory(uint16(address))
-            cpu.StoreMemory(uint16(address), cpu.doRol(value))
+            cpu.storeModified(uint16(address), value, cpu.doRol(value))
             cpu.PC += instruction.Length()
             cpu.Cycle += 5
             return nil
@@ -3656,7 +3757,7 @@ func (cpu *CPUState) Execute(instruction Instruction) error {
             }
             full := address + uint16(cpu.X)
             value := cpu.LoadMemory(full)
-            cpu.StoreMemory(full, cpu.doRor(value))
+            cpu.storeModified(full, value, cpu.doRor(value))
             cpu.PC += instruction.Length()
             cpu.Cycle += 7
             return nil
@@ -3666,7 +3767,7 @@ func (cpu *CPUState) Execute(instruction Instruction) error {
                 return err
             }
             value := cpu.LoadMemory(address)
-            cpu.StoreMemory(address, cpu.doRor(value))
+            cpu.storeModified(address, value, cpu.doRor(value))
             cpu.Cycle += 6
             cpu.PC += instruction.Length()
             return nil
@@ -3677,7 +3778,7 @@ func (cpu *CPUState) Execute(instruction Instruction) error {
             }
             address := uint16(zero + cpu.X)
             value := cpu.LoadMemory(address)
-            cpu.StoreMemory(address, cpu.doRor(value))
+            cpu.storeModified(address, value, cpu.doRor(value))
             cpu.Cycle += 6
             cpu.PC += instruction.Length()
             return nil
@@ -3687,7 +3788,7 @@ func (cpu *CPUState) Execute(instruction Instruction) error {
                 return err
             }
             value := cpu.LoadMemory(uint16(address))
-            cpu.StoreMemory(uint16(address), cpu.doRor(value))
+            cpu.storeModified(uint16(address), value, cpu.doRor(value))
             cpu.Cycle += 5
             cpu.PC += instruction.Length()
             return nil
@@ -670,6 +670,52 @@ func TestBit(testing *testing.T){
     }
 }
 
+type testButtons struct {
+    mapping ButtonMapping
+}
+
+func (buttons *testButtons) Get() ButtonMapping {
+    return buttons.mapping
+}
+
+/* each controller has its own shift register, but both share the strobe at 0x4016 */
+func TestTwoControllers(test *testing.T){
+    cpu := StartupState()
+    cpu.Input = MakeInput(&testButtons{mapping: ButtonMapping{ButtonIndexA: true, ButtonIndexRight: true}})
+    cpu.Input2 = MakeInput(&testButtons{mapping: ButtonMapping{ButtonIndexB: true, ButtonIndexStart: true}})
+
+    cpu.StoreMemory(INPUT_POLL, 1)
+    cpu.StoreMemory(INPUT_POLL, 0)
+
+    expected1 := []byte{1, 0, 0, 0, 0, 0, 0, 1}
+    expected2 := []byte{0, 1, 0, 1, 0, 0, 0, 0}
+
+    /* interleave the reads to make sure the controllers don't share state */
+    for i := 0; i < 8; i++ {
+        value1 := cpu.LoadMemory(JOYPAD1)
+        value2 := cpu.LoadMemory(JOYPAD2)
+        if value1 != expected1[i] {
+            test.Fatalf("player 1 button %v: expected %v but got %v", i, expected1[i], value1)
+        }
+        if value2 != expected2[i] {
+            test.Fatalf("player 2 button %v: expected %v but got %v", i, expected2[i], value2)
+        }
+    }
+
+    /* reading past the 8 buttons returns 1 */
+    if cpu.LoadMemory(JOYPAD1) != 1 || cpu.LoadMemory(JOYPAD2) != 1 {
+        test.Fatalf("expected 1 after all buttons were read")
+    }
+
+    /* while strobing, reads keep returning the A button */
+    cpu.StoreMemory(INPUT_POLL, 1)
+    for i := 0; i < 3; i++ {
+        if cpu.LoadMemory(JOYPAD1) != 1 || cpu.LoadMemory(JOYPAD2) != 0 {
+            test.Fatalf("expected the A button while strobing")
+        }
+    }
+}
+
 func BenchmarkSimple(benchmark *testing.B){
     bytes := []byte{
         0xa2, 0x02, // ldx #$02
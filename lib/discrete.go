@@ -0,0 +1,803 @@
+package lib
+
+import (
+    "fmt"
+)
+
+/* Mappers built from a handful of discrete logic chips. They are mostly a latch that holds
+ * a prg bank and a chr bank, and differ in which bits of the written value select what.
+ */
+
+/* read a ppu address where the pattern table address is in a chr bank of size bytes. chr ram
+ * boards have no chr rom and use the ppu's memory instead
+ */
+func readChrBank(ppu *PPUState, characterRom []byte, address uint16, bank int, size int) byte {
+    if address >= 0x2000 {
+        return ppu.LoadNametableMemory(address)
+    }
+
+    if len(characterRom) == 0 {
+        return ppu.VideoMemory[address]
+    }
+
+    return characterRom[(bank * size + int(address) % size) % len(characterRom)]
+}
+
+func writeChrBank(ppu *PPUState, characterRom []byte, address uint16, value byte){
+    if address >= 0x2000 {
+        ppu.StoreNametableMemory(address, value)
+        return
+    }
+
+    if len(characterRom) == 0 {
+        ppu.VideoMemory[address] = value
+    }
+}
+
+/* read from a bank of size bytes, where the bank number wraps around the size of the rom */
+func readBank(rom []byte, bank int, size int, offset uint16) byte {
+    if len(rom) == 0 {
+        return 0
+    }
+
+    return rom[(bank * size + int(offset)) % len(rom)]
+}
+
+/* Color Dreams (mapper 11). One register at $8000-$ffff with a 32k prg bank in bits 0-1 and
+ * an 8k chr bank in bits 4-7.
+ */
+type Mapper11 struct {
+    ProgramRom []byte `json:"programrom"`
+    CharacterRom []byte `json:"characterrom"`
+    PrgBank byte `json:"prgbank"`
+    ChrBank byte `json:"chrbank"`
+}
+
+func (mapper *Mapper11) IsNSF() bool {
+    return false
+}
+
+func (mapper *Mapper11) Kind() int {
+    return 11
+}
+
+func (mapper *Mapper11) Compare(other Mapper) error {
+    him, ok := other.(*Mapper11)
+    if !ok {
+        return fmt.Errorf("other was not a mapper11")
+    }
+
+    if mapper.PrgBank != him.PrgBank || mapper.ChrBank != him.ChrBank {
+        return fmt.Errorf("banks differ: me=%v/%v him=%v/%v", mapper.PrgBank, mapper.ChrBank, him.PrgBank, him.ChrBank)
+    }
+
+    return compareSlice(mapper.ProgramRom, him.ProgramRom)
+}
+
+func (mapper *Mapper11) Copy() Mapper {
+    return &Mapper11{
+        ProgramRom: copySlice(mapper.ProgramRom),
+        CharacterRom: copySlice(mapper.CharacterRom),
+        PrgBank: mapper.PrgBank,
+        ChrBank: mapper.ChrBank,
+    }
+}
+
+func (mapper *Mapper11) SaveBinary(writer *StateWriter){
+    writer.Bytes(mapper.ProgramRom)
+    writer.Bytes(mapper.CharacterRom)
+    writer.Byte(mapper.PrgBank)
+    writer.Byte(mapper.ChrBank)
+}
+
+func (mapper *Mapper11) LoadBinary(reader *StateReader){
+    mapper.ProgramRom = reader.Bytes()
+    mapper.CharacterRom = reader.Bytes()
+    mapper.PrgBank = reader.Byte()
+    mapper.ChrBank = reader.Byte()
+}
+
+func (mapper *Mapper11) IsIRQAsserted() bool {
+    return false
+}
+
+func (mapper *Mapper11) Read(address uint16) byte {
+    if address >= 0x8000 {
+        return readBank(mapper.ProgramRom, int(mapper.PrgBank), 0x8000, address - 0x8000)
+    }
+
+    return 0
+}
+
+func (mapper *Mapper11) ReadPPU(ppu *PPUState, address uint16) byte {
+    return readChrBank(ppu, mapper.CharacterRom, address, int(mapper.ChrBank), 0x2000)
+}
+
+func (mapper *Mapper11) WritePPU(ppu *PPUState, address uint16, value byte){
+    writeChrBank(ppu, mapper.CharacterRom, address, value)
+}
+
+func (mapper *Mapper11) Write(cpu *CPUState, address uint16, value byte) error {
+    if address >= 0x8000 {
+        mapper.PrgBank = value & 0x3
+        mapper.ChrBank = value >> 4
+        return nil
+    }
+
+    return fmt.Errorf("invalid mapper11 write address=0x%x value=0x%x", address, value)
+}
+
+func MakeMapper11(programRom []byte, chrMemory []byte) Mapper {
+    return &Mapper11{
+        ProgramRom: programRom,
+        CharacterRom: chrMemory,
+    }
+}
+
+/* BNROM and NINA-001 (mapper 34). BNROM has a single 32k prg register at $8000-$ffff and chr
+ * ram, while the NINA-001 has prg ram with its registers at the top of it: $7ffd selects the 32k
+ * prg bank, and $7ffe and $7fff select the 4k chr banks.
+ */
+type Mapper34 struct {
+    ProgramRom []byte `json:"programrom"`
+    CharacterRom []byte `json:"characterrom"`
+    PRGRam []byte `json:"prgram"`
+    Nina bool `json:"nina"`
+    PrgBank byte `json:"prgbank"`
+    ChrBank [2]byte `json:"chrbank"`
+}
+
+func (mapper *Mapper34) IsNSF() bool {
+    return false
+}
+
+func (mapper *Mapper34) Kind() int {
+    return 34
+}
+
+func (mapper *Mapper34) Compare(other Mapper) error {
+    him, ok := other.(*Mapper34)
+    if !ok {
+        return fmt.Errorf("other was not a mapper34")
+    }
+
+    if mapper.Nina != him.Nina {
+        return fmt.Errorf("board differs: me nina=%v him nina=%v", mapper.Nina, him.Nina)
+    }
+
+    if mapper.PrgBank != him.PrgBank || mapper.ChrBank != him.ChrBank {
+        return fmt.Errorf("banks differ: me=%v/%v him=%v/%v", mapper.PrgBank, mapper.ChrBank, him.PrgBank, him.ChrBank)
+    }
+
+    return compareSlice(mapper.PRGRam, him.PRGRam)
+}
+
+func (mapper *Mapper34) Copy() Mapper {
+    return &Mapper34{
+        ProgramRom: copySlice(mapper.ProgramRom),
+        CharacterRom: copySlice(mapper.CharacterRom),
+        PRGRam: copySlice(mapper.PRGRam),
+        Nina: mapper.Nina,
+        PrgBank: mapper.PrgBank,
+        ChrBank: mapper.ChrBank,
+    }
+}
+
+func (mapper *Mapper34) SaveBinary(writer *StateWriter){
+    writer.Bytes(mapper.ProgramRom)
+    writer.Bytes(mapper.CharacterRom)
+    writer.Bytes(mapper.PRGRam)
+    writer.Bool(mapper.Nina)
+    writer.Byte(mapper.PrgBank)
+    writer.Byte(mapper.ChrBank[0])
+    writer.Byte(mapper.ChrBank[1])
+}
+
+func (mapper *Mapper34) LoadBinary(reader *StateReader){
+    mapper.ProgramRom = reader.Bytes()
+    mapper.CharacterRom = reader.Bytes()
+    mapper.PRGRam = reader.Bytes()
+    mapper.Nina = reader.Bool()
+    mapper.PrgBank = reader.Byte()
+    mapper.ChrBank[0] = reader.Byte()
+    mapper.ChrBank[1] = reader.Byte()
+}
+
+func (mapper *Mapper34) IsIRQAsserted() bool {
+    return false
+}
+
+func (mapper *Mapper34) GetPRGRam() []byte {
+    return mapper.PRGRam
+}
+
+func (mapper *Mapper34) Read(address uint16) byte {
+    if address >= 0x6000 && address < 0x8000 {
+        if len(mapper.PRGRam) > 0 {
+            return mapper.PRGRam[int(address - 0x6000) % len(mapper.PRGRam)]
+        }
+        return 0
+    }
+
+    if address >= 0x8000 {
+        return readBank(mapper.ProgramRom, int(mapper.PrgBank), 0x8000, address - 0x8000)
+    }
+
+    return 0
+}
+
+func (mapper *Mapper34) ReadPPU(ppu *PPUState, address uint16) byte {
+    if address < 0x1000 {
+        return readChrBank(ppu, mapper.CharacterRom, address, int(mapper.ChrBank[0]), 0x1000)
+    }
+    return readChrBank(ppu, mapper.CharacterRom, address, int(mapper.ChrBank[1]), 0x1000)
+}
+
+func (mapper *Mapper34) WritePPU(ppu *PPUState, address uint16, value byte){
+    writeChrBank(ppu, mapper.CharacterRom, address, value)
+}
+
+func (mapper *Mapper34) Write(cpu *CPUState, address uint16, value byte) error {
+    if address >= 0x6000 && address < 0x8000 {
+        if len(mapper.PRGRam) > 0 {
+            mapper.PRGRam[int(address - 0x6000) % len(mapper.PRGRam)] = value
+        }
+
+        if mapper.Nina {
+            switch address {
+                case 0x7ffd:
+                    mapper.PrgBank = value & 0x1
+                case 0x7ffe:
+                    mapper.ChrBank[0] = value & 0xf
+                case 0x7fff:
+                    mapper.ChrBank[1] = value & 0xf
+            }
+        }
+
+        return nil
+    }
+
+    if address >= 0x8000 {
+        if !mapper.Nina {
+            mapper.PrgBank = value
+        }
+        return nil
+    }
+
+    return fmt.Errorf("invalid mapper34 write address=0x%x value=0x%x", address, value)
+}
+
+/* submapper 1 is the NINA-001 and 2 is BNROM. Otherwise only the NINA-001 has more than 8k of chr */
+func MakeMapper34(info MapperInfo, programRom []byte, chrMemory []byte) Mapper {
+    nina := len(chrMemory) > 0x2000
+    switch info.Submapper {
+        case 1: nina = true
+        case 2: nina = false
+    }
+
+    ramSize := 0x2000
+    if info.Nes2 {
+        ramSize = info.TotalPRGRam()
+    }
+
+    return &Mapper34{
+        ProgramRom: programRom,
+        CharacterRom: chrMemory,
+        PRGRam: make([]byte, ramSize),
+        Nina: nina,
+    }
+}
+
+/* GxROM (mapper 66). One register at $8000-$ffff with a 32k prg bank in bits 4-5 and an 8k chr
+ * bank in bits 0-1.
+ */
+type Mapper66 struct {
+    ProgramRom []byte `json:"programrom"`
+    CharacterRom []byte `json:"characterrom"`
+    PrgBank byte `json:"prgbank"`
+    ChrBank byte `json:"chrbank"`
+}
+
+func (mapper *Mapper66) IsNSF() bool {
+    return false
+}
+
+func (mapper *Mapper66) Kind() int {
+    return 66
+}
+
+func (mapper *Mapper66) Compare(other Mapper) error {
+    him, ok := other.(*Mapper66)
+    if !ok {
+        return fmt.Errorf("other was not a mapper66")
+    }
+
+    if mapper.PrgBank != him.PrgBank || mapper.ChrBank != him.ChrBank {
+        return fmt.Errorf("banks differ: me=%v/%v him=%v/%v", mapper.PrgBank, mapper.ChrBank, him.PrgBank, him.ChrBank)
+    }
+
+    return compareSlice(mapper.ProgramRom, him.ProgramRom)
+}
+
+func (mapper *Mapper66) Copy() Mapper {
+    return &Mapper66{
+        ProgramRom: copySlice(mapper.ProgramRom),
+        CharacterRom: copySlice(mapper.CharacterRom),
+        PrgBank: mapper.PrgBank,
+        ChrBank: mapper.ChrBank,
+    }
+}
+
+func (mapper *Mapper66) SaveBinary(writer *StateWriter){
+    writer.Bytes(mapper.ProgramRom)
+    writer.Bytes(mapper.CharacterRom)
+    writer.Byte(mapper.PrgBank)
+    writer.Byte(mapper.ChrBank)
+}
+
+func (mapper *Mapper66) LoadBinary(reader *StateReader){
+    mapper.ProgramRom = reader.Bytes()
+    mapper.CharacterRom = reader.Bytes()
+    mapper.PrgBank = reader.Byte()
+    mapper.ChrBank = reader.Byte()
+}
+
+func (mapper *Mapper66) IsIRQAsserted() bool {
+    return false
+}
+
+func (mapper *Mapper66) Read(address uint16) byte {
+    if address >= 0x8000 {
+        return readBank(mapper.ProgramRom, int(mapper.PrgBank), 0x8000, address - 0x8000)
+    }
+
+    return 0
+}
+
+func (mapper *Mapper66) ReadPPU(ppu *PPUState, address uint16) byte {
+    return readChrBank(ppu, mapper.CharacterRom, address, int(mapper.ChrBank), 0x2000)
+}
+
+func (mapper *Mapper66) WritePPU(ppu *PPUState, address uint16, value byte){
+    writeChrBank(ppu, mapper.CharacterRom, address, value)
+}
+
+func (mapper *Mapper66) Write(cpu *CPUState, address uint16, value byte) error {
+    if address >= 0x8000 {
+        mapper.PrgBank = (value >> 4) & 0x3
+        mapper.ChrBank = value & 0x3
+        return nil
+    }
+
+    return fmt.Errorf("invalid mapper66 write address=0x%x value=0x%x", address, value)
+}
+
+func MakeMapper66(programRom []byte, chrMemory []byte) Mapper {
+    return &Mapper66{
+        ProgramRom: programRom,
+        CharacterRom: chrMemory,
+    }
+}
+
+/* Camerica/Codemasters (mapper 71). Like UxROM the last 16k bank is fixed at $c000, and writes
+ * to $c000-$ffff select the 16k bank at $8000. Fire Hawk (submapper 1) also selects a single
+ * screen nametable with bit 4 of writes to $8000-$9fff, and other games write there too so iNES
+ * roms only take the mirroring from $9000-$9fff.
+ */
+type Mapper71 struct {
+    ProgramRom []byte `json:"programrom"`
+    Bank byte `json:"bank"`
+    MirrorWrites bool `json:"mirrorwrites"`
+}
+
+func (mapper *Mapper71) IsNSF() bool {
+    return false
+}
+
+func (mapper *Mapper71) Kind() int {
+    return 71
+}
+
+func (mapper *Mapper71) Compare(other Mapper) error {
+    him, ok := other.(*Mapper71)
+    if !ok {
+        return fmt.Errorf("other was not a mapper71")
+    }
+
+    if mapper.Bank != him.Bank {
+        return fmt.Errorf("bank differs: me=%v him=%v", mapper.Bank, him.Bank)
+    }
+
+    return compareSlice(mapper.ProgramRom, him.ProgramRom)
+}
+
+func (mapper *Mapper71) Copy() Mapper {
+    return &Mapper71{
+        ProgramRom: copySlice(mapper.ProgramRom),
+        Bank: mapper.Bank,
+        MirrorWrites: mapper.MirrorWrites,
+    }
+}
+
+func (mapper *Mapper71) SaveBinary(writer *StateWriter){
+    writer.Bytes(mapper.ProgramRom)
+    writer.Byte(mapper.Bank)
+    writer.Bool(mapper.MirrorWrites)
+}
+
+func (mapper *Mapper71) LoadBinary(reader *StateReader){
+    mapper.ProgramRom = reader.Bytes()
+    mapper.Bank = reader.Byte()
+    mapper.MirrorWrites = reader.Bool()
+}
+
+func (mapper *Mapper71) IsIRQAsserted() bool {
+    return false
+}
+
+func (mapper *Mapper71) Read(address uint16) byte {
+    switch {
+        case address >= 0xc000:
+            return readBank(mapper.ProgramRom, len(mapper.ProgramRom) / 0x4000 - 1, 0x4000, address - 0xc000)
+        case address >= 0x8000:
+            return readBank(mapper.ProgramRom, int(mapper.Bank), 0x4000, address - 0x8000)
+    }
+
+    return 0
+}
+
+func (mapper *Mapper71) Write(cpu *CPUState, address uint16, value byte) error {
+    switch {
+        case address >= 0xc000:
+            mapper.Bank = value & 0xf
+        case address >= 0xa000:
+            /* nothing is mapped at $a000-$bfff */
+        case address >= 0x9000 || (address >= 0x8000 && mapper.MirrorWrites):
+            if value & 0x10 == 0 {
+                cpu.PPU.SetScreenAMirror()
+            } else {
+                cpu.PPU.SetScreenBMirror()
+            }
+        case address >= 0x8000:
+        default:
+            return fmt.Errorf("invalid mapper71 write address=0x%x value=0x%x", address, value)
+    }
+
+    return nil
+}
+
+func MakeMapper71(info MapperInfo, programRom []byte) Mapper {
+    return &Mapper71{
+        ProgramRom: programRom,
+        MirrorWrites: info.Submapper == 1,
+    }
+}
+
+/* NINA-03/NINA-06 (mapper 79). The register is in the expansion area, at addresses in
+ * $4100-$5fff where a8 is set, and holds a 32k prg bank in bit 3 and an 8k chr bank in bits 0-2.
+ */
+type Mapper79 struct {
+    ProgramRom []byte `json:"programrom"`
+    CharacterRom []byte `json:"characterrom"`
+    PrgBank byte `json:"prgbank"`
+    ChrBank byte `json:"chrbank"`
+}
+
+func (mapper *Mapper79) IsNSF() bool {
+    return false
+}
+
+func (mapper *Mapper79) Kind() int {
+    return 79
+}
+
+func (mapper *Mapper79) Compare(other Mapper) error {
+    him, ok := other.(*Mapper79)
+    if !ok {
+        return fmt.Errorf("other was not a mapper79")
+    }
+
+    if mapper.PrgBank != him.PrgBank || mapper.ChrBank != him.ChrBank {
+        return fmt.Errorf("banks differ: me=%v/%v him=%v/%v", mapper.PrgBank, mapper.ChrBank, him.PrgBank, him.ChrBank)
+    }
+
+    return compareSlice(mapper.ProgramRom, him.ProgramRom)
+}
+
+func (mapper *Mapper79) Copy() Mapper {
+    return &Mapper79{
+        ProgramRom: copySlice(mapper.ProgramRom),
+        CharacterRom: copySlice(mapper.CharacterRom),
+        PrgBank: mapper.PrgBank,
+        ChrBank: mapper.ChrBank,
+    }
+}
+
+func (mapper *Mapper79) SaveBinary(writer *StateWriter){
+    writer.Bytes(mapper.ProgramRom)
+    writer.Bytes(mapper.CharacterRom)
+    writer.Byte(mapper.PrgBank)
+    writer.Byte(mapper.ChrBank)
+}
+
+func (mapper *Mapper79) LoadBinary(reader *StateReader){
+    mapper.ProgramRom = reader.Bytes()
+    mapper.CharacterRom = reader.Bytes()
+    mapper.PrgBank = reader.Byte()
+    mapper.ChrBank = reader.Byte()
+}
+
+func (mapper *Mapper79) IsIRQAsserted() bool {
+    return false
+}
+
+func (mapper *Mapper79) Read(address uint16) byte {
+    if address >= 0x8000 {
+        return readBank(mapper.ProgramRom, int(mapper.PrgBank), 0x8000, address - 0x8000)
+    }
+
+    return 0
+}
+
+func (mapper *Mapper79) ReadPPU(ppu *PPUState, address uint16) byte {
+    return readChrBank(ppu, mapper.CharacterRom, address, int(mapper.ChrBank), 0x2000)
+}
+
+func (mapper *Mapper79) WritePPU(ppu *PPUState, address uint16, value byte){
+    writeChrBank(ppu, mapper.CharacterRom, address, value)
+}
+
+func (mapper *Mapper79) Write(cpu *CPUState, address uint16, value byte) error {
+    if address >= 0x6000 {
+        return nil
+    }
+
+    return fmt.Errorf("invalid mapper79 write address=0x%x value=0x%x", address, value)
+}
+
+func (mapper *Mapper79) ReadExpansion(address uint16) byte {
+    return 0
+}
+
+func (mapper *Mapper79) WriteExpansion(cpu *CPUState, address uint16, value byte){
+    if address & 0xe100 == 0x4100 {
+        mapper.PrgBank = (value >> 3) & 0x1
+        mapper.ChrBank = value & 0x7
+    }
+}
+
+func MakeMapper79(programRom []byte, chrMemory []byte) Mapper {
+    return &Mapper79{
+        ProgramRom: programRom,
+        CharacterRom: chrMemory,
+    }
+}
+
+/* Namco 108/DxROM (mapper 206). The predecessor of the MMC3: $8000 selects one of eight
+ * registers and $8001 writes it. Registers 0 and 1 are 2k chr banks at $0000 and $0800, 2-5 are
+ * 1k chr banks at $1000-$1fff, and 6 and 7 are 8k prg banks at $8000 and $a000. The last two
+ * prg banks are fixed, and there is no irq or mirroring control.
+ */
+type Mapper206 struct {
+    ProgramRom []byte `json:"programrom"`
+    CharacterRom []byte `json:"characterrom"`
+    RegisterIndex byte `json:"register"`
+    ChrRegister [6]byte `json:"chrregister"`
+    PrgRegister [2]byte `json:"prgregister"`
+}
+
+func (mapper *Mapper206) IsNSF() bool {
+    return false
+}
+
+func (mapper *Mapper206) Kind() int {
+    return 206
+}
+
+func (mapper *Mapper206) Compare(other Mapper) error {
+    him, ok := other.(*Mapper206)
+    if !ok {
+        return fmt.Errorf("other was not a mapper206")
+    }
+
+    if mapper.RegisterIndex != him.RegisterIndex {
+        return fmt.Errorf("register index differs: me=%v him=%v", mapper.RegisterIndex, him.RegisterIndex)
+    }
+
+    if mapper.ChrRegister != him.ChrRegister || mapper.PrgRegister != him.PrgRegister {
+        return fmt.Errorf("banks differ: me=%v/%v him=%v/%v", mapper.ChrRegister, mapper.PrgRegister, him.ChrRegister, him.PrgRegister)
+    }
+
+    return compareSlice(mapper.ProgramRom, him.ProgramRom)
+}
+
+func (mapper *Mapper206) Copy() Mapper {
+    return &Mapper206{
+        ProgramRom: copySlice(mapper.ProgramRom),
+        CharacterRom: copySlice(mapper.CharacterRom),
+        RegisterIndex: mapper.RegisterIndex,
+        ChrRegister: mapper.ChrRegister,
+        PrgRegister: mapper.PrgRegister,
+    }
+}
+
+func (mapper *Mapper206) SaveBinary(writer *StateWriter){
+    writer.Bytes(mapper.ProgramRom)
+    writer.Bytes(mapper.CharacterRom)
+    writer.Byte(mapper.RegisterIndex)
+    for _, value := range mapper.ChrRegister {
+        writer.Byte(value)
+    }
+    for _, value := range mapper.PrgRegister {
+        writer.Byte(value)
+    }
+}
+
+func (mapper *Mapper206) LoadBinary(reader *StateReader){
+    mapper.ProgramRom = reader.Bytes()
+    mapper.CharacterRom = reader.Bytes()
+    mapper.RegisterIndex = reader.Byte()
+    for i := range mapper.ChrRegister {
+        mapper.ChrRegister[i] = reader.Byte()
+    }
+    for i := range mapper.PrgRegister {
+        mapper.PrgRegister[i] = reader.Byte()
+    }
+}
+
+func (mapper *Mapper206) IsIRQAsserted() bool {
+    return false
+}
+
+func (mapper *Mapper206) Read(address uint16) byte {
+    pages := len(mapper.ProgramRom) / 0x2000
+    switch {
+        case address >= 0xc000:
+            bank := pages - 2 + int(address - 0xc000) / 0x2000
+            return readBank(mapper.ProgramRom, bank, 0x2000, address & 0x1fff)
+        case address >= 0xa000:
+            return readBank(mapper.ProgramRom, int(mapper.PrgRegister[1]), 0x2000, address - 0xa000)
+        case address >= 0x8000:
+            return readBank(mapper.ProgramRom, int(mapper.PrgRegister[0]), 0x2000, address - 0x8000)
+    }
+
+    return 0
+}
+
+/* two 2k banks at $0000 that ignore the low bit of their register, then four 1k banks */
+func (mapper *Mapper206) ReadPPU(ppu *PPUState, address uint16) byte {
+    if address < 0x1000 {
+        return readChrBank(ppu, mapper.CharacterRom, address, int(mapper.ChrRegister[address / 0x800] >> 1), 0x800)
+    }
+    return readChrBank(ppu, mapper.CharacterRom, address, int(mapper.ChrRegister[2 + (address & 0xfff) / 0x400]), 0x400)
+}
+
+func (mapper *Mapper206) WritePPU(ppu *PPUState, address uint16, value byte){
+    writeChrBank(ppu, mapper.CharacterRom, address, value)
+}
+
+func (mapper *Mapper206) Write(cpu *CPUState, address uint16, value byte) error {
+    if address >= 0x8000 && address < 0xa000 {
+        if address & 0x1 == 0 {
+            mapper.RegisterIndex = value & 0x7
+            return nil
+        }
+
+        switch mapper.RegisterIndex {
+            case 0, 1, 2, 3, 4, 5:
+                mapper.ChrRegister[mapper.RegisterIndex] = value & 0x3f
+            case 6, 7:
+                mapper.PrgRegister[mapper.RegisterIndex - 6] = value & 0xf
+        }
+
+        return nil
+    }
+
+    if address >= 0xa000 {
+        return nil
+    }
+
+    return fmt.Errorf("invalid mapper206 write address=0x%x value=0x%x", address, value)
+}
+
+func MakeMapper206(programRom []byte, chrMemory []byte) Mapper {
+    return &Mapper206{
+        ProgramRom: programRom,
+        CharacterRom: chrMemory,
+        PrgRegister: [2]byte{0, 1},
+    }
+}
+
+/* Camerica Quattro (mapper 232). Writes to $8000-$bfff select a 64k block with bits 3-4, and
+ * writes to $c000-$ffff select the 16k bank within the block at $8000. The last bank of the
+ * block is fixed at $c000. The Aladdin Deck Enhancer (submapper 1) swaps the two block bits.
+ */
+type Mapper232 struct {
+    ProgramRom []byte `json:"programrom"`
+    Block byte `json:"block"`
+    Bank byte `json:"bank"`
+    Aladdin bool `json:"aladdin"`
+}
+
+func (mapper *Mapper232) IsNSF() bool {
+    return false
+}
+
+func (mapper *Mapper232) Kind() int {
+    return 232
+}
+
+func (mapper *Mapper232) Compare(other Mapper) error {
+    him, ok := other.(*Mapper232)
+    if !ok {
+        return fmt.Errorf("other was not a mapper232")
+    }
+
+    if mapper.Block != him.Block || mapper.Bank != him.Bank {
+        return fmt.Errorf("banks differ: me=%v/%v him=%v/%v", mapper.Block, mapper.Bank, him.Block, him.Bank)
+    }
+
+    return compareSlice(mapper.ProgramRom, him.ProgramRom)
+}
+
+func (mapper *Mapper232) Copy() Mapper {
+    return &Mapper232{
+        ProgramRom: copySlice(mapper.ProgramRom),
+        Block: mapper.Block,
+        Bank: mapper.Bank,
+        Aladdin: mapper.Aladdin,
+    }
+}
+
+func (mapper *Mapper232) SaveBinary(writer *StateWriter){
+    writer.Bytes(mapper.ProgramRom)
+    writer.Byte(mapper.Block)
+    writer.Byte(mapper.Bank)
+    writer.Bool(mapper.Aladdin)
+}
+
+func (mapper *Mapper232) LoadBinary(reader *StateReader){
+    mapper.ProgramRom = reader.Bytes()
+    mapper.Block = reader.Byte()
+    mapper.Bank = reader.Byte()
+    mapper.Aladdin = reader.Bool()
+}
+
+func (mapper *Mapper232) IsIRQAsserted() bool {
+    return false
+}
+
+func (mapper *Mapper232) Read(address uint16) byte {
+    switch {
+        case address >= 0xc000:
+            return readBank(mapper.ProgramRom, int(mapper.Block) * 4 + 3, 0x4000, address - 0xc000)
+        case address >= 0x8000:
+            return readBank(mapper.ProgramRom, int(mapper.Block) * 4 + int(mapper.Bank), 0x4000, address - 0x8000)
+    }
+
+    return 0
+}
+
+func (mapper *Mapper232) Write(cpu *CPUState, address uint16, value byte) error {
+    switch {
+        case address >= 0xc000:
+            mapper.Bank = value & 0x3
+        case address >= 0x8000:
+            if mapper.Aladdin {
+                mapper.Block = ((value >> 4) & 0x1) | ((value >> 2) & 0x2)
+            } else {
+                mapper.Block = (value >> 3) & 0x3
+            }
+        default:
+            return fmt.Errorf("invalid mapper232 write address=0x%x value=0x%x", address, value)
+    }
+
+    return nil
+}
+
+func MakeMapper232(info MapperInfo, programRom []byte) Mapper {
+    return &Mapper232{
+        ProgramRom: programRom,
+        Aladdin: info.Submapper == 1,
+    }
+}
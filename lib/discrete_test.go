@@ -0,0 +1,161 @@
+package lib
+
+import (
+    "testing"
+)
+
+/* every byte of each 1k chr bank holds the bank number */
+func makeBankedChr(size int) []byte {
+    out := make([]byte, size)
+    for i := range out {
+        out[i] = byte(i / 0x400)
+    }
+    return out
+}
+
+func TestDiscreteMappers(test *testing.T){
+    type write struct {
+        Address uint16
+        Value byte
+    }
+
+    type mapperTest struct {
+        Info MapperInfo
+        Writes []write
+        /* cpu address -> 8k prg page number, read from offset 0x1000 of each page */
+        Program map[uint16]byte
+        /* ppu address -> 1k chr bank number */
+        Character map[uint16]byte
+    }
+
+    tests := []mapperTest{
+        {
+            Info: MapperInfo{Mapper: 11},
+            Writes: []write{{0x8000, 0x31}},
+            Program: map[uint16]byte{0x8000: 4, 0xe000: 7},
+            Character: map[uint16]byte{0x0000: 24, 0x1c00: 31},
+        },
+        {
+            Info: MapperInfo{Mapper: 34, Submapper: 2, Nes2: true},
+            Writes: []write{{0x8000, 3}},
+            Program: map[uint16]byte{0x8000: 12, 0xe000: 15},
+        },
+        {
+            Info: MapperInfo{Mapper: 34},
+            Writes: []write{{0x7ffd, 1}, {0x7ffe, 5}, {0x7fff, 2}},
+            Program: map[uint16]byte{0x8000: 4, 0xe000: 7},
+            Character: map[uint16]byte{0x0000: 20, 0x0c00: 23, 0x1000: 8},
+        },
+        {
+            Info: MapperInfo{Mapper: 66},
+            Writes: []write{{0x8000, 0x21}},
+            Program: map[uint16]byte{0x8000: 8, 0xe000: 11},
+            Character: map[uint16]byte{0x0000: 8, 0x1c00: 15},
+        },
+        {
+            Info: MapperInfo{Mapper: 71},
+            Writes: []write{{0xc000, 3}},
+            Program: map[uint16]byte{0x8000: 6, 0xa000: 7, 0xc000: 14, 0xe000: 15},
+        },
+        {
+            Info: MapperInfo{Mapper: 79},
+            Writes: []write{{0x4100, 0xb}},
+            Program: map[uint16]byte{0x8000: 4, 0xe000: 7},
+            Character: map[uint16]byte{0x0000: 24, 0x1000: 28},
+        },
+        {
+            Info: MapperInfo{Mapper: 206},
+            Writes: []write{
+                {0x8000, 0}, {0x8001, 5},
+                {0x8000, 2}, {0x8001, 9},
+                {0x8000, 6}, {0x8001, 3},
+                {0x8000, 7}, {0x8001, 4},
+            },
+            Program: map[uint16]byte{0x8000: 3, 0xa000: 4, 0xc000: 14, 0xe000: 15},
+            Character: map[uint16]byte{0x0000: 4, 0x0400: 5, 0x1000: 9},
+        },
+        {
+            Info: MapperInfo{Mapper: 232},
+            Writes: []write{{0x8000, 0x08}, {0xc000, 2}},
+            Program: map[uint16]byte{0x8000: 12, 0xc000: 14, 0xe000: 15},
+        },
+        {
+            Info: MapperInfo{Mapper: 232, Submapper: 1, Nes2: true},
+            Writes: []write{{0x8000, 0x08}, {0xc000, 2}},
+            Program: map[uint16]byte{0x8000: 20, 0xc000: 22, 0xe000: 23},
+        },
+    }
+
+    for _, mapperTest := range tests {
+        info := mapperTest.Info
+        mapper, err := MakeMapper(info, makeMapperTestRom(0x20000, nil), makeBankedChr(0x8000))
+        if info.Mapper == 232 {
+            mapper, err = MakeMapper(info, makeMapperTestRom(0x40000, nil), nil)
+        }
+        if err != nil {
+            test.Fatalf("could not make mapper %v: %v", info.Mapper, err)
+        }
+
+        cpu := StartupState()
+        cpu.SetMapper(mapper)
+
+        for _, write := range mapperTest.Writes {
+            cpu.StoreMemory(write.Address, write.Value)
+        }
+
+        for address, page := range mapperTest.Program {
+            if value := cpu.LoadMemory(address + 0x1000); value != page {
+                test.Fatalf("mapper %v submapper %v: expected page %v at 0x%x but got %v", info.Mapper, info.Submapper, page, address, value)
+            }
+        }
+
+        for address, bank := range mapperTest.Character {
+            if value := readPPUData(&cpu, address); value != bank {
+                test.Fatalf("mapper %v: expected chr bank %v at 0x%x but got %v", info.Mapper, bank, address, value)
+            }
+        }
+
+        copied := mapper.Copy()
+        if err := copied.Compare(mapper); err != nil {
+            test.Fatalf("mapper %v: copy differs: %v", info.Mapper, err)
+        }
+    }
+}
+
+/* boards without chr rom write the pattern tables to the ppu's chr ram */
+func TestDiscreteChrRam(test *testing.T){
+    for _, info := range []MapperInfo{{Mapper: 34, Submapper: 2, Nes2: true}, {Mapper: 71}, {Mapper: 232}} {
+        mapper, err := MakeMapper(info, makeMapperTestRom(0x20000, nil), nil)
+        if err != nil {
+            test.Fatalf("could not make mapper %v: %v", info.Mapper, err)
+        }
+
+        cpu := StartupState()
+        cpu.SetMapper(mapper)
+        cpu.PPU.VideoAddress = 0x1abc
+        cpu.PPU.WriteVideoMemory(0x77, cpu.Mapper.Mapper)
+        if value := readPPUData(&cpu, 0x1abc); value != 0x77 {
+            test.Fatalf("mapper %v: expected 0x77 in chr ram but got 0x%x", info.Mapper, value)
+        }
+    }
+}
+
+func TestMapper71Mirroring(test *testing.T){
+    mapper := MakeMapper71(MapperInfo{Mapper: 71, Submapper: 1, Nes2: true}, makeMapperTestRom(0x20000, nil))
+    cpu := StartupState()
+    cpu.SetMapper(mapper)
+
+    cpu.StoreMemory(0x8000, 0x10)
+    cpu.PPU.StoreNametableMemory(0x2000, 0x42)
+    if value := cpu.PPU.LoadNametableMemory(0x2400); value != 0x42 {
+        test.Fatalf("expected single screen mirroring but got 0x%x", value)
+    }
+
+    /* $a000-$bfff does not change the mirroring */
+    cpu.StoreMemory(0xa000, 0x00)
+    cpu.StoreMemory(0xbfff, 0x00)
+    cpu.PPU.StoreNametableMemory(0x2000, 0x13)
+    if value := cpu.PPU.LoadNametableMemory(0x2400); value != 0x13 || cpu.PPU.NametableMemory[0x400] != 0x13 {
+        test.Fatalf("a write to $a000 changed the mirroring")
+    }
+}
@@ -0,0 +1,1053 @@
+package lib
+
+import (
+    "bytes"
+    "fmt"
+    "io"
+    "log"
+)
+
+/* The Famicom Disk System.
+ * https://www.nesdev.org/wiki/Family_Computer_Disk_System
+ *
+ * The ram adapter plugs into the cartridge slot and has 32k of prg ram at $6000-$dfff, 8k of
+ * chr ram, the disk system bios at $e000-$ffff, a timer irq, the disk drive interface and a
+ * wavetable sound channel. Games are loaded from disk into the ram by the bios.
+ *
+ * .fds images hold each 65500 byte side without the gaps and crcs that are on a real disk, so
+ * those are added when a disk is loaded and removed again when the disk is saved.
+ */
+
+/* the size of a side in a .fds image */
+const FDSSideSize = 65500
+/* QD images are the dumps of the quick disks themselves, with the block crcs */
+const fdsQDSideSize = 0x10000
+
+/* fwNES header, followed by the number of sides */
+var fdsHeaderMagic = []byte{'F', 'D', 'S', 0x1a}
+/* every side starts with the disk info block */
+var fdsDiskMagic = []byte("\x01*NINTENDO-HVC*")
+
+/* the drive reads 28300 bits of gap before the first block, and 976 bits between blocks */
+const fdsLeadInGap = 28300 / 8
+const fdsBlockGap = 976 / 8
+const fdsRawSideSize = fdsLeadInGap + FDSSideSize
+
+/* cpu cycles between bytes on the disk, and from the motor starting to the first byte */
+const fdsByteCycles = 150
+const fdsSpinUpCycles = 50000
+/* how long the drive is empty when switching sides, about a second, so the bios notices */
+const fdsInsertDelay = 1800000
+
+func isFDS(header []byte) bool {
+    return bytes.HasPrefix(header, fdsHeaderMagic) || bytes.HasPrefix(header, fdsDiskMagic)
+}
+
+func IsFDSFile(path string) bool {
+    return hasRomHeader(path, isFDS)
+}
+
+/* the size of the block that starts with blockType, or 0 if it isn't a block. the size of a
+ * file's data is in the file header block, which is the end of previous
+ */
+func fdsBlockLength(blockType byte, previous []byte) int {
+    switch blockType {
+        /* disk info */
+        case 1: return 56
+        /* file amount */
+        case 2: return 2
+        /* file header */
+        case 3: return 16
+        /* file data */
+        case 4:
+            if len(previous) < 3 {
+                return 0
+            }
+            return 1 + int(previous[len(previous) - 3]) + int(previous[len(previous) - 2]) << 8
+    }
+
+    return 0
+}
+
+/* the drive's crc, which also covers the start mark */
+func fdsUpdateCRC(crc uint16, value byte) uint16 {
+    for bit := range 8 {
+        carry := crc & 1
+        crc >>= 1
+        if carry == 1 {
+            crc ^= 0x8408
+        }
+        if (value >> bit) & 1 == 1 {
+            crc ^= 0x8000
+        }
+    }
+    return crc
+}
+
+func fdsBlockCRC(block []byte) uint16 {
+    crc := fdsUpdateCRC(0, 0x80)
+    for _, value := range block {
+        crc = fdsUpdateCRC(crc, value)
+    }
+    crc = fdsUpdateCRC(crc, 0)
+    return fdsUpdateCRC(crc, 0)
+}
+
+/* turn a side from a .fds image into what the drive reads: a gap, then each block with a start
+ * mark before it and its crc after it
+ */
+func addDiskGaps(side []byte) []byte {
+    out := make([]byte, fdsLeadInGap, fdsRawSideSize)
+
+    position := 0
+    for position < len(side) {
+        length := fdsBlockLength(side[position], side[:position])
+        if length == 0 || position + length > len(side) {
+            break
+        }
+
+        block := side[position:position + length]
+        crc := fdsBlockCRC(block)
+
+        out = append(out, 0x80)
+        out = append(out, block...)
+        out = append(out, byte(crc), byte(crc >> 8))
+        out = append(out, make([]byte, fdsBlockGap)...)
+
+        position += length
+    }
+
+    /* the rest of the disk is empty, and can be written to */
+    if len(out) < fdsRawSideSize {
+        out = append(out, make([]byte, fdsRawSideSize - len(out))...)
+    }
+
+    return out
+}
+
+/* the inverse of addDiskGaps, also used for blocks the bios wrote */
+func removeDiskGaps(raw []byte) []byte {
+    out := make([]byte, 0, FDSSideSize)
+
+    position := 0
+    for {
+        for position < len(raw) && raw[position] == 0 {
+            position += 1
+        }
+
+        if position + 1 >= len(raw) || raw[position] != 0x80 {
+            break
+        }
+        position += 1
+
+        length := fdsBlockLength(raw[position], out)
+        if length == 0 || position + length > len(raw) {
+            break
+        }
+
+        out = append(out, raw[position:position + length]...)
+        /* skip the crc */
+        position += length + 2
+    }
+
+    if len(out) < FDSSideSize {
+        out = append(out, make([]byte, FDSSideSize - len(out))...)
+    }
+
+    return out
+}
+
+/* QD sides have a crc after each block, but no gaps */
+func removeDiskCRCs(side []byte) []byte {
+    out := make([]byte, 0, FDSSideSize)
+
+    position := 0
+    for position < len(side) {
+        length := fdsBlockLength(side[position], out)
+        if length == 0 || position + length > len(side) {
+            break
+        }
+
+        out = append(out, side[position:position + length]...)
+        position += length + 2
+    }
+
+    if len(out) < FDSSideSize {
+        out = append(out, make([]byte, FDSSideSize - len(out))...)
+    }
+
+    return out
+}
+
+/* split a disk image without a header into 65500 byte sides */
+func splitDiskSides(data []byte) [][]byte {
+    size := FDSSideSize
+    qd := len(data) % fdsQDSideSize == 0 && len(data) % FDSSideSize != 0
+    if qd {
+        size = fdsQDSideSize
+    }
+
+    var sides [][]byte
+    for start := 0; start < len(data); start += size {
+        side := make([]byte, size)
+        copy(side, data[start:])
+
+        if qd {
+            side = removeDiskCRCs(side)
+        }
+
+        sides = append(sides, side)
+    }
+
+    return sides
+}
+
+/* join the sides back into a .fds image without a header */
+func joinDiskSides(sides [][]byte) []byte {
+    var out []byte
+    for _, side := range sides {
+        out = append(out, side...)
+    }
+    return out
+}
+
+/* header is the first 16 bytes of the file, which were already read */
+func parseFDS(header []byte, reader io.Reader, name string) (NESFile, error) {
+    data, err := io.ReadAll(reader)
+    if err != nil {
+        return NESFile{}, err
+    }
+
+    /* without the fwNES header the first 16 bytes are part of the disk */
+    if !bytes.HasPrefix(header, fdsHeaderMagic) {
+        data = append(bytes.Clone(header), data...)
+    }
+
+    sides := splitDiskSides(data)
+    if len(sides) == 0 {
+        return NESFile{}, fmt.Errorf("disk image has no sides")
+    }
+
+    for i, side := range sides {
+        if !bytes.HasPrefix(side, fdsDiskMagic) {
+            log.Printf("Warning: side %v of disk %v does not start with the disk info block", i, name)
+        }
+    }
+
+    return NESFile{
+        Mapper: 20,
+        VerticalMirror: true,
+        PRGRamSize: 0x8000,
+        CHRRamSize: 0x2000,
+        /* the disk itself is the save */
+        Battery: true,
+        /* the disk system was only sold in japan */
+        Region: RegionNTSC,
+        HasRegion: true,
+        Console: ConsoleNES,
+        DiskSides: sides,
+        Path: name,
+    }, nil
+}
+
+/* the wavetable channel of the ram adapter.
+ * https://www.nesdev.org/wiki/FDS_audio
+ *
+ * A 64 step table of 6-bit samples is played at a 12-bit pitch, which a second table of
+ * 3-bit steps modulates. The volume and the modulation depth each have an envelope.
+ */
+
+type FDSEnvelope struct {
+    /* bits 0-5 */
+    Speed byte `json:"speed"`
+    /* 0-32 */
+    Gain byte `json:"gain"`
+    Increase bool `json:"increase"`
+    /* the gain is the speed when the envelope is off */
+    Disabled bool `json:"disabled"`
+    Timer uint32 `json:"timer"`
+}
+
+func (envelope *FDSEnvelope) Write(value byte, masterSpeed byte){
+    envelope.Speed = value & 0x3f
+    envelope.Increase = value & 0x40 == 0x40
+    envelope.Disabled = value & 0x80 == 0x80
+    if envelope.Disabled {
+        envelope.Gain = envelope.Speed
+    }
+    envelope.ResetTimer(masterSpeed)
+}
+
+func (envelope *FDSEnvelope) ResetTimer(masterSpeed byte){
+    envelope.Timer = 8 * (uint32(envelope.Speed) + 1) * uint32(masterSpeed)
+}
+
+/* returns true if the gain was clocked */
+func (envelope *FDSEnvelope) Tick(masterSpeed byte) bool {
+    if envelope.Disabled || masterSpeed == 0 {
+        return false
+    }
+
+    if envelope.Timer > 0 {
+        envelope.Timer -= 1
+    }
+
+    if envelope.Timer == 0 {
+        envelope.ResetTimer(masterSpeed)
+        if envelope.Increase && envelope.Gain < 32 {
+            envelope.Gain += 1
+        } else if !envelope.Increase && envelope.Gain > 0 {
+            envelope.Gain -= 1
+        }
+        return true
+    }
+
+    return false
+}
+
+func (envelope *FDSEnvelope) SaveBinary(writer *StateWriter){
+    writer.Byte(envelope.Speed)
+    writer.Byte(envelope.Gain)
+    writer.Bool(envelope.Increase)
+    writer.Bool(envelope.Disabled)
+    writer.Uint32(envelope.Timer)
+}
+
+func (envelope *FDSEnvelope) LoadBinary(reader *StateReader){
+    envelope.Speed = reader.Byte()
+    envelope.Gain = reader.Byte()
+    envelope.Increase = reader.Bool()
+    envelope.Disabled = reader.Bool()
+    envelope.Timer = reader.Uint32()
+}
+
+/* how much each modulation table entry changes the counter. 4 resets it to 0 */
+var fdsModulationSteps = [8]int{0, 1, 2, 4, 0, -4, -2, -1}
+
+/* the output is scaled by 2/2, 2/3, 2/4 or 2/5 */
+var fdsMasterVolume = [4]int{36, 24, 18, 14}
+
+type FDSAudio struct {
+    Wave [64]byte `json:"wave"`
+    /* the wave table can only be written while this is set, which also stops the wave from advancing */
+    WaveWrite bool `json:"wavewrite"`
+    WavePosition byte `json:"waveposition"`
+    WaveAccumulator uint16 `json:"waveaccumulator"`
+    /* 12 bits */
+    Frequency uint16 `json:"frequency"`
+    WaveHalt bool `json:"wavehalt"`
+    EnvelopeHalt bool `json:"envelopehalt"`
+    MasterVolume byte `json:"mastervolume"`
+    EnvelopeSpeed byte `json:"envelopespeed"`
+
+    Volume FDSEnvelope `json:"volume"`
+    /* the gain of this envelope is the modulation depth */
+    Modulation FDSEnvelope `json:"modulation"`
+
+    ModulationTable [64]byte `json:"modulationtable"`
+    ModulationPosition byte `json:"modulationposition"`
+    /* 7-bit signed */
+    ModulationCounter int8 `json:"modulationcounter"`
+    /* 12 bits */
+    ModulationFrequency uint16 `json:"modulationfrequency"`
+    ModulationAccumulator uint16 `json:"modulationaccumulator"`
+    ModulationHalt bool `json:"modulationhalt"`
+
+    /* fraction of a cpu cycle left over from the last run */
+    Cycles float64 `json:"cycles"`
+}
+
+func MakeFDSAudio() *FDSAudio {
+    return &FDSAudio{
+        EnvelopeSpeed: 0xe8,
+        ModulationHalt: true,
+    }
+}
+
+func (audio *FDSAudio) SaveBinary(writer *StateWriter){
+    writer.Bytes(audio.Wave[:])
+    writer.Bool(audio.WaveWrite)
+    writer.Byte(audio.WavePosition)
+    writer.Uint16(audio.WaveAccumulator)
+    writer.Uint16(audio.Frequency)
+    writer.Bool(audio.WaveHalt)
+    writer.Bool(audio.EnvelopeHalt)
+    writer.Byte(audio.MasterVolume)
+    writer.Byte(audio.EnvelopeSpeed)
+    audio.Volume.SaveBinary(writer)
+    audio.Modulation.SaveBinary(writer)
+    writer.Bytes(audio.ModulationTable[:])
+    writer.Byte(audio.ModulationPosition)
+    writer.Byte(byte(audio.ModulationCounter))
+    writer.Uint16(audio.ModulationFrequency)
+    writer.Uint16(audio.ModulationAccumulator)
+    writer.Bool(audio.ModulationHalt)
+    writer.Float64(audio.Cycles)
+}
+
+func (audio *FDSAudio) LoadBinary(reader *StateReader){
+    copy(audio.Wave[:], reader.Bytes())
+    audio.WaveWrite = reader.Bool()
+    audio.WavePosition = reader.Byte()
+    audio.WaveAccumulator = reader.Uint16()
+    audio.Frequency = reader.Uint16()
+    audio.WaveHalt = reader.Bool()
+    audio.EnvelopeHalt = reader.Bool()
+    audio.MasterVolume = reader.Byte()
+    audio.EnvelopeSpeed = reader.Byte()
+    audio.Volume.LoadBinary(reader)
+    audio.Modulation.LoadBinary(reader)
+    copy(audio.ModulationTable[:], reader.Bytes())
+    audio.ModulationPosition = reader.Byte()
+    audio.ModulationCounter = int8(reader.Byte())
+    audio.ModulationFrequency = reader.Uint16()
+    audio.ModulationAccumulator = reader.Uint16()
+    audio.ModulationHalt = reader.Bool()
+    audio.Cycles = reader.Float64()
+}
+
+func (audio *FDSAudio) setModulationCounter(value int){
+    if value >= 64 {
+        value -= 128
+    } else if value < -64 {
+        value += 128
+    }
+    audio.ModulationCounter = int8(value)
+}
+
+/* $4040-$4092 */
+func (audio *FDSAudio) Read(address uint16) byte {
+    switch {
+        case address >= 0x4040 && address < 0x4080:
+            return audio.Wave[address - 0x4040] | 0x40
+        case address == 0x4090:
+            return audio.Volume.Gain | 0x40
+        case address == 0x4092:
+            return audio.Modulation.Gain | 0x40
+    }
+
+    return 0
+}
+
+func (audio *FDSAudio) Write(address uint16, value byte){
+    if address >= 0x4040 && address < 0x4080 {
+        if audio.WaveWrite {
+            audio.Wave[address - 0x4040] = value & 0x3f
+        }
+        return
+    }
+
+    switch address {
+        case 0x4080:
+            audio.Volume.Write(value, audio.EnvelopeSpeed)
+        case 0x4082:
+            audio.Frequency = (audio.Frequency & 0xf00) | uint16(value)
+        case 0x4083:
+            audio.Frequency = (audio.Frequency & 0xff) | uint16(value & 0xf) << 8
+            audio.WaveHalt = value & 0x80 == 0x80
+            audio.EnvelopeHalt = value & 0x40 == 0x40
+            if audio.WaveHalt {
+                audio.WavePosition = 0
+            }
+            if audio.EnvelopeHalt {
+                audio.Volume.ResetTimer(audio.EnvelopeSpeed)
+                audio.Modulation.ResetTimer(audio.EnvelopeSpeed)
+            }
+        case 0x4084:
+            audio.Modulation.Write(value, audio.EnvelopeSpeed)
+        case 0x4085:
+            audio.setModulationCounter(int(value & 0x7f))
+        case 0x4086:
+            audio.ModulationFrequency = (audio.ModulationFrequency & 0xf00) | uint16(value)
+        case 0x4087:
+            audio.ModulationFrequency = (audio.ModulationFrequency & 0xff) | uint16(value & 0xf) << 8
+            audio.ModulationHalt = value & 0x80 == 0x80
+            if audio.ModulationHalt {
+                audio.ModulationAccumulator = 0
+            }
+        case 0x4088:
+            /* the table can only be written while the modulator is halted, two entries at a time */
+            if audio.ModulationHalt {
+                audio.ModulationTable[audio.ModulationPosition] = value & 0x7
+                audio.ModulationTable[(audio.ModulationPosition + 1) & 0x3f] = value & 0x7
+                audio.ModulationPosition = (audio.ModulationPosition + 2) & 0x3f
+            }
+        case 0x4089:
+            audio.WaveWrite = value & 0x80 == 0x80
+            audio.MasterVolume = value & 0x3
+        case 0x408a:
+            audio.EnvelopeSpeed = value
+    }
+}
+
+/* how much the modulator changes the pitch, using the hardware's odd rounding */
+func (audio *FDSAudio) modulationOutput() int {
+    counter := int(audio.ModulationCounter)
+
+    value := counter * int(audio.Modulation.Gain)
+    remainder := value & 0xf
+    value >>= 4
+    if remainder > 0 && value & 0x80 == 0 {
+        if counter < 0 {
+            value -= 1
+        } else {
+            value += 2
+        }
+    }
+
+    if value >= 192 {
+        value -= 256
+    } else if value < -64 {
+        value += 256
+    }
+
+    value = int(audio.Frequency) * value
+    remainder = value & 0x3f
+    value >>= 6
+    if remainder >= 32 {
+        value += 1
+    }
+
+    return value
+}
+
+/* one cpu cycle */
+func (audio *FDSAudio) clock(){
+    if !audio.WaveHalt && !audio.EnvelopeHalt {
+        audio.Volume.Tick(audio.EnvelopeSpeed)
+        audio.Modulation.Tick(audio.EnvelopeSpeed)
+    }
+
+    if !audio.ModulationHalt && audio.ModulationFrequency > 0 {
+        next := uint32(audio.ModulationAccumulator) + uint32(audio.ModulationFrequency)
+        audio.ModulationAccumulator = uint16(next)
+        if next > 0xffff {
+            step := audio.ModulationTable[audio.ModulationPosition]
+            if step == 4 {
+                audio.setModulationCounter(0)
+            } else {
+                audio.setModulationCounter(int(audio.ModulationCounter) + fdsModulationSteps[step])
+            }
+            audio.ModulationPosition = (audio.ModulationPosition + 1) & 0x3f
+        }
+    }
+
+    if audio.WaveHalt {
+        audio.WavePosition = 0
+        return
+    }
+
+    pitch := int(audio.Frequency) + audio.modulationOutput()
+    if pitch > 0 && !audio.WaveWrite {
+        next := uint32(audio.WaveAccumulator) + uint32(pitch)
+        audio.WaveAccumulator = uint16(next)
+        if next > 0xffff {
+            audio.WavePosition = (audio.WavePosition + 1) & 0x3f
+        }
+    }
+}
+
+/* cycles is in cpu cycles */
+func (audio *FDSAudio) Run(cycles float64){
+    audio.Cycles += cycles
+    for audio.Cycles >= 1 {
+        audio.Cycles -= 1
+        audio.clock()
+    }
+}
+
+func (audio *FDSAudio) GenerateSample() float32 {
+    gain := min(int(audio.Volume.Gain), 32)
+    /* 0-63 */
+    level := int(audio.Wave[audio.WavePosition]) * gain * fdsMasterVolume[audio.MasterVolume] / 1152
+
+    /* at full volume the fds is about 2.4 times as loud as a square wave */
+    return float32(level) / 63 * 0.36
+}
+
+/* the frontend uses this to save the changes made to a disk and to swap disk sides */
+type DiskMapper interface {
+    /* the disk in .fds format without a header, with everything the game wrote to it */
+    GetDiskImage() []byte
+    /* replace the disk, such as with a saved copy that has the game's progress */
+    SetDiskImage(image []byte)
+    /* eject the disk and insert the next side a moment later. returns the new side */
+    SwitchDiskSide() int
+}
+
+/* the ram adapter, mapper 20 */
+type MapperFDS struct {
+    Bios []byte `json:"bios"`
+    PRGRam []byte `json:"prgram"`
+
+    /* each side as the drive reads it, with gaps and crcs */
+    Disk [][]byte `json:"disk"`
+    Side int `json:"side"`
+    /* the drive is empty until this counts down to 0 */
+    InsertDelay uint32 `json:"insertdelay"`
+
+    /* $4023 */
+    DiskEnabled bool `json:"diskenabled"`
+    SoundEnabled bool `json:"soundenabled"`
+
+    IrqReload uint16 `json:"irqreload"`
+    IrqCounter uint16 `json:"irqcounter"`
+    IrqRepeat bool `json:"irqrepeat"`
+    IrqEnabled bool `json:"irqenabled"`
+    TimerIrq bool `json:"timerirq"`
+
+    /* $4025 */
+    MotorOn bool `json:"motoron"`
+    ResetTransfer bool `json:"resettransfer"`
+    ReadMode bool `json:"readmode"`
+    CrcControl bool `json:"crccontrol"`
+    /* bit 6, the bios sets this once the gap before a block has gone by */
+    TransferStart bool `json:"transferstart"`
+    DiskIrqEnabled bool `json:"diskirqenabled"`
+
+    DiskIrq bool `json:"diskirq"`
+    TransferComplete bool `json:"transfercomplete"`
+    ReadData byte `json:"readdata"`
+    WriteData byte `json:"writedata"`
+    /* $4026 */
+    ExternalWrite byte `json:"externalwrite"`
+
+    /* where the head is on the side */
+    Position int `json:"position"`
+    /* cycles until the next byte */
+    Delay int `json:"delay"`
+    Scanning bool `json:"scanning"`
+    EndOfHead bool `json:"endofhead"`
+    GapEnded bool `json:"gapended"`
+    PreviousCrcControl bool `json:"previouscrccontrol"`
+    Crc uint16 `json:"crc"`
+
+    Audio *FDSAudio `json:"audio"`
+}
+
+func (mapper *MapperFDS) IsNSF() bool {
+    return false
+}
+
+func (mapper *MapperFDS) Kind() int {
+    return 20
+}
+
+func (mapper *MapperFDS) Compare(other Mapper) error {
+    him, ok := other.(*MapperFDS)
+    if !ok {
+        return fmt.Errorf("other mapper is not the disk system")
+    }
+
+    if !bytes.Equal(mapper.PRGRam, him.PRGRam) {
+        return fmt.Errorf("prg ram differs")
+    }
+
+    if len(mapper.Disk) != len(him.Disk) {
+        return fmt.Errorf("number of disk sides differs: %v vs %v", len(mapper.Disk), len(him.Disk))
+    }
+
+    for i := range mapper.Disk {
+        if !bytes.Equal(mapper.Disk[i], him.Disk[i]) {
+            return fmt.Errorf("disk side %v differs", i)
+        }
+    }
+
+    if mapper.Side != him.Side || mapper.Position != him.Position {
+        return fmt.Errorf("disk head differs: side %v position %v vs side %v position %v", mapper.Side, mapper.Position, him.Side, him.Position)
+    }
+
+    if mapper.IrqCounter != him.IrqCounter {
+        return fmt.Errorf("irq counter differs: %v vs %v", mapper.IrqCounter, him.IrqCounter)
+    }
+
+    return nil
+}
+
+func (mapper *MapperFDS) Copy() Mapper {
+    out := *mapper
+    out.Bios = copySlice(mapper.Bios)
+    out.PRGRam = copySlice(mapper.PRGRam)
+    out.Disk = make([][]byte, len(mapper.Disk))
+    for i, side := range mapper.Disk {
+        out.Disk[i] = copySlice(side)
+    }
+    audio := *mapper.Audio
+    out.Audio = &audio
+    return &out
+}
+
+func (mapper *MapperFDS) SaveBinary(writer *StateWriter){
+    writer.Bytes(mapper.Bios)
+    writer.Bytes(mapper.PRGRam)
+    writer.Int(len(mapper.Disk))
+    for _, side := range mapper.Disk {
+        writer.Bytes(side)
+    }
+    writer.Int(mapper.Side)
+    writer.Uint32(mapper.InsertDelay)
+    writer.Bool(mapper.DiskEnabled)
+    writer.Bool(mapper.SoundEnabled)
+    writer.Uint16(mapper.IrqReload)
+    writer.Uint16(mapper.IrqCounter)
+    writer.Bool(mapper.IrqRepeat)
+    writer.Bool(mapper.IrqEnabled)
+    writer.Bool(mapper.TimerIrq)
+    writer.Bool(mapper.MotorOn)
+    writer.Bool(mapper.ResetTransfer)
+    writer.Bool(mapper.ReadMode)
+    writer.Bool(mapper.CrcControl)
+    writer.Bool(mapper.TransferStart)
+    writer.Bool(mapper.DiskIrqEnabled)
+    writer.Bool(mapper.DiskIrq)
+    writer.Bool(mapper.TransferComplete)
+    writer.Byte(mapper.ReadData)
+    writer.Byte(mapper.WriteData)
+    writer.Byte(mapper.ExternalWrite)
+    writer.Int(mapper.Position)
+    writer.Int(mapper.Delay)
+    writer.Bool(mapper.Scanning)
+    writer.Bool(mapper.EndOfHead)
+    writer.Bool(mapper.GapEnded)
+    writer.Bool(mapper.PreviousCrcControl)
+    writer.Uint16(mapper.Crc)
+    mapper.Audio.SaveBinary(writer)
+}
+
+func (mapper *MapperFDS) LoadBinary(reader *StateReader){
+    mapper.Bios = reader.Bytes()
+    mapper.PRGRam = reader.Bytes()
+    mapper.Disk = make([][]byte, reader.Int())
+    for i := range mapper.Disk {
+        mapper.Disk[i] = reader.Bytes()
+    }
+    mapper.Side = reader.Int()
+    mapper.InsertDelay = reader.Uint32()
+    mapper.DiskEnabled = reader.Bool()
+    mapper.SoundEnabled = reader.Bool()
+    mapper.IrqReload = reader.Uint16()
+    mapper.IrqCounter = reader.Uint16()
+    mapper.IrqRepeat = reader.Bool()
+    mapper.IrqEnabled = reader.Bool()
+    mapper.TimerIrq = reader.Bool()
+    mapper.MotorOn = reader.Bool()
+    mapper.ResetTransfer = reader.Bool()
+    mapper.ReadMode = reader.Bool()
+    mapper.CrcControl = reader.Bool()
+    mapper.TransferStart = reader.Bool()
+    mapper.DiskIrqEnabled = reader.Bool()
+    mapper.DiskIrq = reader.Bool()
+    mapper.TransferComplete = reader.Bool()
+    mapper.ReadData = reader.Byte()
+    mapper.WriteData = reader.Byte()
+    mapper.ExternalWrite = reader.Byte()
+    mapper.Position = reader.Int()
+    mapper.Delay = reader.Int()
+    mapper.Scanning = reader.Bool()
+    mapper.EndOfHead = reader.Bool()
+    mapper.GapEnded = reader.Bool()
+    mapper.PreviousCrcControl = reader.Bool()
+    mapper.Crc = reader.Uint16()
+    mapper.Audio = MakeFDSAudio()
+    mapper.Audio.LoadBinary(reader)
+}
+
+func (mapper *MapperFDS) IsIRQAsserted() bool {
+    return mapper.TimerIrq || mapper.DiskIrq
+}
+
+func (mapper *MapperFDS) GetDiskImage() []byte {
+    sides := make([][]byte, len(mapper.Disk))
+    for i, side := range mapper.Disk {
+        sides[i] = removeDiskGaps(side)
+    }
+    return joinDiskSides(sides)
+}
+
+func (mapper *MapperFDS) SetDiskImage(image []byte){
+    sides := splitDiskSides(image)
+    mapper.Disk = make([][]byte, len(sides))
+    for i, side := range sides {
+        mapper.Disk[i] = addDiskGaps(side)
+    }
+
+    mapper.Side = 0
+    mapper.Position = 0
+    mapper.EndOfHead = true
+}
+
+func (mapper *MapperFDS) SwitchDiskSide() int {
+    if len(mapper.Disk) > 0 {
+        mapper.Side = (mapper.Side + 1) % len(mapper.Disk)
+    }
+    mapper.InsertDelay = fdsInsertDelay
+    return mapper.Side
+}
+
+func (mapper *MapperFDS) diskInserted() bool {
+    return mapper.InsertDelay == 0 && mapper.Side < len(mapper.Disk)
+}
+
+func (mapper *MapperFDS) Read(address uint16) byte {
+    if address >= 0xe000 {
+        return mapper.Bios[int(address - 0xe000) % len(mapper.Bios)]
+    }
+
+    return mapper.PRGRam[address - 0x6000]
+}
+
+func (mapper *MapperFDS) Write(cpu *CPUState, address uint16, value byte) error {
+    if address < 0xe000 {
+        mapper.PRGRam[address - 0x6000] = value
+    }
+    return nil
+}
+
+func (mapper *MapperFDS) ReadExpansion(address uint16) byte {
+    switch address {
+        case 0x4030:
+            var value byte
+            if mapper.TimerIrq {
+                value |= 0x1
+            }
+            if mapper.TransferComplete {
+                value |= 0x2
+            }
+            /* bit 4 is a crc error, which can't happen since the crcs are made when the disk is loaded */
+            mapper.TransferComplete = false
+            mapper.TimerIrq = false
+            mapper.DiskIrq = false
+            return value
+        case 0x4031:
+            mapper.TransferComplete = false
+            mapper.DiskIrq = false
+            return mapper.ReadData
+        case 0x4032:
+            value := byte(0x40)
+            if !mapper.diskInserted() {
+                /* no disk, and not writable */
+                value |= 0x1 | 0x4
+            }
+            if !mapper.diskInserted() || !mapper.Scanning {
+                value |= 0x2
+            }
+            return value
+        case 0x4033:
+            /* bit 7 is the battery, which is always good */
+            return mapper.ExternalWrite & 0x7f | 0x80
+    }
+
+    if address >= 0x4040 && address <= 0x4092 {
+        return mapper.Audio.Read(address)
+    }
+
+    return 0
+}
+
+func (mapper *MapperFDS) WriteExpansion(cpu *CPUState, address uint16, value byte){
+    if address == 0x4023 {
+        mapper.DiskEnabled = value & 0x1 == 0x1
+        mapper.SoundEnabled = value & 0x2 == 0x2
+        if !mapper.DiskEnabled {
+            mapper.IrqEnabled = false
+            mapper.TimerIrq = false
+            mapper.DiskIrq = false
+        }
+        return
+    }
+
+    if address >= 0x4040 && address <= 0x408a {
+        if mapper.SoundEnabled {
+            mapper.Audio.Write(address, value)
+        }
+        return
+    }
+
+    if !mapper.DiskEnabled {
+        return
+    }
+
+    switch address {
+        case 0x4020:
+            mapper.IrqReload = (mapper.IrqReload & 0xff00) | uint16(value)
+        case 0x4021:
+            mapper.IrqReload = (mapper.IrqReload & 0xff) | uint16(value) << 8
+        case 0x4022:
+            mapper.IrqRepeat = value & 0x1 == 0x1
+            mapper.IrqEnabled = value & 0x2 == 0x2
+            if mapper.IrqEnabled {
+                mapper.IrqCounter = mapper.IrqReload
+            } else {
+                mapper.TimerIrq = false
+            }
+        case 0x4024:
+            mapper.WriteData = value
+            mapper.TransferComplete = false
+            mapper.DiskIrq = false
+        case 0x4025:
+            mapper.MotorOn = value & 0x1 == 0x1
+            mapper.ResetTransfer = value & 0x2 == 0x2
+            mapper.ReadMode = value & 0x4 == 0x4
+            if value & 0x8 == 0x8 {
+                cpu.PPU.SetHorizontalMirror()
+            } else {
+                cpu.PPU.SetVerticalMirror()
+            }
+            mapper.CrcControl = value & 0x10 == 0x10
+            mapper.TransferStart = value & 0x40 == 0x40
+            mapper.DiskIrqEnabled = value & 0x80 == 0x80
+            mapper.DiskIrq = false
+        case 0x4026:
+            mapper.ExternalWrite = value
+    }
+}
+
+func (mapper *MapperFDS) clockTimer(){
+    if !mapper.IrqEnabled {
+        return
+    }
+
+    if mapper.IrqCounter == 0 {
+        mapper.TimerIrq = true
+        mapper.IrqCounter = mapper.IrqReload
+        if !mapper.IrqRepeat {
+            mapper.IrqEnabled = false
+        }
+    } else {
+        mapper.IrqCounter -= 1
+    }
+}
+
+/* move the head along the disk one cpu cycle, reading or writing a byte every 150 cycles */
+func (mapper *MapperFDS) clockDisk(){
+    if mapper.InsertDelay > 0 {
+        mapper.InsertDelay -= 1
+    }
+
+    if !mapper.diskInserted() || !mapper.MotorOn {
+        mapper.EndOfHead = true
+        mapper.Scanning = false
+        return
+    }
+
+    if mapper.ResetTransfer && !mapper.Scanning {
+        return
+    }
+
+    /* the head goes back to the start of the disk */
+    if mapper.EndOfHead {
+        mapper.Delay = fdsSpinUpCycles
+        mapper.EndOfHead = false
+        mapper.Position = 0
+        mapper.GapEnded = false
+        return
+    }
+
+    if mapper.Delay > 0 {
+        mapper.Delay -= 1
+        return
+    }
+
+    mapper.Scanning = true
+
+    side := mapper.Disk[mapper.Side]
+    irq := mapper.DiskIrqEnabled
+
+    if mapper.ReadMode {
+        data := side[mapper.Position]
+
+        if !mapper.PreviousCrcControl {
+            mapper.Crc = fdsUpdateCRC(mapper.Crc, data)
+        }
+
+        if !mapper.TransferStart {
+            mapper.GapEnded = false
+            mapper.Crc = 0
+        } else if data != 0 && !mapper.GapEnded {
+            /* the start mark doesn't raise an irq */
+            mapper.GapEnded = true
+            irq = false
+        }
+
+        if mapper.GapEnded {
+            mapper.TransferComplete = true
+            mapper.ReadData = data
+            if irq {
+                mapper.DiskIrq = true
+            }
+        }
+    } else {
+        var data byte
+        if !mapper.CrcControl {
+            mapper.TransferComplete = true
+            data = mapper.WriteData
+            if irq {
+                mapper.DiskIrq = true
+            }
+        }
+
+        /* the gap */
+        if !mapper.TransferStart {
+            data = 0
+        }
+
+        if !mapper.CrcControl {
+            mapper.Crc = fdsUpdateCRC(mapper.Crc, data)
+        } else {
+            if !mapper.PreviousCrcControl {
+                mapper.Crc = fdsUpdateCRC(mapper.Crc, 0)
+                mapper.Crc = fdsUpdateCRC(mapper.Crc, 0)
+            }
+            data = byte(mapper.Crc)
+            mapper.Crc >>= 8
+        }
+
+        /* the write head is two bytes behind the read head */
+        if mapper.Position >= 2 {
+            side[mapper.Position - 2] = data
+        }
+        mapper.GapEnded = false
+    }
+
+    mapper.PreviousCrcControl = mapper.CrcControl
+
+    mapper.Position += 1
+    if mapper.Position >= len(side) {
+        mapper.MotorOn = false
+    } else {
+        mapper.Delay = fdsByteCycles
+    }
+}
+
+func (mapper *MapperFDS) RunCycles(cycles uint64){
+    for range cycles {
+        mapper.clockTimer()
+        mapper.clockDisk()
+    }
+}
+
+func (mapper *MapperFDS) RunAudio(cycles float64, cyclesPerSample float64){
+    mapper.Audio.Run(cycles)
+}
+
+func (mapper *MapperFDS) AudioOutput() float32 {
+    return mapper.Audio.GenerateSample()
+}
+
+/* bios is the 8k disksys.rom, and sides are from a .fds image */
+func MakeMapperFDS(bios []byte, sides [][]byte) (Mapper, error) {
+    if len(bios) != 0x2000 {
+        return nil, fmt.Errorf("the disk system bios should be 8k but is %v bytes", len(bios))
+    }
+
+    mapper := &MapperFDS{
+        Bios: bios,
+        PRGRam: make([]byte, 0x8000),
+        EndOfHead: true,
+        Audio: MakeFDSAudio(),
+    }
+
+    mapper.SetDiskImage(joinDiskSides(sides))
+
+    return mapper, nil
+}
@@ -0,0 +1,234 @@
+package lib
+
+import (
+    "bytes"
+    "testing"
+)
+
+/* a side with the disk info block, the file amount block and one 16 byte file */
+func makeTestDiskSide() []byte {
+    side := make([]byte, FDSSideSize)
+
+    info := make([]byte, 56)
+    copy(info, fdsDiskMagic)
+
+    header := make([]byte, 16)
+    header[0] = 3
+    header[13] = 16
+
+    data := make([]byte, 17)
+    data[0] = 4
+    for i := 1; i < len(data); i++ {
+        data[i] = byte(i * 3)
+    }
+
+    var blocks []byte
+    blocks = append(blocks, info...)
+    blocks = append(blocks, 2, 1)
+    blocks = append(blocks, header...)
+    blocks = append(blocks, data...)
+
+    copy(side, blocks)
+    return side
+}
+
+func TestFDSParse(test *testing.T){
+    side := makeTestDiskSide()
+
+    raw := addDiskGaps(side)
+    if !bytes.Equal(removeDiskGaps(raw), side) {
+        test.Fatalf("side changed after adding and removing the gaps")
+    }
+
+    /* a QD side has a crc after every block */
+    var qd []byte
+    offset := 0
+    for _, length := range []int{56, 2, 16, 17} {
+        qd = append(qd, side[offset:offset + length]...)
+        qd = append(qd, 0x12, 0x34)
+        offset += length
+    }
+    qd = append(qd, make([]byte, fdsQDSideSize - len(qd))...)
+
+    images := map[string][]byte{
+        "fwnes": append(append([]byte{'F', 'D', 'S', 0x1a, 2}, make([]byte, 11)...), append(bytes.Clone(side), side...)...),
+        "headerless": side,
+        "qd": qd,
+    }
+
+    for name, image := range images {
+        file, err := ParseNes(bytes.NewReader(image), false, name)
+        if err != nil {
+            test.Fatalf("%v: could not parse disk: %v", name, err)
+        }
+
+        if !file.IsDisk() || file.Mapper != 20 {
+            test.Fatalf("%v: expected a disk image", name)
+        }
+
+        for i, parsed := range file.DiskSides {
+            if !bytes.Equal(parsed, side) {
+                test.Fatalf("%v: side %v differs", name, i)
+            }
+        }
+    }
+}
+
+func makeTestFDS(test *testing.T) *MapperFDS {
+    mapper, err := MakeMapperFDS(make([]byte, 0x2000), [][]byte{makeTestDiskSide(), makeTestDiskSide()})
+    if err != nil {
+        test.Fatalf("could not make disk system: %v", err)
+    }
+    return mapper.(*MapperFDS)
+}
+
+func TestFDSTimerIrq(test *testing.T){
+    cpu := StartupState()
+    mapper := makeTestFDS(test)
+    cpu.SetMapper(mapper)
+
+    cpu.StoreMemory(0x4023, 0x1)
+    cpu.StoreMemory(0x4020, 100)
+    cpu.StoreMemory(0x4021, 0)
+    /* repeat */
+    cpu.StoreMemory(0x4022, 0x3)
+
+    mapper.RunCycles(100)
+    if mapper.IsIRQAsserted() {
+        test.Fatalf("irq raised too early")
+    }
+
+    mapper.RunCycles(1)
+    if !mapper.IsIRQAsserted() {
+        test.Fatalf("irq should be raised when the counter reaches 0")
+    }
+
+    if cpu.LoadMemory(0x4030) & 0x1 != 0x1 || mapper.IsIRQAsserted() {
+        test.Fatalf("reading $4030 should report and acknowledge the timer irq")
+    }
+
+    mapper.RunCycles(101)
+    if !mapper.IsIRQAsserted() {
+        test.Fatalf("irq should repeat")
+    }
+}
+
+func TestFDSDiskRead(test *testing.T){
+    cpu := StartupState()
+    mapper := makeTestFDS(test)
+    cpu.SetMapper(mapper)
+
+    cpu.StoreMemory(0x4023, 0x1)
+    /* motor on, read mode, wait for the gap to end, irq on every byte */
+    cpu.StoreMemory(0x4025, 0xe5)
+
+    var read []byte
+    for cycles := 0; len(read) < len(fdsDiskMagic) + 1; cycles++ {
+        if cycles > 1000000 {
+            test.Fatalf("timed out reading the disk, read %v", read)
+        }
+
+        mapper.RunCycles(1)
+        if mapper.IsIRQAsserted() {
+            read = append(read, cpu.LoadMemory(0x4031))
+        }
+    }
+
+    if !bytes.Equal(read[:len(fdsDiskMagic)], fdsDiskMagic) {
+        test.Fatalf("expected the disk info block but read %v", read)
+    }
+
+    /* switching sides leaves the drive empty for a while */
+    if side := mapper.SwitchDiskSide(); side != 1 {
+        test.Fatalf("expected side 1 but got %v", side)
+    }
+    if cpu.LoadMemory(0x4032) & 0x1 != 0x1 {
+        test.Fatalf("the drive should be empty while switching sides")
+    }
+    mapper.RunCycles(fdsInsertDelay)
+    if cpu.LoadMemory(0x4032) & 0x1 != 0 {
+        test.Fatalf("the disk should be inserted after switching sides")
+    }
+}
+
+func TestFDSDiskImage(test *testing.T){
+    mapper := makeTestFDS(test)
+    original := mapper.GetDiskImage()
+
+    if !bytes.Equal(original, append(makeTestDiskSide(), makeTestDiskSide()...)) {
+        test.Fatalf("disk image should be the same as the loaded sides")
+    }
+
+    modified := bytes.Clone(original)
+    modified[FDSSideSize + 57] = 5
+    mapper.SetDiskImage(modified)
+
+    if !bytes.Equal(mapper.GetDiskImage(), modified) {
+        test.Fatalf("disk image should have the changes")
+    }
+
+    patch, err := MakeIPSPatch(original, modified)
+    if err != nil {
+        test.Fatalf("could not make patch: %v", err)
+    }
+
+    patched, err := ApplyIPSPatch(original, patch)
+    if err != nil {
+        test.Fatalf("could not apply patch: %v", err)
+    }
+
+    if !bytes.Equal(patched, modified) {
+        test.Fatalf("patched disk differs")
+    }
+}
+
+func TestFDSAudio(test *testing.T){
+    audio := MakeFDSAudio()
+
+    audio.Write(0x4089, 0x80)
+    for i := range 64 {
+        audio.Write(0x4040 + uint16(i), byte(i))
+    }
+    audio.Write(0x4089, 0)
+
+    if audio.Read(0x4050) & 0x3f != 0x10 {
+        test.Fatalf("wave table was not written")
+    }
+
+    /* fixed volume of 32 and the highest pitch */
+    audio.Write(0x4080, 0x80 | 32)
+    audio.Write(0x4082, 0xff)
+    audio.Write(0x4083, 0x0f)
+
+    audio.Run(1000)
+    if audio.WavePosition == 0 {
+        test.Fatalf("wave did not advance")
+    }
+
+    if audio.GenerateSample() <= 0 {
+        test.Fatalf("expected sound at position %v", audio.WavePosition)
+    }
+}
+
+/* the master volume in $4089 scales the output by 2/2, 2/3, 2/4 or 2/5 */
+func TestFDSMasterVolume(test *testing.T){
+    audio := MakeFDSAudio()
+
+    audio.Write(0x4089, 0x80)
+    for i := range 64 {
+        audio.Write(0x4040 + uint16(i), 63)
+    }
+    audio.Write(0x4080, 0x80 | 32)
+
+    audio.Write(0x4089, 0)
+    full := audio.GenerateSample()
+
+    for volume, scale := range []float32{1, 2.0 / 3, 2.0 / 4, 2.0 / 5} {
+        audio.Write(0x4089, byte(volume))
+        sample := audio.GenerateSample()
+        /* the table is rounded to whole numbers, so allow a couple of steps of the 6-bit output */
+        if difference := sample - full * scale; difference > 2 * 0.36 / 63 || difference < -2 * 0.36 / 63 {
+            test.Fatalf("master volume %v: expected %v but got %v", volume, full * scale, sample)
+        }
+    }
+}
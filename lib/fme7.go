@@ -0,0 +1,498 @@
+package lib
+
+import (
+    "fmt"
+    "math"
+)
+
+/* Sunsoft 5B audio, a YM2149 (an AY-3-8910 clone) built into the FME-7.
+ * https://www.nesdev.org/wiki/Sunsoft_5B_audio
+ *
+ * Three square wave channels that can each mix in a shared noise generator, and a shared
+ * envelope generator that can drive any channel's volume instead of its fixed volume. The
+ * volume is logarithmic, 1.5db per step of the 5-bit envelope, and a fixed volume v is the
+ * same as envelope level 2v+1.
+ */
+
+const Sunsoft5BRegisterSelect = 0xc000
+const Sunsoft5BRegisterWrite = 0xe000
+
+/* the tone, noise and envelope counters are clocked once every 16 cpu cycles */
+const sunsoft5BTickCycles = 16
+
+var sunsoft5BVolume = func() [32]float64 {
+    var table [32]float64
+    for level := 1; level < len(table); level++ {
+        table[level] = math.Pow(10, -float64(31 - level) * 1.5 / 20)
+    }
+    return table
+}()
+
+type Sunsoft5BChannel struct {
+    /* 12 bits */
+    Period uint16 `json:"period"`
+    Counter uint16 `json:"counter"`
+    Output bool `json:"output"`
+    Volume byte `json:"volume"`
+    UseEnvelope bool `json:"useenvelope"`
+    ToneDisable bool `json:"tonedisable"`
+    NoiseDisable bool `json:"noisedisable"`
+}
+
+type Sunsoft5BAudio struct {
+    Register byte `json:"register"`
+    Channels [3]Sunsoft5BChannel `json:"channels"`
+
+    NoisePeriod byte `json:"noiseperiod"`
+    NoiseCounter uint16 `json:"noisecounter"`
+    /* 17-bit lfsr */
+    Noise uint32 `json:"noise"`
+
+    EnvelopePeriod uint16 `json:"envelopeperiod"`
+    EnvelopeCounter uint16 `json:"envelopecounter"`
+    EnvelopeShape byte `json:"envelopeshape"`
+    /* 0-31 */
+    EnvelopeStep byte `json:"envelopestep"`
+    EnvelopeAttack bool `json:"envelopeattack"`
+    EnvelopeHolding bool `json:"envelopeholding"`
+    EnvelopeLevel byte `json:"envelopelevel"`
+
+    /* cpu cycles until the next tick */
+    Cycles float64 `json:"cycles"`
+}
+
+func MakeSunsoft5BAudio() *Sunsoft5BAudio {
+    return &Sunsoft5BAudio{
+        Noise: 1,
+        EnvelopeHolding: true,
+    }
+}
+
+func (channel *Sunsoft5BChannel) SaveBinary(writer *StateWriter){
+    writer.Uint16(channel.Period)
+    writer.Uint16(channel.Counter)
+    writer.Bool(channel.Output)
+    writer.Byte(channel.Volume)
+    writer.Bool(channel.UseEnvelope)
+    writer.Bool(channel.ToneDisable)
+    writer.Bool(channel.NoiseDisable)
+}
+
+func (channel *Sunsoft5BChannel) LoadBinary(reader *StateReader){
+    channel.Period = reader.Uint16()
+    channel.Counter = reader.Uint16()
+    channel.Output = reader.Bool()
+    channel.Volume = reader.Byte()
+    channel.UseEnvelope = reader.Bool()
+    channel.ToneDisable = reader.Bool()
+    channel.NoiseDisable = reader.Bool()
+}
+
+func (audio *Sunsoft5BAudio) SaveBinary(writer *StateWriter){
+    writer.Byte(audio.Register)
+    for i := range audio.Channels {
+        audio.Channels[i].SaveBinary(writer)
+    }
+    writer.Byte(audio.NoisePeriod)
+    writer.Uint16(audio.NoiseCounter)
+    writer.Uint32(audio.Noise)
+    writer.Uint16(audio.EnvelopePeriod)
+    writer.Uint16(audio.EnvelopeCounter)
+    writer.Byte(audio.EnvelopeShape)
+    writer.Byte(audio.EnvelopeStep)
+    writer.Bool(audio.EnvelopeAttack)
+    writer.Bool(audio.EnvelopeHolding)
+    writer.Byte(audio.EnvelopeLevel)
+    writer.Float64(audio.Cycles)
+}
+
+func (audio *Sunsoft5BAudio) LoadBinary(reader *StateReader){
+    audio.Register = reader.Byte()
+    for i := range audio.Channels {
+        audio.Channels[i].LoadBinary(reader)
+    }
+    audio.NoisePeriod = reader.Byte()
+    audio.NoiseCounter = reader.Uint16()
+    audio.Noise = reader.Uint32()
+    audio.EnvelopePeriod = reader.Uint16()
+    audio.EnvelopeCounter = reader.Uint16()
+    audio.EnvelopeShape = reader.Byte()
+    audio.EnvelopeStep = reader.Byte()
+    audio.EnvelopeAttack = reader.Bool()
+    audio.EnvelopeHolding = reader.Bool()
+    audio.EnvelopeLevel = reader.Byte()
+    audio.Cycles = reader.Float64()
+}
+
+// returns true if the address is a 5B audio address
+func (audio *Sunsoft5BAudio) HandleWrite(address uint16, value byte) bool {
+    switch address & 0xe000 {
+        case Sunsoft5BRegisterSelect:
+            audio.Register = value & 0xf
+            return true
+        case Sunsoft5BRegisterWrite:
+            audio.WriteRegister(audio.Register, value)
+            return true
+    }
+
+    return false
+}
+
+func (audio *Sunsoft5BAudio) WriteRegister(register byte, value byte){
+    switch register {
+        case 0, 2, 4:
+            channel := &audio.Channels[register / 2]
+            channel.Period = (channel.Period & 0xf00) | uint16(value)
+        case 1, 3, 5:
+            channel := &audio.Channels[register / 2]
+            channel.Period = (channel.Period & 0xff) | (uint16(value & 0xf) << 8)
+        case 6:
+            audio.NoisePeriod = value & 0x1f
+        case 7:
+            for i := range audio.Channels {
+                audio.Channels[i].ToneDisable = value & (1 << i) != 0
+                audio.Channels[i].NoiseDisable = value & (1 << (i + 3)) != 0
+            }
+        case 8, 9, 10:
+            channel := &audio.Channels[register - 8]
+            channel.Volume = value & 0xf
+            channel.UseEnvelope = value & 0x10 == 0x10
+        case 11:
+            audio.EnvelopePeriod = (audio.EnvelopePeriod & 0xff00) | uint16(value)
+        case 12:
+            audio.EnvelopePeriod = (audio.EnvelopePeriod & 0xff) | (uint16(value) << 8)
+        case 13:
+            audio.EnvelopeShape = value & 0xf
+            audio.EnvelopeStep = 0
+            audio.EnvelopeCounter = 0
+            audio.EnvelopeHolding = false
+            audio.EnvelopeAttack = value & 0x4 == 0x4
+            audio.updateEnvelopeLevel()
+    }
+}
+
+func (audio *Sunsoft5BAudio) updateEnvelopeLevel(){
+    if audio.EnvelopeAttack {
+        audio.EnvelopeLevel = audio.EnvelopeStep
+    } else {
+        audio.EnvelopeLevel = 31 - audio.EnvelopeStep
+    }
+}
+
+/* move the envelope one of its 32 steps. the shape's bits are continue, attack, alternate and hold */
+func (audio *Sunsoft5BAudio) stepEnvelope(){
+    if audio.EnvelopeHolding {
+        return
+    }
+
+    audio.EnvelopeStep += 1
+    if audio.EnvelopeStep < 32 {
+        audio.updateEnvelopeLevel()
+        return
+    }
+
+    shape := audio.EnvelopeShape
+    continues := shape & 0x8 == 0x8
+    attack := shape & 0x4 == 0x4
+    alternate := shape & 0x2 == 0x2
+    hold := shape & 0x1 == 0x1
+
+    switch {
+        case !continues:
+            audio.EnvelopeHolding = true
+            audio.EnvelopeLevel = 0
+        case hold:
+            audio.EnvelopeHolding = true
+            if attack != alternate {
+                audio.EnvelopeLevel = 31
+            } else {
+                audio.EnvelopeLevel = 0
+            }
+        default:
+            if alternate {
+                audio.EnvelopeAttack = !audio.EnvelopeAttack
+            }
+            audio.EnvelopeStep = 0
+            audio.updateEnvelopeLevel()
+    }
+}
+
+func (audio *Sunsoft5BAudio) tick(){
+    for i := range audio.Channels {
+        channel := &audio.Channels[i]
+        channel.Counter += 1
+        if channel.Counter >= max(channel.Period, 1) {
+            channel.Counter = 0
+            channel.Output = !channel.Output
+        }
+    }
+
+    /* the noise runs at half the rate of the tones */
+    audio.NoiseCounter += 1
+    if audio.NoiseCounter >= max(uint16(audio.NoisePeriod), 1) * 2 {
+        audio.NoiseCounter = 0
+        bit := (audio.Noise ^ (audio.Noise >> 3)) & 0x1
+        audio.Noise = (audio.Noise >> 1) | (bit << 16)
+    }
+
+    audio.EnvelopeCounter += 1
+    if audio.EnvelopeCounter >= max(audio.EnvelopePeriod, 1) {
+        audio.EnvelopeCounter = 0
+        audio.stepEnvelope()
+    }
+}
+
+/* cycles is in cpu cycles */
+func (audio *Sunsoft5BAudio) Run(cycles float64){
+    audio.Cycles -= cycles
+    for audio.Cycles <= 0 {
+        audio.Cycles += sunsoft5BTickCycles
+        audio.tick()
+    }
+}
+
+func (audio *Sunsoft5BAudio) GenerateSample() float32 {
+    noise := audio.Noise & 0x1 == 0x1
+
+    var total float64
+    for i := range audio.Channels {
+        channel := &audio.Channels[i]
+        if !(channel.Output || channel.ToneDisable) || !(noise || channel.NoiseDisable) {
+            continue
+        }
+
+        level := audio.EnvelopeLevel
+        if !channel.UseEnvelope {
+            level = channel.Volume * 2 + 1
+            if channel.Volume == 0 {
+                level = 0
+            }
+        }
+        total += sunsoft5BVolume[level]
+    }
+
+    return float32(total * 0.15)
+}
+
+/* The Sunsoft FME-7 and 5B, used by batman: return of the joker, gimmick! and others (mapper 69).
+ * https://www.nesdev.org/wiki/Sunsoft_FME-7
+ *
+ * All of the banking goes through a command register at $8000 and a parameter register at
+ * $a000. The 5B is an FME-7 with the sound chip, and the sound registers are unused on an FME-7.
+ */
+type Mapper69 struct {
+    ProgramRom []byte `json:"programrom"`
+    CharacterRom []byte `json:"characterrom"`
+    PRGRam []byte `json:"prgram"`
+
+    Command byte `json:"command"`
+    /* $6000: bits 0-5 are the bank, bit 6 selects ram and bit 7 enables the ram */
+    PrgBank6000 byte `json:"prgbank6000"`
+    /* 8k banks at $8000, $a000 and $c000 */
+    PrgRegister [3]byte `json:"prgregister"`
+    ChrRegister [8]byte `json:"chrregister"`
+
+    /* counts down every cpu cycle, and raises an irq when it wraps around from 0 */
+    IrqCounter uint16 `json:"irqcounter"`
+    IrqCounterEnabled bool `json:"irqcounterenabled"`
+    IrqEnabled bool `json:"irqenabled"`
+    IrqPending bool `json:"irqpending"`
+
+    Audio *Sunsoft5BAudio `json:"audio"`
+}
+
+func (mapper *Mapper69) IsNSF() bool {
+    return false
+}
+
+func (mapper *Mapper69) Kind() int {
+    return 69
+}
+
+func (mapper *Mapper69) Compare(other Mapper) error {
+    return fmt.Errorf("mapper69 compare unimplemented")
+}
+
+func (mapper *Mapper69) Copy() Mapper {
+    out := *mapper
+    out.ProgramRom = copySlice(mapper.ProgramRom)
+    out.CharacterRom = copySlice(mapper.CharacterRom)
+    out.PRGRam = copySlice(mapper.PRGRam)
+    audio := *mapper.Audio
+    out.Audio = &audio
+    return &out
+}
+
+func (mapper *Mapper69) SaveBinary(writer *StateWriter){
+    writer.Bytes(mapper.ProgramRom)
+    writer.Bytes(mapper.CharacterRom)
+    writer.Bytes(mapper.PRGRam)
+    writer.Byte(mapper.Command)
+    writer.Byte(mapper.PrgBank6000)
+    for _, value := range mapper.PrgRegister {
+        writer.Byte(value)
+    }
+    for _, value := range mapper.ChrRegister {
+        writer.Byte(value)
+    }
+    writer.Uint16(mapper.IrqCounter)
+    writer.Bool(mapper.IrqCounterEnabled)
+    writer.Bool(mapper.IrqEnabled)
+    writer.Bool(mapper.IrqPending)
+    mapper.Audio.SaveBinary(writer)
+}
+
+func (mapper *Mapper69) LoadBinary(reader *StateReader){
+    mapper.ProgramRom = reader.Bytes()
+    mapper.CharacterRom = reader.Bytes()
+    mapper.PRGRam = reader.Bytes()
+    mapper.Command = reader.Byte()
+    mapper.PrgBank6000 = reader.Byte()
+    for i := range mapper.PrgRegister {
+        mapper.PrgRegister[i] = reader.Byte()
+    }
+    for i := range mapper.ChrRegister {
+        mapper.ChrRegister[i] = reader.Byte()
+    }
+    mapper.IrqCounter = reader.Uint16()
+    mapper.IrqCounterEnabled = reader.Bool()
+    mapper.IrqEnabled = reader.Bool()
+    mapper.IrqPending = reader.Bool()
+    mapper.Audio = MakeSunsoft5BAudio()
+    mapper.Audio.LoadBinary(reader)
+}
+
+func (mapper *Mapper69) IsIRQAsserted() bool {
+    return mapper.IrqPending
+}
+
+func (mapper *Mapper69) GetPRGRam() []byte {
+    return mapper.PRGRam
+}
+
+func (mapper *Mapper69) RunCycles(cycles uint64){
+    if !mapper.IrqCounterEnabled {
+        return
+    }
+
+    if cycles > uint64(mapper.IrqCounter) && mapper.IrqEnabled {
+        mapper.IrqPending = true
+    }
+    mapper.IrqCounter -= uint16(cycles)
+}
+
+func (mapper *Mapper69) RunAudio(cycles float64, cyclesPerSample float64){
+    mapper.Audio.Run(cycles)
+}
+
+func (mapper *Mapper69) AudioOutput() float32 {
+    return mapper.Audio.GenerateSample()
+}
+
+func (mapper *Mapper69) readProgram(bank int, offset uint16) byte {
+    pages := len(mapper.ProgramRom) / 0x2000
+    return mapper.ProgramRom[(bank % pages) * 0x2000 + int(offset)]
+}
+
+func (mapper *Mapper69) ramSelected() bool {
+    return mapper.PrgBank6000 & 0x40 == 0x40
+}
+
+func (mapper *Mapper69) ramEnabled() bool {
+    return mapper.ramSelected() && mapper.PrgBank6000 & 0x80 == 0x80 && len(mapper.PRGRam) > 0
+}
+
+func (mapper *Mapper69) ramAddress(address uint16) int {
+    offset := int(mapper.PrgBank6000 & 0x3f) * 0x2000 + int(address - 0x6000)
+    return offset % len(mapper.PRGRam)
+}
+
+func (mapper *Mapper69) Read(address uint16) byte {
+    switch {
+        case address >= 0x6000 && address < 0x8000:
+            if !mapper.ramSelected() {
+                return mapper.readProgram(int(mapper.PrgBank6000 & 0x3f), address & 0x1fff)
+            }
+            if mapper.ramEnabled() {
+                return mapper.PRGRam[mapper.ramAddress(address)]
+            }
+            return 0
+        case address >= 0x8000 && address < 0xe000:
+            index := (address - 0x8000) / 0x2000
+            return mapper.readProgram(int(mapper.PrgRegister[index]), address & 0x1fff)
+        case address >= 0xe000:
+            return mapper.readProgram(len(mapper.ProgramRom) / 0x2000 - 1, address & 0x1fff)
+    }
+
+    return 0
+}
+
+/* eight 1k chr banks */
+func (mapper *Mapper69) ReadPPU(ppu *PPUState, address uint16) byte {
+    var bank int
+    if address < 0x2000 {
+        bank = int(mapper.ChrRegister[address / 0x400])
+    }
+    return readChrBank(ppu, mapper.CharacterRom, address, bank, 0x400)
+}
+
+func (mapper *Mapper69) WritePPU(ppu *PPUState, address uint16, value byte){
+    writeChrBank(ppu, mapper.CharacterRom, address, value)
+}
+
+func (mapper *Mapper69) writeCommand(ppu *PPUState, value byte){
+    switch mapper.Command {
+        case 0, 1, 2, 3, 4, 5, 6, 7:
+            mapper.ChrRegister[mapper.Command] = value
+        case 8:
+            mapper.PrgBank6000 = value
+        case 9, 10, 11:
+            mapper.PrgRegister[mapper.Command - 9] = value & 0x3f
+        case 12:
+            switch value & 0x3 {
+                case 0: ppu.SetVerticalMirror()
+                case 1: ppu.SetHorizontalMirror()
+                case 2: ppu.SetScreenAMirror()
+                case 3: ppu.SetScreenBMirror()
+            }
+        case 13:
+            mapper.IrqEnabled = value & 0x1 == 0x1
+            mapper.IrqCounterEnabled = value & 0x80 == 0x80
+            mapper.IrqPending = false
+        case 14:
+            mapper.IrqCounter = (mapper.IrqCounter & 0xff00) | uint16(value)
+        case 15:
+            mapper.IrqCounter = (mapper.IrqCounter & 0xff) | (uint16(value) << 8)
+    }
+}
+
+func (mapper *Mapper69) Write(cpu *CPUState, address uint16, value byte) error {
+    switch {
+        case address >= 0x6000 && address < 0x8000:
+            if mapper.ramEnabled() {
+                mapper.PRGRam[mapper.ramAddress(address)] = value
+            }
+        case address < 0xa000:
+            mapper.Command = value & 0xf
+        case address < 0xc000:
+            mapper.writeCommand(&cpu.PPU, value)
+        default:
+            mapper.Audio.HandleWrite(address, value)
+    }
+
+    return nil
+}
+
+func MakeMapper69(info MapperInfo, programRom []byte, chrMemory []byte) Mapper {
+    ramSize := 0x2000
+    if info.Nes2 {
+        ramSize = int(info.TotalPRGRam())
+    }
+
+    return &Mapper69{
+        ProgramRom: programRom,
+        CharacterRom: chrMemory,
+        PRGRam: make([]byte, ramSize),
+        Audio: MakeSunsoft5BAudio(),
+    }
+}
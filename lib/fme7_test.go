@@ -0,0 +1,127 @@
+package lib
+
+import (
+    "testing"
+)
+
+func TestFME7Banking(test *testing.T){
+    mapper := MakeMapper69(MapperInfo{Mapper: 69}, makeMapperTestRom(0x20000, nil), makeBankedChr(0x20000)).(*Mapper69)
+    cpu := StartupState()
+    cpu.SetMapper(mapper)
+
+    /* each 8k page of the test rom has its page number at 0x1000 */
+    cpu.StoreMemory(0x8000, 0x9)
+    cpu.StoreMemory(0xa000, 5)
+    if value := cpu.LoadMemory(0x9000); value != 5 {
+        test.Fatalf("expected page 5 at $8000 but got %v", value)
+    }
+    if value := cpu.LoadMemory(0xf000); value != 15 {
+        test.Fatalf("expected the last page at $e000 but got %v", value)
+    }
+
+    /* 1k chr bank 0x4a at $0c00 */
+    cpu.StoreMemory(0x8000, 3)
+    cpu.StoreMemory(0xa000, 0x4a)
+    if value := readPPUData(&cpu, 0x0c00); value != 0x4a {
+        test.Fatalf("expected chr bank 0x4a at $0c00 but got 0x%x", value)
+    }
+
+    /* rom at $6000 */
+    cpu.StoreMemory(0x8000, 0x8)
+    cpu.StoreMemory(0xa000, 3)
+    if value := cpu.LoadMemory(0x7000); value != 3 {
+        test.Fatalf("expected page 3 at $6000 but got %v", value)
+    }
+
+    /* ram selected but disabled */
+    cpu.StoreMemory(0xa000, 0x40)
+    cpu.StoreMemory(0x6000, 0x42)
+    if value := cpu.LoadMemory(0x6000); value != 0 {
+        test.Fatalf("expected disabled ram to read as 0 but got 0x%x", value)
+    }
+
+    cpu.StoreMemory(0xa000, 0xc0)
+    cpu.StoreMemory(0x6000, 0x42)
+    if value := cpu.LoadMemory(0x6000); value != 0x42 {
+        test.Fatalf("expected 0x42 in prg ram but got 0x%x", value)
+    }
+}
+
+func TestFME7Irq(test *testing.T){
+    mapper := MakeMapper69(MapperInfo{Mapper: 69}, makeMapperTestRom(0x20000, nil), nil).(*Mapper69)
+    cpu := StartupState()
+    cpu.SetMapper(mapper)
+
+    cpu.StoreMemory(0x8000, 0xe)
+    cpu.StoreMemory(0xa000, 0x10)
+    cpu.StoreMemory(0x8000, 0xf)
+    cpu.StoreMemory(0xa000, 0)
+    cpu.StoreMemory(0x8000, 0xd)
+    cpu.StoreMemory(0xa000, 0x81)
+
+    /* the irq happens when the counter wraps from 0 to $ffff */
+    mapper.RunCycles(0x10)
+    if mapper.IsIRQAsserted() {
+        test.Fatalf("irq raised too early")
+    }
+    mapper.RunCycles(1)
+    if !mapper.IsIRQAsserted() || mapper.IrqCounter != 0xffff {
+        test.Fatalf("irq should be raised, counter 0x%x", mapper.IrqCounter)
+    }
+
+    /* any write to the control register acknowledges */
+    cpu.StoreMemory(0xa000, 0x80)
+    if mapper.IsIRQAsserted() {
+        test.Fatalf("irq should be acknowledged")
+    }
+    mapper.RunCycles(0x10000)
+    if mapper.IsIRQAsserted() {
+        test.Fatalf("irq should not be raised while disabled")
+    }
+}
+
+func TestSunsoft5BAudio(test *testing.T){
+    audio := MakeSunsoft5BAudio()
+
+    /* channel A, tone only, full volume */
+    audio.HandleWrite(0xc000, 0)
+    audio.HandleWrite(0xe000, 0x10)
+    audio.HandleWrite(0xc000, 7)
+    audio.HandleWrite(0xe000, 0x3e)
+    audio.HandleWrite(0xc000, 8)
+    audio.HandleWrite(0xe000, 0xf)
+
+    /* the tone toggles every 16 * period cpu cycles */
+    high := 0
+    for range 64 {
+        audio.Run(16)
+        if audio.GenerateSample() > 0 {
+            high += 1
+        }
+    }
+    if high != 32 {
+        test.Fatalf("expected a square wave with half of the samples high but got %v", high)
+    }
+
+    /* a decaying envelope that holds at 0 */
+    audio.HandleWrite(0xc000, 8)
+    audio.HandleWrite(0xe000, 0x10)
+    audio.HandleWrite(0xc000, 11)
+    audio.HandleWrite(0xe000, 1)
+    audio.HandleWrite(0xc000, 13)
+    audio.HandleWrite(0xe000, 0)
+    if audio.EnvelopeLevel != 31 {
+        test.Fatalf("expected the envelope to start at 31 but got %v", audio.EnvelopeLevel)
+    }
+    audio.Run(16 * 40)
+    if audio.EnvelopeLevel != 0 || !audio.EnvelopeHolding {
+        test.Fatalf("expected the envelope to hold at 0 but got %v", audio.EnvelopeLevel)
+    }
+
+    /* attack then hold high */
+    audio.HandleWrite(0xe000, 0xd)
+    audio.Run(16 * 40)
+    if audio.EnvelopeLevel != 31 {
+        test.Fatalf("expected the envelope to hold at 31 but got %v", audio.EnvelopeLevel)
+    }
+}
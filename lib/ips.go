@@ -0,0 +1,114 @@
+package lib
+
+import (
+    "bytes"
+    "fmt"
+)
+
+/* IPS patches, a list of (offset, data) records. The disk system saves the changes a game made
+ * to its disk as a patch against the original image, so the original file is never modified.
+ * https://zerosoft.zophar.net/ips.php
+ */
+
+var ipsMagic = []byte("PATCH")
+var ipsEnd = []byte("EOF")
+
+/* offsets are 3 bytes */
+const ipsMaxOffset = 0xffffff
+const ipsMaxRecord = 0xffff
+
+/* a record at this offset would look like the end of the patch */
+const ipsEndOffset = 0x454f46
+
+/* make a patch that turns original into modified. modified can be longer than original, but
+ * not shorter since ips has no way to truncate
+ */
+func MakeIPSPatch(original []byte, modified []byte) ([]byte, error) {
+    var out bytes.Buffer
+    out.Write(ipsMagic)
+
+    differs := func(position int) bool {
+        return position >= len(original) || original[position] != modified[position]
+    }
+
+    position := 0
+    for position < len(modified) {
+        if !differs(position) {
+            position += 1
+            continue
+        }
+
+        start := position
+        if start == ipsEndOffset {
+            start -= 1
+        }
+
+        if start > ipsMaxOffset {
+            return nil, fmt.Errorf("ips patches cannot change data past offset 0x%x", ipsMaxOffset)
+        }
+
+        end := position
+        for end < len(modified) && end - start < ipsMaxRecord && differs(end) {
+            end += 1
+        }
+
+        out.Write([]byte{byte(start >> 16), byte(start >> 8), byte(start)})
+        out.Write([]byte{byte((end - start) >> 8), byte(end - start)})
+        out.Write(modified[start:end])
+
+        position = end
+    }
+
+    out.Write(ipsEnd)
+
+    return out.Bytes(), nil
+}
+
+/* returns a patched copy of data, which grows if the patch writes past the end */
+func ApplyIPSPatch(data []byte, patch []byte) ([]byte, error) {
+    if !bytes.HasPrefix(patch, ipsMagic) {
+        return nil, fmt.Errorf("not an ips patch")
+    }
+
+    out := bytes.Clone(data)
+
+    write := func(offset int, values []byte){
+        if offset + len(values) > len(out) {
+            out = append(out, make([]byte, offset + len(values) - len(out))...)
+        }
+        copy(out[offset:], values)
+    }
+
+    position := len(ipsMagic)
+    for {
+        /* some patches have a truncation size after the end marker, which is ignored */
+        if bytes.HasPrefix(patch[position:], ipsEnd) {
+            return out, nil
+        }
+
+        if position + 5 > len(patch) {
+            return nil, fmt.Errorf("ips patch is truncated at 0x%x", position)
+        }
+
+        offset := int(patch[position]) << 16 | int(patch[position + 1]) << 8 | int(patch[position + 2])
+        size := int(patch[position + 3]) << 8 | int(patch[position + 4])
+        position += 5
+
+        /* a size of 0 is a run of a single value */
+        if size == 0 {
+            if position + 3 > len(patch) {
+                return nil, fmt.Errorf("ips patch is truncated at 0x%x", position)
+            }
+            count := int(patch[position]) << 8 | int(patch[position + 1])
+            write(offset, bytes.Repeat([]byte{patch[position + 2]}, count))
+            position += 3
+            continue
+        }
+
+        if position + size > len(patch) {
+            return nil, fmt.Errorf("ips patch is truncated at 0x%x", position)
+        }
+        write(offset, patch[position:position + size])
+        position += size
+    }
+}
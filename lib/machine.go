@@ -0,0 +1,185 @@
+package lib
+
+import (
+    "log"
+    "fmt"
+)
+
+/* mappers that produce their own audio (vrc6, etc) implement this so that the machine
+ * can clock them alongside the apu. cycles and cyclesPerSample are in cpu cycles
+ */
+type AudioMapper interface {
+    RunAudio(cycles float64, cyclesPerSample float64)
+}
+
+/* mappers with a counter that is clocked by the cpu, such as the konami vrc irq, implement
+ * this so that the machine can clock them after every instruction
+ */
+type CycleMapper interface {
+    RunCycles(cycles uint64)
+}
+
+/* mappers whose timing depends on the region, such as the mmc5 with its own audio frame counter,
+ * implement this. the cpu passes the region on when the mapper is set and when the region changes
+ */
+type RegionMapper interface {
+    SetRegion(region Region)
+}
+
+/* cartridge mappers with expansion audio implement this so that their output is mixed into
+ * every sample the apu generates, rather than going through a separate audio stream
+ */
+type MixedAudioMapper interface {
+    AudioOutput() float32
+}
+
+/* A Machine owns the loop that steps the cpu, then catches the apu and ppu up
+ * to the number of cycles the cpu used. Frontends, tools and tests should all drive
+ * the emulator through a Machine so that timing changes only have to happen here.
+ */
+type Machine struct {
+    CPU *CPUState
+    Table InstructionTable
+    /* the ppu renders into this screen */
+    Screen VirtualScreen
+
+    /* apu cycles per audio sample. frontends scale this by the emulation speed */
+    CyclesPerSample float64
+
+    /* nsf playback only needs the cpu and apu */
+    AudioOnly bool
+
+    /* called after the ppu finishes drawing a frame. the screen is reused
+     * for the next frame, so copy it if it needs to be kept around
+     */
+    FrameComplete func(screen VirtualScreen)
+
+    /* called for each audio sample produced by the apu */
+    AudioSample func(sample float32)
+
+    /* cpu cycle that the apu/ppu have been run up to */
+    lastCycle uint64
+    /* cycles RunCycles ran past its target, subtracted from the next call */
+    overshoot float64
+    frameDone bool
+}
+
+func MakeMachine(cpu *CPUState, sampleRate float32) *Machine {
+    return &Machine{
+        CPU: cpu,
+        Table: MakeInstructionDescriptiontable(),
+        Screen: MakeVirtualScreen(VideoWidth, VideoHeight),
+        /* about 20.292 for 44.1khz on ntsc */
+        CyclesPerSample: cpu.GetRegion().Timing().CPUSpeed / 2 / float64(sampleRate),
+        lastCycle: cpu.Cycle,
+    }
+}
+
+/* call this when the cpu state was replaced out from under the machine, such as loading a save state.
+ * also forgets any cycles that RunCycles ran over by
+ */
+func (machine *Machine) Sync(){
+    machine.lastCycle = machine.CPU.Cycle
+    machine.overshoot = 0
+}
+
+/* run the apu and ppu for however many cycles the cpu has used since the last time */
+func (machine *Machine) catchUp() {
+    cpu := machine.CPU
+    cycles := cpu.Cycle - machine.lastCycle
+    lastCycle := machine.lastCycle
+    machine.lastCycle = cpu.Cycle
+
+    sample, count := cpu.APU.Run(float64(cycles) / 2.0, machine.CyclesPerSample, cpu)
+    if machine.AudioSample != nil {
+        for range count {
+            machine.AudioSample(sample)
+        }
+    }
+
+    if counter, ok := cpu.Mapper.Mapper.(CycleMapper); ok {
+        counter.RunCycles(cycles)
+    }
+
+    if audio, ok := cpu.Mapper.Mapper.(AudioMapper); ok {
+        audio.RunAudio(float64(cycles), machine.CyclesPerSample * 2)
+    }
+
+    if machine.AudioOnly {
+        return
+    }
+
+    /* ppu runs 3 times faster than cpu on ntsc, and 3.2 times faster on pal. the dots are
+     * computed from the total cycle count so the fractional dots on pal aren't lost
+     */
+    timing := cpu.PPU.Region.Timing()
+    nmi, drawn := cpu.PPU.Run(timing.PPUDots(cpu.Cycle) - timing.PPUDots(lastCycle), machine.Screen, cpu.Mapper.Mapper)
+
+    if drawn {
+        machine.frameDone = true
+        if machine.FrameComplete != nil {
+            machine.FrameComplete(machine.Screen)
+        }
+    }
+
+    if nmi {
+        if cpu.Debug > 0 {
+            log.Printf("Cycle %v Do NMI\n", cpu.Cycle)
+        }
+        cpu.NMI()
+    }
+}
+
+/* execute one cpu instruction and run the rest of the system to match. returns the number of cpu cycles used */
+func (machine *Machine) StepInstruction() (uint64, error) {
+    start := machine.CPU.Cycle
+    err := machine.CPU.Run(machine.Table)
+    if err != nil {
+        return 0, err
+    }
+
+    machine.catchUp()
+
+    return machine.CPU.Cycle - start, nil
+}
+
+/* let time pass without executing any instructions */
+func (machine *Machine) Idle(cycles uint64) {
+    machine.CPU.Cycle += cycles
+    machine.catchUp()
+}
+
+/* run instructions until at least the given number of cpu cycles have elapsed. any extra
+ * cycles used by the last instruction are taken out of the next call
+ */
+func (machine *Machine) RunCycles(cycles float64) error {
+    counter := cycles - machine.overshoot
+    for counter > 0 {
+        used, err := machine.StepInstruction()
+        if err != nil {
+            return err
+        }
+        counter -= float64(used)
+    }
+
+    machine.overshoot = -counter
+
+    return nil
+}
+
+/* run until the ppu finishes drawing the current frame */
+func (machine *Machine) StepFrame() error {
+    if machine.AudioOnly {
+        return fmt.Errorf("cannot step a frame without the ppu")
+    }
+
+    machine.frameDone = false
+    for !machine.frameDone {
+        _, err := machine.StepInstruction()
+        if err != nil {
+            return err
+        }
+    }
+
+    return nil
+}
@@ -0,0 +1,76 @@
+package lib
+
+import (
+    "testing"
+)
+
+/* a 16k mapper0 rom that just loops on a jmp at 0x8000 */
+func makeLoopMachine() (*Machine, *CPUState) {
+    rom := make([]byte, 0x4000)
+    copy(rom, []byte{0x4c, 0x00, 0x80})
+    /* reset vector */
+    rom[0x3ffc] = 0x00
+    rom[0x3ffd] = 0x80
+
+    cpu := StartupState()
+    cpu.SetMapper(MakeMapper0(rom))
+    cpu.Reset()
+
+    return MakeMachine(&cpu, 44100), &cpu
+}
+
+func TestMachineStepFrame(test *testing.T){
+    machine, cpu := makeLoopMachine()
+
+    frames := 0
+    machine.FrameComplete = func(screen VirtualScreen){
+        frames += 1
+    }
+
+    samples := 0
+    machine.AudioSample = func(sample float32){
+        samples += 1
+    }
+
+    err := machine.StepFrame()
+    if err != nil {
+        test.Fatalf("could not step frame: %v", err)
+    }
+
+    start := cpu.Cycle
+    err = machine.StepFrame()
+    if err != nil {
+        test.Fatalf("could not step frame: %v", err)
+    }
+
+    if frames != 2 {
+        test.Fatalf("expected 2 frames but got %v", frames)
+    }
+
+    /* 341 * 262 / 3 = 29780.67 cpu cycles per frame, give or take one instruction */
+    used := cpu.Cycle - start
+    if used < 29775 || used > 29786 {
+        test.Fatalf("frame took %v cycles", used)
+    }
+
+    /* 44100 / 60 = 735 samples per frame */
+    if samples < 1400 || samples > 1500 {
+        test.Fatalf("unexpected number of samples %v", samples)
+    }
+}
+
+func TestMachineRunCycles(test *testing.T){
+    machine, cpu := makeLoopMachine()
+
+    for range 10 {
+        err := machine.RunCycles(1000)
+        if err != nil {
+            test.Fatalf("could not run cycles: %v", err)
+        }
+    }
+
+    /* overshoot from one call is taken out of the next, so we can only be off by the last instruction */
+    if cpu.Cycle < 10000 || cpu.Cycle > 10003 + 7 {
+        test.Fatalf("ran for %v cycles", cpu.Cycle)
+    }
+}
@@ -145,7 +145,7 @@ func (state *MapperState) UnmarshalJSON(data []byte) error {
             }
             state.Mapper = &mapper.Mapper0
             */
-        case 1:
+        case 1, 155:
             mapper1, err := unmarshalMapper[*Mapper1](data)
             if err != nil {
                 return err
@@ -173,6 +173,13 @@ func (state *MapperState) UnmarshalJSON(data []byte) error {
             }
             state.Mapper = mapper4
             return nil
+        case 5:
+            mapper5, err := unmarshalMapper[*Mapper5](data)
+            if err != nil {
+                return err
+            }
+            state.Mapper = mapper5
+            return nil
         case 7:
             mapper7, err := unmarshalMapper[*Mapper7](data)
             if err != nil {
@@ -187,6 +194,111 @@ func (state *MapperState) UnmarshalJSON(data []byte) error {
             }
             state.Mapper = mapper9
             return nil
+        case 19:
+            mapper19, err := unmarshalMapper[*Mapper19](data)
+            if err != nil {
+                return err
+            }
+            state.Mapper = mapper19
+            return nil
+        case 20:
+            fds, err := unmarshalMapper[*MapperFDS](data)
+            if err != nil {
+                return err
+            }
+            state.Mapper = fds
+            return nil
+        case 21, 22, 23, 25:
+            vrc4, err := unmarshalMapper[*MapperVRC4](data)
+            if err != nil {
+                return err
+            }
+            state.Mapper = vrc4
+            return nil
+        case 24:
+            mapper24, err := unmarshalMapper[*Mapper24](data)
+            if err != nil {
+                return err
+            }
+            state.Mapper = mapper24
+            return nil
+        case 26:
+            mapper26, err := unmarshalMapper[*Mapper26](data)
+            if err != nil {
+                return err
+            }
+            state.Mapper = mapper26
+            return nil
+        case 85:
+            mapper85, err := unmarshalMapper[*Mapper85](data)
+            if err != nil {
+                return err
+            }
+            state.Mapper = mapper85
+            return nil
+        case 69:
+            mapper69, err := unmarshalMapper[*Mapper69](data)
+            if err != nil {
+                return err
+            }
+            state.Mapper = mapper69
+            return nil
+        case 11:
+            mapper11, err := unmarshalMapper[*Mapper11](data)
+            if err != nil {
+                return err
+            }
+            state.Mapper = mapper11
+            return nil
+        case 34:
+            mapper34, err := unmarshalMapper[*Mapper34](data)
+            if err != nil {
+                return err
+            }
+            state.Mapper = mapper34
+            return nil
+        case 66:
+            mapper66, err := unmarshalMapper[*Mapper66](data)
+            if err != nil {
+                return err
+            }
+            state.Mapper = mapper66
+            return nil
+        case 71:
+            mapper71, err := unmarshalMapper[*Mapper71](data)
+            if err != nil {
+                return err
+            }
+            state.Mapper = mapper71
+            return nil
+        case 79:
+            mapper79, err := unmarshalMapper[*Mapper79](data)
+            if err != nil {
+                return err
+            }
+            state.Mapper = mapper79
+            return nil
+        case 99:
+            mapper99, err := unmarshalMapper[*Mapper99](data)
+            if err != nil {
+                return err
+            }
+            state.Mapper = mapper99
+            return nil
+        case 206:
+            mapper206, err := unmarshalMapper[*Mapper206](data)
+            if err != nil {
+                return err
+            }
+            state.Mapper = mapper206
+            return nil
+        case 232:
+            mapper232, err := unmarshalMapper[*Mapper232](data)
+            if err != nil {
+                return err
+            }
+            state.Mapper = mapper232
+            return nil
     }
 
     return fmt.Errorf("could not deserialize mapper. unknown mapper type %v", state.Kind)
@@ -206,21 +318,72 @@ func compareSlice[T comparable](slice1 []T, slice2 []T) error {
     return nil
 }
 
-func MakeMapper(mapper uint32, programRom []byte, chrMemory []byte) (Mapper, error) {
-    switch mapper {
-        case 0: return MakeMapper0(programRom), nil
-        case 1: return MakeMapper1(programRom, chrMemory), nil
+/* mappers with ram at 0x6000-0x7fff implement this so the ram can be
+ * saved to disk for games that have a battery
+ */
+type PRGRamMapper interface {
+    GetPRGRam() []byte
+}
+
+/* mappers with registers or memory in the expansion area at 0x4020-0x5fff implement this,
+ * such as the mmc5. other mappers never see accesses to that range
+ */
+type ExpansionMapper interface {
+    ReadExpansion(address uint16) byte
+    WriteExpansion(cpu *CPUState, address uint16, value byte)
+}
+
+/* mappers that also see the writes to $4016, such as the vs. system's mapper 99 which
+ * switches banks with bit 2
+ */
+type InputPollMapper interface {
+    WriteInputPoll(cpu *CPUState, value byte)
+}
+
+/* the info comes from the rom header, and lets boards that come in different configurations
+ * set themselves up correctly
+ */
+func MakeMapper(info MapperInfo, programRom []byte, chrMemory []byte) (Mapper, error) {
+    switch info.Mapper {
+        case 0:
+            mapper := &Mapper0{
+                BankMemory: programRom,
+            }
+            /* nrom boards don't have prg ram, except for a few like family basic */
+            if (info.Nes2 && info.TotalPRGRam() > 0) || (!info.Nes2 && info.Battery) {
+                mapper.PRGRam = make([]byte, 0x2000)
+            }
+            return mapper, nil
+        case 1, 155: return MakeMapper1(info, programRom, chrMemory), nil
         case 2: return MakeMapper2(programRom), nil
         case 3: return MakeMapper3(programRom, chrMemory), nil
-        case 4: return MakeMapper4(programRom, chrMemory), nil
+        case 4: return MakeMapper4(info, programRom, chrMemory), nil
+        case 5: return MakeMapper5(info, programRom, chrMemory), nil
         case 7: return MakeMapper7(programRom, chrMemory), nil
         case 9: return MakeMapper9(programRom, chrMemory), nil
-        default: return nil, fmt.Errorf("Unimplemented mapper %v", mapper)
+        case 19: return MakeMapper19(programRom, chrMemory), nil
+        case 21, 22, 23, 25: return MakeMapperVRC4(info, programRom, chrMemory), nil
+        case 24: return MakeMapper24(programRom, chrMemory), nil
+        case 26: return MakeMapper26(programRom, chrMemory), nil
+        case 69: return MakeMapper69(info, programRom, chrMemory), nil
+        case 11: return MakeMapper11(programRom, chrMemory), nil
+        case 34: return MakeMapper34(info, programRom, chrMemory), nil
+        case 66: return MakeMapper66(programRom, chrMemory), nil
+        case 71: return MakeMapper71(info, programRom), nil
+        case 79: return MakeMapper79(programRom, chrMemory), nil
+        case 99: return MakeMapper99(programRom, chrMemory), nil
+        case 206: return MakeMapper206(programRom, chrMemory), nil
+        case 232: return MakeMapper232(info, programRom), nil
+        case 85: return MakeMapper85(info, programRom, chrMemory), nil
+        case 20: return nil, fmt.Errorf("the famicom disk system needs a bios and a disk, use MakeMapperFDS")
+        default: return nil, fmt.Errorf("Unimplemented mapper %v", info.Mapper)
     }
 }
 
 type Mapper0 struct {
     BankMemory []byte `json:"bank"`
+    /* nil if the board has no prg ram */
+    PRGRam []byte `json:"prgram,omitempty"`
 }
 
 func (mapper *Mapper0) IsNSF() bool {
@@ -267,12 +430,40 @@ func copySlice2[T any](x [2]T) [2]T {
 }
 
 func (mapper *Mapper0) Copy() Mapper {
+    var ram []byte
+    if mapper.PRGRam != nil {
+        ram = copySlice(mapper.PRGRam)
+    }
+
     return &Mapper0{
         BankMemory: copySlice(mapper.BankMemory),
+        PRGRam: ram,
     }
 }
 
+func (mapper *Mapper0) SaveBinary(writer *StateWriter){
+    writer.Bytes(mapper.BankMemory)
+    writer.Bytes(mapper.PRGRam)
+}
+
+func (mapper *Mapper0) LoadBinary(reader *StateReader){
+    mapper.BankMemory = reader.Bytes()
+    mapper.PRGRam = nil
+    if reader.Version >= 3 {
+        mapper.PRGRam = reader.Bytes()
+    }
+}
+
+func (mapper *Mapper0) GetPRGRam() []byte {
+    return mapper.PRGRam
+}
+
 func (mapper *Mapper0) Write(cpu *CPUState, address uint16, value byte) error {
+    if address >= 0x6000 && address < 0x8000 && mapper.PRGRam != nil {
+        mapper.PRGRam[address - 0x6000] = value
+        return nil
+    }
+
     return fmt.Errorf("mapper0 does not support bank switching at address 0x%x: 0x%x", address, value)
 }
 
@@ -281,6 +472,13 @@ func (mapper *Mapper0) IsIRQAsserted() bool {
 }
 
 func (mapper *Mapper0) Read(address uint16) byte {
+    if address < 0x8000 {
+        if address >= 0x6000 && mapper.PRGRam != nil {
+            return mapper.PRGRam[address - 0x6000]
+        }
+        return 0
+    }
+
     use := address - uint16(0x8000)
     if len(mapper.BankMemory) == 16*1024 {
         use = use % 0x4000
@@ -305,7 +503,14 @@ func MakeMapper0(bankMemory []byte) Mapper {
     }
 }
 
-/* http://wiki.nesdev.org/w/index.php/MMC1 */
+/* The MMC1 (mapper 1), and the MMC1A (mapper 155).
+ * https://www.nesdev.org/wiki/MMC1
+ *
+ * Registers are written one bit at a time through a serial port at $8000-$ffff. Boards with chr
+ * ram reuse the upper bits of the chr registers: SUROM and SXROM select the 256k half of a 512k
+ * prg rom with bit 4, and SOROM and SXROM select the 8k bank of their 16k or 32k prg ram with
+ * bits 3 and 2-3.
+ */
 type Mapper1 struct {
     BankMemory []byte `json:"bankmemory"`
     CharacterMemory []byte `json:"charmemory"`
@@ -323,8 +528,14 @@ type Mapper1 struct {
     ChrRegister0 byte `json:"chrregister0"`
     ChrRegister1 byte `json:"chrregister1"`
 
-    /* FIXME: this might get mapped from the bank memory, not sure */
     PRGRam []byte `json:"prgram"`
+
+    /* the mmc1a has no prg ram disable bit in the prg register */
+    MMC1A bool `json:"mmc1a"`
+    /* the cpu cycle of the last write to the serial port. the mmc1 ignores a write on the cycle
+     * after another write, which happens when a read-modify-write instruction writes twice
+     */
+    LastWriteCycle uint64 `json:"lastwritecycle"`
 }
 
 func (mapper *Mapper1) IsNSF() bool {
@@ -332,6 +543,9 @@ func (mapper *Mapper1) IsNSF() bool {
 }
 
 func (mapper *Mapper1) Kind() int {
+    if mapper.MMC1A {
+        return 155
+    }
     return 1
 }
 
@@ -339,23 +553,14 @@ func (mapper *Mapper1) Compare(other Mapper) error {
     return fmt.Errorf("mapper1 compare unimplemented")
 }
 
-/* Read at address 'offset' within the 32k bank given by 'bank'.
- * When bank = 0, the starting address is 0x0000
- * When bank = 1, the starting address is 0x8000
- * etc.
+/* Read at address 'offset' within the bank given by 'bank', where banks are pageSize bytes.
+ * Banks past the end of the rom wrap around.
  */
 func (mapper *Mapper1) ReadBank(pageSize uint16, bank int, offset uint16) byte {
     base := uint32(bank) * uint32(pageSize)
 
     final := uint32(offset) + base
 
-    /*
-    if final >= uint32(len(mapper.BankMemory)) {
-        log.Printf("Warning: mapper1: cannot read memory at 0x%x maximum is 0x%x", final, len(mapper.BankMemory))
-        return 0
-    }
-    */
-
     /* blaster master reads addresses higher than available memory, so we wrap around */
 
     final = final % uint32(len(mapper.BankMemory))
@@ -377,57 +582,170 @@ func (mapper *Mapper1) Copy() Mapper {
         ChrRegister1: mapper.ChrRegister1,
         PrgBank: mapper.PrgBank,
         PRGRam: copySlice(mapper.PRGRam),
+        MMC1A: mapper.MMC1A,
+        LastWriteCycle: mapper.LastWriteCycle,
+    }
+}
+
+func (mapper *Mapper1) SaveBinary(writer *StateWriter){
+    writer.Bytes(mapper.BankMemory)
+    writer.Bytes(mapper.CharacterMemory)
+    writer.Int(mapper.Last4kBank)
+    writer.Int(mapper.Shift)
+    writer.Byte(mapper.Register)
+    writer.Byte(mapper.Mirror)
+    writer.Byte(mapper.PrgBankMode)
+    writer.Byte(mapper.ChrBankMode)
+    writer.Byte(mapper.PrgBank)
+    writer.Byte(mapper.ChrRegister0)
+    writer.Byte(mapper.ChrRegister1)
+    writer.Bytes(mapper.PRGRam)
+    writer.Bool(mapper.MMC1A)
+    writer.Uint64(mapper.LastWriteCycle)
+}
+
+func (mapper *Mapper1) LoadBinary(reader *StateReader){
+    mapper.BankMemory = reader.Bytes()
+    mapper.CharacterMemory = reader.Bytes()
+    mapper.Last4kBank = reader.Int()
+    mapper.Shift = reader.Int()
+    mapper.Register = reader.Byte()
+    mapper.Mirror = reader.Byte()
+    mapper.PrgBankMode = reader.Byte()
+    mapper.ChrBankMode = reader.Byte()
+    mapper.PrgBank = reader.Byte()
+    mapper.ChrRegister0 = reader.Byte()
+    mapper.ChrRegister1 = reader.Byte()
+    mapper.PRGRam = reader.Bytes()
+    if reader.Version >= 6 {
+        mapper.MMC1A = reader.Bool()
+        mapper.LastWriteCycle = reader.Uint64()
     }
 }
 
+/* the upper chr register bits are only used for prg on boards with chr ram. the hardware uses
+ * whichever chr register the ppu last read through, but games keep both the same, so like
+ * fceux this only looks at chr register 0
+ */
+func (mapper *Mapper1) usesChrRam() bool {
+    return len(mapper.CharacterMemory) == 0
+}
+
+/* the 16k page of the 256k prg half selected by SUROM and SXROM */
+func (mapper *Mapper1) prgOuterBank() int {
+    if mapper.usesChrRam() && len(mapper.BankMemory) > 0x40000 {
+        return int(mapper.ChrRegister0 & 0x10)
+    }
+    return 0
+}
+
+func (mapper *Mapper1) ramEnabled() bool {
+    return len(mapper.PRGRam) > 0 && (mapper.MMC1A || mapper.PrgBank & 0x10 == 0)
+}
+
+/* the offset into prg ram for an address at $6000-$7fff */
+func (mapper *Mapper1) ramAddress(address uint16) int {
+    bank := 0
+    if mapper.usesChrRam() {
+        switch len(mapper.PRGRam) {
+            /* SOROM */
+            case 0x4000: bank = int(mapper.ChrRegister0 >> 3) & 0x1
+            /* SXROM */
+            case 0x8000: bank = int(mapper.ChrRegister0 >> 2) & 0x3
+        }
+    }
+
+    return (bank * 0x2000 + int(address - 0x6000)) % len(mapper.PRGRam)
+}
+
 func (mapper *Mapper1) Read(address uint16) byte {
     if address >= 0x6000 && address < 0x8000 {
-        return mapper.PRGRam[address - uint16(0x6000)]
+        if mapper.ramEnabled() {
+            return mapper.PRGRam[mapper.ramAddress(address)]
+        }
+        return 0
     }
 
     baseAddress := address - uint16(0x8000)
 
-    const pageSize32k = 0x8000
     const pageSize16k = 0x4000
 
-    /* For SUROM (dragon warrior 4), the 5th bit of a chr register is used as the 5th bit of the prg register.
-     * FCEUX only uses chr register 0, even though the mmc documentation says that both chr reg 0 and chr reg 1
-     * supply a 5th bit to prg.
-     */
-    hijackedPrgBit := int(mapper.ChrRegister0 & 0x10)
+    outer := mapper.prgOuterBank()
+    bank := int(mapper.PrgBank & 0xf)
 
     switch mapper.PrgBankMode {
-        /* P=0, read in 32k mode */
+        /* P=0, read in 32k mode, ignoring the low bit of the bank */
         case 0, 1:
-            return mapper.ReadBank(pageSize32k, int(mapper.PrgBank >> 1), baseAddress)
+            return mapper.ReadBank(pageSize16k, outer + (bank &^ 1), baseAddress)
         /* P=1, S=0, read in 16k mode where 0x8000 is mapped to 0, and 0xc000 is mapped to the program bank */
         case 2:
             if address < 0xc000 {
-                /* hijacked prg bit applies to fixed pages as well */
-                return mapper.ReadBank(pageSize16k, 0 + hijackedPrgBit, baseAddress)
+                /* the outer bank applies to fixed pages as well */
+                return mapper.ReadBank(pageSize16k, outer, baseAddress)
             }
 
-            return mapper.ReadBank(pageSize16k, int(mapper.PrgBank) + hijackedPrgBit, address - 0xc000)
+            return mapper.ReadBank(pageSize16k, outer + bank, address - 0xc000)
         /* P=1, S=1, read in 16k mode where 0x8000 is mapped to the program bank, and 0xc000 is mapped to page 0xf */
         case 3:
             if address < 0xc000 {
-                return mapper.ReadBank(pageSize16k, int(mapper.PrgBank) + hijackedPrgBit, baseAddress)
+                return mapper.ReadBank(pageSize16k, outer + bank, baseAddress)
             }
 
-            /* hijacked prg bit applies to fixed pages as well */
-            return mapper.ReadBank(pageSize16k, 0xf + hijackedPrgBit, address - 0xc000)
+            return mapper.ReadBank(pageSize16k, outer + 0xf, address - 0xc000)
     }
 
     return 0
 }
 
+/* the offset into chr memory of a pattern table address. in 8k mode chr register 0 selects
+ * an 8k bank and ignores its low bit, and in 4k mode each register selects a 4k bank
+ */
+func (mapper *Mapper1) chrOffset(address uint16, size int) int {
+    var base int
+    if mapper.ChrBankMode == 0 {
+        base = int(mapper.ChrRegister0 &^ 1) * 0x1000 + int(address)
+    } else if address < 0x1000 {
+        base = int(mapper.ChrRegister0) * 0x1000 + int(address)
+    } else {
+        base = int(mapper.ChrRegister1) * 0x1000 + int(address - 0x1000)
+    }
+
+    return base % size
+}
+
+/* chr ram is the ppu's 8k of pattern memory */
+func (mapper *Mapper1) ReadPPU(ppu *PPUState, address uint16) byte {
+    if address >= 0x2000 {
+        return ppu.LoadNametableMemory(address)
+    }
+
+    if mapper.usesChrRam() {
+        return ppu.VideoMemory[mapper.chrOffset(address, 0x2000)]
+    }
+
+    return mapper.CharacterMemory[mapper.chrOffset(address, len(mapper.CharacterMemory))]
+}
+
+func (mapper *Mapper1) WritePPU(ppu *PPUState, address uint16, value byte){
+    if address >= 0x2000 {
+        ppu.StoreNametableMemory(address, value)
+        return
+    }
+
+    if mapper.usesChrRam() {
+        ppu.VideoMemory[mapper.chrOffset(address, 0x2000)] = value
+    }
+}
+
 func (mapper *Mapper1) IsIRQAsserted() bool {
     return false
 }
 
 func (mapper *Mapper1) Write(cpu *CPUState, address uint16, value byte) error {
     if address >= 0x6000 && address < 0x8000 {
-        mapper.PRGRam[address - uint16(0x6000)] = value
+        if mapper.ramEnabled() {
+            mapper.PRGRam[mapper.ramAddress(address)] = value
+        }
         return nil
     }
 
@@ -435,12 +753,22 @@ func (mapper *Mapper1) Write(cpu *CPUState, address uint16, value byte) error {
         log.Printf("mapper1: Writing bank switching register 0x%x with value 0x%x", address, value)
     }
 
+    /* both writes of a read-modify-write instruction happen during the same instruction, and
+     * only the first one counts
+     */
+    if cpu.Cycle == mapper.LastWriteCycle && cpu.Cycle != 0 {
+        return nil
+    }
+    mapper.LastWriteCycle = cpu.Cycle
+
     /* if bit 7 is set then clear the shift register */
     clear := value >> 7 == 1
 
     if clear {
         mapper.Shift = 0
         mapper.Register = 0
+        /* resetting also goes back to fixing the last bank at $c000 */
+        mapper.PrgBankMode = 3
     } else {
         /* shift a single bit into the internal register */
         mapper.Register = ((value & 0x1) << mapper.Shift) | mapper.Register
@@ -473,53 +801,13 @@ func (mapper *Mapper1) Write(cpu *CPUState, address uint16, value byte) error {
                         cpu.PPU.SetHorizontalMirror()
                 }
             } else if address >= 0xa000 && address <= 0xbfff {
-                mapper.ChrRegister0 = mapper.Register
-
                 /* chr bank 0 */
-                if mapper.ChrBankMode == 1 {
-                    /* FIXME: base could be 0xf000, so base + 0x1000 could be 0
-                     * making base an int prevents this wraparound, but im not 100% sure if its the right thing to do
-                     */
-                    base := int(uint16(mapper.Register) * 0x1000)
-                    /* FIXME: this is needed for games that have chrrom in the nesfile
-                     * such as bubble bobble and zelda2, but doesn't seem to work
-                     * for ninja gaiden
-                     */
-                    if len(mapper.CharacterMemory) != 0 {
-                        if int(base) < len(mapper.CharacterMemory) && int(base + 0x1000) < len(mapper.CharacterMemory) && base < base + 0x1000 {
-                            cpu.PPU.CopyCharacterRom(0x0000, mapper.CharacterMemory[base:base + 0x1000])
-                        } else {
-                            log.Printf("[mapper1] Warning: could not copy character data from range %v to %v", base, base + 0x1000)
-                        }
-                    } else {
-                        cpu.PPU.CopyCharacterRom(0x0000, mapper.BankMemory[base:base + 0x1000])
-                    }
-                } else {
-                    base := uint16(mapper.Register >> 1) * 0x2000
-                    if len(mapper.CharacterMemory) != 0 {
-                        cpu.PPU.CopyCharacterRom(0x0000, mapper.CharacterMemory[base:base + 0x2000])
-                    } else {
-                        cpu.PPU.CopyCharacterRom(0x0000, mapper.BankMemory[base:base + 0x2000])
-                    }
-                }
+                mapper.ChrRegister0 = mapper.Register
             } else if address >= 0xc000 && address <= 0xdfff {
+                /* chr bank 1, ignored in 8k mode */
                 mapper.ChrRegister1 = mapper.Register
-
-                /* chr bank 1 */
-                if mapper.ChrBankMode == 1 {
-                    base := uint32(mapper.Register) * 0x1000
-                    if len(mapper.CharacterMemory) != 0 {
-                        if int(base + 0x1000) < len(mapper.CharacterMemory) {
-                            cpu.PPU.CopyCharacterRom(0x1000, mapper.CharacterMemory[base:base + 0x1000])
-                        }
-                    } else {
-                        cpu.PPU.CopyCharacterRom(0x1000, mapper.BankMemory[base:base + 0x1000])
-                    }
-                } else {
-                    /* ignore in 8k mode */
-                }
             } else if address >= 0xe000 {
-                /* prg bank */
+                /* prg bank, bit 4 disables prg ram on the mmc1b */
                 mapper.PrgBank = mapper.Register
                 if cpu.Debug > 0 {
                     log.Printf("mapper1: set prg bank 0x%x setting 0x%x", mapper.PrgBank, mapper.PrgBankMode)
@@ -535,8 +823,30 @@ func (mapper *Mapper1) Write(cpu *CPUState, address uint16, value byte) error {
     return nil
 }
 
-func MakeMapper1(bankMemory []byte, chrMemory []byte) Mapper {
+func (mapper *Mapper1) GetPRGRam() []byte {
+    return mapper.PRGRam
+}
+
+/* nes 2.0 headers give the prg ram size, which is 16k for SOROM and 32k for SXROM. ines
+ * headers don't, so SXROM is guessed from the rom sizes and SOROM needs a nes 2.0 header or a
+ * rom database entry.
+ */
+func MakeMapper1(info MapperInfo, bankMemory []byte, chrMemory []byte) Mapper {
     pages := len(bankMemory) / 0x4000
+
+    ramSize := 0x2000
+    if info.Nes2 && info.TotalPRGRam() > ramSize {
+        ramSize = info.TotalPRGRam()
+    }
+
+    /* 512k of prg rom with chr ram is SUROM or SXROM. SXROM games such as Genghis Khan and
+     * Romance of the Three Kingdoms need 32k of banked ram. SUROM games leave the ram bank bits of
+     * the chr registers clear, so they stay in the first 8k bank.
+     */
+    if !info.Nes2 && len(bankMemory) == 0x80000 && len(chrMemory) == 0 {
+        ramSize = 0x8000
+    }
+
     return &Mapper1{
         BankMemory: bankMemory,
         CharacterMemory: chrMemory,
@@ -545,8 +855,9 @@ func MakeMapper1(bankMemory []byte, chrMemory []byte) Mapper {
         ChrBankMode: 0,
         ChrRegister0: 0,
         ChrRegister1: 0,
-        PRGRam: make([]byte, 0x8000 - 0x6000),
+        PRGRam: make([]byte, ramSize),
         Last4kBank: pages-1,
+        MMC1A: info.Mapper == 155,
     }
 }
 
@@ -587,6 +898,20 @@ func (mapper *Mapper2) Copy() Mapper {
     }
 }
 
+func (mapper *Mapper2) SaveBinary(writer *StateWriter){
+    writer.Bytes(mapper.BankMemory)
+    writer.Bytes(mapper.SaveRam)
+    writer.Uint32(mapper.LastBankAddress)
+    writer.Byte(mapper.Bank)
+}
+
+func (mapper *Mapper2) LoadBinary(reader *StateReader){
+    mapper.BankMemory = reader.Bytes()
+    mapper.SaveRam = reader.Bytes()
+    mapper.LastBankAddress = reader.Uint32()
+    mapper.Bank = reader.Byte()
+}
+
 func (mapper *Mapper2) Kind() int {
     return 2
 }
@@ -634,6 +959,10 @@ func (mapper *Mapper2) Write(cpu *CPUState, address uint16, value byte) error {
     return nil
 }
 
+func (mapper *Mapper2) GetPRGRam() []byte {
+    return mapper.SaveRam
+}
+
 func MakeMapper2(bankMemory []byte) Mapper {
     return &Mapper2{
         BankMemory: bankMemory,
@@ -658,6 +987,16 @@ func (mapper *Mapper3) Copy() Mapper {
     }
 }
 
+func (mapper *Mapper3) SaveBinary(writer *StateWriter){
+    writer.Bytes(mapper.ProgramRom)
+    writer.Bytes(mapper.BankMemory)
+}
+
+func (mapper *Mapper3) LoadBinary(reader *StateReader){
+    mapper.ProgramRom = reader.Bytes()
+    mapper.BankMemory = reader.Bytes()
+}
+
 func (mapper *Mapper3) Kind() int {
     return 3
 }
@@ -708,6 +1047,16 @@ type Mapper4 struct {
     IrqReload byte `json:"irqreload"`
     IrqCounter byte `json:"irqcounter"`
     IrqPending bool `json:"irqpending"`
+    /* set by writing $c001, reloads the counter on the next clock */
+    IrqReloadPending bool `json:"irqreloadpending"`
+    /* the mmc3a only raises an irq when the counter is decremented to 0 or reloaded by
+     * $c001, while later revisions raise it whenever the counter is 0 after a clock
+     */
+    OldIrq bool `json:"oldirq"`
+
+    /* the state of ppu a12 in the last pattern fetch, and the dot it went low */
+    A12High bool `json:"a12high"`
+    A12LowDot int `json:"a12lowdot"`
 
     WramEnabled bool `json:"wramenabled"`
     WramWrite bool `json:"wramwrite"`
@@ -743,6 +1092,10 @@ func (mapper *Mapper4) Copy() Mapper {
         IrqReload: mapper.IrqReload,
         IrqCounter: mapper.IrqCounter,
         IrqPending: mapper.IrqPending,
+        IrqReloadPending: mapper.IrqReloadPending,
+        OldIrq: mapper.OldIrq,
+        A12High: mapper.A12High,
+        A12LowDot: mapper.A12LowDot,
         WramEnabled: mapper.WramEnabled,
         WramWrite: mapper.WramWrite,
         ChrMode: mapper.ChrMode,
@@ -753,6 +1106,60 @@ func (mapper *Mapper4) Copy() Mapper {
     }
 }
 
+func (mapper *Mapper4) SaveBinary(writer *StateWriter){
+    writer.Bytes(mapper.ProgramRom)
+    writer.Bytes(mapper.CharacterRom)
+    writer.Bytes(mapper.SaveRam)
+    writer.Int(mapper.LastBank)
+    writer.Bool(mapper.IrqEnabled)
+    writer.Byte(mapper.IrqReload)
+    writer.Byte(mapper.IrqCounter)
+    writer.Bool(mapper.IrqPending)
+    writer.Bool(mapper.WramEnabled)
+    writer.Bool(mapper.WramWrite)
+    writer.Byte(mapper.ChrMode)
+    writer.Byte(mapper.PrgMode)
+    writer.Byte(mapper.RegisterIndex)
+    for _, value := range mapper.ChrRegister {
+        writer.Byte(value)
+    }
+    for _, value := range mapper.PrgRegister {
+        writer.Byte(value)
+    }
+    writer.Bool(mapper.IrqReloadPending)
+    writer.Bool(mapper.OldIrq)
+    writer.Bool(mapper.A12High)
+    writer.Int(mapper.A12LowDot)
+}
+
+func (mapper *Mapper4) LoadBinary(reader *StateReader){
+    mapper.ProgramRom = reader.Bytes()
+    mapper.CharacterRom = reader.Bytes()
+    mapper.SaveRam = reader.Bytes()
+    mapper.LastBank = reader.Int()
+    mapper.IrqEnabled = reader.Bool()
+    mapper.IrqReload = reader.Byte()
+    mapper.IrqCounter = reader.Byte()
+    mapper.IrqPending = reader.Bool()
+    mapper.WramEnabled = reader.Bool()
+    mapper.WramWrite = reader.Bool()
+    mapper.ChrMode = reader.Byte()
+    mapper.PrgMode = reader.Byte()
+    mapper.RegisterIndex = reader.Byte()
+    for i := range mapper.ChrRegister {
+        mapper.ChrRegister[i] = reader.Byte()
+    }
+    for i := range mapper.PrgRegister {
+        mapper.PrgRegister[i] = reader.Byte()
+    }
+    if reader.Version >= 4 {
+        mapper.IrqReloadPending = reader.Bool()
+        mapper.OldIrq = reader.Bool()
+        mapper.A12High = reader.Bool()
+        mapper.A12LowDot = reader.Int()
+    }
+}
+
 func (mapper *Mapper4) IsIRQAsserted() bool {
     return mapper.IrqPending
 }
@@ -821,39 +1228,54 @@ func (mapper *Mapper4) Read(address uint16) byte {
     // return 0
 }
 
-func (mapper *Mapper4) CharacterBlock(length uint32, page byte) []byte {
-    /* Kind of weird but I guess a page is always 0x400 (1k) bytes */
-    base := uint32(page) * 0x400
-    // log.Printf("mapper4: character rom bank page 0x%x at 0x%x - 0x%x", page, base, base + length)
-    if base+length <= uint32(len(mapper.CharacterRom)) {
-        return mapper.CharacterRom[base:base+length]
-    } else {
-        log.Printf("mapper4: warning: attempting to read out of bounds chr memory 0x%x to 0x%x, maximum 0x%x", base, base+length, len(mapper.CharacterRom))
-        return nil
+/* the offset into the chr rom of a pattern table address. registers 0 and 1 are 2k banks and
+ * 2-5 are 1k banks, and chr mode 1 swaps which half of the pattern tables they are in
+ */
+func (mapper *Mapper4) chrOffset(address uint16) int {
+    if mapper.ChrMode == 1 {
+        address ^= 0x1000
     }
+
+    /* banks are numbered in 1k pages */
+    var page byte
+    var offset uint16
+    switch {
+        case address < 0x0800:
+            page = mapper.ChrRegister[0]
+            offset = address
+        case address < 0x1000:
+            page = mapper.ChrRegister[1]
+            offset = address - 0x0800
+        default:
+            page = mapper.ChrRegister[2 + (address - 0x1000) / 0x400]
+            offset = address & 0x3ff
+    }
+
+    return (int(page) * 0x400 + int(offset)) % len(mapper.CharacterRom)
 }
 
-func (mapper *Mapper4) SetChrBank(ppu *PPUState) error {
-    switch mapper.ChrMode {
-        case 0:
-            ppu.CopyCharacterRom(0x0000, mapper.CharacterBlock(0x800, mapper.ChrRegister[0]))
-            ppu.CopyCharacterRom(0x0800, mapper.CharacterBlock(0x800, mapper.ChrRegister[1]))
-            ppu.CopyCharacterRom(0x1000, mapper.CharacterBlock(0x400, mapper.ChrRegister[2]))
-            ppu.CopyCharacterRom(0x1400, mapper.CharacterBlock(0x400, mapper.ChrRegister[3]))
-            ppu.CopyCharacterRom(0x1800, mapper.CharacterBlock(0x400, mapper.ChrRegister[4]))
-            ppu.CopyCharacterRom(0x1c00, mapper.CharacterBlock(0x400, mapper.ChrRegister[5]))
-            return nil
-        case 1:
-            ppu.CopyCharacterRom(0x0000, mapper.CharacterBlock(0x400, mapper.ChrRegister[2]))
-            ppu.CopyCharacterRom(0x0400, mapper.CharacterBlock(0x400, mapper.ChrRegister[3]))
-            ppu.CopyCharacterRom(0x0800, mapper.CharacterBlock(0x400, mapper.ChrRegister[4]))
-            ppu.CopyCharacterRom(0x0c00, mapper.CharacterBlock(0x400, mapper.ChrRegister[5]))
-            ppu.CopyCharacterRom(0x1000, mapper.CharacterBlock(0x800, mapper.ChrRegister[0]))
-            ppu.CopyCharacterRom(0x1800, mapper.CharacterBlock(0x800, mapper.ChrRegister[1]))
-            return nil
+/* boards without chr rom use the ppu's memory as chr ram */
+func (mapper *Mapper4) ReadPPU(ppu *PPUState, address uint16) byte {
+    if address >= 0x2000 {
+        return ppu.LoadNametableMemory(address)
+    }
+
+    if len(mapper.CharacterRom) == 0 {
+        return ppu.VideoMemory[address]
+    }
+
+    return mapper.CharacterRom[mapper.chrOffset(address)]
+}
+
+func (mapper *Mapper4) WritePPU(ppu *PPUState, address uint16, value byte){
+    if address >= 0x2000 {
+        ppu.StoreNametableMemory(address, value)
+        return
     }
 
-    return fmt.Errorf("mapper4: unknown chr mode %v", mapper.ChrMode)
+    if len(mapper.CharacterRom) == 0 {
+        ppu.VideoMemory[address] = value
+    }
 }
 
 func (mapper *Mapper4) Write(cpu *CPUState, address uint16, value byte) error {
@@ -875,7 +1297,6 @@ func (mapper *Mapper4) Write(cpu *CPUState, address uint16, value byte) error {
             mapper.PrgMode = (value >> 6) & 0x1
 
             mapper.RegisterIndex = value & 0x7
-            mapper.SetChrBank(&cpu.PPU)
         case 0x8001:
             switch mapper.RegisterIndex {
                 case 0, 1, 2, 3, 4, 5:
@@ -883,14 +1304,17 @@ func (mapper *Mapper4) Write(cpu *CPUState, address uint16, value byte) error {
                         value = value & (^byte(1))
                     }
                     mapper.ChrRegister[mapper.RegisterIndex] = value
-                    mapper.SetChrBank(&cpu.PPU)
                 case 6, 7:
                     /* only use the first 6 bits, top two are ignored */
                     mapper.PrgRegister[mapper.RegisterIndex-6] = value & 0x3f
             }
         case 0xa000:
+            /* boards with four screen nametables ignore the mirroring register */
+            if cpu.PPU.NametableMirror == NametableMirrorFourScreen {
+                break
+            }
+
             mirror := value & 0x1
-            /* FIXME: dont set mirroring for nes files that set 4-way mirroring */
             switch mirror {
                 case 0:
                     cpu.PPU.SetVerticalMirror()
@@ -905,7 +1329,8 @@ func (mapper *Mapper4) Write(cpu *CPUState, address uint16, value byte) error {
         case 0xc000:
             mapper.IrqReload = value
         case 0xc001:
-            mapper.IrqCounter = value
+            mapper.IrqCounter = 0
+            mapper.IrqReloadPending = true
         case 0xe000:
             mapper.IrqEnabled = false
             mapper.IrqPending = false
@@ -918,18 +1343,64 @@ func (mapper *Mapper4) Write(cpu *CPUState, address uint16, value byte) error {
     return nil
 }
 
-func (mapper *Mapper4) Scanline() {
-    if mapper.IrqCounter == 0 {
+/* clock the scanline counter, which normally happens once per scanline */
+func (mapper *Mapper4) ClockIrqCounter() {
+    /* the old behavior only raises the irq if the counter reached 0 by decrementing or by a
+     * reload requested through $c001
+     */
+    raise := true
+    if mapper.IrqCounter == 0 || mapper.IrqReloadPending {
+        if mapper.OldIrq {
+            raise = mapper.IrqReloadPending
+        }
         mapper.IrqCounter = mapper.IrqReload
+        mapper.IrqReloadPending = false
     } else {
         mapper.IrqCounter -= 1
-        if mapper.IrqCounter == 0 && mapper.IrqEnabled {
-            mapper.IrqPending = true
+    }
+
+    if mapper.IrqCounter == 0 && mapper.IrqEnabled && raise {
+        mapper.IrqPending = true
+    }
+}
+
+/* a12 has to stay low for a few cpu cycles before a rise clocks the counter, which filters out
+ * the short drops between sprite pattern fetches
+ */
+const mmc3A12LowDots = 10
+
+/* clock the counter when a12 rises, which happens once per scanline when the background and
+ * sprites use different pattern tables
+ */
+func (mapper *Mapper4) PPUAddress(ppu *PPUState, address uint16){
+    dot := ppu.Scanline * 341 + ppu.ScanlineCycle
+
+    if address & 0x1000 == 0 {
+        if mapper.A12High {
+            mapper.A12LowDot = dot
+            mapper.A12High = false
+        }
+        return
+    }
+
+    if !mapper.A12High {
+        mapper.A12High = true
+        elapsed := dot - mapper.A12LowDot
+        if elapsed < 0 {
+            elapsed += ppu.Region.Timing().Scanlines * 341
+        }
+        if elapsed >= mmc3A12LowDots {
+            mapper.ClockIrqCounter()
         }
     }
 }
 
-func MakeMapper4(programRom []byte, chrMemory []byte) Mapper {
+func (mapper *Mapper4) GetPRGRam() []byte {
+    return mapper.SaveRam
+}
+
+/* nes 2.0 submapper 4 is the mmc3a, with the old irq behavior */
+func MakeMapper4(info MapperInfo, programRom []byte, chrMemory []byte) Mapper {
     pageSize := uint16(0x2000)
     pages := len(programRom) / int(pageSize)
 
@@ -938,6 +1409,7 @@ func MakeMapper4(programRom []byte, chrMemory []byte) Mapper {
         CharacterRom: chrMemory,
         SaveRam: make([]byte, 0x2000),
         LastBank: pages-1,
+        OldIrq: info.Nes2 && info.Submapper == 4,
     }
 }
 
@@ -969,6 +1441,20 @@ func (mapper *Mapper7) Copy() Mapper {
     }
 }
 
+func (mapper *Mapper7) SaveBinary(writer *StateWriter){
+    writer.Bytes(mapper.ProgramRom)
+    writer.Bytes(mapper.CharacterRom)
+    writer.Int(mapper.Bank)
+    writer.Int(mapper.Mirror)
+}
+
+func (mapper *Mapper7) LoadBinary(reader *StateReader){
+    mapper.ProgramRom = reader.Bytes()
+    mapper.CharacterRom = reader.Bytes()
+    mapper.Bank = reader.Int()
+    mapper.Mirror = reader.Int()
+}
+
 func MakeMapper7(programRom []byte, chrMemory []byte) Mapper {
     return &Mapper7{
         ProgramRom: programRom,
@@ -1030,7 +1516,10 @@ type Mapper9 struct {
     Pages int `json:"pages"`
 
     PrgRegister byte `json:"prg"`
+    /* $fd and $fe banks for $0000, then the $fd and $fe banks for $1000 */
     ChrRegister [4]byte `json:"chr"`
+    /* which bank each pattern table uses, false for $fd and true for $fe */
+    Latch [2]bool `json:"latch"`
 }
 
 func (mapper *Mapper9) IsNSF() bool {
@@ -1052,6 +1541,33 @@ func (mapper *Mapper9) Copy() Mapper {
         Pages: mapper.Pages,
         PrgRegister: mapper.PrgRegister,
         ChrRegister: copySlice4(mapper.ChrRegister),
+        Latch: mapper.Latch,
+    }
+}
+
+func (mapper *Mapper9) SaveBinary(writer *StateWriter){
+    writer.Bytes(mapper.ProgramRom)
+    writer.Bytes(mapper.CharacterRom)
+    writer.Int(mapper.Pages)
+    writer.Byte(mapper.PrgRegister)
+    for _, value := range mapper.ChrRegister {
+        writer.Byte(value)
+    }
+    writer.Bool(mapper.Latch[0])
+    writer.Bool(mapper.Latch[1])
+}
+
+func (mapper *Mapper9) LoadBinary(reader *StateReader){
+    mapper.ProgramRom = reader.Bytes()
+    mapper.CharacterRom = reader.Bytes()
+    mapper.Pages = reader.Int()
+    mapper.PrgRegister = reader.Byte()
+    for i := range mapper.ChrRegister {
+        mapper.ChrRegister[i] = reader.Byte()
+    }
+    if reader.Version >= 5 {
+        mapper.Latch[0] = reader.Bool()
+        mapper.Latch[1] = reader.Bool()
     }
 }
 
@@ -1078,16 +1594,45 @@ func (mapper *Mapper9) Read(address uint16) byte {
     // return 0
 }
 
-func (mapper *Mapper9) CharacterBlock(pageSize uint16, register byte) []byte {
-    base := uint32(register) * uint32(pageSize)
-    return mapper.CharacterRom[base:base+uint32(pageSize)]
+/* Reading the high plane of tile $fd or $fe flips the latch of that pattern table, which takes
+ * effect from the next fetch. This lets punch-out switch chr banks part way through a scanline.
+ */
+func (mapper *Mapper9) ReadPPU(ppu *PPUState, address uint16) byte {
+    if address >= 0x2000 {
+        return ppu.LoadNametableMemory(address)
+    }
+
+    if len(mapper.CharacterRom) == 0 {
+        return ppu.VideoMemory[address]
+    }
+
+    table := address >> 12
+    register := table * 2
+    if mapper.Latch[table] {
+        register += 1
+    }
+
+    base := int(mapper.ChrRegister[register]) * 0x1000
+    value := mapper.CharacterRom[(base + int(address & 0xfff)) % len(mapper.CharacterRom)]
+
+    switch {
+        case address == 0x0fd8:
+            mapper.Latch[0] = false
+        case address == 0x0fe8:
+            mapper.Latch[0] = true
+        case address >= 0x1fd8 && address <= 0x1fdf:
+            mapper.Latch[1] = false
+        case address >= 0x1fe8 && address <= 0x1fef:
+            mapper.Latch[1] = true
+    }
+
+    return value
 }
 
-func (mapper *Mapper9) SetChrBank(ppu *PPUState) {
-    /* FIXME: Use chrRegister 0 or 2 depending on the ppu latch set at $fd or $fe */
-    ppu.CopyCharacterRom(0x0000, mapper.CharacterBlock(0x1000, mapper.ChrRegister[1]))
-    /* FIXME: Use chrRegister 1 or 3 depending on the ppu latch set at $fd or $fe */
-    ppu.CopyCharacterRom(0x1000, mapper.CharacterBlock(0x1000, mapper.ChrRegister[2]))
+func (mapper *Mapper9) WritePPU(ppu *PPUState, address uint16, value byte){
+    if address >= 0x2000 {
+        ppu.StoreNametableMemory(address, value)
+    }
 }
 
 func (mapper *Mapper9) Write(cpu *CPUState, address uint16, value byte) error {
@@ -1098,19 +1643,15 @@ func (mapper *Mapper9) Write(cpu *CPUState, address uint16, value byte) error {
             return nil
         case 0xb:
             mapper.ChrRegister[0] = value
-            mapper.SetChrBank(&cpu.PPU)
             return nil
         case 0xc:
             mapper.ChrRegister[1] = value
-            mapper.SetChrBank(&cpu.PPU)
             return nil
         case 0xd:
             mapper.ChrRegister[2] = value
-            mapper.SetChrBank(&cpu.PPU)
             return nil
         case 0xe:
             mapper.ChrRegister[3] = value
-            mapper.SetChrBank(&cpu.PPU)
             return nil
         case 0xf:
             mirror := value & 0x1
@@ -0,0 +1,118 @@
+package lib
+
+import (
+    "testing"
+)
+
+/* write a value to an mmc1 register through the serial port. the mmc1 ignores a write on the
+ * same cycle as the previous one, so each bit is written a few cycles apart like a real 'sta'
+ */
+func writeMMC1(cpu *CPUState, address uint16, value byte){
+    for i := range 5 {
+        cpu.Cycle += 4
+        cpu.StoreMemory(address, (value >> i) & 1)
+    }
+}
+
+func TestMMC1SUROM(test *testing.T){
+    cpu := StartupState()
+    cpu.SetMapper(MakeMapper1(MapperInfo{Mapper: 1}, makeMapperTestRom(0x80000, nil), nil))
+
+    /* 16k mode with $c000 fixed to the last bank of the selected 256k half */
+    writeMMC1(&cpu, 0x8000, 0x0c)
+    writeMMC1(&cpu, 0xe000, 2)
+
+    if value := cpu.LoadMemory(0x9000); value != 4 {
+        test.Fatalf("expected page 4 at $8000 but got %v", value)
+    }
+    if value := cpu.LoadMemory(0xd000); value != 30 {
+        test.Fatalf("expected page 30 at $c000 but got %v", value)
+    }
+
+    writeMMC1(&cpu, 0xa000, 0x10)
+    if value := cpu.LoadMemory(0x9000); value != 36 {
+        test.Fatalf("expected page 36 at $8000 but got %v", value)
+    }
+    if value := cpu.LoadMemory(0xd000); value != 62 {
+        test.Fatalf("expected page 62 at $c000 but got %v", value)
+    }
+}
+
+func TestMMC1PrgRam(test *testing.T){
+    info := MapperInfo{Mapper: 1, Nes2: true, PRGRam: 0x2000, PRGNVRam: 0x6000}
+    if info.TotalPRGRam() != 0x8000 {
+        test.Fatalf("expected 32k of prg ram but got %v", info.TotalPRGRam())
+    }
+
+    cpu := StartupState()
+    cpu.SetMapper(MakeMapper1(info, makeMapperTestRom(0x40000, nil), nil))
+
+    /* SXROM selects the 8k ram bank with bits 2-3 of chr register 0 */
+    for bank := range 4 {
+        writeMMC1(&cpu, 0xa000, byte(bank << 2))
+        cpu.StoreMemory(0x6000, byte(bank + 1))
+    }
+
+    for bank := range 4 {
+        writeMMC1(&cpu, 0xa000, byte(bank << 2))
+        if value := cpu.LoadMemory(0x6000); value != byte(bank + 1) {
+            test.Fatalf("expected %v in ram bank %v but got %v", bank + 1, bank, value)
+        }
+    }
+
+    /* bit 4 of the prg register disables the ram on the mmc1b but not the mmc1a */
+    writeMMC1(&cpu, 0xe000, 0x10)
+    if value := cpu.LoadMemory(0x6000); value != 0 {
+        test.Fatalf("prg ram should be disabled but read %v", value)
+    }
+
+    mmc1a := StartupState()
+    mmc1a.SetMapper(MakeMapper1(MapperInfo{Mapper: 155}, makeMapperTestRom(0x20000, nil), makeMapperTestChr(0x8000)))
+    writeMMC1(&mmc1a, 0xe000, 0x10)
+    mmc1a.StoreMemory(0x6000, 9)
+    if value := mmc1a.LoadMemory(0x6000); value != 9 {
+        test.Fatalf("mmc1a prg ram should stay enabled but read %v", value)
+    }
+}
+
+/* ines headers don't give the prg ram size, so 512k of prg rom with chr ram is taken to be SXROM */
+func TestMMC1InesSXROM(test *testing.T){
+    sxrom := MakeMapper1(MapperInfo{Mapper: 1}, makeMapperTestRom(0x80000, nil), nil).(*Mapper1)
+    if len(sxrom.PRGRam) != 0x8000 {
+        test.Fatalf("expected 32k of prg ram but got %v", len(sxrom.PRGRam))
+    }
+
+    cpu := StartupState()
+    cpu.SetMapper(sxrom)
+    writeMMC1(&cpu, 0xa000, 3 << 2)
+    cpu.StoreMemory(0x6000, 7)
+    if sxrom.PRGRam[0x6000] != 7 {
+        test.Fatalf("expected the write in ram bank 3")
+    }
+
+    /* smaller roms and roms with chr rom keep 8k of ram */
+    if ram := MakeMapper1(MapperInfo{Mapper: 1}, makeMapperTestRom(0x40000, nil), nil).(*Mapper1).PRGRam; len(ram) != 0x2000 {
+        test.Fatalf("expected 8k of prg ram for SNROM but got %v", len(ram))
+    }
+    if ram := MakeMapper1(MapperInfo{Mapper: 1}, makeMapperTestRom(0x80000, nil), makeMapperTestChr(0x2000)).(*Mapper1).PRGRam; len(ram) != 0x2000 {
+        test.Fatalf("expected 8k of prg ram with chr rom but got %v", len(ram))
+    }
+}
+
+func TestMMC1ConsecutiveWrites(test *testing.T){
+    cpu := StartupState()
+    mapper := MakeMapper1(MapperInfo{Mapper: 1}, makeMapperTestRom(0x20000, nil), nil).(*Mapper1)
+    cpu.SetMapper(mapper)
+
+    writeMMC1(&cpu, 0xe000, 1)
+    if mapper.PrgBank != 1 {
+        test.Fatalf("expected prg bank 1 but got %v", mapper.PrgBank)
+    }
+
+    /* the second write of the same instruction is ignored, so one bit is shifted in */
+    cpu.Cycle += 4
+    cpu.storeModified(0xe000, 1, 0)
+    if mapper.Shift != 1 || mapper.Register != 1 {
+        test.Fatalf("expected a single shifted write but got shift %v register %v", mapper.Shift, mapper.Register)
+    }
+}
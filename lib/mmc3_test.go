@@ -0,0 +1,72 @@
+package lib
+
+import (
+    "testing"
+)
+
+/* run the ppu one dot at a time until it reaches the given scanline and dot */
+func runPPUUntil(cpu *CPUState, screen VirtualScreen, scanline int, dot int){
+    for cpu.PPU.Scanline != scanline || cpu.PPU.ScanlineCycle != dot {
+        cpu.PPU.Run(1, screen, cpu.Mapper.Mapper)
+    }
+}
+
+func TestMMC3A12Irq(test *testing.T){
+    cpu := StartupState()
+    mapper := MakeMapper4(MapperInfo{Mapper: 4}, makeMapperTestRom(0x20000, nil), makeMapperTestChr(0x20000)).(*Mapper4)
+    cpu.SetMapper(mapper)
+    screen := MakeVirtualScreen(256, 240)
+
+    /* background at $0000 and sprites at $1000, so a12 rises once per scanline at the sprite fetches */
+    cpu.PPU.SetControllerFlags(0x08)
+    cpu.PPU.SetMask(0x18)
+
+    prerender := cpu.PPU.Region.Timing().Scanlines - 1
+    cpu.PPU.Scanline = prerender
+    cpu.PPU.ScanlineCycle = 0
+
+    cpu.StoreMemory(0xc000, 20)
+    cpu.StoreMemory(0xc001, 0)
+    cpu.StoreMemory(0xe001, 0)
+
+    /* the pre-render line reloads the counter and each visible line decrements it */
+    runPPUUntil(&cpu, screen, 19, 250)
+    if mapper.IsIRQAsserted() {
+        test.Fatalf("irq raised too early, counter %v", mapper.IrqCounter)
+    }
+
+    runPPUUntil(&cpu, screen, 19, 270)
+    if !mapper.IsIRQAsserted() {
+        test.Fatalf("irq should be raised at the sprite fetches of scanline 19, counter %v", mapper.IrqCounter)
+    }
+
+    /* with both pattern tables at $1000 a12 never falls, so the counter is never clocked */
+    cpu.StoreMemory(0xe000, 0)
+    cpu.PPU.SetControllerFlags(0x18)
+    counter := mapper.IrqCounter
+    runPPUUntil(&cpu, screen, 100, 0)
+    if mapper.IrqCounter != counter {
+        test.Fatalf("counter should not change when a12 stays high: %v vs %v", mapper.IrqCounter, counter)
+    }
+}
+
+func TestMMC3OldIrq(test *testing.T){
+    for _, old := range []bool{false, true} {
+        mapper := Mapper4{OldIrq: old, IrqEnabled: true}
+
+        /* a reload value of 0 raises the irq on every clock on the new mmc3, but only when
+         * reloaded through $c001 on the old one
+         */
+        mapper.IrqReloadPending = true
+        mapper.ClockIrqCounter()
+        if !mapper.IrqPending {
+            test.Fatalf("old=%v: reloading with 0 through $c001 should raise the irq", old)
+        }
+
+        mapper.IrqPending = false
+        mapper.ClockIrqCounter()
+        if mapper.IrqPending == old {
+            test.Fatalf("old=%v: unexpected irq %v when the counter reloads 0 by itself", old, mapper.IrqPending)
+        }
+    }
+}
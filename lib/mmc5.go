@@ -0,0 +1,793 @@
+package lib
+
+import (
+    "fmt"
+    "math"
+)
+
+/* MMC5, used by castlevania 3, the koei strategy games and a few others.
+ * https://www.nesdev.org/wiki/MMC5
+ *
+ * Besides prg/chr banking it has 1k of extra ram (exram) that can be used as a third nametable
+ * or to give every background tile its own palette and chr bank, a fill mode nametable, a vertical
+ * split screen, a scanline irq, a multiplier and two extra pulse channels plus 8-bit pcm.
+ *
+ * The mmc5 has two sets of chr registers. With 8x16 sprites set A ($5120-$5127) is used for
+ * sprites and set B ($5128-$512b) for the background. With 8x8 sprites whichever set was
+ * written last is used for everything.
+ */
+
+const (
+    MMC5ExRamNametable = 0
+    MMC5ExRamAttributes = 1
+    MMC5ExRamWritable = 2
+    MMC5ExRamReadOnly = 3
+)
+
+/* the two pulse channels work like the apu pulses but have no sweep unit, and their
+ * envelopes and length counters are always clocked at the rate of the apu frame counter, 240hz on ntsc
+ */
+type MMC5Audio struct {
+    Pulse1 Pulse `json:"pulse1"`
+    Pulse2 Pulse `json:"pulse2"`
+    EnablePulse1 bool `json:"enablepulse1"`
+    EnablePulse2 bool `json:"enablepulse2"`
+
+    PCM byte `json:"pcm"`
+    /* if true then pcm samples come from cpu reads of 0x8000-0xbfff instead of writes to $5011 */
+    PCMReadMode bool `json:"pcmreadmode"`
+    PCMIrqEnabled bool `json:"pcmirqenabled"`
+    PCMIrqPending bool `json:"pcmirqpending"`
+
+    /* cpu cycles since the last frame tick */
+    FrameCycles float64 `json:"framecycles"`
+    /* the frame ticks come at the same rate as the apu's frame counter steps, which depends on the region */
+    Region Region `json:"region"`
+}
+
+func (audio *MMC5Audio) SaveBinary(writer *StateWriter){
+    audio.Pulse1.SaveBinary(writer)
+    audio.Pulse2.SaveBinary(writer)
+    writer.Bool(audio.EnablePulse1)
+    writer.Bool(audio.EnablePulse2)
+    writer.Byte(audio.PCM)
+    writer.Bool(audio.PCMReadMode)
+    writer.Bool(audio.PCMIrqEnabled)
+    writer.Bool(audio.PCMIrqPending)
+    writer.Float64(audio.FrameCycles)
+    writer.Int(int(audio.Region))
+}
+
+func (audio *MMC5Audio) LoadBinary(reader *StateReader){
+    audio.Pulse1.LoadBinary(reader)
+    audio.Pulse2.LoadBinary(reader)
+    audio.EnablePulse1 = reader.Bool()
+    audio.EnablePulse2 = reader.Bool()
+    audio.PCM = reader.Byte()
+    audio.PCMReadMode = reader.Bool()
+    audio.PCMIrqEnabled = reader.Bool()
+    audio.PCMIrqPending = reader.Bool()
+    audio.FrameCycles = reader.Float64()
+    audio.Region = RegionNTSC
+    if reader.Version >= 12 {
+        audio.Region = Region(reader.Int())
+    }
+}
+
+func (audio *MMC5Audio) writeDuty(pulse *Pulse, value byte){
+    duty := value >> 6
+    halt := (value >> 5) & 0x1 == 0x1
+    constant := (value >> 4) & 0x1 == 0x1
+    volume := value & 0xf
+
+    pulse.SetDuty(duty)
+    pulse.Length.Halt = halt
+    pulse.Envelope.Set(halt, constant, volume)
+}
+
+func (audio *MMC5Audio) writeTimerLow(pulse *Pulse, value byte){
+    pulse.Timer.Low = uint16(value)
+    pulse.Timer.Reset()
+}
+
+func (audio *MMC5Audio) writeLength(pulse *Pulse, enabled bool, value byte){
+    pulse.Timer.High = uint16(value & 7)
+    if enabled {
+        pulse.Length.SetLength(value >> 3)
+    }
+    pulse.Sequencer.Position = 0
+    pulse.Envelope.Reset()
+    pulse.Timer.Reset()
+}
+
+/* writes to $5000-$5015 */
+func (audio *MMC5Audio) Write(address uint16, value byte){
+    switch address {
+        case 0x5000: audio.writeDuty(&audio.Pulse1, value)
+        case 0x5002: audio.writeTimerLow(&audio.Pulse1, value)
+        case 0x5003: audio.writeLength(&audio.Pulse1, audio.EnablePulse1, value)
+        case 0x5004: audio.writeDuty(&audio.Pulse2, value)
+        case 0x5006: audio.writeTimerLow(&audio.Pulse2, value)
+        case 0x5007: audio.writeLength(&audio.Pulse2, audio.EnablePulse2, value)
+        case 0x5001, 0x5005:
+            /* there is no sweep unit */
+        case 0x5010:
+            audio.PCMReadMode = value & 0x1 == 0x1
+            audio.PCMIrqEnabled = value & 0x80 == 0x80
+        case 0x5011:
+            /* writing 0 has no effect */
+            if !audio.PCMReadMode && value != 0 {
+                audio.PCM = value
+            }
+        case 0x5015:
+            audio.EnablePulse1 = value & 0x1 == 0x1
+            audio.EnablePulse2 = value & 0x2 == 0x2
+            if !audio.EnablePulse1 {
+                audio.Pulse1.Length.Clear()
+            }
+            if !audio.EnablePulse2 {
+                audio.Pulse2.Length.Clear()
+            }
+    }
+}
+
+func (audio *MMC5Audio) Read(address uint16) byte {
+    switch address {
+        case 0x5010:
+            var out byte
+            if audio.PCMIrqPending {
+                out |= 0x80
+            }
+            audio.PCMIrqPending = false
+            return out
+        case 0x5015:
+            var out byte
+            if audio.Pulse1.Length.Length > 0 {
+                out |= 0x1
+            }
+            if audio.Pulse2.Length.Length > 0 {
+                out |= 0x2
+            }
+            return out
+    }
+
+    return 0
+}
+
+/* in read mode every byte the cpu reads from 0x8000-0xbfff becomes the pcm output, and reading a 0 raises an irq */
+func (audio *MMC5Audio) ReadPCM(value byte){
+    if !audio.PCMReadMode {
+        return
+    }
+
+    if value == 0 {
+        if audio.PCMIrqEnabled {
+            audio.PCMIrqPending = true
+        }
+    } else {
+        audio.PCM = value
+    }
+}
+
+func (audio *MMC5Audio) IsIRQAsserted() bool {
+    return audio.PCMIrqEnabled && audio.PCMIrqPending
+}
+
+/* cycles is in cpu cycles */
+func (audio *MMC5Audio) Run(cycles float64){
+    /* the pulse timers run at the apu rate, half the cpu speed */
+    audio.Pulse1.Run(cycles / 2)
+    audio.Pulse2.Run(cycles / 2)
+
+    /* the frame counter period is in apu cycles */
+    frameTick := audio.Region.Timing().FrameCounterPeriod * 2
+    audio.FrameCycles += cycles
+    for audio.FrameCycles >= frameTick {
+        audio.FrameCycles -= frameTick
+
+        audio.Pulse1.Envelope.Tick()
+        audio.Pulse2.Envelope.Tick()
+        audio.Pulse1.Length.Tick()
+        audio.Pulse2.Length.Tick()
+    }
+}
+
+func (audio *MMC5Audio) pulseSample(pulse *Pulse) byte {
+    if pulse.Length.Length == 0 {
+        return 0
+    }
+
+    return pulse.Sequencer.Value() * pulse.Envelope.Volume()
+}
+
+/* mixed the same way as the apu pulses and dmc */
+func (audio *MMC5Audio) Output() float32 {
+    pulse := audio.pulseSample(&audio.Pulse1) + audio.pulseSample(&audio.Pulse2)
+
+    var pulseValue float32
+    if pulse > 0 {
+        pulseValue = 95.88 / (8128.0 / float32(pulse) + 100)
+    }
+
+    var pcmValue float32
+    pcm := float32(audio.PCM) / 22638.0
+    if math.Abs(float64(pcm)) > 0.00001 {
+        pcmValue = 159.79 / (1.0 / pcm + 100)
+    }
+
+    return pulseValue + pcmValue
+}
+
+func MakeMMC5Audio() MMC5Audio {
+    return MMC5Audio{
+        Pulse1: Pulse{
+            Name: "mmc5 pulse1",
+        },
+        Pulse2: Pulse{
+            Name: "mmc5 pulse2",
+        },
+    }
+}
+
+type Mapper5 struct {
+    ProgramRom []byte `json:"programrom"`
+    CharacterRom []byte `json:"characterrom"`
+    PRGRam []byte `json:"prgram"`
+    ExRam []byte `json:"exram"`
+
+    PrgMode byte `json:"prgmode"`
+    ChrMode byte `json:"chrmode"`
+    /* prg ram is only writable when these are 2 and 1 */
+    PrgRamProtect1 byte `json:"prgramprotect1"`
+    PrgRamProtect2 byte `json:"prgramprotect2"`
+    ExRamMode byte `json:"exrammode"`
+    /* 2 bits for each of the 4 nametables. 0 and 1 are the ppu's nametables, 2 is exram and 3 is fill mode */
+    NametableMapping byte `json:"nametablemapping"`
+    FillTile byte `json:"filltile"`
+    FillAttribute byte `json:"fillattribute"`
+
+    /* the bank at 0x6000 */
+    PrgRamBank byte `json:"prgrambank"`
+    /* $5114-$5117. bit 7 selects rom (1) or ram (0), except for $5117 which is always rom */
+    PrgRegister [4]byte `json:"prgregister"`
+
+    /* 10-bit chr banks, the upper 2 bits come from $5130 */
+    ChrRegisterA [8]uint16 `json:"chrregistera"`
+    ChrRegisterB [4]uint16 `json:"chrregisterb"`
+    ChrUpper byte `json:"chrupper"`
+    /* true if set B was written after set A */
+    LastChrB bool `json:"lastchrb"`
+
+    SplitEnabled bool `json:"splitenabled"`
+    SplitRight bool `json:"splitright"`
+    SplitTile byte `json:"splittile"`
+    SplitScroll byte `json:"splitscroll"`
+    SplitBank byte `json:"splitbank"`
+
+    IrqCompare byte `json:"irqcompare"`
+    IrqEnabled bool `json:"irqenabled"`
+    IrqPending bool `json:"irqpending"`
+    InFrame bool `json:"inframe"`
+    ScanlineCounter byte `json:"scanlinecounter"`
+
+    Multiplicand byte `json:"multiplicand"`
+    Multiplier byte `json:"multiplier"`
+
+    Audio MMC5Audio `json:"audio"`
+}
+
+func (mapper *Mapper5) IsNSF() bool {
+    return false
+}
+
+func (mapper *Mapper5) Kind() int {
+    return 5
+}
+
+func (mapper *Mapper5) Compare(other Mapper) error {
+    return fmt.Errorf("mapper5 compare unimplemented")
+}
+
+func (mapper *Mapper5) Copy() Mapper {
+    out := *mapper
+    out.ProgramRom = copySlice(mapper.ProgramRom)
+    out.CharacterRom = copySlice(mapper.CharacterRom)
+    out.PRGRam = copySlice(mapper.PRGRam)
+    out.ExRam = copySlice(mapper.ExRam)
+    return &out
+}
+
+func (mapper *Mapper5) SaveBinary(writer *StateWriter){
+    writer.Bytes(mapper.ProgramRom)
+    writer.Bytes(mapper.CharacterRom)
+    writer.Bytes(mapper.PRGRam)
+    writer.Bytes(mapper.ExRam)
+    writer.Byte(mapper.PrgMode)
+    writer.Byte(mapper.ChrMode)
+    writer.Byte(mapper.PrgRamProtect1)
+    writer.Byte(mapper.PrgRamProtect2)
+    writer.Byte(mapper.ExRamMode)
+    writer.Byte(mapper.NametableMapping)
+    writer.Byte(mapper.FillTile)
+    writer.Byte(mapper.FillAttribute)
+    writer.Byte(mapper.PrgRamBank)
+    for _, value := range mapper.PrgRegister {
+        writer.Byte(value)
+    }
+    for _, value := range mapper.ChrRegisterA {
+        writer.Uint16(value)
+    }
+    for _, value := range mapper.ChrRegisterB {
+        writer.Uint16(value)
+    }
+    writer.Byte(mapper.ChrUpper)
+    writer.Bool(mapper.LastChrB)
+    writer.Bool(mapper.SplitEnabled)
+    writer.Bool(mapper.SplitRight)
+    writer.Byte(mapper.SplitTile)
+    writer.Byte(mapper.SplitScroll)
+    writer.Byte(mapper.SplitBank)
+    writer.Byte(mapper.IrqCompare)
+    writer.Bool(mapper.IrqEnabled)
+    writer.Bool(mapper.IrqPending)
+    writer.Bool(mapper.InFrame)
+    writer.Byte(mapper.ScanlineCounter)
+    writer.Byte(mapper.Multiplicand)
+    writer.Byte(mapper.Multiplier)
+    mapper.Audio.SaveBinary(writer)
+}
+
+func (mapper *Mapper5) LoadBinary(reader *StateReader){
+    mapper.ProgramRom = reader.Bytes()
+    mapper.CharacterRom = reader.Bytes()
+    mapper.PRGRam = reader.Bytes()
+    mapper.ExRam = reader.Bytes()
+    mapper.PrgMode = reader.Byte()
+    mapper.ChrMode = reader.Byte()
+    mapper.PrgRamProtect1 = reader.Byte()
+    mapper.PrgRamProtect2 = reader.Byte()
+    mapper.ExRamMode = reader.Byte()
+    mapper.NametableMapping = reader.Byte()
+    mapper.FillTile = reader.Byte()
+    mapper.FillAttribute = reader.Byte()
+    mapper.PrgRamBank = reader.Byte()
+    for i := range mapper.PrgRegister {
+        mapper.PrgRegister[i] = reader.Byte()
+    }
+    for i := range mapper.ChrRegisterA {
+        mapper.ChrRegisterA[i] = reader.Uint16()
+    }
+    for i := range mapper.ChrRegisterB {
+        mapper.ChrRegisterB[i] = reader.Uint16()
+    }
+    mapper.ChrUpper = reader.Byte()
+    mapper.LastChrB = reader.Bool()
+    mapper.SplitEnabled = reader.Bool()
+    mapper.SplitRight = reader.Bool()
+    mapper.SplitTile = reader.Byte()
+    mapper.SplitScroll = reader.Byte()
+    mapper.SplitBank = reader.Byte()
+    mapper.IrqCompare = reader.Byte()
+    mapper.IrqEnabled = reader.Bool()
+    mapper.IrqPending = reader.Bool()
+    mapper.InFrame = reader.Bool()
+    mapper.ScanlineCounter = reader.Byte()
+    mapper.Multiplicand = reader.Byte()
+    mapper.Multiplier = reader.Byte()
+    mapper.Audio.LoadBinary(reader)
+}
+
+func (mapper *Mapper5) GetPRGRam() []byte {
+    return mapper.PRGRam
+}
+
+func (mapper *Mapper5) IsIRQAsserted() bool {
+    return (mapper.IrqEnabled && mapper.IrqPending) || mapper.Audio.IsIRQAsserted()
+}
+
+func (mapper *Mapper5) SetRegion(region Region){
+    mapper.Audio.Region = region
+}
+
+func (mapper *Mapper5) RunAudio(cycles float64, cyclesPerSample float64){
+    mapper.Audio.Run(cycles)
+}
+
+func (mapper *Mapper5) AudioOutput() float32 {
+    return mapper.Audio.Output()
+}
+
+/* returns which of $5114-$5117 and the size of the bank that covers the cpu address 0x8000-0xffff */
+func (mapper *Mapper5) prgBank(address uint16) (int, uint32) {
+    switch mapper.PrgMode {
+        case 0:
+            return 3, 0x8000
+        case 1:
+            if address < 0xc000 {
+                return 1, 0x4000
+            }
+            return 3, 0x4000
+        case 2:
+            if address < 0xc000 {
+                return 1, 0x4000
+            }
+            if address < 0xe000 {
+                return 2, 0x2000
+            }
+            return 3, 0x2000
+        default:
+            return int((address - 0x8000) / 0x2000), 0x2000
+    }
+}
+
+/* the prg rom or ram and the offset within it for a cpu address 0x8000-0xffff */
+func (mapper *Mapper5) prgMemory(address uint16) ([]byte, uint32) {
+    index, size := mapper.prgBank(address)
+    register := mapper.PrgRegister[index]
+    /* larger banks ignore the low bits of the 8k bank number */
+    page := uint32(register & 0x7f) &^ (size / 0x2000 - 1)
+    offset := page * 0x2000 + uint32(address) % size
+
+    /* $5117 always selects rom */
+    if register & 0x80 == 0x80 || index == 3 {
+        return mapper.ProgramRom, offset % uint32(len(mapper.ProgramRom))
+    }
+
+    if len(mapper.PRGRam) == 0 {
+        return nil, 0
+    }
+
+    return mapper.PRGRam, offset % uint32(len(mapper.PRGRam))
+}
+
+func (mapper *Mapper5) prgRamWritable() bool {
+    return mapper.PrgRamProtect1 == 2 && mapper.PrgRamProtect2 == 1
+}
+
+func (mapper *Mapper5) Read(address uint16) byte {
+    if address < 0x6000 {
+        return 0
+    }
+
+    if address < 0x8000 {
+        if len(mapper.PRGRam) == 0 {
+            return 0
+        }
+        offset := uint32(mapper.PrgRamBank & 0xf) * 0x2000 + uint32(address - 0x6000)
+        return mapper.PRGRam[offset % uint32(len(mapper.PRGRam))]
+    }
+
+    memory, offset := mapper.prgMemory(address)
+    if memory == nil {
+        return 0
+    }
+
+    value := memory[offset]
+    if address < 0xc000 {
+        mapper.Audio.ReadPCM(value)
+    }
+    return value
+}
+
+func (mapper *Mapper5) Write(cpu *CPUState, address uint16, value byte) error {
+    if !mapper.prgRamWritable() || len(mapper.PRGRam) == 0 {
+        return nil
+    }
+
+    if address >= 0x6000 && address < 0x8000 {
+        offset := uint32(mapper.PrgRamBank & 0xf) * 0x2000 + uint32(address - 0x6000)
+        mapper.PRGRam[offset % uint32(len(mapper.PRGRam))] = value
+        return nil
+    }
+
+    memory, offset := mapper.prgMemory(address)
+    /* writes to banks mapped to rom are ignored */
+    if memory != nil && &memory[0] == &mapper.PRGRam[0] {
+        memory[offset] = value
+    }
+
+    return nil
+}
+
+func (mapper *Mapper5) ReadExpansion(address uint16) byte {
+    switch {
+        case address >= 0x5000 && address <= 0x5015:
+            return mapper.Audio.Read(address)
+        case address == 0x5204:
+            var out byte
+            if mapper.IrqPending {
+                out |= 0x80
+            }
+            if mapper.InFrame {
+                out |= 0x40
+            }
+            mapper.IrqPending = false
+            return out
+        case address == 0x5205:
+            return byte(uint16(mapper.Multiplicand) * uint16(mapper.Multiplier))
+        case address == 0x5206:
+            return byte((uint16(mapper.Multiplicand) * uint16(mapper.Multiplier)) >> 8)
+        case address >= 0x5c00 && address < 0x6000:
+            /* exram is only readable by the cpu in modes 2 and 3 */
+            if mapper.ExRamMode >= MMC5ExRamWritable {
+                return mapper.ExRam[address - 0x5c00]
+            }
+            return 0
+    }
+
+    return 0
+}
+
+func (mapper *Mapper5) WriteExpansion(cpu *CPUState, address uint16, value byte){
+    switch {
+        case address >= 0x5000 && address <= 0x5015:
+            mapper.Audio.Write(address, value)
+            return
+        case address >= 0x5114 && address <= 0x5117:
+            mapper.PrgRegister[address - 0x5114] = value
+            return
+        case address >= 0x5120 && address <= 0x5127:
+            mapper.ChrRegisterA[address - 0x5120] = uint16(value) | (uint16(mapper.ChrUpper) << 8)
+            mapper.LastChrB = false
+            return
+        case address >= 0x5128 && address <= 0x512b:
+            mapper.ChrRegisterB[address - 0x5128] = uint16(value) | (uint16(mapper.ChrUpper) << 8)
+            mapper.LastChrB = true
+            return
+        case address >= 0x5c00 && address < 0x6000:
+            switch mapper.ExRamMode {
+                case MMC5ExRamNametable, MMC5ExRamAttributes:
+                    /* while the ppu is not rendering the written value is replaced with 0 */
+                    if !mapper.InFrame {
+                        value = 0
+                    }
+                    mapper.ExRam[address - 0x5c00] = value
+                case MMC5ExRamWritable:
+                    mapper.ExRam[address - 0x5c00] = value
+            }
+            return
+    }
+
+    switch address {
+        case 0x5100:
+            mapper.PrgMode = value & 0x3
+        case 0x5101:
+            mapper.ChrMode = value & 0x3
+        case 0x5102:
+            mapper.PrgRamProtect1 = value & 0x3
+        case 0x5103:
+            mapper.PrgRamProtect2 = value & 0x3
+        case 0x5104:
+            mapper.ExRamMode = value & 0x3
+        case 0x5105:
+            mapper.NametableMapping = value
+        case 0x5106:
+            mapper.FillTile = value
+        case 0x5107:
+            mapper.FillAttribute = value & 0x3
+        case 0x5113:
+            mapper.PrgRamBank = value & 0x7
+        case 0x5130:
+            mapper.ChrUpper = value & 0x3
+        case 0x5200:
+            mapper.SplitEnabled = value & 0x80 == 0x80
+            mapper.SplitRight = value & 0x40 == 0x40
+            mapper.SplitTile = value & 0x1f
+        case 0x5201:
+            mapper.SplitScroll = value
+        case 0x5202:
+            mapper.SplitBank = value
+        case 0x5203:
+            mapper.IrqCompare = value
+        case 0x5204:
+            mapper.IrqEnabled = value & 0x80 == 0x80
+        case 0x5205:
+            mapper.Multiplicand = value
+        case 0x5206:
+            mapper.Multiplier = value
+    }
+}
+
+/* the offset in chr rom of a ppu address 0x0000-0x1fff through either set of chr registers */
+func (mapper *Mapper5) chrOffset(address uint16, useB bool) uint32 {
+    address = address & 0x1fff
+
+    var bank uint16
+    var size uint32
+    if useB {
+        /* set B only has 4k worth of registers, which are used for both pattern tables */
+        low := address & 0xfff
+        switch mapper.ChrMode {
+            case 0:
+                bank, size = mapper.ChrRegisterB[3], 0x2000
+                /* in 8k mode the upper pattern table is the second half of the bank */
+                return (uint32(bank) * size + uint32(address)) % max(uint32(len(mapper.CharacterRom)), 1)
+            case 1: bank, size = mapper.ChrRegisterB[3], 0x1000
+            case 2: bank, size = mapper.ChrRegisterB[1 + (low / 0x800) * 2], 0x800
+            default: bank, size = mapper.ChrRegisterB[low / 0x400], 0x400
+        }
+    } else {
+        switch mapper.ChrMode {
+            case 0: bank, size = mapper.ChrRegisterA[7], 0x2000
+            case 1: bank, size = mapper.ChrRegisterA[3 + (address / 0x1000) * 4], 0x1000
+            case 2: bank, size = mapper.ChrRegisterA[1 + (address / 0x800) * 2], 0x800
+            default: bank, size = mapper.ChrRegisterA[address / 0x400], 0x400
+        }
+    }
+
+    offset := uint32(bank) * size + uint32(address) % size
+    return offset % max(uint32(len(mapper.CharacterRom)), 1)
+}
+
+/* read chr through one of the register sets. boards without chr rom use the ppu's memory */
+func (mapper *Mapper5) loadChr(ppu *PPUState, address uint16, useB bool) byte {
+    if len(mapper.CharacterRom) == 0 {
+        return ppu.VideoMemory[address & 0x1fff]
+    }
+    return mapper.CharacterRom[mapper.chrOffset(address, useB)]
+}
+
+/* the cpu sees the pattern tables through whichever set of chr registers was written last */
+func (mapper *Mapper5) ReadPPU(ppu *PPUState, address uint16) byte {
+    if address >= 0x2000 {
+        return mapper.loadNametable(ppu, address)
+    }
+
+    return mapper.loadChr(ppu, address, mapper.LastChrB)
+}
+
+func (mapper *Mapper5) WritePPU(ppu *PPUState, address uint16, value byte){
+    if address >= 0x2000 {
+        mapper.storeNametable(ppu, address, value)
+        return
+    }
+
+    if len(mapper.CharacterRom) == 0 {
+        ppu.VideoMemory[address] = value
+    }
+}
+
+func (mapper *Mapper5) loadNametable(ppu *PPUState, address uint16) byte {
+    offset := address & 0x3ff
+    switch (mapper.NametableMapping >> (((address >> 10) & 0x3) * 2)) & 0x3 {
+        case 0: return ppu.NametableMemory[offset]
+        case 1: return ppu.NametableMemory[0x400 + offset]
+        case 2:
+            if mapper.ExRamMode <= MMC5ExRamAttributes {
+                return mapper.ExRam[offset]
+            }
+            return 0
+        default:
+            if offset >= 0x3c0 {
+                /* the same palette for every quadrant */
+                return mapper.FillAttribute * 0x55
+            }
+            return mapper.FillTile
+    }
+}
+
+func (mapper *Mapper5) storeNametable(ppu *PPUState, address uint16, value byte){
+    offset := address & 0x3ff
+    switch (mapper.NametableMapping >> (((address >> 10) & 0x3) * 2)) & 0x3 {
+        case 0: ppu.NametableMemory[offset] = value
+        case 1: ppu.NametableMemory[0x400 + offset] = value
+        case 2:
+            if mapper.ExRamMode <= MMC5ExRamAttributes {
+                mapper.ExRam[offset] = value
+            }
+    }
+}
+
+func (mapper *Mapper5) inSplit(column int) bool {
+    if !mapper.SplitEnabled || mapper.ExRamMode > MMC5ExRamAttributes {
+        return false
+    }
+
+    if mapper.SplitRight {
+        return column >= int(mapper.SplitTile)
+    }
+    return column < int(mapper.SplitTile)
+}
+
+func (mapper *Mapper5) FetchBackgroundTile(ppu *PPUState, scanline int, column int) BackgroundTile {
+    if mapper.inSplit(column) {
+        /* the split region scrolls vertically on its own and is always drawn from exram */
+        y := (scanline + int(mapper.SplitScroll)) % 240
+        x := column & 31
+        tile := mapper.ExRam[(y / 8) * 32 + x]
+        attribute := mapper.ExRam[0x3c0 + (y / 32) * 8 + x / 4]
+        address := uint32(mapper.SplitBank) * 0x1000 + uint32(tile) * 16 + uint32(y & 7)
+        size := max(uint32(len(mapper.CharacterRom)), 1)
+        var low, high byte
+        if len(mapper.CharacterRom) > 0 {
+            low = mapper.CharacterRom[address % size]
+            high = mapper.CharacterRom[(address + 8) % size]
+        }
+        return BackgroundTile{
+            Low: low,
+            High: high,
+            Palette: attributePalette(attribute, byte(x), byte(y / 8)),
+        }
+    }
+
+    fineY, _, coarseY, coarseX := ppu.DeconstructVideoAddress()
+    tile := mapper.loadNametable(ppu, 0x2000 | (ppu.VideoAddress & 0xfff))
+
+    if mapper.ExRamMode == MMC5ExRamAttributes {
+        /* every tile picks its own 4k chr bank and palette */
+        extended := mapper.ExRam[ppu.VideoAddress & 0x3ff]
+        bank := uint32(extended & 0x3f) | (uint32(mapper.ChrUpper) << 6)
+        address := bank * 0x1000 + uint32(tile) * 16 + uint32(fineY)
+        size := max(uint32(len(mapper.CharacterRom)), 1)
+        var low, high byte
+        if len(mapper.CharacterRom) > 0 {
+            low = mapper.CharacterRom[address % size]
+            high = mapper.CharacterRom[(address + 8) % size]
+        }
+        return BackgroundTile{
+            Low: low,
+            High: high,
+            Palette: extended >> 6,
+        }
+    }
+
+    attribute := mapper.loadNametable(ppu, backgroundAttributeAddress(ppu.VideoAddress))
+    address := ppu.GetBackgroundPatternTableBase() + uint16(tile) * 16 + uint16(fineY)
+    /* with 8x8 sprites the last written register set is used for the background too */
+    useB := ppu.GetSpriteSize() == SpriteSize8x16 || mapper.LastChrB
+
+    return BackgroundTile{
+        Low: mapper.loadChr(ppu, address, useB),
+        High: mapper.loadChr(ppu, address + 8, useB),
+        Palette: attributePalette(attribute, coarseX, coarseY),
+    }
+}
+
+func (mapper *Mapper5) LoadSpritePattern(ppu *PPUState, address uint16) byte {
+    useB := ppu.GetSpriteSize() != SpriteSize8x16 && mapper.LastChrB
+    return mapper.loadChr(ppu, address, useB)
+}
+
+/* the scanline counter starts at 0 on the first rendered scanline of the frame and raises an
+ * irq when it reaches the compare value
+ */
+func (mapper *Mapper5) StartScanline(ppu *PPUState, scanline int){
+    rendering := ppu.IsBackgroundEnabled() || ppu.IsSpriteEnabled()
+    if !rendering || scanline >= 240 {
+        mapper.InFrame = false
+        return
+    }
+
+    if !mapper.InFrame {
+        mapper.InFrame = true
+        mapper.ScanlineCounter = 0
+        mapper.IrqPending = false
+        return
+    }
+
+    mapper.ScanlineCounter += 1
+    if mapper.IrqCompare != 0 && mapper.ScanlineCounter == mapper.IrqCompare {
+        mapper.IrqPending = true
+    }
+}
+
+/* info.TotalPRGRam is used for nes 2.0 roms. ines headers can't say how much ram there is so
+ * give those the maximum of 64k
+ */
+func MakeMapper5(info MapperInfo, programRom []byte, chrMemory []byte) Mapper {
+    ramSize := 0x10000
+    if info.Nes2 {
+        ramSize = int(info.TotalPRGRam())
+    }
+
+    return &Mapper5{
+        ProgramRom: programRom,
+        CharacterRom: chrMemory,
+        PRGRam: make([]byte, ramSize),
+        ExRam: make([]byte, 0x400),
+        PrgMode: 3,
+        ChrMode: 3,
+        PrgRegister: [4]byte{0xff, 0xff, 0xff, 0xff},
+        Audio: MakeMMC5Audio(),
+    }
+}
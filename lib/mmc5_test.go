@@ -0,0 +1,285 @@
+package lib
+
+import (
+    "testing"
+)
+
+func makeMMC5TestCpu(test *testing.T) (CPUState, *Mapper5) {
+    program := makeMapperTestRom(0x20000, nil)
+    mapper, err := MakeMapper(MapperInfo{Mapper: 5}, program, makeMapperTestChr(0x20000))
+    if err != nil {
+        test.Fatalf("could not make mapper 5: %v", err)
+    }
+
+    cpu := StartupState()
+    cpu.SetMapper(mapper)
+    return cpu, mapper.(*Mapper5)
+}
+
+func TestMMC5Registers(test *testing.T){
+    cpu, mapper := makeMMC5TestCpu(test)
+
+    cpu.StoreMemory(0x5205, 200)
+    cpu.StoreMemory(0x5206, 100)
+    product := uint16(cpu.LoadMemory(0x5205)) | uint16(cpu.LoadMemory(0x5206)) << 8
+    if product != 20000 {
+        test.Fatalf("expected the multiplier to give 20000 but got %v", product)
+    }
+
+    /* 8k banks, each page of the test rom has its page number at offset 0x1000 */
+    cpu.StoreMemory(0x5100, 3)
+    cpu.StoreMemory(0x5114, 0x80 | 5)
+    if value := cpu.LoadMemory(0x9000); value != 5 {
+        test.Fatalf("expected page 5 at 0x8000 but got %v", value)
+    }
+
+    /* a 16k bank ignores the lowest bit of the page number */
+    cpu.StoreMemory(0x5100, 1)
+    cpu.StoreMemory(0x5115, 0x80 | 7)
+    if value := cpu.LoadMemory(0xb000); value != 7 {
+        test.Fatalf("expected page 7 at 0xa000 but got %v", value)
+    }
+    if value := cpu.LoadMemory(0x9000); value != 6 {
+        test.Fatalf("expected page 6 at 0x8000 but got %v", value)
+    }
+
+    /* ram is only writable once both protect registers are set */
+    cpu.StoreMemory(0x6000, 0x42)
+    if cpu.LoadMemory(0x6000) == 0x42 {
+        test.Fatalf("prg ram should be write protected")
+    }
+    cpu.StoreMemory(0x5102, 2)
+    cpu.StoreMemory(0x5103, 1)
+    cpu.StoreMemory(0x6000, 0x42)
+    if value := cpu.LoadMemory(0x6000); value != 0x42 {
+        test.Fatalf("expected 0x42 in prg ram but got %v", value)
+    }
+
+    /* fill mode for the second nametable */
+    cpu.StoreMemory(0x5105, 0xc)
+    cpu.StoreMemory(0x5106, 0x33)
+    cpu.StoreMemory(0x5107, 2)
+    if value := mapper.ReadPPU(&cpu.PPU, 0x2410); value != 0x33 {
+        test.Fatalf("expected the fill tile but got 0x%x", value)
+    }
+    if value := mapper.ReadPPU(&cpu.PPU, 0x27c0); value != 0xaa {
+        test.Fatalf("expected the fill attribute but got 0x%x", value)
+    }
+}
+
+func TestMMC5ScanlineIrq(test *testing.T){
+    cpu, mapper := makeMMC5TestCpu(test)
+    cpu.PPU.SetMask(0x1e)
+
+    cpu.StoreMemory(0x5203, 10)
+    cpu.StoreMemory(0x5204, 0x80)
+
+    for scanline := range 10 {
+        mapper.StartScanline(&cpu.PPU, scanline)
+        if mapper.IsIRQAsserted() {
+            test.Fatalf("irq raised too early on scanline %v", scanline)
+        }
+    }
+
+    mapper.StartScanline(&cpu.PPU, 10)
+    if !mapper.IsIRQAsserted() {
+        test.Fatalf("irq should be raised on scanline 10")
+    }
+
+    status := cpu.LoadMemory(0x5204)
+    if status != 0xc0 {
+        test.Fatalf("expected the irq and in frame flags but got 0x%x", status)
+    }
+    if mapper.IsIRQAsserted() {
+        test.Fatalf("reading $5204 should acknowledge the irq")
+    }
+
+    mapper.StartScanline(&cpu.PPU, 240)
+    if cpu.LoadMemory(0x5204) & 0x40 != 0 {
+        test.Fatalf("should not be in frame during vblank")
+    }
+}
+
+/* the ppu fetches the tile at its current video address, so point it at a nametable entry */
+func setMMC5TestTile(ppu *PPUState, coarseX uint16, coarseY uint16, fineY uint16){
+    ppu.VideoAddress = (fineY << 12) | 0x2000 | (coarseY << 5) | coarseX
+}
+
+func TestMMC5SplitScreen(test *testing.T){
+    cpu := StartupState()
+    mapper := MakeMapper5(MapperInfo{Mapper: 5}, makeMapperTestRom(0x20000, nil), makeBankedChr(0x20000)).(*Mapper5)
+    cpu.SetMapper(mapper)
+
+    /* exram can be written freely in mode 2 */
+    cpu.StoreMemory(0x5104, MMC5ExRamWritable)
+    /* with a split scroll of 16, scanline 10 draws row 26 of the split, which is tile row 3 */
+    cpu.StoreMemory(0x5c00 + 3 * 32 + 2, 0x40)
+    cpu.StoreMemory(0x5c00 + 0x3c0, 0xc0)
+
+    cpu.StoreMemory(0x5104, MMC5ExRamNametable)
+    /* the split covers the 4 leftmost tiles and uses the 4k chr bank 3 */
+    cpu.StoreMemory(0x5200, 0x80 | 4)
+    cpu.StoreMemory(0x5201, 16)
+    cpu.StoreMemory(0x5202, 3)
+
+    setMMC5TestTile(&cpu.PPU, 2, 1, 2)
+    /* tile $40 in 4k bank 3 is at $3400 of chr rom, which is 1k bank 13 */
+    tile := mapper.FetchBackgroundTile(&cpu.PPU, 10, 2)
+    if tile.Low != 13 || tile.High != 13 {
+        test.Fatalf("expected the split tile to come from 1k bank 13 but got %+v", tile)
+    }
+    /* column 2, row 3 is the bottom right of the attribute byte */
+    if tile.Palette != 3 {
+        test.Fatalf("expected palette 3 from the split attributes but got %v", tile.Palette)
+    }
+
+    /* outside the split the nametable is used, where tile 0 is in chr bank 0 */
+    tile = mapper.FetchBackgroundTile(&cpu.PPU, 10, 5)
+    if tile.Low != 0 || tile.Palette != 0 {
+        test.Fatalf("column 5 should not be in the split but got %+v", tile)
+    }
+
+    /* the split can be on the right side instead */
+    cpu.StoreMemory(0x5200, 0xc0 | 4)
+    if mapper.FetchBackgroundTile(&cpu.PPU, 10, 2).Low != 0 {
+        test.Fatalf("column 2 should not be in a right side split")
+    }
+    if tile := mapper.FetchBackgroundTile(&cpu.PPU, 10, 5); tile.Low != 12 {
+        test.Fatalf("expected column 5 to be in the right side split but got %+v", tile)
+    }
+
+    /* the split is only drawn when exram is a nametable or extended attributes */
+    cpu.StoreMemory(0x5104, MMC5ExRamWritable)
+    if tile := mapper.FetchBackgroundTile(&cpu.PPU, 10, 5); tile.Low != 0 {
+        test.Fatalf("the split should be off when exram is writable but got %+v", tile)
+    }
+}
+
+func TestMMC5ExtendedAttributes(test *testing.T){
+    cpu := StartupState()
+    mapper := MakeMapper5(MapperInfo{Mapper: 5}, makeMapperTestRom(0x20000, nil), makeBankedChr(0x20000)).(*Mapper5)
+    cpu.SetMapper(mapper)
+
+    /* tile $41 at column 5, row 2 of the first nametable */
+    cpu.PPU.VideoAddress = 0x2045
+    cpu.PPU.WriteVideoMemory(0x41, cpu.Mapper.Mapper)
+
+    /* the exram byte at the same offset picks the 4k chr bank and the palette */
+    cpu.StoreMemory(0x5104, MMC5ExRamWritable)
+    cpu.StoreMemory(0x5c45, 0x80 | 5)
+    cpu.StoreMemory(0x5104, MMC5ExRamAttributes)
+
+    setMMC5TestTile(&cpu.PPU, 5, 2, 3)
+    /* tile $41 in 4k bank 5 is at $5410, which is 1k bank 21 */
+    tile := mapper.FetchBackgroundTile(&cpu.PPU, 19, 5)
+    if tile.Low != 21 || tile.High != 21 || tile.Palette != 2 {
+        test.Fatalf("expected 1k bank 21 and palette 2 but got %+v", tile)
+    }
+
+    /* $5130 supplies the upper bits of the bank, which wraps around the 128k of chr */
+    cpu.StoreMemory(0x5130, 1)
+    if tile := mapper.FetchBackgroundTile(&cpu.PPU, 19, 5); tile.Low != 21 {
+        test.Fatalf("expected the bank to wrap around to 1k bank 21 but got %+v", tile)
+    }
+
+    /* the chr registers and the normal attribute table are used otherwise */
+    cpu.StoreMemory(0x5121, 4)
+    cpu.StoreMemory(0x5104, MMC5ExRamNametable)
+    if tile := mapper.FetchBackgroundTile(&cpu.PPU, 19, 5); tile.Palette != 0 || tile.Low != 4 {
+        test.Fatalf("expected tile $41 from the 1k bank at $0400 and palette 0 but got %+v", tile)
+    }
+}
+
+func TestMMC5Audio(test *testing.T){
+    cpu, mapper := makeMMC5TestCpu(test)
+
+    /* length counters only count while the channel is enabled */
+    cpu.StoreMemory(0x5000, 0x1f)
+    cpu.StoreMemory(0x5003, 0x08)
+    if cpu.LoadMemory(0x5015) & 0x1 != 0 {
+        test.Fatalf("pulse 1 should not have a length while disabled")
+    }
+
+    cpu.StoreMemory(0x5015, 0x3)
+    cpu.StoreMemory(0x5002, 0x80)
+    cpu.StoreMemory(0x5003, 0x00)
+    cpu.StoreMemory(0x5007, 0x00)
+    if value := cpu.LoadMemory(0x5015); value != 0x3 {
+        test.Fatalf("expected both pulses to have a length but got 0x%x", value)
+    }
+
+    /* a length of 10 runs out after 10 ticks of the 240hz frame counter */
+    mapper.Audio.Run(CPUSpeed / 20)
+    if value := cpu.LoadMemory(0x5015); value != 0 {
+        test.Fatalf("expected the length counters to run out but got 0x%x", value)
+    }
+
+    /* the halt flag stops the length counter */
+    cpu.StoreMemory(0x5004, 0x3f)
+    cpu.StoreMemory(0x5007, 0x00)
+    mapper.Audio.Run(CPUSpeed / 20)
+    if value := cpu.LoadMemory(0x5015); value != 0x2 {
+        test.Fatalf("expected the halted pulse 2 to keep its length but got 0x%x", value)
+    }
+
+    cpu.StoreMemory(0x5015, 0)
+    if value := cpu.LoadMemory(0x5015); value != 0 {
+        test.Fatalf("disabling the pulses should clear their lengths but got 0x%x", value)
+    }
+
+    /* pcm write mode ignores 0 */
+    cpu.StoreMemory(0x5011, 0x80)
+    cpu.StoreMemory(0x5011, 0)
+    if mapper.Audio.PCM != 0x80 {
+        test.Fatalf("expected the pcm level to be 0x80 but got 0x%x", mapper.Audio.PCM)
+    }
+
+    /* in read mode reads of $8000-$bfff set the level and a 0 raises the irq */
+    cpu.StoreMemory(0x5010, 0x81)
+    cpu.StoreMemory(0x5011, 0x10)
+    if mapper.Audio.PCM != 0x80 {
+        test.Fatalf("$5011 should be ignored in read mode")
+    }
+    page := cpu.LoadMemory(0x9000)
+    if mapper.Audio.PCM != page {
+        test.Fatalf("expected the pcm level to be the byte read, 0x%x, but got 0x%x", page, mapper.Audio.PCM)
+    }
+    if mapper.IsIRQAsserted() {
+        test.Fatalf("a non zero read should not raise the pcm irq")
+    }
+
+    cpu.LoadMemory(0x8100)
+    if !mapper.IsIRQAsserted() {
+        test.Fatalf("reading a 0 should raise the pcm irq")
+    }
+    if cpu.LoadMemory(0x5010) != 0x80 || mapper.IsIRQAsserted() {
+        test.Fatalf("reading $5010 should report and acknowledge the pcm irq")
+    }
+
+    /* reads outside $8000-$bfff don't change the level */
+    cpu.LoadMemory(0xc000)
+    if mapper.Audio.PCM != page {
+        test.Fatalf("a read from $c000 changed the pcm level to 0x%x", mapper.Audio.PCM)
+    }
+}
+
+func TestMMC5AudioRegion(test *testing.T){
+    for _, region := range []Region{RegionNTSC, RegionPAL} {
+        cpu, mapper := makeMMC5TestCpu(test)
+        cpu.SetRegion(region)
+        if mapper.Audio.Region != region {
+            test.Fatalf("the mmc5 audio did not get the %v region", region)
+        }
+
+        cpu.StoreMemory(0x5015, 0x1)
+        cpu.StoreMemory(0x5000, 0x0f)
+        cpu.StoreMemory(0x5003, 0x00)
+
+        /* a length of 10 lasts 10 frame counter steps, 74575 cpu cycles on ntsc and 83132 on pal */
+        mapper.Audio.Run(80000)
+        running := cpu.LoadMemory(0x5015) & 0x1 == 0x1
+        if running != (region == RegionPAL) {
+            test.Fatalf("%v: wrong length counter rate, pulse 1 running is %v after 80000 cycles", region, running)
+        }
+    }
+}
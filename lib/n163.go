@@ -0,0 +1,424 @@
+package lib
+
+import (
+    "fmt"
+)
+
+/* Namco 163 wavetable audio.
+ * https://www.nesdev.org/wiki/Namco_163_audio
+ *
+ * The chip has 128 bytes of ram that hold both the waveforms, as 4-bit samples, and the
+ * registers of up to 8 channels at $40-$7f. Only one channel is updated at a time, every 15
+ * cpu cycles, so using more channels lowers each channel's sample rate. The real chip also
+ * outputs one channel at a time, which makes an audible whine with many channels enabled, so
+ * the channels are averaged instead like most emulators do.
+ */
+
+const N163DataPort = 0x4800
+const N163AddressPort = 0xf800
+
+/* cpu cycles between channel updates */
+const n163ChannelCycles = 15
+
+type N163Audio struct {
+    Ram [128]byte `json:"ram"`
+    /* the ram address used by the data port */
+    Address byte `json:"address"`
+    AutoIncrement bool `json:"autoincrement"`
+
+    /* cpu cycles until the next channel update */
+    Cycles float64 `json:"cycles"`
+    /* the channel that is updated next */
+    Channel int `json:"channel"`
+    /* the last output of each channel */
+    Outputs [8]int `json:"outputs"`
+    Disabled bool `json:"disabled"`
+}
+
+func MakeN163Audio() *N163Audio {
+    return &N163Audio{}
+}
+
+func (audio *N163Audio) SaveBinary(writer *StateWriter){
+    writer.Bytes(audio.Ram[:])
+    writer.Byte(audio.Address)
+    writer.Bool(audio.AutoIncrement)
+    writer.Float64(audio.Cycles)
+    writer.Int(audio.Channel)
+    for _, output := range audio.Outputs {
+        writer.Int(output)
+    }
+    writer.Bool(audio.Disabled)
+}
+
+func (audio *N163Audio) LoadBinary(reader *StateReader){
+    copy(audio.Ram[:], reader.Bytes())
+    audio.Address = reader.Byte()
+    audio.AutoIncrement = reader.Bool()
+    audio.Cycles = reader.Float64()
+    audio.Channel = reader.Int()
+    for i := range audio.Outputs {
+        audio.Outputs[i] = reader.Int()
+    }
+    audio.Disabled = reader.Bool()
+}
+
+func (audio *N163Audio) SetAddress(value byte){
+    audio.Address = value & 0x7f
+    audio.AutoIncrement = value & 0x80 == 0x80
+}
+
+func (audio *N163Audio) ReadData() byte {
+    value := audio.Ram[audio.Address]
+    if audio.AutoIncrement {
+        audio.Address = (audio.Address + 1) & 0x7f
+    }
+    return value
+}
+
+func (audio *N163Audio) WriteData(value byte){
+    audio.Ram[audio.Address] = value
+    if audio.AutoIncrement {
+        audio.Address = (audio.Address + 1) & 0x7f
+    }
+}
+
+/* the enabled channels are the last ones, so with 2 channels only 6 and 7 play */
+func (audio *N163Audio) channelCount() int {
+    return int((audio.Ram[0x7f] >> 4) & 0x7) + 1
+}
+
+func (audio *N163Audio) updateChannel(channel int){
+    base := 0x40 + channel * 8
+    ram := audio.Ram[base:base+8]
+
+    frequency := uint32(ram[0]) | uint32(ram[2]) << 8 | uint32(ram[4] & 0x3) << 16
+    phase := uint32(ram[1]) | uint32(ram[3]) << 8 | uint32(ram[5]) << 16
+    length := 256 - uint32(ram[4] & 0xfc)
+
+    phase = (phase + frequency) % (length << 16)
+    ram[1] = byte(phase)
+    ram[3] = byte(phase >> 8)
+    ram[5] = byte(phase >> 16)
+
+    /* two 4-bit samples per byte, the low nibble first */
+    position := ((phase >> 16) + uint32(ram[6])) & 0xff
+    sample := audio.Ram[position / 2]
+    if position & 0x1 == 0 {
+        sample = sample & 0xf
+    } else {
+        sample = sample >> 4
+    }
+
+    audio.Outputs[channel] = (int(sample) - 8) * int(ram[7] & 0xf)
+}
+
+/* cycles is in cpu cycles */
+func (audio *N163Audio) Run(cycles float64){
+    if audio.Disabled {
+        return
+    }
+
+    audio.Cycles -= cycles
+    for audio.Cycles <= 0 {
+        audio.Cycles += n163ChannelCycles
+
+        first := 8 - audio.channelCount()
+        if audio.Channel < first {
+            audio.Channel = 7
+        }
+        audio.updateChannel(audio.Channel)
+        audio.Channel -= 1
+    }
+}
+
+func (audio *N163Audio) GenerateSample() float32 {
+    if audio.Disabled {
+        return 0
+    }
+
+    count := audio.channelCount()
+    total := 0
+    for channel := 8 - count; channel < 8; channel++ {
+        total += audio.Outputs[channel]
+    }
+
+    /* a single channel at full volume is a bit louder than an apu pulse */
+    return float32(total) / float32(count) / 120 * 0.25
+}
+
+/* The Namco 163 (and 129), used by megami tensei 2, king of kings, erika to satoru no yume bouken
+ * and others. https://www.nesdev.org/wiki/Namco_163
+ *
+ * Chr banks of $e0-$ff select the ppu's nametable ram instead of chr rom, and each nametable can
+ * come from chr rom or nametable ram, so the mapper does all of the ppu's reads itself.
+ */
+type Mapper19 struct {
+    ProgramRom []byte `json:"programrom"`
+    CharacterRom []byte `json:"characterrom"`
+    PRGRam []byte `json:"prgram"`
+
+    /* 8k banks at $8000, $a000 and $c000 */
+    PrgRegister [3]byte `json:"prgregister"`
+    /* 1k banks for the pattern tables and the 4 nametables */
+    ChrRegister [8]byte `json:"chrregister"`
+    NametableRegister [4]byte `json:"nametableregister"`
+    /* $e800 bits 6 and 7, if set chr banks $e0-$ff in that pattern table use chr rom */
+    LowChrRamDisable bool `json:"lowchrramdisable"`
+    HighChrRamDisable bool `json:"highchrramdisable"`
+    /* $f800, which also protects each 2k of prg ram */
+    WriteProtect byte `json:"writeprotect"`
+
+    /* 15 bits, counts up every cpu cycle and raises an irq at $7fff */
+    IrqCounter uint16 `json:"irqcounter"`
+    IrqEnabled bool `json:"irqenabled"`
+    IrqPending bool `json:"irqpending"`
+
+    Audio *N163Audio `json:"audio"`
+}
+
+func (mapper *Mapper19) IsNSF() bool {
+    return false
+}
+
+func (mapper *Mapper19) Kind() int {
+    return 19
+}
+
+func (mapper *Mapper19) Compare(other Mapper) error {
+    return fmt.Errorf("mapper19 compare unimplemented")
+}
+
+func (mapper *Mapper19) Copy() Mapper {
+    out := *mapper
+    out.ProgramRom = copySlice(mapper.ProgramRom)
+    out.CharacterRom = copySlice(mapper.CharacterRom)
+    out.PRGRam = copySlice(mapper.PRGRam)
+    audio := *mapper.Audio
+    out.Audio = &audio
+    return &out
+}
+
+func (mapper *Mapper19) SaveBinary(writer *StateWriter){
+    writer.Bytes(mapper.ProgramRom)
+    writer.Bytes(mapper.CharacterRom)
+    writer.Bytes(mapper.PRGRam)
+    for _, value := range mapper.PrgRegister {
+        writer.Byte(value)
+    }
+    for _, value := range mapper.ChrRegister {
+        writer.Byte(value)
+    }
+    for _, value := range mapper.NametableRegister {
+        writer.Byte(value)
+    }
+    writer.Bool(mapper.LowChrRamDisable)
+    writer.Bool(mapper.HighChrRamDisable)
+    writer.Byte(mapper.WriteProtect)
+    writer.Uint16(mapper.IrqCounter)
+    writer.Bool(mapper.IrqEnabled)
+    writer.Bool(mapper.IrqPending)
+    mapper.Audio.SaveBinary(writer)
+}
+
+func (mapper *Mapper19) LoadBinary(reader *StateReader){
+    mapper.ProgramRom = reader.Bytes()
+    mapper.CharacterRom = reader.Bytes()
+    mapper.PRGRam = reader.Bytes()
+    for i := range mapper.PrgRegister {
+        mapper.PrgRegister[i] = reader.Byte()
+    }
+    for i := range mapper.ChrRegister {
+        mapper.ChrRegister[i] = reader.Byte()
+    }
+    for i := range mapper.NametableRegister {
+        mapper.NametableRegister[i] = reader.Byte()
+    }
+    mapper.LowChrRamDisable = reader.Bool()
+    mapper.HighChrRamDisable = reader.Bool()
+    mapper.WriteProtect = reader.Byte()
+    mapper.IrqCounter = reader.Uint16()
+    mapper.IrqEnabled = reader.Bool()
+    mapper.IrqPending = reader.Bool()
+    mapper.Audio = MakeN163Audio()
+    mapper.Audio.LoadBinary(reader)
+}
+
+func (mapper *Mapper19) IsIRQAsserted() bool {
+    return mapper.IrqPending
+}
+
+func (mapper *Mapper19) GetPRGRam() []byte {
+    return mapper.PRGRam
+}
+
+func (mapper *Mapper19) RunCycles(cycles uint64){
+    if !mapper.IrqEnabled || mapper.IrqCounter >= 0x7fff {
+        return
+    }
+
+    mapper.IrqCounter = uint16(min(uint64(mapper.IrqCounter) + cycles, 0x7fff))
+    if mapper.IrqCounter == 0x7fff {
+        mapper.IrqPending = true
+    }
+}
+
+func (mapper *Mapper19) RunAudio(cycles float64, cyclesPerSample float64){
+    mapper.Audio.Run(cycles)
+}
+
+func (mapper *Mapper19) AudioOutput() float32 {
+    return mapper.Audio.GenerateSample()
+}
+
+func (mapper *Mapper19) ReadExpansion(address uint16) byte {
+    switch address & 0xf800 {
+        case 0x4800:
+            return mapper.Audio.ReadData()
+        case 0x5000:
+            return byte(mapper.IrqCounter)
+        case 0x5800:
+            out := byte(mapper.IrqCounter >> 8)
+            if mapper.IrqEnabled {
+                out |= 0x80
+            }
+            return out
+    }
+
+    return 0
+}
+
+func (mapper *Mapper19) WriteExpansion(cpu *CPUState, address uint16, value byte){
+    switch address & 0xf800 {
+        case 0x4800:
+            mapper.Audio.WriteData(value)
+        case 0x5000:
+            mapper.IrqCounter = (mapper.IrqCounter & 0x7f00) | uint16(value)
+            mapper.IrqPending = false
+        case 0x5800:
+            mapper.IrqCounter = (mapper.IrqCounter & 0xff) | (uint16(value & 0x7f) << 8)
+            mapper.IrqEnabled = value & 0x80 == 0x80
+            mapper.IrqPending = false
+    }
+}
+
+func (mapper *Mapper19) readProgram(bank int, offset uint16) byte {
+    pages := len(mapper.ProgramRom) / 0x2000
+    return mapper.ProgramRom[(bank % pages) * 0x2000 + int(offset)]
+}
+
+func (mapper *Mapper19) Read(address uint16) byte {
+    switch {
+        case address >= 0x6000 && address < 0x8000:
+            return mapper.PRGRam[address - 0x6000]
+        case address >= 0x8000 && address < 0xe000:
+            index := (address - 0x8000) / 0x2000
+            return mapper.readProgram(int(mapper.PrgRegister[index]), address & 0x1fff)
+        case address >= 0xe000:
+            return mapper.readProgram(len(mapper.ProgramRom) / 0x2000 - 1, address & 0x1fff)
+    }
+
+    return 0
+}
+
+/* prg ram can only be written when the upper nibble of $f800 is 4, and each of the low 4 bits protects 2k */
+func (mapper *Mapper19) prgRamWritable(address uint16) bool {
+    if mapper.WriteProtect & 0xf0 != 0x40 {
+        return false
+    }
+    return mapper.WriteProtect & (1 << ((address - 0x6000) / 0x800)) == 0
+}
+
+func (mapper *Mapper19) Write(cpu *CPUState, address uint16, value byte) error {
+    if address >= 0x6000 && address < 0x8000 {
+        if mapper.prgRamWritable(address) {
+            mapper.PRGRam[address - 0x6000] = value
+        }
+        return nil
+    }
+
+    switch address & 0xf800 {
+        case 0x8000, 0x8800, 0x9000, 0x9800, 0xa000, 0xa800, 0xb000, 0xb800:
+            mapper.ChrRegister[(address - 0x8000) / 0x800] = value
+        case 0xc000, 0xc800, 0xd000, 0xd800:
+            mapper.NametableRegister[(address - 0xc000) / 0x800] = value
+        case 0xe000:
+            mapper.PrgRegister[0] = value & 0x3f
+            mapper.Audio.Disabled = value & 0x40 == 0x40
+        case 0xe800:
+            mapper.PrgRegister[1] = value & 0x3f
+            mapper.LowChrRamDisable = value & 0x40 == 0x40
+            mapper.HighChrRamDisable = value & 0x80 == 0x80
+        case 0xf000:
+            mapper.PrgRegister[2] = value & 0x3f
+        case 0xf800:
+            mapper.WriteProtect = value
+            mapper.Audio.SetAddress(value)
+    }
+
+    return nil
+}
+
+/* read from a 1k bank, which is either chr rom or one of the two pages of nametable ram */
+func (mapper *Mapper19) readBank(ppu *PPUState, bank byte, ciram bool, offset uint16) byte {
+    if ciram && bank >= 0xe0 {
+        return ppu.NametableMemory[uint16(bank & 0x1) * 0x400 + offset]
+    }
+
+    if len(mapper.CharacterRom) == 0 {
+        return 0
+    }
+    return mapper.CharacterRom[(uint32(bank) * 0x400 + uint32(offset)) % uint32(len(mapper.CharacterRom))]
+}
+
+/* the 1k bank at a pattern table address, and whether banks $e0-$ff select nametable ram there */
+func (mapper *Mapper19) chrBank(address uint16) (byte, bool) {
+    ciram := !mapper.LowChrRamDisable
+    if address >= 0x1000 {
+        ciram = !mapper.HighChrRamDisable
+    }
+
+    return mapper.ChrRegister[address / 0x400], ciram
+}
+
+/* the nametables and pattern tables are both made of 1k banks of chr rom or nametable ram */
+func (mapper *Mapper19) ReadPPU(ppu *PPUState, address uint16) byte {
+    if address >= 0x2000 {
+        bank := mapper.NametableRegister[(address >> 10) & 0x3]
+        return mapper.readBank(ppu, bank, true, address & 0x3ff)
+    }
+
+    bank, ciram := mapper.chrBank(address)
+    if len(mapper.CharacterRom) == 0 && !(ciram && bank >= 0xe0) {
+        return ppu.VideoMemory[address]
+    }
+    return mapper.readBank(ppu, bank, ciram, address & 0x3ff)
+}
+
+/* writes to banks mapped to chr rom are ignored */
+func (mapper *Mapper19) WritePPU(ppu *PPUState, address uint16, value byte){
+    var bank byte
+    ciram := true
+    if address >= 0x2000 {
+        bank = mapper.NametableRegister[(address >> 10) & 0x3]
+    } else {
+        bank, ciram = mapper.chrBank(address)
+    }
+
+    if ciram && bank >= 0xe0 {
+        ppu.NametableMemory[uint16(bank & 0x1) * 0x400 + (address & 0x3ff)] = value
+    } else if address < 0x2000 && len(mapper.CharacterRom) == 0 {
+        ppu.VideoMemory[address] = value
+    }
+}
+
+func MakeMapper19(programRom []byte, chrMemory []byte) Mapper {
+    return &Mapper19{
+        ProgramRom: programRom,
+        CharacterRom: chrMemory,
+        PRGRam: make([]byte, 0x2000),
+        /* nametables start out as vertical mirroring */
+        NametableRegister: [4]byte{0xe0, 0xe1, 0xe0, 0xe1},
+        Audio: MakeN163Audio(),
+    }
+}
@@ -0,0 +1,91 @@
+package lib
+
+import (
+    "testing"
+)
+
+func TestN163Audio(test *testing.T){
+    audio := MakeN163Audio()
+
+    /* a square wave of 16 samples at address 0 */
+    audio.SetAddress(0x80)
+    for range 4 {
+        audio.WriteData(0x00)
+    }
+    for range 4 {
+        audio.WriteData(0xff)
+    }
+    if audio.Address != 8 {
+        test.Fatalf("the address should auto increment, it is %v", audio.Address)
+    }
+
+    /* one channel, the last one at $78 */
+    audio.SetAddress(0x80 | 0x78)
+    for _, value := range []byte{0x00, 0x00, 0x40, 0x00, 256 - 16, 0x00, 0x00, 0x0f} {
+        audio.WriteData(value)
+    }
+
+    low, high := float32(0), float32(0)
+    for range 1000 {
+        audio.Run(n163ChannelCycles)
+        sample := audio.GenerateSample()
+        low = min(low, sample)
+        high = max(high, sample)
+    }
+    if low >= 0 || high <= 0 {
+        test.Fatalf("the channel should play a square wave, range was %v to %v", low, high)
+    }
+
+    audio.Disabled = true
+    if audio.GenerateSample() != 0 {
+        test.Fatalf("a disabled chip should be silent")
+    }
+}
+
+func TestN163Mapper(test *testing.T){
+    character := makeMapperTestChr(0x20000)
+    mapper := MakeMapper19(makeMapperTestRom(0x20000, nil), character).(*Mapper19)
+    cpu := StartupState()
+    cpu.SetMapper(mapper)
+
+    /* the irq counter counts up to $7fff */
+    cpu.StoreMemory(0x5000, 0xf0)
+    cpu.StoreMemory(0x5800, 0xff)
+    mapper.RunCycles(14)
+    if mapper.IsIRQAsserted() {
+        test.Fatalf("irq raised too early")
+    }
+    mapper.RunCycles(1)
+    if !mapper.IsIRQAsserted() {
+        test.Fatalf("irq should be raised when the counter reaches $7fff")
+    }
+    if cpu.LoadMemory(0x5800) != 0xff || cpu.LoadMemory(0x5000) != 0xff {
+        test.Fatalf("the counter should stop at $7fff")
+    }
+    cpu.StoreMemory(0x5800, 0)
+    if mapper.IsIRQAsserted() {
+        test.Fatalf("writing the counter should acknowledge the irq")
+    }
+
+    /* nametable 0 from chr rom, nametable 1 from the second page of nametable ram */
+    cpu.StoreMemory(0xc000, 3)
+    cpu.StoreMemory(0xc800, 0xe1)
+    mapper.WritePPU(&cpu.PPU, 0x2405, 0x42)
+    if value := mapper.ReadPPU(&cpu.PPU, 0x2405); value != 0x42 || cpu.PPU.NametableMemory[0x405] != 0x42 {
+        test.Fatalf("expected the write to go to nametable ram, got 0x%x", value)
+    }
+    if value := mapper.ReadPPU(&cpu.PPU, 0x2005); value != character[3 * 0x400 + 5] {
+        test.Fatalf("expected nametable 0 to come from chr rom, got 0x%x", value)
+    }
+
+    /* prg ram is write protected until $f800 is $40 */
+    cpu.StoreMemory(0x6000, 0x11)
+    if cpu.LoadMemory(0x6000) != 0 {
+        test.Fatalf("prg ram should be write protected")
+    }
+    cpu.StoreMemory(0xf800, 0x40)
+    cpu.StoreMemory(0x6000, 0x11)
+    if cpu.LoadMemory(0x6000) != 0x11 {
+        test.Fatalf("prg ram should be writable")
+    }
+}
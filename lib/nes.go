@@ -7,6 +7,7 @@ import (
     "fmt"
     "os"
     "log"
+    "path/filepath"
 )
 
 func isINes(check []byte) bool {
@@ -33,7 +34,8 @@ func isNes2(nesHeader []byte) bool {
     return nesHeader[7] & 0xc == 0x8
 }
 
-func IsNESFile(path string) bool {
+/* true if the first 16 bytes of the file pass check */
+func hasRomHeader(path string, check func([]byte) bool) bool {
     file, err := os.Open(path)
     if err != nil {
         return false
@@ -47,16 +49,28 @@ func IsNESFile(path string) bool {
         return false
     }
 
-    return isINes(header[0:4])
+    return check(header)
+}
+
+func IsNESFile(path string) bool {
+    return hasRomHeader(path, func(header []byte) bool {
+        return isINes(header[0:4])
+    })
+}
+
+/* any file that ParseNes can load: ines, disk images and unif */
+func IsRomFile(path string) bool {
+    return hasRomHeader(path, func(header []byte) bool {
+        return isINes(header[0:4]) || isFDS(header) || isUnif(header)
+    })
 }
 
 func readPRG(header []byte) uint64 {
     lsb := header[4]
-    /* only use the lowest 4 bits of byte 9 in the header */
-    msb := header[9] & 0b1111
-
-    if isDiskDude(header){
-        msb = 0
+    var msb byte
+    /* nes 2.0 uses the lowest 4 bits of byte 9 in the header. ines roms sometimes have garbage there */
+    if isNes2(header) {
+        msb = header[9] & 0b1111
     }
 
     if msb == 15 {
@@ -70,10 +84,9 @@ func readPRG(header []byte) uint64 {
 
 func readCHR(header []byte) uint64 {
     lsb := header[5]
-    msb := (header[9] >> 4) & 15
-
-    if isDiskDude(header){
-        msb = 0
+    var msb byte
+    if isNes2(header) {
+        msb = (header[9] >> 4) & 15
     }
 
     if msb == 15 {
@@ -93,7 +106,27 @@ func isDiskDude(header []byte) bool {
     return bytes.Equal(header[7:16], []byte("DiskDude!"))
 }
 
-func readMapper(header []byte) byte {
+/* nes 2.0 has the region in byte 12, ines only has a rarely used pal bit in byte 9 */
+func readRegion(header []byte) (Region, bool) {
+    if isNes2(header) {
+        switch header[12] & 0x3 {
+            case 0: return RegionNTSC, true
+            case 1: return RegionPAL, true
+            /* works on both, so prefer ntsc */
+            case 2: return RegionNTSC, true
+            case 3: return RegionDendy, true
+        }
+    }
+
+    if !isDiskDude(header) && header[9] & 0x1 == 0x1 {
+        return RegionPAL, true
+    }
+
+    return RegionNTSC, false
+}
+
+/* nes 2.0 has 12 bit mapper numbers, with bits 8-11 in byte 8 */
+func readMapper(header []byte) uint32 {
     lowBits := header[6] >> 4
     var highBits byte
 
@@ -101,16 +134,206 @@ func readMapper(header []byte) byte {
     if !isDiskDude(header){
         highBits = header[7] >> 4
     }
-    return (highBits << 4) | lowBits
+
+    mapper := uint32(highBits << 4 | lowBits)
+
+    if isNes2(header) {
+        mapper |= uint32(header[8] & 0xf) << 8
+    }
+
+    return mapper
+}
+
+func readSubmapper(header []byte) byte {
+    if isNes2(header) {
+        return header[8] >> 4
+    }
+    return 0
+}
+
+/* ram sizes in nes 2.0 are stored as a shift count, where the size is 64 << shift, and 0 means no ram */
+func ramShiftSize(shift byte) int {
+    if shift == 0 {
+        return 0
+    }
+    return 64 << shift
+}
+
+type ConsoleType int
+const (
+    ConsoleNES ConsoleType = iota
+    ConsoleVsSystem
+    ConsolePlaychoice
+    /* the actual type is in NESFile.ExtendedConsole */
+    ConsoleExtended
+)
+
+func (console ConsoleType) String() string {
+    switch console {
+        case ConsoleNES: return "NES"
+        case ConsoleVsSystem: return "VS. System"
+        case ConsolePlaychoice: return "PlayChoice-10"
+        case ConsoleExtended: return "Extended"
+    }
+
+    return "unknown"
+}
+
+func readConsoleType(header []byte) ConsoleType {
+    if isDiskDude(header) {
+        return ConsoleNES
+    }
+
+    if isNes2(header) {
+        return ConsoleType(header[7] & 0x3)
+    }
+
+    /* ines uses bit 0 for vs unisystem and bit 1 for playchoice */
+    if header[7] & 0x1 == 0x1 {
+        return ConsoleVsSystem
+    }
+    if header[7] & 0x2 == 0x2 {
+        return ConsolePlaychoice
+    }
+
+    return ConsoleNES
+}
+
+/* information about the board that a mapper needs to set itself up, such as how much ram it has */
+type MapperInfo struct {
+    Mapper uint32
+    Submapper byte
+
+    /* sizes in bytes */
+    PRGRam int
+    /* battery backed prg ram */
+    PRGNVRam int
+    CHRRam int
+    CHRNVRam int
+
+    Battery bool
+    /* the board has its own nametable ram, so the mapper can't change the mirroring */
+    FourScreen bool
+
+    /* true if the sizes came from a nes 2.0 header. ines headers don't have them, so they are just the usual defaults */
+    Nes2 bool
+}
+
+func (info MapperInfo) TotalPRGRam() int {
+    return info.PRGRam + info.PRGNVRam
 }
 
 type NESFile struct {
     ProgramRom []byte
     CharacterRom []byte
     Mapper uint32
+    /* nes 2.0 variant of the mapper, 0 for ines files */
+    Submapper byte
     HorizontalMirror bool
     VerticalMirror bool
+    /* the cartridge provides 4k of nametable ram */
+    FourScreen bool
+    /* prg ram at 0x6000-0x7fff is battery backed and should be saved to disk */
+    Battery bool
+
+    /* ram sizes in bytes. for ines files these are guessed */
+    PRGRamSize int
+    PRGNVRamSize int
+    CHRRamSize int
+    CHRNVRamSize int
+
+    /* the tv system from the header, or guessed from the name if the header doesn't say */
+    Region Region
+    /* false if neither the header nor the name said what the region is */
+    HasRegion bool
+
+    Console ConsoleType
+    /* for the vs system, which ppu and protection hardware the game expects */
+    VsPPUType byte
+    VsHardwareType byte
+    /* for ConsoleExtended */
+    ExtendedConsole byte
+
+    /* the controller or other device plugged in by default, see
+     * http://wiki.nesdev.org/w/index.php/NES_2.0#Default_Expansion_Device
+     */
+    ExpansionDevice byte
+
+    /* true if the file has a nes 2.0 header */
+    Nes2 bool
+    /* for famicom disk system images (mapper 20), each side of the disk in .fds format.
+     * the program comes from the disk, so ProgramRom and CharacterRom are empty
+     */
+    DiskSides [][]byte
+    /* the board name from a unif file, which is where Mapper came from */
+    Board string
     Path string
+    /* the name of the game if it was found in a RomDatabase */
+    Title string
+}
+
+func (file *NESFile) IsDisk() bool {
+    return len(file.DiskSides) > 0
+}
+
+func (file *NESFile) MapperInfo() MapperInfo {
+    return MapperInfo{
+        Mapper: file.Mapper,
+        Submapper: file.Submapper,
+        PRGRam: file.PRGRamSize,
+        PRGNVRam: file.PRGNVRamSize,
+        CHRRam: file.CHRRamSize,
+        CHRNVRam: file.CHRNVRamSize,
+        Battery: file.Battery,
+        FourScreen: file.FourScreen,
+        Nes2: file.Nes2,
+    }
+}
+
+/* fill in everything that comes from the 16 byte header */
+func parseHeader(header []byte) NESFile {
+    file := NESFile{
+        Mapper: readMapper(header),
+        Submapper: readSubmapper(header),
+        HorizontalMirror: (header[6] & 0x1) == 0x0,
+        VerticalMirror: (header[6] & 0x1) == 0x1,
+        FourScreen: (header[6] & 0x8) == 0x8,
+        Battery: (header[6] & 0x2) == 0x2,
+        Console: readConsoleType(header),
+        Nes2: isNes2(header),
+    }
+
+    file.Region, file.HasRegion = readRegion(header)
+
+    if file.Nes2 {
+        file.PRGRamSize = ramShiftSize(header[10] & 0xf)
+        file.PRGNVRamSize = ramShiftSize(header[10] >> 4)
+        file.CHRRamSize = ramShiftSize(header[11] & 0xf)
+        file.CHRNVRamSize = ramShiftSize(header[11] >> 4)
+
+        switch file.Console {
+            case ConsoleVsSystem:
+                file.VsPPUType = header[13] & 0xf
+                file.VsHardwareType = header[13] >> 4
+            case ConsoleExtended:
+                file.ExtendedConsole = header[13] & 0xf
+        }
+
+        file.ExpansionDevice = header[15] & 0x3f
+    } else {
+        /* ines doesn't say how much ram there is, so assume the usual 8k */
+        if file.Battery {
+            file.PRGNVRamSize = 0x2000
+        } else {
+            file.PRGRamSize = 0x2000
+        }
+
+        if readCHR(header) == 0 {
+            file.CHRRamSize = 0x2000
+        }
+    }
+
+    return file
 }
 
 // reader - where the data for the nes file comes from
@@ -123,38 +346,49 @@ func ParseNes(reader io.Reader, debug bool, name string) (NESFile, error) {
         return NESFile{}, err
     }
 
+    if isFDS(header) {
+        return parseFDS(header, reader, name)
+    }
+
+    if isUnif(header) {
+        return parseUnif(header, reader, name)
+    }
+
     ines := isINes(header[0:4])
     if !ines {
         return NESFile{}, fmt.Errorf("not an nes file")
     }
 
-    nes2 := isNes2(header)
+    file := parseHeader(header)
+    file.Path = name
 
     if debug {
-        log.Printf("Nes 2.0 %v\n", nes2)
+        log.Printf("Nes 2.0 %v\n", file.Nes2)
     }
 
     prgRomSize := readPRG(header)
     chrRomSize := readCHR(header)
 
-    mapper := readMapper(header)
-
     if debug {
         log.Printf("PRG-ROM %vkb\n", prgRomSize >> 10)
         log.Printf("CHR-ROM %vkb\n", chrRomSize >> 10)
-        log.Printf("mapper %v\n", mapper)
+        log.Printf("mapper %v submapper %v\n", file.Mapper, file.Submapper)
     }
 
-    horizontalMirror := (header[6] & 0x1) == 0x0
-    verticalMirror := (header[6] & 0x1) == 0x1
-
-    batteryRam := (header[6] & 0x2) == 0x2
-    _ = batteryRam
+    if !file.HasRegion {
+        file.Region, file.HasRegion = GuessRegionFromName(filepath.Base(name))
+    }
 
     if debug {
-        log.Printf("Has battery-backed SRAM: %v", batteryRam)
-        log.Printf("Horizontal mirror: %v", horizontalMirror)
-        log.Printf("Vertical mirror: %v", verticalMirror)
+        log.Printf("Has battery-backed SRAM: %v", file.Battery)
+        log.Printf("Horizontal mirror: %v", file.HorizontalMirror)
+        log.Printf("Vertical mirror: %v", file.VerticalMirror)
+        log.Printf("Four screen: %v", file.FourScreen)
+        log.Printf("PRG-RAM %v bytes, PRG-NVRAM %v bytes", file.PRGRamSize, file.PRGNVRamSize)
+        log.Printf("CHR-RAM %v bytes, CHR-NVRAM %v bytes", file.CHRRamSize, file.CHRNVRamSize)
+        log.Printf("Region: %v", file.Region)
+        log.Printf("Console: %v", file.Console)
+        log.Printf("Expansion device: %v", file.ExpansionDevice)
     }
 
     hasTrainer := (header[6] & 4) == 4
@@ -175,27 +409,20 @@ func ParseNes(reader io.Reader, debug bool, name string) (NESFile, error) {
         }
     }
 
-    programRom := make([]byte, prgRomSize)
+    file.ProgramRom = make([]byte, prgRomSize)
 
-    _, err = io.ReadFull(reader, programRom)
+    _, err = io.ReadFull(reader, file.ProgramRom)
     if err != nil {
         return NESFile{}, fmt.Errorf("Could not read program rom size 0x%xkB: %v", prgRomSize >> 10, err)
     }
 
-    characterRom := make([]byte, chrRomSize)
-    _, err = io.ReadFull(reader, characterRom)
+    file.CharacterRom = make([]byte, chrRomSize)
+    _, err = io.ReadFull(reader, file.CharacterRom)
     if err != nil {
         return NESFile{}, fmt.Errorf("Could not read character rom size 0x%xkB: %v", chrRomSize >> 10, err)
     }
 
-    return NESFile{
-        ProgramRom: programRom,
-        CharacterRom: characterRom,
-        Mapper: uint32(mapper),
-        HorizontalMirror: horizontalMirror,
-        VerticalMirror: verticalMirror,
-        Path: name,
-    }, nil
+    return file, nil
 }
 
 func ParseNesFile(path string, debug bool) (NESFile, error) {
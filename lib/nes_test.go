@@ -0,0 +1,101 @@
+package lib
+
+import (
+    "bytes"
+    "testing"
+)
+
+func TestParseNes2Header(test *testing.T){
+    header := []byte{
+        'N', 'E', 'S', 0x1a,
+        0x02, // 32k prg rom
+        0x00, // chr ram
+        0x4a, // mapper low nibble 4, four screen, battery
+        0x19, // mapper middle nibble 1, nes 2.0, vs system
+        0x21, // submapper 2, mapper high nibble 1
+        0x00,
+        0x70, // 8k prg nvram
+        0x07, // 8k chr ram
+        0x01, // pal
+        0x32, // vs hardware 3, vs ppu 2
+        0x00,
+        0x01, // standard controller
+    }
+
+    file := parseHeader(header)
+
+    if !file.Nes2 {
+        test.Fatalf("header should be nes 2.0")
+    }
+
+    if file.Mapper != 0x114 || file.Submapper != 2 {
+        test.Fatalf("expected mapper 276 submapper 2 but got mapper %v submapper %v", file.Mapper, file.Submapper)
+    }
+
+    if !file.FourScreen || !file.Battery {
+        test.Fatalf("expected four screen and battery: %v %v", file.FourScreen, file.Battery)
+    }
+
+    if file.PRGRamSize != 0 || file.PRGNVRamSize != 0x2000 || file.CHRRamSize != 0x2000 || file.CHRNVRamSize != 0 {
+        test.Fatalf("wrong ram sizes: prg %v prg nv %v chr %v chr nv %v", file.PRGRamSize, file.PRGNVRamSize, file.CHRRamSize, file.CHRNVRamSize)
+    }
+
+    if !file.HasRegion || file.Region != RegionPAL {
+        test.Fatalf("expected pal but got %v", file.Region)
+    }
+
+    if file.Console != ConsoleVsSystem || file.VsPPUType != 2 || file.VsHardwareType != 3 {
+        test.Fatalf("wrong console: %v ppu %v hardware %v", file.Console, file.VsPPUType, file.VsHardwareType)
+    }
+
+    if file.ExpansionDevice != 1 {
+        test.Fatalf("expected expansion device 1 but got %v", file.ExpansionDevice)
+    }
+}
+
+func TestParseInesHeader(test *testing.T){
+    header := []byte{'N', 'E', 'S', 0x1a, 0x01, 0x01, 0x11, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}
+    rom := append(bytes.Clone(header), make([]byte, 0x4000 + 0x2000)...)
+
+    file, err := ParseNes(bytes.NewReader(rom), false, "Game (E).nes")
+    if err != nil {
+        test.Fatalf("could not parse rom: %v", err)
+    }
+
+    if file.Nes2 || file.Mapper != 1 || file.Submapper != 0 {
+        test.Fatalf("expected an ines mapper 1 rom, got nes2 %v mapper %v submapper %v", file.Nes2, file.Mapper, file.Submapper)
+    }
+
+    if !file.VerticalMirror || file.FourScreen {
+        test.Fatalf("expected vertical mirroring")
+    }
+
+    /* no battery, so the ram is assumed to be volatile */
+    if file.PRGRamSize != 0x2000 || file.PRGNVRamSize != 0 || file.CHRRamSize != 0 {
+        test.Fatalf("wrong ram sizes: prg %v prg nv %v chr %v", file.PRGRamSize, file.PRGNVRamSize, file.CHRRamSize)
+    }
+
+    if file.Region != RegionPAL {
+        test.Fatalf("expected the region to come from the name but got %v", file.Region)
+    }
+
+    if len(file.ProgramRom) != 0x4000 || len(file.CharacterRom) != 0x2000 {
+        test.Fatalf("wrong rom sizes %v %v", len(file.ProgramRom), len(file.CharacterRom))
+    }
+}
+
+func TestFourScreenNametables(test *testing.T){
+    ppu := MakePPU()
+    ppu.SetFourScreenMirror()
+
+    for i := range uint16(4) {
+        ppu.StoreNametableMemory(0x2000 + i * 0x400, byte(i + 1))
+    }
+
+    for i := range uint16(4) {
+        value := ppu.LoadNametableMemory(0x2000 + i * 0x400)
+        if value != byte(i + 1) {
+            test.Fatalf("nametable %v has value %v instead of %v", i, value, i + 1)
+        }
+    }
+}
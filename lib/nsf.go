@@ -160,6 +160,9 @@ type NSFMapper struct {
     LoadAddress uint16
 
     VRC6 *VRC6Audio
+    VRC7 *VRC7Audio
+    N163 *N163Audio
+    S5B *Sunsoft5BAudio
 }
 
 func (mapper *NSFMapper) IsNSF() bool {
@@ -188,6 +191,19 @@ func (mapper *NSFMapper) Write(cpu *CPUState, address uint16, value byte) error
         return nil
     }
 
+    if mapper.VRC7 != nil && mapper.VRC7.HandleWrite(address, value) {
+        return nil
+    }
+
+    if mapper.N163 != nil && address >= N163AddressPort {
+        mapper.N163.SetAddress(value)
+        return nil
+    }
+
+    if mapper.S5B != nil && mapper.S5B.HandleWrite(address, value) {
+        return nil
+    }
+
     return fmt.Errorf("nsf mapper write unimplemented for 0x%x=0x%x", address, value)
 }
 
@@ -240,11 +256,90 @@ func (mapper *NSFMapper) Kind() int {
     return -1
 }
 
-func MakeNSFMapper(data []byte, loadAddress uint16, banks []byte, extraSoundChip byte, audioStream *AudioStream) *NSFMapper {
+/* clock the expansion audio chips */
+func (mapper *NSFMapper) RunAudio(cycles float64, cyclesPerSample float64) {
+    if mapper.VRC6 != nil {
+        mapper.VRC6.Run(cycles)
+    }
+
+    if mapper.VRC7 != nil {
+        mapper.VRC7.Run(cycles)
+    }
+
+    if mapper.N163 != nil {
+        mapper.N163.Run(cycles)
+    }
+
+    if mapper.S5B != nil {
+        mapper.S5B.Run(cycles)
+    }
+}
+
+/* the expansion chips are mixed into the apu's samples */
+func (mapper *NSFMapper) AudioOutput() float32 {
+    var out float32
+    if mapper.VRC6 != nil {
+        out += mapper.VRC6.GenerateSample()
+    }
+
+    if mapper.VRC7 != nil {
+        out += mapper.VRC7.GenerateSample()
+    }
+
+    if mapper.N163 != nil {
+        out += mapper.N163.GenerateSample()
+    }
+
+    if mapper.S5B != nil {
+        out += mapper.S5B.GenerateSample()
+    }
+
+    return out
+}
+
+/* the n163 data port is at $4800. the bank switching registers at $5ff8 are below $6000 too */
+func (mapper *NSFMapper) ReadExpansion(address uint16) byte {
+    if mapper.N163 != nil && address >= N163DataPort && address < N163DataPort + 0x800 {
+        return mapper.N163.ReadData()
+    }
+
+    return 0
+}
+
+func (mapper *NSFMapper) WriteExpansion(cpu *CPUState, address uint16, value byte) {
+    if mapper.N163 != nil && address >= N163DataPort && address < N163DataPort + 0x800 {
+        mapper.N163.WriteData(value)
+        return
+    }
+
+    if address >= 0x5ff6 {
+        err := mapper.Write(cpu, address, value)
+        if err != nil {
+            log.Printf("Warning: writing to mapper memory: %v", err)
+        }
+    }
+}
+
+func MakeNSFMapper(data []byte, loadAddress uint16, banks []byte, extraSoundChip byte) *NSFMapper {
     var vrc6 *VRC6Audio
+    var vrc7 *VRC7Audio
+    var n163 *N163Audio
+    var s5b *Sunsoft5BAudio
 
     if extraSoundChip & 0x1 != 0 {
-        vrc6 = MakeVRC6Audio(audioStream)
+        vrc6 = MakeVRC6Audio()
+    }
+
+    if extraSoundChip & 0x2 != 0 {
+        vrc7 = MakeVRC7Audio()
+    }
+
+    if extraSoundChip & 0x10 != 0 {
+        n163 = MakeN163Audio()
+    }
+
+    if extraSoundChip & 0x20 != 0 {
+        s5b = MakeSunsoft5BAudio()
     }
 
     return &NSFMapper{
@@ -252,6 +347,9 @@ func MakeNSFMapper(data []byte, loadAddress uint16, banks []byte, extraSoundChip
         LoadAddress: loadAddress,
         Banks: banks,
         VRC6: vrc6,
+        VRC7: vrc7,
+        N163: n163,
+        S5B: s5b,
     }
 }
 
@@ -297,7 +395,7 @@ func mixAudio(audio1 []float32, audio2 []float32) []float32 {
 func PlayNSF(nsf NSFFile, track byte, audioStream *AudioStream, sampleRate float32, actions chan NSFActions, mainQuit context.Context, maxCycles uint64) error {
     cpu := StartupState()
     cpu.APU.AddAudioStream(audioStream)
-    nsfMapper := MakeNSFMapper(nsf.Data, nsf.LoadAddress, make([]byte, 8), nsf.ExtraSoundChip, audioStream)
+    nsfMapper := MakeNSFMapper(nsf.Data, nsf.LoadAddress, make([]byte, 8), nsf.ExtraSoundChip)
     cpu.SetMapper(nsfMapper)
     cpu.Input = MakeInput(&NoInput{})
 
@@ -325,7 +423,8 @@ func PlayNSF(nsf NSFFile, track byte, audioStream *AudioStream, sampleRate float
     cpu.PC = 0
     cpu.Debug = 0
 
-    instructionTable := MakeInstructionDescriptiontable()
+    machine := MakeMachine(&cpu, sampleRate)
+    machine.AudioOnly = true
 
     var cycleCounter float64
 
@@ -337,9 +436,6 @@ func PlayNSF(nsf NSFFile, track byte, audioStream *AudioStream, sampleRate float
     hostTickSpeed := 5
     cycleDiff := CPUSpeed / (1000.0 / float64(hostTickSpeed))
 
-    /* about 20.292 */
-    baseCyclesPerSample := CPUSpeed / 2 / float64(sampleRate)
-
     // nes.ApuDebug = 1
 
     turboMultiplier := 1.0
@@ -352,32 +448,10 @@ func PlayNSF(nsf NSFFile, track byte, audioStream *AudioStream, sampleRate float
     playTimer := time.NewTicker(time.Duration(1.0/playRate * 1000 * 1000) * time.Microsecond)
     defer playTimer.Stop()
 
-    lastCpuCycle := cpu.Cycle
-
     quit, cancel := context.WithCancel(mainQuit)
     paused := false
     _ = cancel
 
-    doAudio := func (cpuCycles float64) {
-        cpu.APU.Run(cpuCycles / 2.0, turboMultiplier * baseCyclesPerSample, &cpu)
-        // audioData = nil
-        if nsfMapper.VRC6 != nil {
-            nsfMapper.VRC6.Run(cpuCycles, baseCyclesPerSample * 2)
-            // FIXME
-            // audioData = mixAudio(audioData, vrc6Audio)
-        }
-
-        /*
-        if audioData != nil {
-            // log.Printf("Audio data: %v", audioData)
-            select {
-                case audioOut <- audioData:
-                default:
-            }
-        }
-        */
-    }
-
     runFunction := func (address uint16) error {
         // rts from function will jump back to 0xffff, so quit then
         cpu.PushStack(0xff)
@@ -410,17 +484,12 @@ func PlayNSF(nsf NSFFile, track byte, audioStream *AudioStream, sampleRate float
                 }
             }
 
-            err := cpu.Run(instructionTable)
+            usedCycles, err := machine.StepInstruction()
             if err != nil {
                 return err
             }
-            usedCycles := cpu.Cycle
-
-            cycleCounter -= float64(usedCycles - lastCpuCycle)
 
-            doAudio(float64(usedCycles - lastCpuCycle))
-
-            lastCpuCycle = usedCycles
+            cycleCounter -= float64(usedCycles)
         }
 
         return nil
@@ -451,14 +520,9 @@ func PlayNSF(nsf NSFFile, track byte, audioStream *AudioStream, sampleRate float
             }
 
             // don't do anything for 2 cycles
-            cpu.Cycle += 2
-            usedCycles := cpu.Cycle
-
-            cycleCounter -= float64(usedCycles - lastCpuCycle)
-
-            doAudio(float64(usedCycles - lastCpuCycle))
+            machine.Idle(2)
 
-            lastCpuCycle = usedCycles
+            cycleCounter -= 2
         }
 
         return nil
@@ -20,6 +20,8 @@ const (
     NametableMirrorHorizontal
     NametableMirrorScreenA
     NametableMirrorScreenB
+    /* the cartridge has 2kb of extra ram so each nametable is separate */
+    NametableMirrorFourScreen
 )
 
 func (mirror NametableMirrorConfiguration) String() string {
@@ -28,18 +30,67 @@ func (mirror NametableMirrorConfiguration) String() string {
         case NametableMirrorHorizontal: return "horizontal"
         case NametableMirrorScreenA: return "screen A"
         case NametableMirrorScreenB: return "screen B"
+        case NametableMirrorFourScreen: return "four screen"
     }
 
     return "unknown"
 }
 
+/* the two bitplanes of one row of a background tile, and which of the 4 background palettes it uses */
+type BackgroundTile struct {
+    Low byte
+    High byte
+    Palette byte
+}
+
+/* Mappers that take part in rendering implement this, such as the mmc5 which has separate chr
+ * banks for sprites and the background, per tile attributes and a split screen. When the mapper
+ * implements this the ppu asks it for background tiles and sprite patterns instead of fetching
+ * them itself. PPUDATA accesses still go through PPUMapper.
+ */
+type PPUFetchMapper interface {
+    /* fetch the background tile at the current video address. column is the tile's position
+     * on the scanline, where columns 0 and 1 are fetched at the end of the previous scanline
+     */
+    FetchBackgroundTile(ppu *PPUState, scanline int, column int) BackgroundTile
+    /* read a byte of sprite pattern data at 0x0000-0x1fff */
+    LoadSpritePattern(ppu *PPUState, address uint16) byte
+    /* called every time the ppu moves to a new scanline, including ones that are not rendered */
+    StartScanline(ppu *PPUState, scanline int)
+}
+
+/* Mappers that watch the ppu address bus implement this, such as the mmc3 which clocks its
+ * scanline counter when a12 rises. While rendering, the ppu reports the address of every pattern
+ * table fetch at the dot the real ppu would make it, including the fetches for empty sprite slots.
+ */
+type PPUAddressMapper interface {
+    PPUAddress(ppu *PPUState, address uint16)
+}
+
+/* Mappers that decide what the ppu sees at $0000-$3eff implement this. Pattern table and
+ * nametable accesses go to the mapper instead of VideoMemory and the ppu's nametable mirroring,
+ * so chr banks can be switched without copying, chr ram can live on the cartridge, and the
+ * nametables can be mapped arbitrarily. Nametable addresses at $3000-$3eff are passed as their
+ * $2000-$2eff mirror. A mapper can still use the ppu's own memory through VideoMemory and
+ * LoadNametableMemory/StoreNametableMemory.
+ */
+type PPUMapper interface {
+    ReadPPU(ppu *PPUState, address uint16) byte
+    WritePPU(ppu *PPUState, address uint16, value byte)
+}
+
 type PPUState struct {
     Flags byte `json:"flags"`
     Mask byte `json:"mask"`
     /* http://wiki.nesdev.org/w/index.php/PPU_registers#PPUSTATUS */
     Status byte `json:"status"`
 
-    /* counts in the y direction during rendering, from 0-262 */
+    /* decides how many scanlines there are and when vblank starts */
+    Region Region `json:"region"`
+    /* the vs. system and playchoice ppus have their own palettes */
+    Model PPUModel `json:"model"`
+
+    /* counts in the y direction during rendering, from 0-261 on ntsc and 0-311 on pal */
     Scanline int `json:"scanline"`
     /* counts in the x direction during rendering, from 0-340 */
     ScanlineCycle int `json:"scanlinecycle"`
@@ -75,7 +126,19 @@ type PPUState struct {
     OAM []byte `json:"oam"`
     OAMAddress int `json:"oamaddress"`
 
+    /* the sprites found by sprite evaluation on dots 65-256, which are drawn on the next scanline */
+    SecondaryOAM [32]byte `json:"secondaryoam"`
+    SpriteEvaluation SpriteEvaluation `json:"spriteevaluation"`
+
+    /* the palette with the emphasis bits applied, 64 colors for each of the 8 combinations
+     * of bits. it is made the first time emphasis is used
+     */
+    emphasisPalette [][]uint8
+    emphasisRegion Region
+
     oamSprites []Sprite
+    /* pattern addresses of the sprites fetched on dots 257-320, for PPUAddressMapper */
+    spriteFetches []uint16
 
     /* makes the ppu print stuff via log.Printf if set to a value > 0 */
     Debug uint8 `json:"-"`
@@ -106,6 +169,8 @@ func (ppu *PPUState) Copy() PPUState {
         Flags: ppu.Flags,
         Mask: ppu.Mask,
         Status: ppu.Status,
+        Region: ppu.Region,
+        Model: ppu.Model,
         Scanline: ppu.Scanline,
         ScanlineCycle: ppu.ScanlineCycle,
         TemporaryVideoAddress: ppu.TemporaryVideoAddress,
@@ -119,6 +184,8 @@ func (ppu *PPUState) Copy() PPUState {
         NametableMemory: copySlice(ppu.NametableMemory),
         OAM: copySlice(ppu.OAM),
         OAMAddress: ppu.OAMAddress,
+        SecondaryOAM: ppu.SecondaryOAM,
+        SpriteEvaluation: ppu.SpriteEvaluation,
         Debug: ppu.Debug,
         InternalVideoBuffer: ppu.InternalVideoBuffer,
         Shifts: ppu.Shifts,
@@ -128,6 +195,25 @@ func (ppu *PPUState) Copy() PPUState {
     }
 }
 
+/* how far sprite evaluation has gotten on the current scanline. the oam address holds the n
+ * (the high 6 bits) and m (the low 2 bits) counters of
+ *   https://www.nesdev.org/wiki/PPU_sprite_evaluation
+ */
+type SpriteEvaluation struct {
+    /* the byte read from oam on the last odd dot */
+    Latch byte `json:"latch"`
+    /* where the next byte goes in secondary oam. 32 means 8 sprites were found */
+    SecondaryAddress int `json:"secondaryaddress"`
+    /* the sprite being looked at is on the next scanline, so its bytes are being copied */
+    InRange bool `json:"inrange"`
+    /* all 64 sprites have been looked at */
+    Done bool `json:"done"`
+    /* the first sprite looked at was in range, so the sprite in slot 0 can cause a sprite 0 hit */
+    Sprite0 bool `json:"sprite0"`
+    /* how many bytes of the sprite that set the overflow flag have been read */
+    OverflowReads int `json:"overflowreads"`
+}
+
 func MakePPU() PPUState {
     return PPUState{
         VideoMemory: make([]byte, 64 * 1024), // FIXME: video memory is not this large..
@@ -139,6 +225,25 @@ func MakePPU() PPUState {
     }
 }
 
+func (ppu *PPUState) SetModel(model PPUModel){
+    ppu.Model = model
+    ppu.Palette = model.Palette()
+    ppu.emphasisPalette = nil
+}
+
+/* the register that a write to 0x2000-0x2007 goes to, where the 2c05 has PPUCTRL and PPUMASK swapped */
+func (ppu *PPUState) registerAddress(address uint16) uint16 {
+    register := 0x2000 | (address & 0x7)
+    if ppu.Model.SwapsControlRegisters() {
+        switch register {
+            case PPUCTRL: return PPUMASK
+            case PPUMASK: return PPUCTRL
+        }
+    }
+
+    return register
+}
+
 func (ppu *PPUState) ToggleDebug() {
     ppu.Debug = 1 - ppu.Debug
 }
@@ -173,19 +278,57 @@ func (ppu *PPUState) SetScreenBMirror(){
     ppu.NametableMirror = NametableMirrorScreenB
 }
 
+func (ppu *PPUState) SetFourScreenMirror(){
+    if ppu.Debug > 0 {
+        log.Printf("Set four screen mirror")
+    }
+
+    if len(ppu.NametableMemory) < 4 * 1024 {
+        ppu.NametableMemory = append(ppu.NametableMemory, make([]byte, 4 * 1024 - len(ppu.NametableMemory))...)
+    }
+
+    ppu.NametableMirror = NametableMirrorFourScreen
+}
+
 func (ppu *PPUState) SetOAMAddress(value byte){
     ppu.OAMAddress = int(value)
 }
 
+/* true on the scanlines where the ppu is fetching tiles and evaluating sprites */
+func (ppu *PPUState) isRendering() bool {
+    if !ppu.IsBackgroundEnabled() && !ppu.IsSpriteEnabled() {
+        return false
+    }
+    return ppu.Scanline < 240 || ppu.Scanline == ppu.Region.Timing().Scanlines - 1
+}
+
 func (ppu *PPUState) WriteOAM(value byte){
-    if ppu.OAMAddress < len(ppu.OAM) {
-        ppu.OAM[ppu.OAMAddress] = value
-        ppu.OAMAddress += 1
+    /* while rendering the write is ignored, but the oam address still moves to the next sprite */
+    if ppu.isRendering() {
+        ppu.OAMAddress = (ppu.OAMAddress + 4) & 0xff
+        return
     }
+
+    ppu.OAM[ppu.OAMAddress & 0xff] = value
+    ppu.OAMAddress = (ppu.OAMAddress + 1) & 0xff
 }
 
-func (ppu *PPUState) ReadOAM(address byte) byte {
-    return ppu.OAM[address]
+/* while rendering, OAMDATA shows whatever byte sprite evaluation or the sprite fetches are using */
+func (ppu *PPUState) ReadOAM() byte {
+    if ppu.isRendering() {
+        cycle := ppu.ScanlineCycle
+        switch {
+            case cycle >= 1 && cycle <= 64:
+                return 0xff
+            case cycle >= 65 && cycle <= 256:
+                return ppu.SpriteEvaluation.Latch
+            case cycle >= 257 && cycle <= 320:
+                slot := (cycle - 257) / 8
+                return ppu.SecondaryOAM[slot * 4 + min((cycle - 257) % 8, 3)]
+        }
+    }
+
+    return ppu.OAM[ppu.OAMAddress & 0xff]
 }
 
 func (ppu *PPUState) CopyOAM(data []byte){
@@ -357,17 +500,24 @@ func (ppu *PPUState) CopyCharacterRom(base uint32, data []byte) {
 }
 
 func (ppu *PPUState) IsBackgroundEnabled() bool {
-    /* FIXME: also include background_leftmost_8? */
     background := (ppu.Mask >> 3) & 0x1 == 0x1
     return background
 }
 
 func (ppu *PPUState) IsSpriteEnabled() bool {
-    /* FIXME: what about sprite_leftmost_8 */
     sprite := (ppu.Mask >> 4) & 0x1 == 0x1
     return sprite
 }
 
+/* whether the background and sprites are drawn in the leftmost 8 pixels of the screen */
+func (ppu *PPUState) showBackgroundLeft() bool {
+    return (ppu.Mask >> 1) & 0x1 == 0x1
+}
+
+func (ppu *PPUState) showSpritesLeft() bool {
+    return (ppu.Mask >> 2) & 0x1 == 0x1
+}
+
 func (ppu *PPUState) MaskString() string {
     greyscale := ppu.Mask & 0x1 == 0x1
     background_leftmost_8 := (ppu.Mask >> 1) & 0x1 == 0x1
@@ -422,7 +572,42 @@ func (ppu *PPUState) GetVRamIncrement() uint16 {
     return 1
 }
 
-func (ppu *PPUState) WriteVideoMemory(value byte){
+/* read $0000-$3eff, from the mapper if it implements PPUMapper */
+func (ppu *PPUState) readMemory(memory PPUMapper, address uint16) byte {
+    if address >= 0x3000 {
+        address -= 0x1000
+    }
+
+    if memory != nil {
+        return memory.ReadPPU(ppu, address)
+    }
+
+    if address >= 0x2000 {
+        return ppu.LoadNametableMemory(address)
+    }
+
+    return ppu.VideoMemory[address]
+}
+
+func (ppu *PPUState) writeMemory(memory PPUMapper, address uint16, value byte){
+    if address >= 0x3000 {
+        address -= 0x1000
+    }
+
+    if memory != nil {
+        memory.WritePPU(ppu, address, value)
+        return
+    }
+
+    if address >= 0x2000 {
+        ppu.StoreNametableMemory(address, value)
+        return
+    }
+
+    ppu.VideoMemory[address] = value
+}
+
+func (ppu *PPUState) WriteVideoMemory(value byte, mapper Mapper){
     actualAddress := ppu.VideoAddress
 
     /* Mirror writes to the universal background color */
@@ -444,15 +629,16 @@ func (ppu *PPUState) WriteVideoMemory(value byte){
         log.Printf("PPU: Writing 0x%x to video memory at 0x%x actual 0x%x at scanline %v and cycle %v\n", value, ppu.VideoAddress, actualAddress, ppu.Scanline, ppu.ScanlineCycle)
     }
 
-    if actualAddress >= 0x2000 && actualAddress < 0x3000 {
-        ppu.StoreNametableMemory(actualAddress, value)
+    memory, _ := mapper.(PPUMapper)
+    if actualAddress < 0x3f00 {
+        ppu.writeMemory(memory, actualAddress, value)
     } else {
         ppu.VideoMemory[actualAddress] = value
     }
     ppu.VideoAddress += ppu.GetVRamIncrement()
 }
 
-func (ppu *PPUState) ReadVideoMemory() byte {
+func (ppu *PPUState) ReadVideoMemory(mapper Mapper) byte {
     if int(ppu.VideoAddress) >= len(ppu.VideoMemory) {
         log.Printf("Warning: attemping to read more than available video memory 0x%x at 0x%x", len(ppu.VideoMemory), ppu.VideoAddress)
         return 0
@@ -460,8 +646,9 @@ func (ppu *PPUState) ReadVideoMemory() byte {
 
     var value byte
 
-    if ppu.VideoAddress >= 0x2000 && ppu.VideoAddress < 0x3000 {
-        value = ppu.LoadNametableMemory(ppu.VideoAddress)
+    memory, _ := mapper.(PPUMapper)
+    if ppu.VideoAddress < 0x3f00 {
+        value = ppu.readMemory(memory, ppu.VideoAddress)
     } else {
         value = ppu.VideoMemory[ppu.VideoAddress]
     }
@@ -499,6 +686,20 @@ func (ppu *PPUState) SetSpriteZeroHit(on bool){
     }
 }
 
+func (ppu *PPUState) GetSpriteOverflow() bool {
+    bit := byte(1<<5)
+    return ppu.Status & bit == bit
+}
+
+func (ppu *PPUState) SetSpriteOverflow(on bool){
+    bit := byte(1<<5)
+    if on {
+        ppu.Status = ppu.Status | bit
+    } else {
+        ppu.Status = ppu.Status & (^bit)
+    }
+}
+
 func (ppu *PPUState) SetVerticalBlankFlag(on bool){
     bit := byte(1<<7)
     if on {
@@ -517,6 +718,10 @@ func (ppu *PPUState) ReadStatus() byte {
         log.Printf("Read PPU status")
     }
     out := ppu.Status
+    if id := ppu.Model.statusID(); id != 0 {
+        /* the id covers the low 6 bits, so the 2c05-02 replaces the sprite overflow flag too */
+        out = out & 0xc0 | id
+    }
     ppu.SetVerticalBlankFlag(false)
     ppu.WriteState = 0
     return out
@@ -533,42 +738,27 @@ type Sprite struct {
     Sprite0 bool `json:"sprite0"`
 }
 
+/* a sprite from its 4 bytes of oam */
+func makeSprite(y byte, tile byte, data byte, x byte) Sprite {
+    return Sprite{
+        Tile: tile,
+        X: x,
+        Y: y + 1, // sprites are offset by 1 pixel
+        Flip_horizontal: (data >> 6) & 0x1 == 0x1,
+        Flip_vertical: (data >> 7) & 0x1 == 0x1,
+        Palette: data & 0x3,
+        Priority: (data >> 5) & 0x1,
+    }
+}
+
 func (ppu *PPUState) GetSprites() []Sprite {
-    // var out []Sprite
     if len(ppu.oamSprites) < len(ppu.OAM) {
         ppu.oamSprites = make([]Sprite, len(ppu.OAM))
     }
-    position := 0
     spriteCount := 0
-    for position < len(ppu.OAM) {
-        y := ppu.OAM[position]
-        position += 1
-        tile := ppu.OAM[position]
-        position += 1
-
-        data := ppu.OAM[position]
-        position += 1
-
-        x := ppu.OAM[position]
-        position += 1
-
-        palette := data & 0x3
-        priority := (data >> 5) & 0x1
-        flip_horizontal := (data >> 6) & 0x1 == 0x1
-        flip_vertical := (data >> 7) & 0x1 == 0x1
-
-        // out = append(out, Sprite{
-        ppu.oamSprites[spriteCount] = Sprite{
-            Tile: tile,
-            X: x,
-            Y: y + 1, // sprites are offset by 1 pixel
-            Flip_horizontal: flip_horizontal,
-            Flip_vertical: flip_vertical,
-            Palette: palette,
-            Priority: priority,
-            Sprite0: spriteCount == 0,
-        }
-
+    for position := 0; position + 3 < len(ppu.OAM); position += 4 {
+        ppu.oamSprites[spriteCount] = makeSprite(ppu.OAM[position], ppu.OAM[position+1], ppu.OAM[position+2], ppu.OAM[position+3])
+        ppu.oamSprites[spriteCount].Sprite0 = spriteCount == 0
         spriteCount += 1
     }
 
@@ -651,6 +841,76 @@ func get2c02Palette() [][]uint8 {
     }
 }
 
+/* The emphasis bits of PPUMASK darken the other two color channels of the 2c02 by about 18%,
+ * and the rgb ppus turn the emphasized channel all the way up instead. The pal and dendy ppus
+ * swap the red and green bits.
+ *   https://www.nesdev.org/wiki/NTSC_video#Color_Tint_Bits
+ */
+const emphasisAttenuation = 0.816328
+
+func makeEmphasisPalette(palette [][]uint8, model PPUModel, region Region) [][]uint8 {
+    out := make([][]uint8, 0, 8 * len(palette))
+    for emphasis := range 8 {
+        /* red, green, blue */
+        channels := [3]bool{emphasis & 1 == 1, emphasis & 2 == 2, emphasis & 4 == 4}
+        if region == RegionPAL || region == RegionDendy {
+            channels[0], channels[1] = channels[1], channels[0]
+        }
+
+        for index, color := range palette {
+            rgb := copySlice(color)
+            for channel := range min(len(rgb), 3) {
+                if model != PPU2C02 {
+                    if channels[channel] {
+                        rgb[channel] = 255
+                    }
+                    continue
+                }
+
+                /* the blacks in columns $e and $f are not affected */
+                if index & 0xf >= 0xe {
+                    continue
+                }
+
+                value := float64(rgb[channel])
+                for other := range 3 {
+                    if other != channel && channels[other] {
+                        value *= emphasisAttenuation
+                    }
+                }
+                rgb[channel] = uint8(value)
+            }
+            out = append(out, rgb)
+        }
+    }
+
+    return out
+}
+
+/* the rgb value of a palette entry after applying the greyscale and emphasis bits of PPUMASK */
+func (ppu *PPUState) maskedColor(index byte) []uint8 {
+    if int(index) >= len(ppu.Palette) {
+        index = 0
+    }
+
+    /* greyscale only keeps the brightness of the color */
+    if ppu.Mask & 0x1 == 0x1 {
+        index = index & 0x30
+    }
+
+    emphasis := int(ppu.Mask >> 5)
+    if emphasis == 0 {
+        return ppu.Palette[index]
+    }
+
+    if len(ppu.emphasisPalette) != 8 * len(ppu.Palette) || ppu.emphasisRegion != ppu.Region {
+        ppu.emphasisPalette = makeEmphasisPalette(ppu.Palette, ppu.Model, ppu.Region)
+        ppu.emphasisRegion = ppu.Region
+    }
+
+    return ppu.emphasisPalette[emphasis * len(ppu.Palette) + int(index)]
+}
+
 type VirtualScreen struct {
     Width int
     Height int
@@ -806,10 +1066,18 @@ func (ppu *PPUState) getBackgroundPixel() []uint8 {
     }
     */
 
-    return ppu.Palette[paletteIndex]
+    return ppu.maskedColor(paletteIndex)
+}
+
+/* read sprite pattern data, either from the ppu's memory or from the mapper */
+func (ppu *PPUState) loadSpritePattern(fetcher PPUFetchMapper, memory PPUMapper, address uint16) byte {
+    if fetcher != nil {
+        return fetcher.LoadSpritePattern(ppu, address)
+    }
+    return ppu.readMemory(memory, address)
 }
 
-func (ppu *PPUState) getSpritePixel(x int, y int, sprites []Sprite) ([]uint8, byte, bool) {
+func (ppu *PPUState) getSpritePixel(x int, y int, sprites []Sprite, fetcher PPUFetchMapper, memory PPUMapper) ([]uint8, byte, bool) {
 
     if !ppu.IsSpriteEnabled() {
         return nil, 0, false
@@ -827,8 +1095,6 @@ func (ppu *PPUState) getSpritePixel(x int, y int, sprites []Sprite) ([]uint8, by
             tileIndex := sprite.Tile
             if x >= int(sprite.X) && x < int(sprite.X) + 8 && y >= int(sprite.Y) && y < int(sprite.Y) + 8 {
                 tileAddress := patternTable + uint16(tileIndex) * 16
-                leftBytes := ppu.VideoMemory[tileAddress:tileAddress+8]
-                rightBytes := ppu.VideoMemory[tileAddress+8:tileAddress+16]
                 palette_base := 0x3f10 + uint16(sprite.Palette) * 4
 
                 // for y := 0; y < 8; y++ {
@@ -844,8 +1110,8 @@ func (ppu *PPUState) getSpritePixel(x int, y int, sprites []Sprite) ([]uint8, by
                     use_x = 7 - use_x
                 }
 
-                low := (leftBytes[use_y] >> (7-use_x)) & 0x1
-                high := ((rightBytes[use_y] >> (7-use_x)) & 0x1) << 1
+                low := (ppu.loadSpritePattern(fetcher, memory, tileAddress + uint16(use_y)) >> (7-use_x)) & 0x1
+                high := ((ppu.loadSpritePattern(fetcher, memory, tileAddress + 8 + uint16(use_y)) >> (7-use_x)) & 0x1) << 1
 
                 /*
                 var low byte
@@ -873,7 +1139,7 @@ func (ppu *PPUState) getSpritePixel(x int, y int, sprites []Sprite) ([]uint8, by
                             return nil, 0, false
                         }
 
-                        return ppu.Palette[palette_color], sprite.Priority, sprite.Sprite0
+                        return ppu.maskedColor(palette_color), sprite.Priority, sprite.Sprite0
 
                         /*
                         var final_x int
@@ -915,8 +1181,6 @@ func (ppu *PPUState) getSpritePixel(x int, y int, sprites []Sprite) ([]uint8, by
                         tileAddress += 16
                     }
                 }
-                leftBytes := ppu.VideoMemory[tileAddress:tileAddress+8]
-                rightBytes := ppu.VideoMemory[tileAddress+8:tileAddress+16]
                 palette_base := 0x3f10 + uint16(sprite.Palette) * 4
 
                 use_y := y - int(y_base)
@@ -930,8 +1194,8 @@ func (ppu *PPUState) getSpritePixel(x int, y int, sprites []Sprite) ([]uint8, by
                     use_x = 7 - use_x
                 }
 
-                low := (leftBytes[use_y] >> (7-use_x)) & 0x1
-                high := ((rightBytes[use_y] >> (7-use_x)) & 0x1) << 1
+                low := (ppu.loadSpritePattern(fetcher, memory, tileAddress + uint16(use_y)) >> (7-use_x)) & 0x1
+                high := ((ppu.loadSpritePattern(fetcher, memory, tileAddress + 8 + uint16(use_y)) >> (7-use_x)) & 0x1) << 1
 
                 /*
                 var low byte
@@ -959,7 +1223,7 @@ func (ppu *PPUState) getSpritePixel(x int, y int, sprites []Sprite) ([]uint8, by
                             return nil, 0, false
                         }
 
-                        return ppu.Palette[palette_color], sprite.Priority, sprite.Sprite0
+                        return ppu.maskedColor(palette_color), sprite.Priority, sprite.Sprite0
 
             }
         }
@@ -987,9 +1251,19 @@ func (ppu *PPUState) getSpritePixel(x int, y int, sprites []Sprite) ([]uint8, by
 }
 
 /* Returns true for a sprite 0 hit */
-func (ppu *PPUState) RenderPixel(scanLine int, cycle int, sprites []Sprite, screen *VirtualScreen) bool {
+func (ppu *PPUState) RenderPixel(scanLine int, cycle int, sprites []Sprite, screen *VirtualScreen, fetcher PPUFetchMapper, memory PPUMapper) bool {
     background := ppu.getBackgroundPixel()
-    sprite, spritePriority, sprite0 := ppu.getSpritePixel(cycle, scanLine, sprites)
+    sprite, spritePriority, sprite0 := ppu.getSpritePixel(cycle, scanLine, sprites, fetcher, memory)
+
+    /* PPUMASK can hide either one in the leftmost 8 pixels */
+    if cycle < 8 {
+        if !ppu.showBackgroundLeft() {
+            background = nil
+        }
+        if !ppu.showSpritesLeft() {
+            sprite = nil
+        }
+    }
 
     if sprite != nil && background != nil {
         if spritePriority == 0 {
@@ -1004,12 +1278,7 @@ func (ppu *PPUState) RenderPixel(scanLine int, cycle int, sprites []Sprite, scre
     } else if background != nil {
         screen.DrawPoint(int32(cycle), int32(scanLine), background)
     } else {
-        background := ppu.VideoMemory[0x3f00]
-        if int(background) >= len(ppu.Palette){
-            screen.DrawPoint(int32(cycle), int32(scanLine), ppu.Palette[0])
-        } else {
-            screen.DrawPoint(int32(cycle), int32(scanLine), ppu.Palette[background])
-        }
+        screen.DrawPoint(int32(cycle), int32(scanLine), ppu.maskedColor(ppu.VideoMemory[0x3f00]))
     }
 
     return false
@@ -1196,6 +1465,8 @@ func (ppu *PPUState) nametableMirrorAddress(address uint16) uint16 {
             return getNametableAddress(relative, 0)
         case NametableMirrorScreenB:
             return getNametableAddress(relative, 1)
+        case NametableMirrorFourScreen:
+            return getNametableAddress(relative, uint16(mirror))
     }
 
     return 0x0
@@ -1209,15 +1480,35 @@ func (ppu *PPUState) StoreNametableMemory(address uint16, value byte) {
     ppu.NametableMemory[ppu.nametableMirrorAddress(address)] = value
 }
 
-func (ppu *PPUState) LoadBackgroundTile() {
+/* the address of the attribute byte for the tile at the given video address */
+func backgroundAttributeAddress(videoAddress uint16) uint16 {
+    /* attributeAddress = 0x23c0 + nametable + high 3-bits of coarseY + high 3-bits of coarseX */
+    return 0x23c0 | (videoAddress & 0xc00) | ((videoAddress >> 4) & 0x38) | ((videoAddress >> 2) & 0x7)
+}
+
+/* each attribute byte holds the palettes of a 4x4 group of tiles, 2 bits for each 2x2 quadrant */
+func attributePalette(attribute byte, coarseX byte, coarseY byte) byte {
+    pattern_x := (coarseX/2) & 0x1
+    pattern_y := (coarseY/2) & 0x1
+
+    /* x to x+4
+     * top left = x:x+1, y:y+1
+     * top right = x+2:x+3, y:y+1
+     * bottom left = x:x+1, y+2:y+3
+     * bottom right = x+2:x+3, y+2:y+3
+     */
+    shifter := pattern_x * 2 + pattern_y * 4
+    return (attribute >> shifter) & 0x3
+}
+
+func (ppu *PPUState) fetchBackgroundTile(memory PPUMapper) BackgroundTile {
     fineY, nametable, coarseY, coarseX := ppu.DeconstructVideoAddress()
 
     /* add the nametable, coarseY and coarseX to the tile address. mirroring is handled
      * in MirrorAddress()
      */
     tileAddress := 0x2000 | (ppu.VideoAddress & 0xfff)
-    /* attributeAddress = 0x23c0 + nametable + high 3-bits of coarseY + high 3-bits of coarseX */
-    attributeAddress := 0x23c0 | (ppu.VideoAddress & 0xc00) | ((ppu.VideoAddress >> 4) & 0x38) | ((ppu.VideoAddress >> 2) & 0x7)
+    attributeAddress := backgroundAttributeAddress(ppu.VideoAddress)
 
     patternTable := ppu.GetBackgroundPatternTableBase()
 
@@ -1226,34 +1517,43 @@ func (ppu *PPUState) LoadBackgroundTile() {
     _ = nametable
 
     // tileIndex := ppu.VideoMemory[tileAddress]
-    tileIndex := ppu.LoadNametableMemory(tileAddress)
+    tileIndex := ppu.readMemory(memory, tileAddress)
     patternTileAddress := patternTable + uint16(tileIndex) * 16
     /* Within the tile, pull out row at an offset of fineY */
-    left := ppu.VideoMemory[patternTileAddress + uint16(fineY)]
-    right := ppu.VideoMemory[patternTileAddress + 8 + uint16(fineY)]
+    left := ppu.readMemory(memory, patternTileAddress + uint16(fineY))
+    right := ppu.readMemory(memory, patternTileAddress + 8 + uint16(fineY))
 
     // log.Printf("Left 0x%x right 0x%x", leftAddr, rightAddr)
 
-    pattern_x := (coarseX/2) & 0x1
-    pattern_y := (coarseY/2) & 0x1
-
-    /* x to x+4
-     * top left = x:x+1, y:y+1
-     * top right = x+2:x+3, y:y+1
-     * bottom left = x:x+1, y+2:y+3
-     * bottom right = x+2:x+3, y+2:y+3
-     */
-    shifter := pattern_x * 2 + pattern_y * 4
-    patternAttributeValue := ppu.LoadNametableMemory(attributeAddress)
-    color_set := (patternAttributeValue >> shifter) & 0x3
-    /* the actual palette to use */
-    palette_base := uint16(color_set) * 4
+    patternAttributeValue := ppu.readMemory(memory, attributeAddress)
+    color_set := attributePalette(patternAttributeValue, coarseX, coarseY)
 
     // if coarseX == 0 && coarseY == 20 && ppu.Debug > 0 {
     if ppu.Debug > 0 {
         log.Printf("Scanline %v cycle %v X %v Y %v fineX %v fineY %v nametable %v Tile address 0x%x tile 0x%x pattern address 0x%x attribute 0x%x Video address 0x%x Attribute value 0x%x color set %v", ppu.Scanline, ppu.ScanlineCycle, coarseX, coarseY, ppu.FineX, fineY, nametable, tileAddress, tileIndex, patternTileAddress, attributeAddress, ppu.VideoAddress, patternAttributeValue, color_set)
     }
 
+    return BackgroundTile{
+        Low: left,
+        High: right,
+        Palette: color_set,
+    }
+}
+
+/* column is the position of the tile on the scanline that it will be drawn on */
+func (ppu *PPUState) LoadBackgroundTile(fetcher PPUFetchMapper, memory PPUMapper, scanline int, column int) {
+    var tile BackgroundTile
+    if fetcher != nil {
+        tile = fetcher.FetchBackgroundTile(ppu, scanline, column)
+    } else {
+        tile = ppu.fetchBackgroundTile(memory)
+    }
+
+    left := tile.Low
+    right := tile.High
+    /* the actual palette to use */
+    palette_base := uint16(tile.Palette) * 4
+
     var rawPixel uint16
     var pixel uint32
     for i := 0; i < 8; i++ {
@@ -1282,18 +1582,214 @@ func (ppu *PPUState) LoadBackgroundTile() {
 }
 
 /* Load the first two tiles for the scanline */
-func (ppu *PPUState) PreloadTiles() {
-    ppu.LoadBackgroundTile()
+func (ppu *PPUState) PreloadTiles(fetcher PPUFetchMapper, memory PPUMapper, scanline int) {
+    ppu.LoadBackgroundTile(fetcher, memory, scanline, 0)
     ppu.BackgroundPixels = ppu.BackgroundPixels >> 32
     ppu.RawBackgroundPixels = ppu.RawBackgroundPixels >> 16
-    ppu.LoadBackgroundTile()
+    ppu.LoadBackgroundTile(fetcher, memory, scanline, 1)
 }
 
-/* A bit of a hack, maybe make this more elegant later */
-func (ppu *PPUState) UpdateMapper4Scanline(mapper Mapper){
-    mapper4, ok := mapper.(*Mapper4)
-    if ok {
-        mapper4.Scanline()
+/* the pattern address of the row of a sprite that is row pixels below its top */
+func (ppu *PPUState) spritePatternAddress(sprite *Sprite, row int) uint16 {
+    if ppu.GetSpriteSize() == SpriteSize8x16 {
+        if sprite.Flip_vertical {
+            row = 15 - row
+        }
+        address := (uint16(sprite.Tile & 0x1) << 12) | (uint16(sprite.Tile >> 1) * 32)
+        if row >= 8 {
+            address += 16
+        }
+        return address + uint16(row & 0x7)
+    }
+
+    if sprite.Flip_vertical {
+        row = 7 - row
+    }
+    return ppu.GetSpritePatternTableBase() + uint16(sprite.Tile) * 16 + uint16(row)
+}
+
+func (ppu *PPUState) spriteHeight() int {
+    if ppu.GetSpriteSize() == SpriteSize8x16 {
+        return 16
+    }
+    return 8
+}
+
+/* whether a sprite with the given oam y is drawn on the scanline after this one */
+func (ppu *PPUState) spriteInRange(y byte) bool {
+    row := ppu.Scanline - int(y)
+    return row >= 0 && row < ppu.spriteHeight()
+}
+
+/* Run one dot of sprite evaluation on a visible scanline. Secondary oam is cleared on dots 1-64,
+ * then on dots 65-256 oam is read on odd dots and the byte is copied into secondary oam on even
+ * dots. Once 8 sprites are found the ppu keeps looking for a 9th to set the overflow flag, but it
+ * increments both n and m when a sprite is not in range, so it checks bytes along a diagonal of oam
+ * instead of just the y coordinates.
+ *   https://www.nesdev.org/wiki/PPU_sprite_evaluation
+ */
+func (ppu *PPUState) evaluateSprite(){
+    cycle := ppu.ScanlineCycle
+    eval := &ppu.SpriteEvaluation
+
+    if cycle >= 1 && cycle <= 64 {
+        if cycle % 2 == 0 {
+            ppu.SecondaryOAM[cycle / 2 - 1] = 0xff
+        }
+        return
+    }
+
+    if cycle < 65 || cycle > 256 {
+        return
+    }
+
+    if cycle == 65 {
+        *eval = SpriteEvaluation{}
+    }
+
+    if cycle % 2 == 1 {
+        eval.Latch = ppu.OAM[ppu.OAMAddress & 0xff]
+        return
+    }
+
+    n := (ppu.OAMAddress >> 2) & 0x3f
+    m := ppu.OAMAddress & 0x3
+
+    if eval.Done {
+        /* keeps reading y coordinates but nothing is copied */
+        n = (n + 1) & 0x3f
+        if eval.SecondaryAddress >= len(ppu.SecondaryOAM) {
+            eval.Latch = ppu.SecondaryOAM[eval.SecondaryAddress & 0x1f]
+        }
+    } else {
+        if !eval.InRange && ppu.spriteInRange(eval.Latch) {
+            eval.InRange = true
+            /* dot 66 checks the first sprite */
+            if cycle == 66 {
+                eval.Sprite0 = true
+            }
+        }
+
+        if eval.SecondaryAddress < len(ppu.SecondaryOAM) {
+            ppu.SecondaryOAM[eval.SecondaryAddress] = eval.Latch
+            if eval.InRange {
+                m = (m + 1) & 0x3
+                eval.SecondaryAddress += 1
+                if eval.SecondaryAddress & 0x3 == 0 {
+                    /* copied all 4 bytes of the sprite */
+                    eval.InRange = false
+                    m = 0
+                    n = (n + 1) & 0x3f
+                    eval.Done = n == 0
+                }
+            } else {
+                n = (n + 1) & 0x3f
+                m = 0
+                eval.Done = n == 0
+            }
+        } else {
+            /* 8 sprites were found, so writes to secondary oam turn into reads */
+            eval.Latch = ppu.SecondaryOAM[eval.SecondaryAddress & 0x1f]
+            if eval.InRange {
+                /* the overflowing sprite's y and the next 3 bytes are read, then evaluation stops */
+                ppu.SetSpriteOverflow(true)
+                m += 1
+                if m == 4 {
+                    m = 0
+                    n = (n + 1) & 0x3f
+                }
+                eval.OverflowReads += 1
+                if eval.OverflowReads == 4 {
+                    eval.InRange = false
+                    eval.Done = true
+                    m = 0
+                }
+            } else {
+                /* the hardware bug, m should stay at 0 */
+                n = (n + 1) & 0x3f
+                m = (m + 1) & 0x3
+                eval.Done = n == 0
+            }
+        }
+    }
+
+    ppu.OAMAddress = (n << 2) | m
+}
+
+/* replace the current sprites with the ones found by sprite evaluation, which are drawn on the next
+ * scanline. the pre-render line does not evaluate sprites so nothing is drawn on scanline 0.
+ */
+func (ppu *PPUState) loadSecondarySprites(prerender bool){
+    ppu.CurrentSprites = ppu.CurrentSprites[:0]
+    if prerender {
+        return
+    }
+
+    count := ppu.SpriteEvaluation.SecondaryAddress / 4
+    for i := range count {
+        oam := ppu.SecondaryOAM[i*4:i*4+4]
+        sprite := makeSprite(oam[0], oam[1], oam[2], oam[3])
+        sprite.Sprite0 = i == 0 && ppu.SpriteEvaluation.Sprite0
+        ppu.CurrentSprites = append(ppu.CurrentSprites, sprite)
+    }
+}
+
+/* the pattern addresses of the sprites on the next scanline, whose patterns are fetched at the end
+ * of this one. empty slots fetch tile $ff.
+ */
+func (ppu *PPUState) evaluateSpriteFetches(){
+    ppu.spriteFetches = ppu.spriteFetches[:0]
+
+    next := ppu.Scanline + 1
+    for i := 0; i < len(ppu.CurrentSprites) && len(ppu.spriteFetches) < 8; i++ {
+        sprite := &ppu.CurrentSprites[i]
+        row := (next - int(sprite.Y)) & (ppu.spriteHeight() - 1)
+        ppu.spriteFetches = append(ppu.spriteFetches, ppu.spritePatternAddress(sprite, row))
+    }
+
+    empty := Sprite{Tile: 0xff}
+    for len(ppu.spriteFetches) < 8 {
+        ppu.spriteFetches = append(ppu.spriteFetches, ppu.spritePatternAddress(&empty, 0))
+    }
+}
+
+/* report the pattern fetches made on the current dot. each 8 dot fetch cycle reads the low
+ * pattern byte on its 5th dot and the high byte on its 7th, with the background fetched on dots
+ * 1-256 and 321-336 and the sprites for the next scanline on dots 257-320
+ */
+func (ppu *PPUState) reportPatternFetch(watcher PPUAddressMapper, memory PPUMapper){
+    cycle := ppu.ScanlineCycle
+    switch {
+        case (cycle >= 1 && cycle <= 256) || (cycle >= 321 && cycle <= 336):
+            phase := (cycle - 1) % 8
+            if phase != 4 && phase != 6 {
+                return
+            }
+            tile := ppu.readMemory(memory, 0x2000 | (ppu.VideoAddress & 0xfff))
+            fineY := (ppu.VideoAddress >> 12) & 0x7
+            address := ppu.GetBackgroundPatternTableBase() + uint16(tile) * 16 + fineY
+            if phase == 6 {
+                address += 8
+            }
+            watcher.PPUAddress(ppu, address)
+        case cycle >= 257 && cycle <= 320:
+            if cycle == 257 {
+                ppu.evaluateSpriteFetches()
+            }
+            phase := (cycle - 257) % 8
+            if phase != 4 && phase != 6 {
+                return
+            }
+            slot := (cycle - 257) / 8
+            /* the fetches can be missing if the ppu was copied part way through the scanline */
+            address := uint16(0x1ff0)
+            if slot < len(ppu.spriteFetches) {
+                address = ppu.spriteFetches[slot]
+            }
+            if phase == 6 {
+                address += 8
+            }
+            watcher.PPUAddress(ppu, address)
     }
 }
 
@@ -1301,10 +1797,14 @@ func (ppu *PPUState) Run(cycles uint64, screen VirtualScreen, mapper Mapper) (bo
     /* http://wiki.nesdev.org/w/index.php/PPU_rendering */
     oldNMI := ppu.IsVerticalBlankFlagSet() && ppu.GetNMIOutput()
     didDraw := false
+    timing := ppu.Region.Timing()
+    fetcher, _ := mapper.(PPUFetchMapper)
+    watcher, _ := mapper.(PPUAddressMapper)
+    memory, _ := mapper.(PPUMapper)
     for cycle := uint64(0); cycle < cycles; cycle++ {
         if ppu.IsBackgroundEnabled() || ppu.IsSpriteEnabled() {
             if ppu.Scanline < 240 && ppu.ScanlineCycle <= 256 {
-                sprite0 := ppu.RenderPixel(ppu.Scanline, ppu.ScanlineCycle, ppu.CurrentSprites, &screen)
+                sprite0 := ppu.RenderPixel(ppu.Scanline, ppu.ScanlineCycle, ppu.CurrentSprites, &screen, fetcher, memory)
 
                 /* Shift one pixel out of the background pixel buffer */
                 ppu.BackgroundPixels = ppu.BackgroundPixels >> 4
@@ -1315,7 +1815,8 @@ func (ppu *PPUState) Run(cycles uint64, screen VirtualScreen, mapper Mapper) (bo
                  */
                 ppu.Shifts -= 1
                 if ppu.Shifts == 0 {
-                    ppu.LoadBackgroundTile()
+                    /* the first two tiles were loaded at the end of the previous scanline */
+                    ppu.LoadBackgroundTile(fetcher, memory, ppu.Scanline, 2 + ppu.ScanlineCycle / 8)
                 }
 
                 /* FIXME: not sure if sprite0 should be set multiple times per frame or only once
@@ -1336,7 +1837,26 @@ func (ppu *PPUState) Run(cycles uint64, screen VirtualScreen, mapper Mapper) (bo
             if ppu.ScanlineCycle == 257 {
                 ppu.ResetHorizontalPosition()
 
-                ppu.PreloadTiles()
+                ppu.PreloadTiles(fetcher, memory, ppu.Scanline + 1)
+            }
+        }
+
+        prerender := ppu.Scanline == timing.Scanlines - 1
+        if (ppu.IsBackgroundEnabled() || ppu.IsSpriteEnabled()) && (ppu.Scanline < 240 || prerender) {
+            if !prerender {
+                ppu.evaluateSprite()
+            }
+
+            /* the oam address is reset while the sprites for the next scanline are fetched */
+            if ppu.ScanlineCycle >= 257 && ppu.ScanlineCycle <= 320 {
+                ppu.OAMAddress = 0
+                if ppu.ScanlineCycle == 257 {
+                    ppu.loadSecondarySprites(prerender)
+                }
+            }
+
+            if watcher != nil {
+                ppu.reportPatternFetch(watcher, memory)
             }
         }
 
@@ -1350,11 +1870,11 @@ func (ppu *PPUState) Run(cycles uint64, screen VirtualScreen, mapper Mapper) (bo
             // log.Printf("Render complete")
         }
 
-        if ppu.Scanline == 241 && ppu.ScanlineCycle == 1 {
+        if ppu.Scanline == timing.VBlankScanline && ppu.ScanlineCycle == 1 {
             ppu.SetVerticalBlankFlag(true)
         }
 
-        if ppu.Scanline == 260 && ppu.ScanlineCycle == 0 {
+        if ppu.Scanline == timing.Scanlines - 2 && ppu.ScanlineCycle == 0 {
             ppu.SetVerticalBlankFlag(false)
         }
 
@@ -1363,42 +1883,21 @@ func (ppu *PPUState) Run(cycles uint64, screen VirtualScreen, mapper Mapper) (bo
             ppu.ScanlineCycle = 0
             ppu.Scanline += 1
 
-            if (ppu.IsSpriteEnabled() || ppu.IsBackgroundEnabled()) && ppu.Scanline < 240 {
-                ppu.UpdateMapper4Scanline(mapper)
-            }
-
-            /* Load the sprites for the next scanline */
-            if ppu.IsSpriteEnabled() && ppu.Scanline < 240 {
-                sprites := ppu.GetSprites()
-                ppu.CurrentSprites = ppu.CurrentSprites[:0]
-                count := 0
-                size := 8
-                if ppu.GetSpriteSize() == SpriteSize8x16 {
-                    size = 16
-                }
-                for i := 0; i < len(sprites); i++ {
-                    sprite := &sprites[i]
-                    if ppu.Scanline >= int(sprite.Y) && ppu.Scanline < int(sprite.Y) + size {
-                        ppu.CurrentSprites = append(ppu.CurrentSprites, *sprite)
-                        count += 1
-                        /* 8 sprite limit per scanline */
-                        if count > 7 {
-                            break
-                        }
-                    }
-                }
-            }
-
-            if ppu.Scanline == 261 {
+            if ppu.Scanline == timing.Scanlines - 1 {
                 ppu.SetSpriteZeroHit(false)
+                ppu.SetSpriteOverflow(false)
 
-                if ppu.IsSpriteEnabled() || ppu.IsBackgroundEnabled() {
-                    ppu.UpdateMapper4Scanline(mapper)
+                /* when rendering starts with the oam address at 8 or more, the 8 bytes of the
+                 * row it points to are copied over the first 8 bytes of oam
+                 */
+                if (ppu.IsBackgroundEnabled() || ppu.IsSpriteEnabled()) && ppu.OAMAddress >= 8 {
+                    row := ppu.OAMAddress & 0xf8
+                    copy(ppu.OAM[0:8], ppu.OAM[row:row+8])
                 }
             }
 
             /* Prerender line */
-            if ppu.Scanline == 262 {
+            if ppu.Scanline == timing.Scanlines {
                 ppu.Scanline = 0
 
                 ppu.HasSetSprite0 = false
@@ -1411,9 +1910,13 @@ func (ppu *PPUState) Run(cycles uint64, screen VirtualScreen, mapper Mapper) (bo
                         log.Printf("Draw coarse x %v coarse y %v fine x %v fine y %v nametable %v mirror %v. Video address 0x%x. Temporary video address 0x%x Background color 0x%x", coarseX, coarseY, ppu.FineX, fineY, nametable, ppu.NametableMirror.String(), ppu.VideoAddress, ppu.TemporaryVideoAddress, ppu.VideoMemory[0x3f00])
                     }
 
-                    ppu.PreloadTiles()
+                    ppu.PreloadTiles(fetcher, memory, 0)
                 }
             }
+
+            if fetcher != nil {
+                fetcher.StartScanline(ppu, ppu.Scanline)
+            }
         }
     }
 
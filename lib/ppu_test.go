@@ -0,0 +1,280 @@
+package lib
+
+import (
+    "testing"
+)
+
+/* a ppu with rendering on at the start of the pre-render line and every sprite off screen */
+func makeSpriteTestPPU() PPUState {
+    ppu := MakePPU()
+    for i := range ppu.OAM {
+        ppu.OAM[i] = 0xff
+    }
+    ppu.SetMask(0x18)
+    ppu.Scanline = ppu.Region.Timing().Scanlines - 1
+    ppu.ScanlineCycle = 0
+    return ppu
+}
+
+func runSpriteTestPPU(ppu *PPUState, screen VirtualScreen, scanline int, dot int){
+    for ppu.Scanline != scanline || ppu.ScanlineCycle != dot {
+        ppu.Run(1, screen, nil)
+    }
+}
+
+func setOAMSprite(ppu *PPUState, index int, y byte, tile byte, attributes byte, x byte){
+    copy(ppu.OAM[index*4:], []byte{y, tile, attributes, x})
+}
+
+func TestSpriteOverflow(test *testing.T){
+    screen := MakeVirtualScreen(VideoWidth, VideoHeight)
+
+    ppu := makeSpriteTestPPU()
+    for i := range 8 {
+        setOAMSprite(&ppu, i, 20, byte(i), 0, byte(i * 10))
+    }
+
+    runSpriteTestPPU(&ppu, screen, 30, 0)
+    if ppu.GetSpriteOverflow() {
+        test.Fatalf("8 sprites on a scanline should not overflow")
+    }
+
+    /* the sprites are drawn a scanline below their y */
+    runSpriteTestPPU(&ppu, screen, 21, 0)
+    if len(ppu.CurrentSprites) != 8 {
+        test.Fatalf("expected 8 sprites on scanline 21 but got %v", len(ppu.CurrentSprites))
+    }
+    if !ppu.CurrentSprites[0].Sprite0 || ppu.CurrentSprites[1].Sprite0 {
+        test.Fatalf("only the first sprite should be sprite 0")
+    }
+
+    ppu = makeSpriteTestPPU()
+    for i := range 9 {
+        setOAMSprite(&ppu, i, 20, byte(i), 0, byte(i * 10))
+    }
+
+    runSpriteTestPPU(&ppu, screen, 19, 0)
+    if ppu.GetSpriteOverflow() {
+        test.Fatalf("overflow was set before the sprites are in range")
+    }
+    runSpriteTestPPU(&ppu, screen, 20, 258)
+    if !ppu.GetSpriteOverflow() {
+        test.Fatalf("9 sprites on a scanline should overflow")
+    }
+    if len(ppu.CurrentSprites) != 8 || ppu.CurrentSprites[7].Tile != 7 {
+        test.Fatalf("expected the first 8 sprites to be drawn but got %+v", ppu.CurrentSprites)
+    }
+
+    /* cleared at the start of the pre-render line */
+    runSpriteTestPPU(&ppu, screen, ppu.Region.Timing().Scanlines - 1, 1)
+    if ppu.GetSpriteOverflow() {
+        test.Fatalf("overflow should be cleared on the pre-render line")
+    }
+}
+
+func TestSpriteOverflowStop(test *testing.T){
+    screen := MakeVirtualScreen(VideoWidth, VideoHeight)
+
+    ppu := makeSpriteTestPPU()
+    for i := range 8 {
+        setOAMSprite(&ppu, i, byte(13 + i), 0, 0, 0)
+    }
+    setOAMSprite(&ppu, 8, 20, 0, 0, 0)
+
+    /* the 9th sprite is found on dot 130 and its other 3 bytes are read on dots 132-136. after
+     * that only n is incremented, once every 2 dots, so it wraps around to sprite 4 by dot 256
+     * and dot 256 moves it to sprite 5
+     */
+    runSpriteTestPPU(&ppu, screen, 20, 256)
+    if !ppu.GetSpriteOverflow() {
+        test.Fatalf("9 sprites on a scanline should overflow")
+    }
+    if ppu.OAMAddress != 0x10 {
+        test.Fatalf("expected the oam address to be 0x10 at dot 256 but was 0x%x", ppu.OAMAddress)
+    }
+    if value := ppu.ReadOAM(); value != 17 {
+        test.Fatalf("expected OAMDATA to be the y of sprite 4 at dot 256 but was %v", value)
+    }
+
+    runSpriteTestPPU(&ppu, screen, 20, 257)
+    if ppu.OAMAddress != 0x14 {
+        test.Fatalf("expected the oam address to be 0x14 after dot 256 but was 0x%x", ppu.OAMAddress)
+    }
+}
+
+func TestSpriteOverflowDetails(test *testing.T){
+    screen := MakeVirtualScreen(VideoWidth, VideoHeight)
+
+    /* the 9th sprite can be the last one in oam */
+    ppu := makeSpriteTestPPU()
+    for i := 55; i < 64; i++ {
+        setOAMSprite(&ppu, i, 30, 0, 0, 0)
+    }
+    runSpriteTestPPU(&ppu, screen, 31, 0)
+    if !ppu.GetSpriteOverflow() {
+        test.Fatalf("sprites 55-63 on one scanline should overflow")
+    }
+
+    /* a y of 255 is never on screen, so 8 sprites plus one at 255 don't overflow */
+    ppu = makeSpriteTestPPU()
+    for i := range 8 {
+        setOAMSprite(&ppu, i, 30, 0, 0, 0)
+    }
+    setOAMSprite(&ppu, 8, 255, 0, 0, 0)
+    runSpriteTestPPU(&ppu, screen, 239, 0)
+    if ppu.GetSpriteOverflow() {
+        test.Fatalf("a sprite at y 255 should not cause an overflow")
+    }
+
+    /* the flag is set on the dot that reads the 9th y coordinate, dot 130 for sprite 8 */
+    ppu = makeSpriteTestPPU()
+    for i := range 9 {
+        setOAMSprite(&ppu, i, 30, 0, 0, 0)
+    }
+    runSpriteTestPPU(&ppu, screen, 30, 130)
+    if ppu.GetSpriteOverflow() {
+        test.Fatalf("overflow was set before dot 130")
+    }
+    runSpriteTestPPU(&ppu, screen, 30, 131)
+    if !ppu.GetSpriteOverflow() {
+        test.Fatalf("overflow should be set by dot 130")
+    }
+}
+
+func TestSpriteOverflowBug(test *testing.T){
+    screen := MakeVirtualScreen(VideoWidth, VideoHeight)
+
+    /* after 8 sprites are found m is incremented along with n, so sprite 9 is checked by its
+     * tile instead of its y. a tile that looks like it is in range causes a false overflow
+     */
+    ppu := makeSpriteTestPPU()
+    for i := range 8 {
+        setOAMSprite(&ppu, i, 50, 0, 0, 0)
+    }
+    setOAMSprite(&ppu, 9, 0xff, 50, 0, 0)
+
+    runSpriteTestPPU(&ppu, screen, 51, 0)
+    if !ppu.GetSpriteOverflow() {
+        test.Fatalf("the diagonal oam read should have set overflow from sprite 9's tile")
+    }
+
+    /* and a 10th sprite that really is in range is missed because its attributes are read instead */
+    ppu = makeSpriteTestPPU()
+    for i := range 8 {
+        setOAMSprite(&ppu, i, 50, 0, 0, 0)
+    }
+    setOAMSprite(&ppu, 9, 50, 0xff, 0, 0)
+    setOAMSprite(&ppu, 10, 50, 0xff, 0xff, 0xff)
+    setOAMSprite(&ppu, 11, 50, 0xff, 0xff, 0xff)
+
+    runSpriteTestPPU(&ppu, screen, 60, 0)
+    if ppu.GetSpriteOverflow() {
+        test.Fatalf("the diagonal oam read should have missed the sprites in range")
+    }
+}
+
+func TestSpriteOAMAddress(test *testing.T){
+    screen := MakeVirtualScreen(VideoWidth, VideoHeight)
+
+    ppu := makeSpriteTestPPU()
+    ppu.Scanline = 241
+    for i := range 8 {
+        ppu.OAM[0x20 + i] = byte(i + 1)
+    }
+    ppu.SetOAMAddress(0x23)
+
+    /* starting to render with the oam address at 8 or more copies that row of oam to the start */
+    runSpriteTestPPU(&ppu, screen, ppu.Region.Timing().Scanlines - 1, 2)
+    for i := range 8 {
+        if ppu.OAM[i] != byte(i + 1) {
+            test.Fatalf("oam %v should have been copied from 0x%x but is 0x%x", i, 0x20 + i, ppu.OAM[i])
+        }
+    }
+
+    runSpriteTestPPU(&ppu, screen, 0, 10)
+    if ppu.ReadOAM() != 0xff {
+        test.Fatalf("reading oam while secondary oam is cleared should give 0xff")
+    }
+
+    /* the oam address is reset during the sprite fetches */
+    runSpriteTestPPU(&ppu, screen, 0, 321)
+    if ppu.OAMAddress != 0 {
+        test.Fatalf("expected the oam address to be 0 after the sprite fetches but was 0x%x", ppu.OAMAddress)
+    }
+
+    /* writes during rendering only move the oam address */
+    old := ppu.OAM[0]
+    ppu.WriteOAM(0x42)
+    if ppu.OAM[0] != old || ppu.OAMAddress != 4 {
+        test.Fatalf("oam write while rendering changed oam or moved the address to 0x%x", ppu.OAMAddress)
+    }
+}
+
+func TestMaskColors(test *testing.T){
+    ppu := MakePPU()
+
+    ppu.SetMask(0x01)
+    if color := ppu.maskedColor(0x16); color[0] != 152 || color[1] != 150 || color[2] != 152 {
+        test.Fatalf("greyscale 0x16 should be the grey of 0x10 but was %v", color)
+    }
+
+    /* red emphasis darkens green and blue */
+    ppu.SetMask(0x20)
+    color := ppu.maskedColor(0x30)
+    if color[0] != 236 || color[1] >= 238 || color[2] >= 236 {
+        test.Fatalf("red emphasis of 0x30 should only keep red but was %v", color)
+    }
+    if color := ppu.maskedColor(0x0f); color[0] != 0 || color[1] != 0 || color[2] != 0 {
+        test.Fatalf("emphasis should not change black but was %v", color)
+    }
+
+    /* on pal the red bit emphasizes green */
+    ppu.Region = RegionPAL
+    color = ppu.maskedColor(0x30)
+    if color[1] != 238 || color[0] >= 236 {
+        test.Fatalf("pal red emphasis of 0x30 should keep green but was %v", color)
+    }
+
+    /* the rgb ppus turn the channel all the way up */
+    ppu.Region = RegionNTSC
+    ppu.SetModel(PPU2C03)
+    ppu.SetMask(0x80)
+    if color := ppu.maskedColor(0x0f); color[2] != 255 {
+        test.Fatalf("blue emphasis on the 2c03 should set blue to full but was %v", color)
+    }
+}
+
+func TestMaskLeftColumn(test *testing.T){
+    ppu := MakePPU()
+    screen := MakeVirtualScreen(VideoWidth, VideoHeight)
+
+    /* an opaque sprite at the left edge of the screen */
+    for i := range 8 {
+        ppu.VideoMemory[0x10 + i] = 0xff
+    }
+    ppu.VideoMemory[0x3f00] = 0x0f
+    ppu.VideoMemory[0x3f11] = 0x16
+    sprites := []Sprite{Sprite{Tile: 1, X: 0, Y: 10}, Sprite{Tile: 1, X: 8, Y: 10}}
+
+    draw := func(x int) (uint8, uint8, uint8) {
+        ppu.RenderPixel(10, x, sprites, &screen, nil, nil)
+        r, g, b, _ := screen.GetRGBA(x, 10)
+        return r, g, b
+    }
+
+    ppu.SetMask(0x10)
+    if r, _, _ := draw(3); r != 0 {
+        test.Fatalf("sprite should be hidden in the left column but red was %v", r)
+    }
+    if r, _, _ := draw(7); r != 0 {
+        test.Fatalf("sprite should be hidden at x=7 but red was %v", r)
+    }
+    if r, _, _ := draw(8); r != 152 {
+        test.Fatalf("sprite should be drawn at x=8 but red was %v", r)
+    }
+
+    ppu.SetMask(0x14)
+    if r, _, _ := draw(3); r != 152 {
+        test.Fatalf("sprite should be drawn in the left column but red was %v", r)
+    }
+}
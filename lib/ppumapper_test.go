@@ -0,0 +1,139 @@
+package lib
+
+import (
+    "testing"
+)
+
+/* read ppu memory through PPUDATA, skipping the buffered read */
+func readPPUData(cpu *CPUState, address uint16) byte {
+    cpu.PPU.VideoAddress = address
+    cpu.PPU.ReadVideoMemory(cpu.Mapper.Mapper)
+    cpu.PPU.VideoAddress = address
+    cpu.PPU.ReadVideoMemory(cpu.Mapper.Mapper)
+    return cpu.PPU.InternalVideoBuffer
+}
+
+func TestMMC3ChrBanking(test *testing.T){
+    cpu := StartupState()
+    cpu.SetMapper(MakeMapper4(MapperInfo{Mapper: 4}, makeMapperTestRom(0x20000, nil), makeBankedChr(0x20000)))
+
+    /* 2k bank 6 at $0000 and 1k bank 9 at $1400 */
+    cpu.StoreMemory(0x8000, 0)
+    cpu.StoreMemory(0x8001, 6)
+    cpu.StoreMemory(0x8000, 3)
+    cpu.StoreMemory(0x8001, 9)
+
+    if value := readPPUData(&cpu, 0x0400); value != 7 {
+        test.Fatalf("expected the second half of the 2k bank at $0400 but got %v", value)
+    }
+    if value := readPPUData(&cpu, 0x1400); value != 9 {
+        test.Fatalf("expected bank 9 at $1400 but got %v", value)
+    }
+
+    /* chr mode 1 swaps the pattern tables */
+    cpu.StoreMemory(0x8000, 0x80)
+    if value := readPPUData(&cpu, 0x0400); value != 9 {
+        test.Fatalf("expected bank 9 at $0400 in chr mode 1 but got %v", value)
+    }
+    if value := readPPUData(&cpu, 0x1000); value != 6 {
+        test.Fatalf("expected bank 6 at $1000 in chr mode 1 but got %v", value)
+    }
+
+    /* chr rom can not be written */
+    cpu.PPU.VideoAddress = 0x1000
+    cpu.PPU.WriteVideoMemory(0x42, cpu.Mapper.Mapper)
+    if value := readPPUData(&cpu, 0x1000); value != 6 {
+        test.Fatalf("chr rom was overwritten with 0x%x", value)
+    }
+
+    /* nametable accesses at $3000-$3eff mirror $2000-$2eff */
+    cpu.PPU.VideoAddress = 0x2005
+    cpu.PPU.WriteVideoMemory(0x42, cpu.Mapper.Mapper)
+    if value := readPPUData(&cpu, 0x3005); value != 0x42 {
+        test.Fatalf("expected the nametable mirror at $3005 but got 0x%x", value)
+    }
+}
+
+func TestMMC2Latch(test *testing.T){
+    cpu := StartupState()
+    /* 4k banks, so every fourth 1k bank number */
+    cpu.SetMapper(MakeMapper9(makeMapperTestRom(0x20000, nil), makeBankedChr(0x20000)))
+
+    cpu.StoreMemory(0xb000, 1)
+    cpu.StoreMemory(0xc000, 2)
+    cpu.StoreMemory(0xd000, 3)
+    cpu.StoreMemory(0xe000, 4)
+
+    if value := readPPUData(&cpu, 0x0000); value != 4 {
+        test.Fatalf("expected the $fd bank at $0000 but got %v", value)
+    }
+
+    /* reading the high plane of tile $fe switches to the $fe bank after the read */
+    readPPUData(&cpu, 0x0fe8)
+    if value := readPPUData(&cpu, 0x0000); value != 8 {
+        test.Fatalf("expected the $fe bank at $0000 but got %v", value)
+    }
+
+    /* the $1000 latch triggers on any row of the tile */
+    readPPUData(&cpu, 0x1fec)
+    if value := readPPUData(&cpu, 0x1000); value != 16 {
+        test.Fatalf("expected the $fe bank at $1000 but got %v", value)
+    }
+    readPPUData(&cpu, 0x1fdb)
+    if value := readPPUData(&cpu, 0x1000); value != 12 {
+        test.Fatalf("expected the $fd bank at $1000 but got %v", value)
+    }
+}
+
+func TestMMC5PPUData(test *testing.T){
+    cpu := StartupState()
+    cpu.SetMapper(MakeMapper5(MapperInfo{Mapper: 5}, makeMapperTestRom(0x20000, nil), makeBankedChr(0x20000)))
+
+    /* 1k banks. the cpu sees whichever register set was written last */
+    cpu.StoreMemory(0x5101, 3)
+    cpu.StoreMemory(0x5121, 9)
+    if value := readPPUData(&cpu, 0x0400); value != 9 {
+        test.Fatalf("expected bank 9 from set A at $0400 but got %v", value)
+    }
+
+    cpu.StoreMemory(0x5128, 12)
+    if value := readPPUData(&cpu, 0x1000); value != 12 {
+        test.Fatalf("expected bank 12 from set B at $1000 but got %v", value)
+    }
+
+    /* exram as the second nametable */
+    cpu.StoreMemory(0x5104, MMC5ExRamNametable)
+    cpu.StoreMemory(0x5105, 0x8)
+    cpu.PPU.VideoAddress = 0x2410
+    cpu.PPU.WriteVideoMemory(0x42, cpu.Mapper.Mapper)
+    if value := readPPUData(&cpu, 0x2410); value != 0x42 || cpu.PPU.NametableMemory[0x10] == 0x42 {
+        test.Fatalf("expected the nametable write to go to exram but got 0x%x", value)
+    }
+}
+
+func TestN163PPUData(test *testing.T){
+    cpu := StartupState()
+    cpu.SetMapper(MakeMapper19(makeMapperTestRom(0x20000, nil), makeBankedChr(0x20000)))
+
+    cpu.StoreMemory(0x8000, 7)
+    if value := readPPUData(&cpu, 0x0000); value != 7 {
+        test.Fatalf("expected bank 7 at $0000 but got %v", value)
+    }
+
+    /* banks $e0-$ff select nametable ram in the pattern tables unless it is disabled by $e800 */
+    cpu.StoreMemory(0x8800, 0xe1)
+    cpu.PPU.VideoAddress = 0x0405
+    cpu.PPU.WriteVideoMemory(0x42, cpu.Mapper.Mapper)
+    if cpu.PPU.NametableMemory[0x405] != 0x42 {
+        test.Fatalf("expected the pattern table write to go to nametable ram")
+    }
+    if value := readPPUData(&cpu, 0x2405); value != 0x42 {
+        test.Fatalf("expected the second nametable to hold the write but got 0x%x", value)
+    }
+
+    cpu.StoreMemory(0xe800, 0x40)
+    /* the 128k of chr rom only has 128 banks, so bank $e1 wraps around to $61 */
+    if value := readPPUData(&cpu, 0x0405); value != 0x61 {
+        test.Fatalf("expected chr rom bank $61 with nametable ram disabled but got 0x%x", value)
+    }
+}
@@ -0,0 +1,155 @@
+package lib
+
+import (
+    "fmt"
+    "strings"
+)
+
+/* The tv system a game was made for. PAL and Dendy (a famiclone popular in russia) run
+ * the cpu at a different speed and draw more scanlines per frame than NTSC, so a game
+ * running on the wrong region plays too fast or too slow and can glitch.
+ *
+ * http://wiki.nesdev.org/w/index.php/Cycle_reference_chart
+ */
+type Region int
+const (
+    RegionNTSC Region = iota
+    RegionPAL
+    RegionDendy
+)
+
+func (region Region) String() string {
+    switch region {
+        case RegionNTSC: return "NTSC"
+        case RegionPAL: return "PAL"
+        case RegionDendy: return "Dendy"
+    }
+
+    return "unknown"
+}
+
+func AllRegions() []Region {
+    return []Region{RegionNTSC, RegionPAL, RegionDendy}
+}
+
+/* parse a region name as returned by String(), ignoring case */
+func ParseRegion(name string) (Region, error) {
+    for _, region := range AllRegions() {
+        if strings.EqualFold(name, region.String()) {
+            return region, nil
+        }
+    }
+
+    return RegionNTSC, fmt.Errorf("unknown region '%v'", name)
+}
+
+type RegionTiming struct {
+    /* cpu cycles per second */
+    CPUSpeed float64
+    /* frames per second */
+    FrameRate float64
+
+    /* the ppu runs PPUCycles dots for every CPUCycles cpu cycles */
+    PPUCycles uint64
+    CPUCycles uint64
+
+    /* scanlines per frame, including the pre-render line */
+    Scanlines int
+    /* the scanline where vblank starts */
+    VBlankScanline int
+
+    /* apu cycles between frame sequencer steps */
+    FrameCounterPeriod float64
+
+    /* timer periods indexed by the value written to $400e and $4010 */
+    NoisePeriods [16]uint16
+    DMCRates [16]uint16
+}
+
+var ntscNoisePeriods = [16]uint16{4, 8, 16, 32, 64, 96, 128, 160, 202, 254, 380, 508, 762, 1016, 2034, 4068}
+var ntscDMCRates = [16]uint16{428, 380, 340, 320, 286, 254, 226, 214, 190, 160, 142, 128, 106, 84, 72, 54}
+
+var regionTimings = map[Region]*RegionTiming{
+    RegionNTSC: &RegionTiming{
+        /* 21.477272 MHz ÷ 12 */
+        CPUSpeed: CPUSpeed,
+        FrameRate: 60.0988,
+        PPUCycles: 3,
+        CPUCycles: 1,
+        Scanlines: 262,
+        VBlankScanline: 241,
+        /* 1.789773e6 / 2 / 3728.75 = 240hz */
+        FrameCounterPeriod: 3728.75,
+        NoisePeriods: ntscNoisePeriods,
+        DMCRates: ntscDMCRates,
+    },
+    RegionPAL: &RegionTiming{
+        /* 26.601712 MHz ÷ 16 */
+        CPUSpeed: 1.662607e6,
+        FrameRate: 50.0070,
+        /* 3.2 dots per cpu cycle */
+        PPUCycles: 16,
+        CPUCycles: 5,
+        Scanlines: 312,
+        VBlankScanline: 241,
+        /* 200hz */
+        FrameCounterPeriod: 4156.625,
+        NoisePeriods: [16]uint16{4, 8, 14, 30, 60, 88, 118, 148, 188, 236, 354, 472, 708, 944, 1890, 3778},
+        DMCRates: [16]uint16{398, 354, 316, 298, 276, 236, 210, 198, 176, 148, 132, 118, 98, 78, 66, 50},
+    },
+    /* the dendy has a pal ppu but an ntsc style apu, and puts 51 idle scanlines
+     * before vblank so that ntsc games get about the same amount of vblank time
+     */
+    RegionDendy: &RegionTiming{
+        /* 26.601712 MHz ÷ 15 */
+        CPUSpeed: 1.773448e6,
+        FrameRate: 50.0070,
+        PPUCycles: 3,
+        CPUCycles: 1,
+        Scanlines: 312,
+        VBlankScanline: 291,
+        FrameCounterPeriod: 3728.75,
+        NoisePeriods: ntscNoisePeriods,
+        DMCRates: ntscDMCRates,
+    },
+}
+
+func (region Region) Timing() *RegionTiming {
+    timing, ok := regionTimings[region]
+    if !ok {
+        return regionTimings[RegionNTSC]
+    }
+    return timing
+}
+
+/* the number of ppu dots that have elapsed after the given number of cpu cycles */
+func (timing *RegionTiming) PPUDots(cpuCycles uint64) uint64 {
+    return cpuCycles * timing.PPUCycles / timing.CPUCycles
+}
+
+/* guess the region from the tags that the goodnes and no-intro naming conventions
+ * put in rom names, such as 'Game (E).nes' or 'Game (Europe).nes'
+ */
+func GuessRegionFromName(name string) (Region, bool) {
+    lower := strings.ToLower(name)
+
+    palTags := []string{"(e)", "(europe", "(pal)", "(a)", "(australia", "(g)", "(germany", "(f)", "(france", "(s)", "(spain", "(i)", "(italy", "(sw)", "(sweden", "(uk)"}
+    for _, tag := range palTags {
+        if strings.Contains(lower, tag) {
+            return RegionPAL, true
+        }
+    }
+
+    if strings.Contains(lower, "(dendy)") || strings.Contains(lower, "(r)") || strings.Contains(lower, "(russia") {
+        return RegionDendy, true
+    }
+
+    ntscTags := []string{"(u)", "(usa", "(j)", "(japan", "(ntsc)"}
+    for _, tag := range ntscTags {
+        if strings.Contains(lower, tag) {
+            return RegionNTSC, true
+        }
+    }
+
+    return RegionNTSC, false
+}
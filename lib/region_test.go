@@ -0,0 +1,64 @@
+package lib
+
+import (
+    "testing"
+)
+
+func TestRegionFrameLength(test *testing.T){
+    /* 341 dots per scanline */
+    expected := map[Region]float64{
+        RegionNTSC: 341.0 * 262 / 3,
+        RegionPAL: 341.0 * 312 / 3.2,
+        RegionDendy: 341.0 * 312 / 3,
+    }
+
+    for _, region := range AllRegions() {
+        cpu := makeMapperTestCpu(test, 0)
+        cpu.SetRegion(region)
+        machine := MakeMachine(&cpu, 44100)
+        stepFrames(test, machine, 2)
+
+        const frames = 10
+        start := cpu.Cycle
+        stepFrames(test, machine, frames)
+
+        cycles := float64(cpu.Cycle - start) / frames
+        if cycles < expected[region] - 5 || cycles > expected[region] + 5 {
+            test.Fatalf("%v: expected %v cycles per frame but got %v", region, expected[region], cycles)
+        }
+    }
+}
+
+func TestReadRegion(test *testing.T){
+    header := []byte{'N', 'E', 'S', 0x1a, 2, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+
+    _, ok := readRegion(header)
+    if ok {
+        test.Fatalf("an ines header with no tv system bit should not have a region")
+    }
+
+    header[9] = 1
+    region, ok := readRegion(header)
+    if !ok || region != RegionPAL {
+        test.Fatalf("expected pal from the ines tv system bit but got %v", region)
+    }
+
+    /* nes 2.0 */
+    header[9] = 0
+    header[7] = 0x8
+    header[12] = 3
+    region, ok = readRegion(header)
+    if !ok || region != RegionDendy {
+        test.Fatalf("expected dendy from the nes 2.0 header but got %v", region)
+    }
+
+    region, ok = GuessRegionFromName("Some Game (Europe).nes")
+    if !ok || region != RegionPAL {
+        test.Fatalf("expected pal from the name but got %v", region)
+    }
+
+    region, ok = GuessRegionFromName("Some Game (USA, Europe).nes")
+    if !ok || region != RegionNTSC {
+        test.Fatalf("expected ntsc from the name but got %v", region)
+    }
+}
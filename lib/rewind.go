@@ -0,0 +1,324 @@
+package lib
+
+import (
+    "bytes"
+    "compress/flate"
+    "encoding/binary"
+    "fmt"
+    "io"
+)
+
+/* Rewind support. Every few frames the cpu state is serialized and stored in a
+ * buffer bounded by a maximum number of bytes. Storing the full state every time would
+ * be huge (the rom is part of the mapper state), so most snapshots are stored as a
+ * delta against the most recent keyframe: the binary state is split into chunks at the
+ * start and end of each byte slice, and any chunk that also appears in the keyframe is
+ * replaced by a reference to it. Keyframes and deltas are both compressed.
+ */
+
+/* a keyframe is stored every this many snapshots */
+const RewindKeyframeInterval = 30
+
+type rewindSnapshot struct {
+    /* unique id so the keyframe cache survives snapshots being removed */
+    id uint64
+    keyframe bool
+    /* compressed binary state for keyframes, compressed chunk references for deltas */
+    data []byte
+    /* where the keyframe is split into chunks */
+    marks []int
+}
+
+/* a decoded keyframe, split into chunks */
+type rewindKeyframe struct {
+    id uint64
+    chunks [][]byte
+    index map[string]int
+}
+
+type RewindBuffer struct {
+    /* maximum total size of all stored snapshots in bytes */
+    MaxMemory int
+    /* take a snapshot every this many frames */
+    Interval int
+
+    snapshots []rewindSnapshot
+    memory int
+    frames int
+    nextId uint64
+
+    /* the keyframe that new deltas are built against, also used when restoring */
+    keyframe *rewindKeyframe
+}
+
+func MakeRewindBuffer(maxMemory int, interval int) *RewindBuffer {
+    if interval < 1 {
+        interval = 1
+    }
+
+    return &RewindBuffer{
+        MaxMemory: maxMemory,
+        Interval: interval,
+    }
+}
+
+/* number of snapshots that can be rewound to */
+func (rewind *RewindBuffer) Len() int {
+    return len(rewind.snapshots)
+}
+
+/* bytes used by all snapshots */
+func (rewind *RewindBuffer) Memory() int {
+    return rewind.memory
+}
+
+func (rewind *RewindBuffer) Clear() {
+    rewind.snapshots = nil
+    rewind.memory = 0
+    rewind.frames = 0
+    rewind.keyframe = nil
+}
+
+/* call once per emulated frame, a snapshot is taken every Interval frames */
+func (rewind *RewindBuffer) Frame(cpu *CPUState) error {
+    rewind.frames += 1
+    if rewind.frames < rewind.Interval {
+        return nil
+    }
+
+    rewind.frames = 0
+    return rewind.Snapshot(cpu)
+}
+
+/* split a binary state at the given offsets, which come from StateWriter.marks */
+func splitRewindChunks(data []byte, marks []int) [][]byte {
+    var out [][]byte
+    last := 0
+    for _, mark := range marks {
+        if mark > last {
+            out = append(out, data[last:mark])
+            last = mark
+        }
+    }
+    if last < len(data) {
+        out = append(out, data[last:])
+    }
+    return out
+}
+
+func makeRewindKeyframe(id uint64, chunks [][]byte) *rewindKeyframe {
+    keyframe := rewindKeyframe{
+        id: id,
+        chunks: chunks,
+        index: make(map[string]int),
+    }
+
+    for i, chunk := range keyframe.chunks {
+        if _, ok := keyframe.index[string(chunk)]; !ok {
+            keyframe.index[string(chunk)] = i
+        }
+    }
+
+    return &keyframe
+}
+
+func compressRewind(data []byte) ([]byte, error) {
+    var out bytes.Buffer
+    writer, err := flate.NewWriter(&out, flate.BestSpeed)
+    if err != nil {
+        return nil, err
+    }
+    _, err = writer.Write(data)
+    if err != nil {
+        return nil, err
+    }
+    err = writer.Close()
+    if err != nil {
+        return nil, err
+    }
+    return bytes.Clone(out.Bytes()), nil
+}
+
+func decompressRewind(data []byte) ([]byte, error) {
+    reader := flate.NewReader(bytes.NewReader(data))
+    defer reader.Close()
+    return io.ReadAll(reader)
+}
+
+/* each chunk is written as a uvarint. 0 means a literal follows (length then bytes),
+ * anything else is a reference to keyframe chunk n-1
+ */
+func encodeRewindDelta(keyframe *rewindKeyframe, chunks [][]byte) []byte {
+    var out []byte
+    for _, chunk := range chunks {
+        index, ok := keyframe.index[string(chunk)]
+        if ok {
+            out = binary.AppendUvarint(out, uint64(index + 1))
+        } else {
+            out = binary.AppendUvarint(out, 0)
+            out = binary.AppendUvarint(out, uint64(len(chunk)))
+            out = append(out, chunk...)
+        }
+    }
+    return out
+}
+
+func decodeRewindDelta(keyframe *rewindKeyframe, delta []byte) ([]byte, error) {
+    var out []byte
+    for len(delta) > 0 {
+        value, size := binary.Uvarint(delta)
+        if size <= 0 {
+            return nil, fmt.Errorf("invalid rewind delta")
+        }
+        delta = delta[size:]
+
+        if value == 0 {
+            length, size := binary.Uvarint(delta)
+            if size <= 0 || uint64(len(delta) - size) < length {
+                return nil, fmt.Errorf("invalid rewind delta literal")
+            }
+            delta = delta[size:]
+            out = append(out, delta[:length]...)
+            delta = delta[length:]
+        } else {
+            if value > uint64(len(keyframe.chunks)) {
+                return nil, fmt.Errorf("invalid rewind keyframe chunk %v", value - 1)
+            }
+            out = append(out, keyframe.chunks[value - 1]...)
+        }
+    }
+
+    return out, nil
+}
+
+/* find the keyframe that the snapshot at the given position depends on, and decode it if needed */
+func (rewind *RewindBuffer) keyframeFor(position int) (*rewindKeyframe, error) {
+    for i := position; i >= 0; i-- {
+        snapshot := rewind.snapshots[i]
+        if snapshot.keyframe {
+            if rewind.keyframe != nil && rewind.keyframe.id == snapshot.id {
+                return rewind.keyframe, nil
+            }
+
+            data, err := decompressRewind(snapshot.data)
+            if err != nil {
+                return nil, err
+            }
+            rewind.keyframe = makeRewindKeyframe(snapshot.id, splitRewindChunks(data, snapshot.marks))
+            return rewind.keyframe, nil
+        }
+    }
+
+    return nil, fmt.Errorf("no keyframe for rewind snapshot")
+}
+
+/* remove the oldest keyframe along with all the deltas that depend on it */
+func (rewind *RewindBuffer) evict() {
+    end := 1
+    for end < len(rewind.snapshots) && !rewind.snapshots[end].keyframe {
+        end += 1
+    }
+
+    for _, snapshot := range rewind.snapshots[:end] {
+        rewind.memory -= len(snapshot.data)
+    }
+
+    rewind.snapshots = rewind.snapshots[end:]
+}
+
+/* index of the most recent keyframe, or -1 if there are no snapshots */
+func (rewind *RewindBuffer) lastKeyframe() int {
+    for i := len(rewind.snapshots) - 1; i >= 0; i-- {
+        if rewind.snapshots[i].keyframe {
+            return i
+        }
+    }
+
+    return -1
+}
+
+/* store the current state of the cpu */
+func (rewind *RewindBuffer) Snapshot(cpu *CPUState) error {
+    writer, err := encodeBinaryState(cpu)
+    if err != nil {
+        return err
+    }
+    data := writer.Data()
+    chunks := splitRewindChunks(data, writer.marks)
+
+    snapshot := rewindSnapshot{
+        id: rewind.nextId,
+    }
+    rewind.nextId += 1
+
+    last := rewind.lastKeyframe()
+    if last == -1 || len(rewind.snapshots) - last >= RewindKeyframeInterval {
+        snapshot.keyframe = true
+        snapshot.marks = writer.marks
+        snapshot.data, err = compressRewind(data)
+        if err != nil {
+            return err
+        }
+        rewind.keyframe = makeRewindKeyframe(snapshot.id, chunks)
+    } else {
+        keyframe, err := rewind.keyframeFor(len(rewind.snapshots) - 1)
+        if err != nil {
+            return err
+        }
+        snapshot.data, err = compressRewind(encodeRewindDelta(keyframe, chunks))
+        if err != nil {
+            return err
+        }
+    }
+
+    rewind.snapshots = append(rewind.snapshots, snapshot)
+    rewind.memory += len(snapshot.data)
+
+    /* snapshots are removed a keyframe at a time, but the newest keyframe is always kept */
+    for rewind.memory > rewind.MaxMemory && rewind.lastKeyframe() > 0 {
+        rewind.evict()
+    }
+
+    return nil
+}
+
+/* restore the most recent snapshot and remove it from the buffer. returns false if there
+ * was nothing to rewind to
+ */
+func (rewind *RewindBuffer) Rewind(cpu *CPUState) (bool, error) {
+    if len(rewind.snapshots) == 0 {
+        return false, nil
+    }
+
+    last := len(rewind.snapshots) - 1
+    snapshot := rewind.snapshots[last]
+
+    data, err := decompressRewind(snapshot.data)
+    if err != nil {
+        return false, err
+    }
+
+    if !snapshot.keyframe {
+        keyframe, err := rewind.keyframeFor(last)
+        if err != nil {
+            return false, err
+        }
+        data, err = decodeRewindDelta(keyframe, data)
+        if err != nil {
+            return false, err
+        }
+    }
+
+    state, err := DecodeBinaryState(data)
+    if err != nil {
+        return false, err
+    }
+
+    rewind.snapshots = rewind.snapshots[:last]
+    rewind.memory -= len(snapshot.data)
+    rewind.frames = 0
+
+    cpu.Load(state)
+
+    return true, nil
+}
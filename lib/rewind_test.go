@@ -0,0 +1,101 @@
+package lib
+
+import (
+    "testing"
+)
+
+/* a 16k mapper0 rom that keeps incrementing address 0x10 */
+func makeCounterMachine() (*Machine, *CPUState) {
+    rom := make([]byte, 0x4000)
+    copy(rom, []byte{
+        0xe6, 0x10, // inc $10
+        0x4c, 0x00, 0x80, // jmp $8000
+    })
+    rom[0x3ffc] = 0x00
+    rom[0x3ffd] = 0x80
+
+    cpu := StartupState()
+    cpu.SetMapper(MakeMapper0(rom))
+    cpu.Reset()
+
+    return MakeMachine(&cpu, 44100), &cpu
+}
+
+func TestRewind(test *testing.T){
+    machine, cpu := makeCounterMachine()
+
+    rewind := MakeRewindBuffer(1 << 30, 1)
+
+    var cycles []uint64
+    var counters []byte
+    /* enough frames to go past a keyframe */
+    for range RewindKeyframeInterval + 10 {
+        err := machine.StepFrame()
+        if err != nil {
+            test.Fatalf("could not run frame: %v", err)
+        }
+
+        err = rewind.Frame(cpu)
+        if err != nil {
+            test.Fatalf("could not take snapshot: %v", err)
+        }
+
+        cycles = append(cycles, cpu.Cycle)
+        counters = append(counters, cpu.LoadMemory(0x10))
+    }
+
+    if rewind.Len() != len(cycles) {
+        test.Fatalf("expected %v snapshots but have %v", len(cycles), rewind.Len())
+    }
+
+    for i := len(cycles) - 1; i >= 0; i-- {
+        ok, err := rewind.Rewind(cpu)
+        if err != nil {
+            test.Fatalf("could not rewind: %v", err)
+        }
+        if !ok {
+            test.Fatalf("ran out of snapshots at %v", i)
+        }
+
+        if cpu.Cycle != cycles[i] || cpu.LoadMemory(0x10) != counters[i] {
+            test.Fatalf("snapshot %v: expected cycle %v counter %v but got cycle %v counter %v", i, cycles[i], counters[i], cpu.Cycle, cpu.LoadMemory(0x10))
+        }
+    }
+
+    ok, _ := rewind.Rewind(cpu)
+    if ok {
+        test.Fatalf("rewind should be empty")
+    }
+}
+
+func TestRewindMemory(test *testing.T){
+    machine, cpu := makeCounterMachine()
+
+    /* room for about one keyframe worth of snapshots */
+    rewind := MakeRewindBuffer(1, 1)
+    for range RewindKeyframeInterval * 2 {
+        err := machine.StepFrame()
+        if err != nil {
+            test.Fatalf("could not run frame: %v", err)
+        }
+        rewind.Frame(cpu)
+    }
+
+    /* everything but the newest keyframe group should have been thrown away */
+    if rewind.Len() > RewindKeyframeInterval {
+        test.Fatalf("expected at most %v snapshots but have %v", RewindKeyframeInterval, rewind.Len())
+    }
+
+    limit := rewind.Memory()
+    rewind = MakeRewindBuffer(limit * 2, 1)
+    for range RewindKeyframeInterval * 6 {
+        err := machine.StepFrame()
+        if err != nil {
+            test.Fatalf("could not run frame: %v", err)
+        }
+        rewind.Frame(cpu)
+        if rewind.Memory() > limit * 2 {
+            test.Fatalf("rewind is using %v bytes but the limit is %v", rewind.Memory(), limit * 2)
+        }
+    }
+}
@@ -0,0 +1,259 @@
+package lib
+
+import (
+    "crypto/sha1"
+    "encoding/json"
+    "encoding/xml"
+    "fmt"
+    "hash/crc32"
+    "io"
+    "path"
+    "strconv"
+    "strings"
+)
+
+/* A database of known roms, used to fix dumps whose ines header has the wrong mapper,
+ * mirroring, region or battery flag, and to give roms a proper title. Roms are matched by
+ * the crc32 or sha1 of their prg rom followed by their chr rom, which is the same as hashing
+ * the file without its header and trainer.
+ *
+ * The database is a json list of RomInfo. Fields that are left out keep the value from the header.
+ */
+
+type RomInfo struct {
+    Title string `json:"title"`
+    /* hex encoded hashes of the prg and chr rom. at least one of them must be given */
+    CRC32 string `json:"crc32,omitempty"`
+    SHA1 string `json:"sha1,omitempty"`
+
+    Mapper *uint32 `json:"mapper,omitempty"`
+    Submapper *byte `json:"submapper,omitempty"`
+    /* horizontal, vertical or four-screen */
+    Mirroring string `json:"mirroring,omitempty"`
+    /* NTSC, PAL or Dendy */
+    Region string `json:"region,omitempty"`
+    Battery *bool `json:"battery,omitempty"`
+}
+
+type RomDatabase struct {
+    byCRC32 map[uint32]*RomInfo
+    bySHA1 map[string]*RomInfo
+}
+
+func MakeRomDatabase() *RomDatabase {
+    return &RomDatabase{
+        byCRC32: make(map[uint32]*RomInfo),
+        bySHA1: make(map[string]*RomInfo),
+    }
+}
+
+func (info *RomInfo) validate() error {
+    switch info.Mirroring {
+        case "", "horizontal", "vertical", "four-screen":
+        default:
+            return fmt.Errorf("unknown mirroring '%v'", info.Mirroring)
+    }
+
+    if info.Region != "" {
+        _, err := ParseRegion(info.Region)
+        if err != nil {
+            return err
+        }
+    }
+
+    if info.CRC32 == "" && info.SHA1 == "" {
+        return fmt.Errorf("no crc32 or sha1")
+    }
+
+    return nil
+}
+
+func (database *RomDatabase) Add(info *RomInfo) error {
+    err := info.validate()
+    if err != nil {
+        return fmt.Errorf("invalid rom '%v': %v", info.Title, err)
+    }
+
+    if info.CRC32 != "" {
+        crc, err := strconv.ParseUint(info.CRC32, 16, 32)
+        if err != nil {
+            return fmt.Errorf("invalid crc32 for rom '%v': %v", info.Title, err)
+        }
+        database.byCRC32[uint32(crc)] = info
+    }
+
+    if info.SHA1 != "" {
+        database.bySHA1[strings.ToLower(info.SHA1)] = info
+    }
+
+    return nil
+}
+
+func (database *RomDatabase) Size() int {
+    return max(len(database.byCRC32), len(database.bySHA1))
+}
+
+func LoadRomDatabase(reader io.Reader) (*RomDatabase, error) {
+    var roms []*RomInfo
+    err := json.NewDecoder(reader).Decode(&roms)
+    if err != nil {
+        return nil, err
+    }
+
+    database := MakeRomDatabase()
+    for _, info := range roms {
+        err = database.Add(info)
+        if err != nil {
+            return nil, err
+        }
+    }
+
+    return database, nil
+}
+
+/* the hashes that the database uses to identify a rom */
+func RomHashes(file *NESFile) (uint32, string) {
+    crc := crc32.NewIEEE()
+    crc.Write(file.ProgramRom)
+    crc.Write(file.CharacterRom)
+
+    sha := sha1.New()
+    sha.Write(file.ProgramRom)
+    sha.Write(file.CharacterRom)
+
+    return crc.Sum32(), fmt.Sprintf("%x", sha.Sum(nil))
+}
+
+func (database *RomDatabase) Lookup(file *NESFile) (*RomInfo, bool) {
+    crc, sha := RomHashes(file)
+
+    info, ok := database.byCRC32[crc]
+    if ok {
+        return info, true
+    }
+
+    info, ok = database.bySHA1[sha]
+    return info, ok
+}
+
+/* overwrite the parts of the header that the database knows about */
+func (info *RomInfo) Apply(file *NESFile){
+    file.Title = info.Title
+
+    if info.Mapper != nil {
+        file.Mapper = *info.Mapper
+    }
+
+    if info.Submapper != nil {
+        file.Submapper = *info.Submapper
+    }
+
+    switch info.Mirroring {
+        case "horizontal":
+            file.HorizontalMirror = true
+            file.VerticalMirror = false
+            file.FourScreen = false
+        case "vertical":
+            file.HorizontalMirror = false
+            file.VerticalMirror = true
+            file.FourScreen = false
+        case "four-screen":
+            file.FourScreen = true
+    }
+
+    if info.Region != "" {
+        /* already checked by validate */
+        file.Region, _ = ParseRegion(info.Region)
+        file.HasRegion = true
+    }
+
+    if info.Battery != nil && *info.Battery != file.Battery {
+        file.Battery = *info.Battery
+        /* ines headers don't have ram sizes, so move the default 8k to or from the battery backed ram */
+        if !file.Nes2 {
+            file.PRGRamSize, file.PRGNVRamSize = file.PRGNVRamSize, file.PRGRamSize
+        }
+    }
+}
+
+/* look up the rom and fix its header. returns false if the rom isn't in the database */
+func (database *RomDatabase) Apply(file *NESFile) bool {
+    info, ok := database.Lookup(file)
+    if ok {
+        info.Apply(file)
+    }
+    return ok
+}
+
+/* one game in the nes 2.0 header database, nes20db.xml. the comment before each game is the
+ * path of the rom it was made from
+ */
+type nes20Game struct {
+    Comment string `xml:",comment"`
+    Rom struct {
+        CRC32 string `xml:"crc32,attr"`
+        SHA1 string `xml:"sha1,attr"`
+    } `xml:"rom"`
+    PCB struct {
+        Mapper uint32 `xml:"mapper,attr"`
+        Submapper byte `xml:"submapper,attr"`
+        Mirroring string `xml:"mirroring,attr"`
+        Battery int `xml:"battery,attr"`
+    } `xml:"pcb"`
+    Console struct {
+        Region int `xml:"region,attr"`
+    } `xml:"console"`
+}
+
+/* Convert the nes 2.0 header database into rom database entries. Mirroring that the mapper
+ * controls and roms that run in every region are left to the header.
+ *   https://forums.nesdev.org/viewtopic.php?t=19940
+ */
+func ReadNes20Database(reader io.Reader) ([]*RomInfo, error) {
+    var database struct {
+        Games []nes20Game `xml:"game"`
+    }
+
+    err := xml.NewDecoder(reader).Decode(&database)
+    if err != nil {
+        return nil, err
+    }
+
+    var out []*RomInfo
+    for _, game := range database.Games {
+        /* the comment uses windows path separators */
+        name := path.Base(strings.ReplaceAll(strings.TrimSpace(game.Comment), "\\", "/"))
+
+        info := &RomInfo{
+            Title: strings.TrimSuffix(name, path.Ext(name)),
+            CRC32: strings.ToLower(game.Rom.CRC32),
+            SHA1: strings.ToLower(game.Rom.SHA1),
+            Mapper: &game.PCB.Mapper,
+            Submapper: &game.PCB.Submapper,
+        }
+
+        switch game.PCB.Mirroring {
+            case "H": info.Mirroring = "horizontal"
+            case "V": info.Mirroring = "vertical"
+            case "4": info.Mirroring = "four-screen"
+        }
+
+        switch game.Console.Region {
+            case 0: info.Region = RegionNTSC.String()
+            case 1: info.Region = RegionPAL.String()
+            case 3: info.Region = RegionDendy.String()
+        }
+
+        battery := game.PCB.Battery == 1
+        info.Battery = &battery
+
+        err = info.validate()
+        if err != nil {
+            return nil, fmt.Errorf("invalid game '%v': %v", info.Title, err)
+        }
+
+        out = append(out, info)
+    }
+
+    return out, nil
+}
@@ -0,0 +1,144 @@
+package lib
+
+import (
+    "os"
+    "strings"
+    "testing"
+)
+
+func TestRomDatabaseApply(test *testing.T){
+    file := NESFile{
+        ProgramRom: make([]byte, 0x4000),
+        CharacterRom: make([]byte, 0x2000),
+        Mapper: 1,
+        VerticalMirror: true,
+        PRGRamSize: 0x2000,
+    }
+    file.ProgramRom[0] = 0x4c
+
+    crc, sha := RomHashes(&file)
+
+    database, err := LoadRomDatabase(strings.NewReader(`[
+        {"title": "Test Game", "sha1": "` + strings.ToUpper(sha) + `", "mapper": 2, "mirroring": "horizontal", "region": "pal", "battery": true}
+    ]`))
+    if err != nil {
+        test.Fatalf("could not load database: %v", err)
+    }
+
+    if !database.Apply(&file) {
+        test.Fatalf("rom with crc32 %08x was not found", crc)
+    }
+
+    if file.Title != "Test Game" || file.Mapper != 2 {
+        test.Fatalf("expected mapper 2 'Test Game' but got mapper %v '%v'", file.Mapper, file.Title)
+    }
+
+    if !file.HorizontalMirror || file.VerticalMirror {
+        test.Fatalf("expected horizontal mirroring")
+    }
+
+    if !file.HasRegion || file.Region != RegionPAL {
+        test.Fatalf("expected pal but got %v", file.Region)
+    }
+
+    if !file.Battery || file.PRGRamSize != 0 || file.PRGNVRamSize != 0x2000 {
+        test.Fatalf("expected battery backed prg ram: battery %v ram %v nvram %v", file.Battery, file.PRGRamSize, file.PRGNVRamSize)
+    }
+
+    other := NESFile{ProgramRom: make([]byte, 0x4000)}
+    if database.Apply(&other) {
+        test.Fatalf("found a rom that is not in the database")
+    }
+
+    _, err = LoadRomDatabase(strings.NewReader(`[{"title": "Bad", "crc32": "1234", "mirroring": "diagonal"}]`))
+    if err == nil {
+        test.Fatalf("expected an error for an unknown mirroring")
+    }
+}
+
+/* the database that is embedded in the emulator fixes a real rom whose header is wrong */
+func TestRomDatabaseBundled(test *testing.T){
+    file, err := os.Open("../data/data/romdb.json")
+    if err != nil {
+        test.Fatalf("could not open the rom database: %v", err)
+    }
+    defer file.Close()
+
+    database, err := LoadRomDatabase(file)
+    if err != nil {
+        test.Fatalf("could not load the rom database: %v", err)
+    }
+
+    nesFile, err := ParseNesFile("../test-roms/nestest.nes", false)
+    if err != nil {
+        test.Fatalf("could not load nestest: %v", err)
+    }
+
+    /* a bad dump of nestest */
+    nesFile.Mapper = 4
+    nesFile.HorizontalMirror = false
+    nesFile.VerticalMirror = true
+
+    if !database.Apply(&nesFile) {
+        test.Fatalf("nestest is not in the rom database")
+    }
+
+    if nesFile.Title != "nestest" || nesFile.Mapper != 0 || !nesFile.HorizontalMirror || nesFile.VerticalMirror {
+        test.Fatalf("the database did not fix nestest: '%v' mapper %v horizontal %v", nesFile.Title, nesFile.Mapper, nesFile.HorizontalMirror)
+    }
+}
+
+func TestReadNes20Database(test *testing.T){
+    entries, err := ReadNes20Database(strings.NewReader(`<?xml version="1.0" encoding="UTF-8"?>
+<nes20db date="2024-01-01">
+    <game>
+        <!-- Test\nestest.nes -->
+        <prgrom size="16384" crc32="9E179D92"/>
+        <chrrom size="8192" crc32="FC8A4C8E"/>
+        <rom size="24576" crc32="158B0388" sha1="4131307F0F69F2A5C54B7D438328C5B2A5ED0820"/>
+        <pcb mapper="0" submapper="0" mirroring="H" battery="0"/>
+        <console type="0" region="0"/>
+    </game>
+    <game>
+        <!-- Licensed\Some Game (Europe).nes -->
+        <rom size="131072" crc32="12345678"/>
+        <pcb mapper="1" submapper="0" mirroring="" battery="1"/>
+        <console type="0" region="1"/>
+    </game>
+</nes20db>`))
+    if err != nil {
+        test.Fatalf("could not read the nes 2.0 database: %v", err)
+    }
+
+    if len(entries) != 2 {
+        test.Fatalf("expected 2 games but got %v", len(entries))
+    }
+
+    nestest := entries[0]
+    if nestest.Title != "nestest" || nestest.CRC32 != "158b0388" || *nestest.Mapper != 0 || nestest.Mirroring != "horizontal" || nestest.Region != "NTSC" || *nestest.Battery {
+        test.Fatalf("wrong nestest entry: %+v", nestest)
+    }
+
+    other := entries[1]
+    if other.Title != "Some Game (Europe)" || *other.Mapper != 1 || other.Mirroring != "" || other.Region != "PAL" || !*other.Battery {
+        test.Fatalf("wrong entry: %+v", other)
+    }
+
+    database := MakeRomDatabase()
+    for _, entry := range entries {
+        err = database.Add(entry)
+        if err != nil {
+            test.Fatalf("could not add %v: %v", entry.Title, err)
+        }
+    }
+
+    nesFile, err := ParseNesFile("../test-roms/nestest.nes", false)
+    if err != nil {
+        test.Fatalf("could not load nestest: %v", err)
+    }
+
+    info, ok := database.Lookup(&nesFile)
+    if !ok || info.Title != "nestest" {
+        test.Fatalf("nestest was not found by its hash")
+    }
+}
@@ -0,0 +1,113 @@
+package lib
+
+import (
+    "bytes"
+    "encoding/json"
+    "fmt"
+)
+
+/* Version of the serialized CPUState. When a change to the cpu, ppu, apu or a mapper
+ * would cause older states to load incorrectly (a field is renamed or moved, or a new field
+ * needs a value other than its zero value), bump the version and add a migration from the
+ * previous version to stateMigrations. Older states are upgraded one version at a time
+ * until they reach the current version.
+ */
+const StateVersion = 2
+
+/* upgrades a state by one version. the state is the generic json form of a CPUState, so
+ * fields can be renamed or given defaults without the old go types
+ */
+type stateMigration func(state map[string]any) error
+
+/* the migration for version n upgrades a state from version n to n+1 */
+var stateMigrations = map[int]stateMigration{
+    1: migrateState1,
+}
+
+func getJsonObject(object map[string]any, name string) (map[string]any, error) {
+    value, ok := object[name]
+    if !ok {
+        return nil, fmt.Errorf("missing field '%v'", name)
+    }
+
+    out, ok := value.(map[string]any)
+    if !ok {
+        return nil, fmt.Errorf("field '%v' is not an object", name)
+    }
+
+    return out, nil
+}
+
+/* mapper9 used to always draw the $fe bank at $0000 and the $fd bank at $1000. it now has
+ * latches that pick the bank, so start them where the old states were
+ */
+func migrateState1(state map[string]any) error {
+    mapper, err := getJsonObject(state, "mapper")
+    if err != nil {
+        return err
+    }
+
+    kind, ok := mapper["kind"].(json.Number)
+    if !ok || kind.String() != "9" {
+        return nil
+    }
+
+    mapper9, err := getJsonObject(mapper, "mapper")
+    if err != nil {
+        return err
+    }
+
+    mapper9["latch"] = []any{true, false}
+
+    return nil
+}
+
+/* upgrade a serialized cpu state from the given version to StateVersion */
+func MigrateState(version int, data []byte) ([]byte, error) {
+    if version == StateVersion {
+        return data, nil
+    }
+
+    if version > StateVersion {
+        return nil, fmt.Errorf("state version %v is newer than the supported version %v", version, StateVersion)
+    }
+
+    var state map[string]any
+    /* keep numbers as they are so large values like the cycle count don't lose precision */
+    decoder := json.NewDecoder(bytes.NewReader(data))
+    decoder.UseNumber()
+    err := decoder.Decode(&state)
+    if err != nil {
+        return nil, err
+    }
+
+    for ; version < StateVersion; version++ {
+        migration, ok := stateMigrations[version]
+        if !ok {
+            return nil, fmt.Errorf("no migration for state version %v", version)
+        }
+
+        err = migration(state)
+        if err != nil {
+            return nil, fmt.Errorf("could not migrate state from version %v: %v", version, err)
+        }
+    }
+
+    return json.Marshal(state)
+}
+
+/* decode a cpu state that was serialized with the given version */
+func DecodeState(version int, data []byte) (*CPUState, error) {
+    data, err := MigrateState(version, data)
+    if err != nil {
+        return nil, err
+    }
+
+    var state CPUState
+    err = json.Unmarshal(data, &state)
+    if err != nil {
+        return nil, err
+    }
+
+    return &state, nil
+}
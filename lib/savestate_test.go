@@ -0,0 +1,321 @@
+package lib
+
+import (
+    "bytes"
+    "compress/gzip"
+    "encoding/json"
+    "os"
+    "slices"
+    "testing"
+)
+
+/* a rom made of identical 8k pages, so the code is the same no matter how the mapper
+ * banks the prg rom. the program turns on rendering and nmi, then keeps writing a counter
+ * to the given mapper registers and reading back a byte that is different in every page
+ */
+func makeMapperTestRom(size int, registers []uint16) []byte {
+    code := []byte{
+        0xa9, 0x80, // lda #$80
+        0x8d, 0x00, 0x20, // sta $2000
+        0xa9, 0x1e, // lda #$1e
+        0x8d, 0x01, 0x20, // sta $2001
+    }
+
+    loop := 0xe000 + len(code)
+    code = append(code,
+        0xe6, 0x10, // inc $10
+        0xa5, 0x10, // lda $10
+        0x29, 0x03, // and #$03
+    )
+
+    for _, register := range registers {
+        code = append(code, 0x8d, byte(register & 0xff), byte(register >> 8)) // sta register
+    }
+
+    code = append(code,
+        0xad, 0x00, 0x90, // lda $9000
+        0x85, 0x11, // sta $11
+        0x4c, byte(loop & 0xff), byte(loop >> 8), // jmp loop
+    )
+
+    interrupt := 0xe000 + len(code)
+    code = append(code, 0x40) // rti
+
+    page := make([]byte, 0x2000)
+    copy(page, code)
+
+    /* nmi, reset and irq vectors */
+    copy(page[0x1ffa:], []byte{
+        byte(interrupt & 0xff), byte(interrupt >> 8),
+        0x00, 0xe0,
+        byte(interrupt & 0xff), byte(interrupt >> 8),
+    })
+
+    var out []byte
+    for i := 0; len(out) < size; i++ {
+        page[0x1000] = byte(i)
+        out = append(out, page...)
+    }
+
+    return out
+}
+
+func makeMapperTestChr(size int) []byte {
+    out := make([]byte, size)
+    for i := range out {
+        out[i] = byte(i * 7)
+    }
+    return out
+}
+
+/* the bank switching registers of each mapper */
+var mapperTestRegisters = map[uint32][]uint16{
+    0: nil,
+    1: []uint16{0x8000, 0xa000, 0xc000, 0xe000},
+    2: []uint16{0x8000},
+    3: []uint16{0x8000},
+    4: []uint16{0x8000, 0x8001, 0xa000, 0xc000, 0xc001, 0xe001},
+    5: []uint16{0x5100, 0x5101, 0x5104, 0x5105, 0x5114, 0x5115, 0x5117, 0x5120, 0x5128, 0x5203, 0x5205, 0x5015},
+    7: []uint16{0x8000},
+    9: []uint16{0xa000, 0xb000, 0xc000, 0xd000, 0xe000, 0xf000},
+    19: []uint16{0x4800, 0x5000, 0x5800, 0x8000, 0x9800, 0xc000, 0xe000, 0xe800, 0xf000, 0xf800},
+    21: []uint16{0x8000, 0x9000, 0x9004, 0xa000, 0xb000, 0xb004, 0xc000, 0xf000, 0xf002, 0xf004},
+    22: []uint16{0x8000, 0x9000, 0xa000, 0xb000, 0xb001, 0xc000, 0xe002},
+    23: []uint16{0x8000, 0x9000, 0x9002, 0xa000, 0xb000, 0xb001, 0xd002, 0xf000, 0xf002, 0xf003},
+    25: []uint16{0x8000, 0x9000, 0x9001, 0xa000, 0xb000, 0xb002, 0xd001, 0xf000, 0xf001, 0xf002},
+    24: []uint16{0x8000, 0x9000, 0x9002, 0xb003, 0xc000, 0xd000, 0xe003, 0xf000, 0xf001},
+    85: []uint16{0x8000, 0x8010, 0x9000, 0x9010, 0x9030, 0xa000, 0xb010, 0xe000, 0xe010, 0xf000, 0xf010},
+    26: []uint16{0x8000, 0x9000, 0x9001, 0xb003, 0xc000, 0xd000, 0xe003, 0xf000, 0xf002},
+    69: []uint16{0x8000, 0xa000, 0xc000, 0xe000},
+    11: []uint16{0x8000},
+    34: []uint16{0x7ffd, 0x7ffe, 0x7fff, 0x8000},
+    66: []uint16{0x8000},
+    71: []uint16{0x9000, 0xc000},
+    79: []uint16{0x4100},
+    99: []uint16{0x6000, 0x7ff0},
+    206: []uint16{0x8000, 0x8001},
+    232: []uint16{0x8000, 0xc000},
+    20: []uint16{0x4023, 0x4020, 0x4021, 0x4022, 0x4025, 0x4080, 0x4082, 0x4083, 0x4089},
+}
+
+func makeMapperTestCpu(test *testing.T, kind uint32) CPUState {
+    programSize := 0x20000
+    characterSize := 0x20000
+    switch kind {
+        case 0, 3, 99:
+            programSize = 0x8000
+    }
+
+    program := makeMapperTestRom(programSize, mapperTestRegisters[kind])
+    character := makeMapperTestChr(characterSize)
+
+    mapper, err := MakeMapper(MapperInfo{Mapper: kind}, program, character)
+    /* the program runs from the bios */
+    if kind == 20 {
+        mapper, err = MakeMapperFDS(program[:0x2000], [][]byte{makeTestDiskSide()})
+    }
+    if err != nil {
+        test.Fatalf("could not make mapper %v: %v", kind, err)
+    }
+
+    cpu := StartupState()
+    cpu.SetMapper(mapper)
+    cpu.PPU.CopyCharacterRom(0, character[:0x2000])
+    cpu.Reset()
+    return cpu
+}
+
+func stepFrames(test *testing.T, machine *Machine, frames int) {
+    for range frames {
+        err := machine.StepFrame()
+        if err != nil {
+            test.Fatalf("could not run frame: %v", err)
+        }
+    }
+}
+
+type stateFormat struct {
+    Name string
+    Save func(*CPUState) ([]byte, error)
+    Load func([]byte) (*CPUState, error)
+}
+
+var stateFormats = []stateFormat{
+    stateFormat{
+        Name: "json",
+        Save: func(cpu *CPUState) ([]byte, error) {
+            return json.Marshal(cpu)
+        },
+        Load: func(data []byte) (*CPUState, error) {
+            return DecodeState(StateVersion, data)
+        },
+    },
+    stateFormat{
+        Name: "binary",
+        Save: EncodeBinaryState,
+        Load: DecodeBinaryState,
+    },
+}
+
+func TestSaveStateRoundTrip(test *testing.T){
+    for _, format := range stateFormats {
+        for kind := range mapperTestRegisters {
+            cpu := makeMapperTestCpu(test, kind)
+            machine := MakeMachine(&cpu, 44100)
+            stepFrames(test, machine, 5)
+
+            saved, err := format.Save(&cpu)
+            if err != nil {
+                test.Fatalf("%v mapper %v: could not serialize state: %v", format.Name, kind, err)
+            }
+
+            stepFrames(test, machine, 5)
+
+            loaded, err := format.Load(saved)
+            if err != nil {
+                test.Fatalf("%v mapper %v: could not load state: %v", format.Name, kind, err)
+            }
+
+            other := StartupState()
+            other.Load(loaded)
+            otherMachine := MakeMachine(&other, 44100)
+            stepFrames(test, otherMachine, 5)
+
+            if !cpu.Equals(other) {
+                test.Fatalf("%v mapper %v: registers differ after loading: %v vs %v", format.Name, kind, cpu.String(), other.String())
+            }
+
+            /* not every mapper implements Compare, so compare everything that gets serialized */
+            state1, _ := json.Marshal(&cpu)
+            state2, _ := json.Marshal(&other)
+            if !bytes.Equal(state1, state2) {
+                test.Fatalf("%v mapper %v: state differs after loading", format.Name, kind)
+            }
+
+            if !slices.Equal(machine.Screen.Buffer, otherMachine.Screen.Buffer) {
+                test.Fatalf("%v mapper %v: screen differs after loading", format.Name, kind)
+            }
+        }
+    }
+}
+
+func TestBinaryStateErrors(test *testing.T){
+    cpu := makeMapperTestCpu(test, 4)
+
+    data, err := EncodeBinaryState(&cpu)
+    if err != nil {
+        test.Fatalf("could not encode state: %v", err)
+    }
+
+    _, err = DecodeBinaryState(data[:len(data) - 1])
+    if err == nil {
+        test.Fatalf("should not be able to load a truncated state")
+    }
+
+    _, err = DecodeBinaryState(append(bytes.Clone(data), 0))
+    if err == nil {
+        test.Fatalf("should not be able to load a state with extra data")
+    }
+
+    newer := bytes.Clone(data)
+    newer[len(binaryStateMagic)] = BinaryStateVersion + 1
+    _, err = DecodeBinaryState(newer)
+    if err == nil {
+        test.Fatalf("should not be able to load a state from a newer version")
+    }
+}
+
+/* a version 1 state, saved by the emulator before mapper9 had latches */
+func loadOldState(test *testing.T, path string) (int, []byte) {
+    file, err := os.Open(path)
+    if err != nil {
+        test.Fatalf("could not open %v: %v", path, err)
+    }
+    defer file.Close()
+
+    decompress, err := gzip.NewReader(file)
+    if err != nil {
+        test.Fatalf("could not decompress %v: %v", path, err)
+    }
+
+    var saved struct {
+        State json.RawMessage `json:"state"`
+        Version int `json:"version"`
+    }
+    err = json.NewDecoder(decompress).Decode(&saved)
+    if err != nil {
+        test.Fatalf("could not decode %v: %v", path, err)
+    }
+
+    return saved.Version, saved.State
+}
+
+func TestSaveStateMigration(test *testing.T){
+    version, data := loadOldState(test, "testdata/state-1-mapper9.json.gz")
+    if version != 1 {
+        test.Fatalf("expected a version 1 state but got %v", version)
+    }
+
+    _, err := DecodeState(StateVersion + 1, data)
+    if err == nil {
+        test.Fatalf("should not be able to load a state from a newer version")
+    }
+
+    loaded, err := DecodeState(version, data)
+    if err != nil {
+        test.Fatalf("could not migrate state: %v", err)
+    }
+
+    if loaded.Cycle == 0 {
+        test.Fatalf("cycle was not loaded")
+    }
+
+    mapper, ok := loaded.Mapper.Mapper.(*Mapper9)
+    if !ok {
+        test.Fatalf("expected mapper9 but got %T", loaded.Mapper.Mapper)
+    }
+
+    if mapper.ChrRegister != [4]byte{3, 5, 7, 9} {
+        test.Fatalf("chr registers were not loaded: %v", mapper.ChrRegister)
+    }
+
+    /* the old state drew chr bank 5 at $0000 and bank 7 at $1000, and each byte of the chr
+     * rom is its 4k bank number
+     */
+    if low, high := mapper.ReadPPU(&loaded.PPU, 0x0000), mapper.ReadPPU(&loaded.PPU, 0x1000); low != 5 || high != 7 {
+        test.Fatalf("expected chr banks 5 and 7 after migrating but got %v and %v", low, high)
+    }
+}
+
+func benchmarkState(bench *testing.B, format stateFormat){
+    cpu := StartupState()
+    cpu.SetMapper(MakeMapper4(MapperInfo{Mapper: 4}, makeMapperTestRom(0x40000, nil), makeMapperTestChr(0x20000)))
+    cpu.Reset()
+
+    data, err := format.Save(&cpu)
+    if err != nil {
+        bench.Fatalf("could not save state: %v", err)
+    }
+
+    bench.Run("save", func(bench *testing.B){
+        bench.SetBytes(int64(len(data)))
+        for bench.Loop() {
+            format.Save(&cpu)
+        }
+    })
+
+    bench.Run("load", func(bench *testing.B){
+        bench.SetBytes(int64(len(data)))
+        for bench.Loop() {
+            format.Load(data)
+        }
+    })
+}
+
+func BenchmarkStateJSON(bench *testing.B){
+    benchmarkState(bench, stateFormats[0])
+}
+
+func BenchmarkStateBinary(bench *testing.B){
+    benchmarkState(bench, stateFormats[1])
+}
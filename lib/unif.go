@@ -0,0 +1,284 @@
+package lib
+
+import (
+    "bytes"
+    "encoding/binary"
+    "fmt"
+    "io"
+    "path/filepath"
+    "strings"
+)
+
+/* UNIF, a chunk based format that names the board instead of using a mapper number.
+ * https://www.nesdev.org/wiki/UNIF
+ *
+ * The 32 byte header is "UNIF", a 4 byte revision and padding. Each chunk is a 4 byte id, a
+ * 4 byte little endian length and the data. The board comes from MAPR, and the rom is split
+ * over PRG0-PRGF and CHR0-CHRF, which are joined in order.
+ */
+
+var unifMagic = []byte("UNIF")
+
+const unifHeaderSize = 32
+
+type unifBoard struct {
+    Mapper uint32
+    Submapper byte
+}
+
+/* board names without their NES-, HVC-, UNL-, etc prefix. these are the licensed boards and the
+ * unlicensed ones that use a supported mapper. most BMC- multicart boards need mappers that
+ * aren't emulated, so they are left out.
+ */
+var unifBoards = map[string]unifBoard{
+    "NROM": {Mapper: 0},
+    "NROM-128": {Mapper: 0},
+    "NROM-256": {Mapper: 0},
+    "HROM": {Mapper: 0},
+    "RROM": {Mapper: 0},
+    "RROM-128": {Mapper: 0},
+    "SROM": {Mapper: 0},
+    "RTROM": {Mapper: 0},
+    "STROM": {Mapper: 0},
+
+    "SAROM": {Mapper: 1},
+    "SBROM": {Mapper: 1},
+    "SCROM": {Mapper: 1},
+    "SC1ROM": {Mapper: 1},
+    "SEROM": {Mapper: 1},
+    "SFROM": {Mapper: 1},
+    "SGROM": {Mapper: 1},
+    "SHROM": {Mapper: 1},
+    "SH1ROM": {Mapper: 1},
+    "SJROM": {Mapper: 1},
+    "SKROM": {Mapper: 1},
+    "SLROM": {Mapper: 1},
+    "SL1ROM": {Mapper: 1},
+    "SL2ROM": {Mapper: 1},
+    "SL3ROM": {Mapper: 1},
+    "SLRROM": {Mapper: 1},
+    "SNROM": {Mapper: 1},
+    "SOROM": {Mapper: 1},
+    "SUROM": {Mapper: 1},
+    "SXROM": {Mapper: 1},
+
+    "UNROM": {Mapper: 2},
+    "UOROM": {Mapper: 2},
+
+    "CNROM": {Mapper: 3},
+
+    "TBROM": {Mapper: 4},
+    "TEROM": {Mapper: 4},
+    "TFROM": {Mapper: 4},
+    "TGROM": {Mapper: 4},
+    "TKROM": {Mapper: 4},
+    "TLROM": {Mapper: 4},
+    "TL1ROM": {Mapper: 4},
+    "TR1ROM": {Mapper: 4},
+    "TSROM": {Mapper: 4},
+    "TVROM": {Mapper: 4},
+    "HKROM": {Mapper: 4},
+
+    "EKROM": {Mapper: 5},
+    "ELROM": {Mapper: 5},
+    "ETROM": {Mapper: 5},
+    "EWROM": {Mapper: 5},
+
+    "AMROM": {Mapper: 7},
+    "ANROM": {Mapper: 7},
+    "AN1ROM": {Mapper: 7},
+    "AOROM": {Mapper: 7},
+
+    "PNROM": {Mapper: 9},
+    "PEEOROM": {Mapper: 9},
+
+    "BNROM": {Mapper: 34, Submapper: 2},
+    "NINA-001": {Mapper: 34, Submapper: 1},
+
+    "GNROM": {Mapper: 66},
+    "MHROM": {Mapper: 66},
+
+    "BTR": {Mapper: 69},
+    "JLROM": {Mapper: 69},
+    "JSROM": {Mapper: 69},
+
+    "NINA-03": {Mapper: 79},
+    "NINA-06": {Mapper: 79},
+
+    "CAMERICA-BF9093": {Mapper: 71},
+    "CAMERICA-BF9097": {Mapper: 71, Submapper: 1},
+
+    "VRC7": {Mapper: 85},
+
+    "DEROM": {Mapper: 206},
+    "DE1ROM": {Mapper: 206},
+    "DRROM": {Mapper: 206},
+
+    "CAMERICA-BF9096": {Mapper: 232},
+    "CAMERICA-ALGQ": {Mapper: 232},
+}
+
+/* the prefixes say who made the board, but the same board can have any of them */
+var unifBoardPrefixes = []string{"NES-", "HVC-", "UNL-", "BTL-", "BMC-", "AVE-"}
+
+/* the mapper and submapper for a unif board name */
+func UnifBoardMapper(board string) (uint32, byte, bool) {
+    name := strings.ToUpper(strings.TrimSpace(board))
+    for _, prefix := range unifBoardPrefixes {
+        if strings.HasPrefix(name, prefix) {
+            name = name[len(prefix):]
+            break
+        }
+    }
+
+    info, ok := unifBoards[name]
+    return info.Mapper, info.Submapper, ok
+}
+
+func isUnif(header []byte) bool {
+    return bytes.HasPrefix(header, unifMagic)
+}
+
+func IsUNIFFile(path string) bool {
+    return hasRomHeader(path, isUnif)
+}
+
+/* the index of a PRGn or CHRn chunk, where n is a hex digit */
+func unifChunkIndex(id string, prefix string) (int, bool) {
+    if len(id) != 4 || !strings.HasPrefix(id, prefix) {
+        return 0, false
+    }
+
+    var index int
+    _, err := fmt.Sscanf(id[3:], "%X", &index)
+    return index, err == nil
+}
+
+/* header is the first 16 bytes of the file, which were already read */
+func parseUnif(header []byte, reader io.Reader, name string) (NESFile, error) {
+    /* the rest of the header is padding */
+    _, err := io.ReadFull(reader, make([]byte, unifHeaderSize - len(header)))
+    if err != nil {
+        return NESFile{}, fmt.Errorf("could not read unif header: %v", err)
+    }
+
+    var program [16][]byte
+    var character [16][]byte
+
+    file := NESFile{
+        /* like ines, hardwired horizontal mirroring unless MIRR says otherwise */
+        HorizontalMirror: true,
+        Console: ConsoleNES,
+        Path: name,
+    }
+
+    var board string
+
+    for {
+        var chunkHeader [8]byte
+        _, err := io.ReadFull(reader, chunkHeader[:])
+        if err == io.EOF {
+            break
+        }
+        if err != nil {
+            return NESFile{}, fmt.Errorf("could not read unif chunk: %v", err)
+        }
+
+        id := string(chunkHeader[0:4])
+        length := binary.LittleEndian.Uint32(chunkHeader[4:8])
+
+        /* don't trust the length enough to allocate it up front */
+        data, err := io.ReadAll(io.LimitReader(reader, int64(length)))
+        if err != nil {
+            return NESFile{}, err
+        }
+        if len(data) != int(length) {
+            return NESFile{}, fmt.Errorf("unif chunk %v is truncated, expected %v bytes but got %v", id, length, len(data))
+        }
+
+        if index, ok := unifChunkIndex(id, "PRG"); ok {
+            program[index] = data
+            continue
+        }
+
+        if index, ok := unifChunkIndex(id, "CHR"); ok {
+            character[index] = data
+            continue
+        }
+
+        switch id {
+            case "MAPR":
+                board = string(bytes.TrimRight(data, "\x00"))
+            case "MIRR":
+                if len(data) > 0 {
+                    /* 2 and 3 are single screen and 5 is controlled by the mapper, which
+                     * the mappers take care of
+                     */
+                    switch data[0] {
+                        case 0:
+                            file.HorizontalMirror = true
+                            file.VerticalMirror = false
+                        case 1:
+                            file.HorizontalMirror = false
+                            file.VerticalMirror = true
+                        case 4:
+                            file.FourScreen = true
+                    }
+                }
+            case "BATR":
+                file.Battery = true
+            case "TVCI":
+                if len(data) > 0 {
+                    switch data[0] {
+                        case 0, 2:
+                            file.Region = RegionNTSC
+                            file.HasRegion = true
+                        case 1:
+                            file.Region = RegionPAL
+                            file.HasRegion = true
+                    }
+                }
+        }
+    }
+
+    if board == "" {
+        return NESFile{}, fmt.Errorf("unif file has no MAPR chunk")
+    }
+
+    mapper, submapper, ok := UnifBoardMapper(board)
+    if !ok {
+        return NESFile{}, fmt.Errorf("unknown unif board '%v'", board)
+    }
+
+    file.Board = board
+    file.Mapper = mapper
+    file.Submapper = submapper
+
+    for _, data := range program {
+        file.ProgramRom = append(file.ProgramRom, data...)
+    }
+    for _, data := range character {
+        file.CharacterRom = append(file.CharacterRom, data...)
+    }
+
+    if len(file.ProgramRom) == 0 {
+        return NESFile{}, fmt.Errorf("unif file has no prg rom")
+    }
+
+    /* unif doesn't say how much ram there is, so assume the usual 8k like ines */
+    if file.Battery {
+        file.PRGNVRamSize = 0x2000
+    } else {
+        file.PRGRamSize = 0x2000
+    }
+
+    if len(file.CharacterRom) == 0 {
+        file.CHRRamSize = 0x2000
+    }
+
+    if !file.HasRegion {
+        file.Region, file.HasRegion = GuessRegionFromName(filepath.Base(name))
+    }
+
+    return file, nil
+}
@@ -0,0 +1,93 @@
+package lib
+
+import (
+    "bytes"
+    "encoding/binary"
+    "testing"
+)
+
+func makeUnifChunk(id string, data []byte) []byte {
+    var out []byte
+    out = append(out, id...)
+    out = binary.LittleEndian.AppendUint32(out, uint32(len(data)))
+    return append(out, data...)
+}
+
+func TestUnifParse(test *testing.T){
+    prg0 := bytes.Repeat([]byte{1}, 0x4000)
+    prg1 := bytes.Repeat([]byte{2}, 0x4000)
+    chr := bytes.Repeat([]byte{3}, 0x2000)
+
+    var image []byte
+    image = append(image, unifMagic...)
+    image = binary.LittleEndian.AppendUint32(image, 7)
+    image = append(image, make([]byte, unifHeaderSize - len(image))...)
+    image = append(image, makeUnifChunk("MAPR", []byte("NES-UNROM\x00"))...)
+    /* chunks are joined by their number, not the order they appear in */
+    image = append(image, makeUnifChunk("PRG1", prg1)...)
+    image = append(image, makeUnifChunk("PRG0", prg0)...)
+    image = append(image, makeUnifChunk("CHR0", chr)...)
+    image = append(image, makeUnifChunk("MIRR", []byte{1})...)
+    image = append(image, makeUnifChunk("BATR", []byte{1})...)
+    image = append(image, makeUnifChunk("TVCI", []byte{1})...)
+
+    file, err := ParseNes(bytes.NewReader(image), false, "test.unf")
+    if err != nil {
+        test.Fatalf("could not parse unif: %v", err)
+    }
+
+    if file.Mapper != 2 || file.Board != "NES-UNROM" {
+        test.Fatalf("expected mapper 2 for %v but got %v", file.Board, file.Mapper)
+    }
+
+    if !bytes.Equal(file.ProgramRom, append(bytes.Clone(prg0), prg1...)) {
+        test.Fatalf("prg rom was not joined in order")
+    }
+
+    if !bytes.Equal(file.CharacterRom, chr) {
+        test.Fatalf("chr rom differs")
+    }
+
+    if !file.VerticalMirror || file.HorizontalMirror || !file.Battery || file.Region != RegionPAL {
+        test.Fatalf("wrong mirroring, battery or region: %+v", file.MapperInfo())
+    }
+
+    if _, err := MakeMapper(file.MapperInfo(), file.ProgramRom, file.CharacterRom); err != nil {
+        test.Fatalf("could not make mapper: %v", err)
+    }
+
+    unknown := append(bytes.Clone(image[:unifHeaderSize]), makeUnifChunk("MAPR", []byte("BMC-Unknown"))...)
+    if _, err := ParseNes(bytes.NewReader(unknown), false, "unknown.unf"); err == nil {
+        test.Fatalf("expected an error for an unknown board")
+    }
+}
+
+func TestUnifBoardMapper(test *testing.T){
+    boards := map[string]uint32{
+        "NES-SLROM": 1,
+        "HVC-TLROM": 4,
+        "UNL-CNROM": 3,
+        "AOROM": 7,
+        "NES-BNROM": 34,
+        "CAMERICA-BF9093": 71,
+        "UNL-VRC7": 85,
+        "CAMERICA-ALGQ": 232,
+    }
+
+    for board, expected := range boards {
+        mapper, _, ok := UnifBoardMapper(board)
+        if !ok || mapper != expected {
+            test.Fatalf("%v: expected mapper %v but got %v", board, expected, mapper)
+        }
+    }
+
+    /* fire hawk's board has the mirroring register */
+    if mapper, submapper, _ := UnifBoardMapper("CAMERICA-BF9097"); mapper != 71 || submapper != 1 {
+        test.Fatalf("expected mapper 71 submapper 1 for CAMERICA-BF9097 but got %v/%v", mapper, submapper)
+    }
+
+    /* multicarts without a supported mapper are not loaded */
+    if _, _, ok := UnifBoardMapper("BMC-70in1"); ok {
+        test.Fatalf("BMC-70in1 should not have a mapper")
+    }
+}
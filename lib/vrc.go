@@ -0,0 +1,418 @@
+package lib
+
+import (
+    "fmt"
+)
+
+/* The irq counter shared by the konami vrc4, vrc6 and vrc7.
+ * https://www.nesdev.org/wiki/VRC_IRQ
+ *
+ * The counter counts up from the latch and raises an irq when it overflows. In cycle mode it is
+ * clocked every cpu cycle. In scanline mode a prescaler divides the cpu clock by 113.667 so that
+ * the counter is clocked about once per scanline, without looking at the ppu at all.
+ */
+type VRCIrq struct {
+    Latch byte `json:"latch"`
+    Counter byte `json:"counter"`
+    /* counts down by 3 every cpu cycle, and clocks the counter every 341 */
+    Prescaler int `json:"prescaler"`
+    Enabled bool `json:"enabled"`
+    /* copied to Enabled when the irq is acknowledged */
+    EnableAfterAck bool `json:"enableafterack"`
+    CycleMode bool `json:"cyclemode"`
+    Pending bool `json:"pending"`
+}
+
+func (irq *VRCIrq) SaveBinary(writer *StateWriter){
+    writer.Byte(irq.Latch)
+    writer.Byte(irq.Counter)
+    writer.Int(irq.Prescaler)
+    writer.Bool(irq.Enabled)
+    writer.Bool(irq.EnableAfterAck)
+    writer.Bool(irq.CycleMode)
+    writer.Bool(irq.Pending)
+}
+
+func (irq *VRCIrq) LoadBinary(reader *StateReader){
+    irq.Latch = reader.Byte()
+    irq.Counter = reader.Byte()
+    irq.Prescaler = reader.Int()
+    irq.Enabled = reader.Bool()
+    irq.EnableAfterAck = reader.Bool()
+    irq.CycleMode = reader.Bool()
+    irq.Pending = reader.Bool()
+}
+
+func (irq *VRCIrq) WriteLatch(value byte){
+    irq.Latch = value
+}
+
+/* the vrc4 sets the latch 4 bits at a time */
+func (irq *VRCIrq) WriteLatchLow(value byte){
+    irq.Latch = (irq.Latch & 0xf0) | (value & 0xf)
+}
+
+func (irq *VRCIrq) WriteLatchHigh(value byte){
+    irq.Latch = (irq.Latch & 0xf) | ((value & 0xf) << 4)
+}
+
+func (irq *VRCIrq) WriteControl(value byte){
+    irq.EnableAfterAck = value & 0x1 == 0x1
+    irq.Enabled = value & 0x2 == 0x2
+    irq.CycleMode = value & 0x4 == 0x4
+    irq.Pending = false
+
+    if irq.Enabled {
+        irq.Counter = irq.Latch
+        irq.Prescaler = 341
+    }
+}
+
+func (irq *VRCIrq) Acknowledge(){
+    irq.Pending = false
+    irq.Enabled = irq.EnableAfterAck
+}
+
+func (irq *VRCIrq) clock(){
+    if irq.Counter == 0xff {
+        irq.Counter = irq.Latch
+        irq.Pending = true
+    } else {
+        irq.Counter += 1
+    }
+}
+
+/* cycles is in cpu cycles */
+func (irq *VRCIrq) Run(cycles uint64){
+    if !irq.Enabled {
+        return
+    }
+
+    for range cycles {
+        if irq.CycleMode {
+            irq.clock()
+        } else {
+            irq.Prescaler -= 3
+            if irq.Prescaler <= 0 {
+                irq.Prescaler += 341
+                irq.clock()
+            }
+        }
+    }
+}
+
+/* The VRC2 and VRC4, used by mappers 21, 22, 23 and 25.
+ * https://www.nesdev.org/wiki/VRC2_and_VRC4
+ *
+ * Each board connects the chip's two register select lines to different cpu address lines, so
+ * the same register might be at $b001 on one board and $b004 on another. Nes 2.0 submappers say
+ * which wiring is used. Without a submapper both wirings of the mapper number are combined,
+ * which works because games only write to the addresses of their own wiring.
+ *
+ * The VRC2 is a VRC4 without the irq, prg swap mode, one-screen mirroring or prg ram enable.
+ * Boards without prg ram have a 1-bit latch at $6000-$6fff instead, which some games use for
+ * copy protection.
+ */
+type MapperVRC4 struct {
+    ProgramRom []byte `json:"programrom"`
+    CharacterRom []byte `json:"characterrom"`
+    /* nil if the board has no prg ram */
+    PRGRam []byte `json:"prgram,omitempty"`
+
+    /* the ines mapper number, 21, 22, 23 or 25 */
+    Mapper uint32 `json:"mapper"`
+    VRC2 bool `json:"vrc2"`
+    /* the cpu address lines connected to the chip's A0 and A1 */
+    Line0 uint16 `json:"line0"`
+    Line1 uint16 `json:"line1"`
+
+    PrgRegister [2]byte `json:"prgregister"`
+    /* if set, $8000 is fixed to the second to last bank and PrgRegister[0] selects $c000 */
+    PrgSwap bool `json:"prgswap"`
+    /* cleared by bit 0 of $9002 on the vrc4 */
+    RamDisabled bool `json:"ramdisabled"`
+    /* 1k chr banks, written 4 bits at a time */
+    ChrRegister [8]uint16 `json:"chrregister"`
+    Latch byte `json:"latch"`
+
+    Irq VRCIrq `json:"irq"`
+}
+
+func (mapper *MapperVRC4) IsNSF() bool {
+    return false
+}
+
+func (mapper *MapperVRC4) Kind() int {
+    return int(mapper.Mapper)
+}
+
+func (mapper *MapperVRC4) Compare(other Mapper) error {
+    return fmt.Errorf("mapper%v compare unimplemented", mapper.Mapper)
+}
+
+func (mapper *MapperVRC4) Copy() Mapper {
+    out := *mapper
+    out.ProgramRom = copySlice(mapper.ProgramRom)
+    out.CharacterRom = copySlice(mapper.CharacterRom)
+    out.PRGRam = copySlice(mapper.PRGRam)
+    return &out
+}
+
+func (mapper *MapperVRC4) SaveBinary(writer *StateWriter){
+    writer.Bytes(mapper.ProgramRom)
+    writer.Bytes(mapper.CharacterRom)
+    writer.Bytes(mapper.PRGRam)
+    writer.Uint32(mapper.Mapper)
+    writer.Bool(mapper.VRC2)
+    writer.Uint16(mapper.Line0)
+    writer.Uint16(mapper.Line1)
+    for _, value := range mapper.PrgRegister {
+        writer.Byte(value)
+    }
+    writer.Bool(mapper.PrgSwap)
+    for _, value := range mapper.ChrRegister {
+        writer.Uint16(value)
+    }
+    writer.Byte(mapper.Latch)
+    mapper.Irq.SaveBinary(writer)
+    writer.Bool(mapper.RamDisabled)
+}
+
+func (mapper *MapperVRC4) LoadBinary(reader *StateReader){
+    mapper.ProgramRom = reader.Bytes()
+    mapper.CharacterRom = reader.Bytes()
+    mapper.PRGRam = reader.Bytes()
+    mapper.Mapper = reader.Uint32()
+    mapper.VRC2 = reader.Bool()
+    mapper.Line0 = reader.Uint16()
+    mapper.Line1 = reader.Uint16()
+    for i := range mapper.PrgRegister {
+        mapper.PrgRegister[i] = reader.Byte()
+    }
+    mapper.PrgSwap = reader.Bool()
+    for i := range mapper.ChrRegister {
+        mapper.ChrRegister[i] = reader.Uint16()
+    }
+    mapper.Latch = reader.Byte()
+    mapper.Irq.LoadBinary(reader)
+    if reader.Version >= 10 {
+        mapper.RamDisabled = reader.Bool()
+    }
+}
+
+func (mapper *MapperVRC4) IsIRQAsserted() bool {
+    return mapper.Irq.Pending
+}
+
+func (mapper *MapperVRC4) GetPRGRam() []byte {
+    return mapper.PRGRam
+}
+
+func (mapper *MapperVRC4) RunCycles(cycles uint64){
+    mapper.Irq.Run(cycles)
+}
+
+func (mapper *MapperVRC4) readProgram(bank int, offset uint16) byte {
+    pages := len(mapper.ProgramRom) / 0x2000
+    /* negative banks count from the end */
+    bank = ((bank % pages) + pages) % pages
+    return mapper.ProgramRom[bank * 0x2000 + int(offset)]
+}
+
+func (mapper *MapperVRC4) Read(address uint16) byte {
+    switch {
+        case address >= 0x6000 && address < 0x8000:
+            if mapper.PRGRam != nil {
+                if mapper.RamDisabled {
+                    return 0
+                }
+                return mapper.PRGRam[int(address - 0x6000) % len(mapper.PRGRam)]
+            }
+            if address < 0x7000 {
+                return mapper.Latch
+            }
+            return 0
+        case address >= 0x8000 && address < 0xa000:
+            if mapper.PrgSwap {
+                return mapper.readProgram(-2, address - 0x8000)
+            }
+            return mapper.readProgram(int(mapper.PrgRegister[0]), address - 0x8000)
+        case address >= 0xa000 && address < 0xc000:
+            return mapper.readProgram(int(mapper.PrgRegister[1]), address - 0xa000)
+        case address >= 0xc000 && address < 0xe000:
+            if mapper.PrgSwap {
+                return mapper.readProgram(int(mapper.PrgRegister[0]), address - 0xc000)
+            }
+            return mapper.readProgram(-2, address - 0xc000)
+        case address >= 0xe000:
+            return mapper.readProgram(-1, address - 0xe000)
+    }
+
+    return 0
+}
+
+/* the offset into the chr rom of a pattern table address, in 1k banks */
+func (mapper *MapperVRC4) chrOffset(address uint16) int {
+    page := int(mapper.ChrRegister[address / 0x400])
+    /* the vrc2a ignores the lowest bit of the chr bank */
+    if mapper.Mapper == 22 {
+        page = page >> 1
+    }
+
+    return (page * 0x400 + int(address & 0x3ff)) % len(mapper.CharacterRom)
+}
+
+/* boards without chr rom use the ppu's memory as chr ram */
+func (mapper *MapperVRC4) ReadPPU(ppu *PPUState, address uint16) byte {
+    if address >= 0x2000 {
+        return ppu.LoadNametableMemory(address)
+    }
+
+    if len(mapper.CharacterRom) == 0 {
+        return ppu.VideoMemory[address]
+    }
+
+    return mapper.CharacterRom[mapper.chrOffset(address)]
+}
+
+func (mapper *MapperVRC4) WritePPU(ppu *PPUState, address uint16, value byte){
+    if address >= 0x2000 {
+        ppu.StoreNametableMemory(address, value)
+        return
+    }
+
+    if len(mapper.CharacterRom) == 0 {
+        ppu.VideoMemory[address] = value
+    }
+}
+
+/* turn the address into $x000-$x003 according to how A0 and A1 are wired */
+func (mapper *MapperVRC4) register(address uint16) uint16 {
+    out := address & 0xf000
+    if address & mapper.Line0 != 0 {
+        out |= 0x1
+    }
+    if address & mapper.Line1 != 0 {
+        out |= 0x2
+    }
+    return out
+}
+
+func (mapper *MapperVRC4) Write(cpu *CPUState, address uint16, value byte) error {
+    if address >= 0x6000 && address < 0x8000 {
+        if mapper.PRGRam != nil {
+            if !mapper.RamDisabled {
+                mapper.PRGRam[int(address - 0x6000) % len(mapper.PRGRam)] = value
+            }
+        } else if address < 0x7000 {
+            mapper.Latch = value & 0x1
+        }
+        return nil
+    }
+
+    prgMask := byte(0x1f)
+    chrHighMask := uint16(0x1f)
+    if mapper.VRC2 {
+        prgMask = 0xf
+        chrHighMask = 0xf
+    }
+
+    register := mapper.register(address)
+    switch register {
+        case 0x8000, 0x8001, 0x8002, 0x8003:
+            mapper.PrgRegister[0] = value & prgMask
+        case 0x9000, 0x9001, 0x9002, 0x9003:
+            if !mapper.VRC2 && register >= 0x9002 {
+                mapper.RamDisabled = value & 0x1 == 0
+                mapper.PrgSwap = value & 0x2 == 0x2
+                break
+            }
+
+            mirror := value & 0x3
+            if mapper.VRC2 {
+                mirror = value & 0x1
+            }
+            switch mirror {
+                case 0: cpu.PPU.SetVerticalMirror()
+                case 1: cpu.PPU.SetHorizontalMirror()
+                case 2: cpu.PPU.SetScreenAMirror()
+                case 3: cpu.PPU.SetScreenBMirror()
+            }
+        case 0xa000, 0xa001, 0xa002, 0xa003:
+            mapper.PrgRegister[1] = value & prgMask
+        case 0xf000:
+            mapper.Irq.WriteLatchLow(value)
+        case 0xf001:
+            mapper.Irq.WriteLatchHigh(value)
+        case 0xf002:
+            mapper.Irq.WriteControl(value)
+        case 0xf003:
+            mapper.Irq.Acknowledge()
+        default:
+            if register >= 0xb000 && register < 0xf000 {
+                /* two registers per 4k region, low nibble then high nibble */
+                index := (register - 0xb000) / 0x1000 * 2 + (register & 0x3) / 2
+                if register & 0x1 == 0 {
+                    mapper.ChrRegister[index] = (mapper.ChrRegister[index] & 0x1f0) | uint16(value & 0xf)
+                } else {
+                    mapper.ChrRegister[index] = (mapper.ChrRegister[index] & 0xf) | ((uint16(value) & chrHighMask) << 4)
+                }
+            }
+    }
+
+    return nil
+}
+
+/* which cpu address lines are connected to A0 and A1, and whether the chip is a vrc2 */
+func vrcWiring(mapper uint32, submapper byte) (uint16, uint16, bool) {
+    switch mapper {
+        case 21:
+            switch submapper {
+                case 1: return 0x02, 0x04, false // vrc4a
+                case 2: return 0x40, 0x80, false // vrc4c
+            }
+            return 0x42, 0x84, false
+        case 22:
+            return 0x02, 0x01, true // vrc2a
+        case 23:
+            switch submapper {
+                case 1: return 0x01, 0x02, false // vrc4f
+                case 2: return 0x04, 0x08, false // vrc4e
+                case 3: return 0x01, 0x02, true // vrc2b
+            }
+            return 0x05, 0x0a, false
+        case 25:
+            switch submapper {
+                case 1: return 0x02, 0x01, false // vrc4b
+                case 2: return 0x08, 0x04, false // vrc4d
+                case 3: return 0x02, 0x01, true // vrc2c
+            }
+            return 0x0a, 0x05, false
+    }
+
+    return 0x01, 0x02, false
+}
+
+func MakeMapperVRC4(info MapperInfo, programRom []byte, chrMemory []byte) Mapper {
+    line0, line1, vrc2 := vrcWiring(info.Mapper, info.Submapper)
+
+    mapper := &MapperVRC4{
+        ProgramRom: programRom,
+        CharacterRom: chrMemory,
+        Mapper: info.Mapper,
+        VRC2: vrc2,
+        Line0: line0,
+        Line1: line1,
+    }
+
+    /* ines headers always have the default 8k of prg ram, but only the boards with a battery
+     * really have it. the others might be a vrc2 that needs the latch at $6000 instead
+     */
+    if info.Nes2 || info.Battery {
+        if info.TotalPRGRam() > 0 {
+            mapper.PRGRam = make([]byte, info.TotalPRGRam())
+        }
+    }
+
+    return mapper
+}
@@ -3,7 +3,7 @@ package lib
 // https://www.nesdev.org/wiki/VRC6_audio
 
 import (
-    // "log"
+    "fmt"
 )
 
 // memory addresses to control the VRC6 audio chip
@@ -21,12 +21,12 @@ const VRC6SawFrequencyLow = 0xB001
 const VRC6SawFrequencyHigh = 0xB002
 
 type VRC6Pulse struct {
-    Divider Divider
-    DutyCycle int
-    Duty int
-    Volume byte
-    Mode bool
-    Enabled bool
+    Divider Divider `json:"divider"`
+    DutyCycle int `json:"dutycycle"`
+    Duty int `json:"duty"`
+    Volume byte `json:"volume"`
+    Mode bool `json:"mode"`
+    Enabled bool `json:"enabled"`
 }
 
 func (pulse *VRC6Pulse) Run(x16 bool, x256 bool) {
@@ -87,12 +87,12 @@ func (pulse *VRC6Pulse) GenerateSample() byte {
 }
 
 type VRC6Saw struct {
-    Divider Divider
-    Enabled bool
-    Counter int
-    Rate uint8
-    Accumulator uint8
-    AccumulatorCount int
+    Divider Divider `json:"divider"`
+    Enabled bool `json:"enabled"`
+    Counter int `json:"counter"`
+    Rate uint8 `json:"rate"`
+    Accumulator uint8 `json:"accumulator"`
+    AccumulatorCount int `json:"accumulatorcount"`
 }
 
 func (saw *VRC6Saw) SetEnable(enable bool) {
@@ -152,19 +152,16 @@ func (saw *VRC6Saw) GenerateSample() byte {
 }
 
 type VRC6Audio struct {
-    Pulse1 VRC6Pulse
-    Pulse2 VRC6Pulse
-    Saw VRC6Saw
-    SampleCycles float64
+    Pulse1 VRC6Pulse `json:"pulse1"`
+    Pulse2 VRC6Pulse `json:"pulse2"`
+    Saw VRC6Saw `json:"saw"`
 
-    AudioStream *AudioStream
-
-    Halt bool
-    X16 bool
-    X256 bool
+    Halt bool `json:"halt"`
+    X16 bool `json:"x16"`
+    X256 bool `json:"x256"`
 }
 
-func MakeVRC6Audio(audioStream *AudioStream) *VRC6Audio {
+func MakeVRC6Audio() *VRC6Audio {
     return &VRC6Audio{
         Pulse1: VRC6Pulse{
             Divider: Divider{
@@ -190,7 +187,6 @@ func MakeVRC6Audio(audioStream *AudioStream) *VRC6Audio {
             },
         },
         // SampleBuffer: make([]float32, 1024),
-        AudioStream: audioStream,
     }
 }
 
@@ -206,13 +202,12 @@ func (vr6 *VRC6Audio) GenerateSample() float32 {
     return float32(total) / float32(1 << 6)
 }
 
-func (vrc6 *VRC6Audio) Run(cycles float64, cyclesPerSample float64) {
+/* cycles is in cpu cycles. the output is mixed into the apu samples by the mapper */
+func (vrc6 *VRC6Audio) Run(cycles float64) {
     if vrc6.Halt {
         return
     }
 
-    vrc6.SampleCycles += cycles
-
     for cycles > 0 {
         cycles -= 1
 
@@ -220,14 +215,6 @@ func (vrc6 *VRC6Audio) Run(cycles float64, cyclesPerSample float64) {
         vrc6.Pulse2.Run(vrc6.X16, vrc6.X256)
         vrc6.Saw.Run(vrc6.X16, vrc6.X256)
     }
-
-    if vrc6.SampleCycles >= cyclesPerSample {
-        sample := vrc6.GenerateSample()
-        for vrc6.SampleCycles >= cyclesPerSample {
-            vrc6.SampleCycles -= cyclesPerSample
-            vrc6.AudioStream.AddSample2(sample)
-        }
-    }
 }
 
 // returns true if the address is a VRC6 audio address
@@ -329,6 +316,67 @@ func (vrc6 *VRC6Audio) HandleWrite(address uint16, value uint8) bool {
     return false
 }
 
+func (pulse *VRC6Pulse) SaveBinary(writer *StateWriter){
+    pulse.Divider.SaveBinary(writer)
+    writer.Int(pulse.DutyCycle)
+    writer.Int(pulse.Duty)
+    writer.Byte(pulse.Volume)
+    writer.Bool(pulse.Mode)
+    writer.Bool(pulse.Enabled)
+}
+
+func (pulse *VRC6Pulse) LoadBinary(reader *StateReader){
+    pulse.Divider.LoadBinary(reader)
+    pulse.DutyCycle = reader.Int()
+    pulse.Duty = reader.Int()
+    pulse.Volume = reader.Byte()
+    pulse.Mode = reader.Bool()
+    pulse.Enabled = reader.Bool()
+}
+
+func (saw *VRC6Saw) SaveBinary(writer *StateWriter){
+    saw.Divider.SaveBinary(writer)
+    writer.Bool(saw.Enabled)
+    writer.Int(saw.Counter)
+    writer.Byte(saw.Rate)
+    writer.Byte(saw.Accumulator)
+    writer.Int(saw.AccumulatorCount)
+}
+
+func (saw *VRC6Saw) LoadBinary(reader *StateReader){
+    saw.Divider.LoadBinary(reader)
+    saw.Enabled = reader.Bool()
+    saw.Counter = reader.Int()
+    saw.Rate = reader.Byte()
+    saw.Accumulator = reader.Byte()
+    saw.AccumulatorCount = reader.Int()
+}
+
+func (vrc6 *VRC6Audio) SaveBinary(writer *StateWriter){
+    vrc6.Pulse1.SaveBinary(writer)
+    vrc6.Pulse2.SaveBinary(writer)
+    vrc6.Saw.SaveBinary(writer)
+    writer.Bool(vrc6.Halt)
+    writer.Bool(vrc6.X16)
+    writer.Bool(vrc6.X256)
+}
+
+func (vrc6 *VRC6Audio) LoadBinary(reader *StateReader){
+    vrc6.Pulse1.LoadBinary(reader)
+    vrc6.Pulse2.LoadBinary(reader)
+    vrc6.Saw.LoadBinary(reader)
+    /* the vrc6 was added in version 3, and only the version 3 states saved before vrc7 support
+     * have the unused sample cycles. the vrc6 audio is the last thing in a version 3 state, so
+     * those states have the 8 byte float left here as well as the 3 flags
+     */
+    if reader.Version == 3 && len(reader.data) == 8 + 3 {
+        reader.Float64()
+    }
+    vrc6.Halt = reader.Bool()
+    vrc6.X16 = reader.Bool()
+    vrc6.X256 = reader.Bool()
+}
+
 func (vrc6 *VRC6Audio) FrequencyControl(halt bool, x16 bool, x256 bool) {
     vrc6.Halt = halt
     vrc6.X16 = x16
@@ -390,3 +438,277 @@ func (vrc6 *VRC6Audio) SawVolume(volume int) {
 func (vrc6 *VRC6Audio) SawSetEnable(enable bool) {
     vrc6.Saw.SetEnable(enable)
 }
+
+/* The VRC6 board, used by akumajou densetsu (mapper 24), esper dream 2 and madara (mapper 26).
+ * https://www.nesdev.org/wiki/VRC6
+ *
+ * The two mappers are the same chip with the A0 and A1 address lines swapped. Nametables that
+ * come from chr rom ($b003 bit 4) are not supported, none of the released games use them.
+ */
+type Mapper24 struct {
+    ProgramRom []byte `json:"programrom"`
+    CharacterRom []byte `json:"characterrom"`
+    PRGRam []byte `json:"prgram"`
+
+    /* 16k bank at 0x8000 and 8k bank at 0xc000. 0xe000 is fixed to the last bank */
+    PrgBank16 byte `json:"prgbank16"`
+    PrgBank8 byte `json:"prgbank8"`
+    /* 1k chr banks */
+    ChrRegister [8]byte `json:"chrregister"`
+    /* $b003: chr banking mode, mirroring and prg ram enable */
+    BankingMode byte `json:"bankingmode"`
+
+    Irq VRCIrq `json:"irq"`
+    Audio *VRC6Audio `json:"audio"`
+}
+
+type Mapper26 struct {
+    Mapper24
+}
+
+func (mapper *Mapper24) IsNSF() bool {
+    return false
+}
+
+func (mapper *Mapper24) Kind() int {
+    return 24
+}
+
+func (mapper *Mapper26) Kind() int {
+    return 26
+}
+
+func (mapper *Mapper24) Compare(other Mapper) error {
+    return fmt.Errorf("mapper24 compare unimplemented")
+}
+
+func (mapper *Mapper26) Compare(other Mapper) error {
+    return fmt.Errorf("mapper26 compare unimplemented")
+}
+
+func (mapper *Mapper24) copy() Mapper24 {
+    out := *mapper
+    out.ProgramRom = copySlice(mapper.ProgramRom)
+    out.CharacterRom = copySlice(mapper.CharacterRom)
+    out.PRGRam = copySlice(mapper.PRGRam)
+    audio := *mapper.Audio
+    out.Audio = &audio
+    return out
+}
+
+func (mapper *Mapper24) Copy() Mapper {
+    out := mapper.copy()
+    return &out
+}
+
+func (mapper *Mapper26) Copy() Mapper {
+    return &Mapper26{Mapper24: mapper.Mapper24.copy()}
+}
+
+func (mapper *Mapper24) SaveBinary(writer *StateWriter){
+    writer.Bytes(mapper.ProgramRom)
+    writer.Bytes(mapper.CharacterRom)
+    writer.Bytes(mapper.PRGRam)
+    writer.Byte(mapper.PrgBank16)
+    writer.Byte(mapper.PrgBank8)
+    for _, value := range mapper.ChrRegister {
+        writer.Byte(value)
+    }
+    writer.Byte(mapper.BankingMode)
+    mapper.Irq.SaveBinary(writer)
+    mapper.Audio.SaveBinary(writer)
+}
+
+func (mapper *Mapper24) LoadBinary(reader *StateReader){
+    mapper.ProgramRom = reader.Bytes()
+    mapper.CharacterRom = reader.Bytes()
+    mapper.PRGRam = reader.Bytes()
+    mapper.PrgBank16 = reader.Byte()
+    mapper.PrgBank8 = reader.Byte()
+    for i := range mapper.ChrRegister {
+        mapper.ChrRegister[i] = reader.Byte()
+    }
+    mapper.BankingMode = reader.Byte()
+    mapper.Irq.LoadBinary(reader)
+    mapper.Audio = MakeVRC6Audio()
+    mapper.Audio.LoadBinary(reader)
+}
+
+func (mapper *Mapper24) IsIRQAsserted() bool {
+    return mapper.Irq.Pending
+}
+
+func (mapper *Mapper24) GetPRGRam() []byte {
+    return mapper.PRGRam
+}
+
+func (mapper *Mapper24) RunCycles(cycles uint64){
+    mapper.Irq.Run(cycles)
+}
+
+func (mapper *Mapper24) RunAudio(cycles float64, cyclesPerSample float64){
+    mapper.Audio.Run(cycles)
+}
+
+func (mapper *Mapper24) AudioOutput() float32 {
+    return mapper.Audio.GenerateSample()
+}
+
+func (mapper *Mapper24) prgRamEnabled() bool {
+    return mapper.BankingMode & 0x80 == 0x80
+}
+
+func (mapper *Mapper24) readProgram(bank uint32, size uint32, offset uint16) byte {
+    address := (bank * size + uint32(offset)) % uint32(len(mapper.ProgramRom))
+    return mapper.ProgramRom[address]
+}
+
+func (mapper *Mapper24) Read(address uint16) byte {
+    switch {
+        case address >= 0x6000 && address < 0x8000:
+            if mapper.prgRamEnabled() {
+                return mapper.PRGRam[address - 0x6000]
+            }
+            return 0
+        case address >= 0x8000 && address < 0xc000:
+            return mapper.readProgram(uint32(mapper.PrgBank16), 0x4000, address - 0x8000)
+        case address >= 0xc000 && address < 0xe000:
+            return mapper.readProgram(uint32(mapper.PrgBank8), 0x2000, address - 0xc000)
+        case address >= 0xe000:
+            return mapper.readProgram(uint32(len(mapper.ProgramRom) / 0x2000 - 1), 0x2000, address - 0xe000)
+    }
+
+    return 0
+}
+
+/* the two 1k pages that make up a 2k bank. normally the low bit of the register is replaced by
+ * ppu A10, but when $b003 bit 5 is set the register's own low bit is used for both halves
+ */
+func (mapper *Mapper24) chr2k(register byte) (uint16, uint16) {
+    if mapper.BankingMode & 0x20 == 0x20 {
+        return uint16(register), uint16(register)
+    }
+    page := uint16(register & 0xfe)
+    return page, page + 1
+}
+
+/* the 1k chr page at a pattern table address, according to the banking mode in $b003 */
+func (mapper *Mapper24) chrPage(address uint16) uint16 {
+    slot := int(address / 0x400)
+    switch mapper.BankingMode & 0x3 {
+        case 0:
+            return uint16(mapper.ChrRegister[slot])
+        case 1:
+            low, high := mapper.chr2k(mapper.ChrRegister[slot / 2])
+            if slot & 1 == 0 {
+                return low
+            }
+            return high
+        default:
+            if slot < 4 {
+                return uint16(mapper.ChrRegister[slot])
+            }
+            low, high := mapper.chr2k(mapper.ChrRegister[4 + (slot - 4) / 2])
+            if slot & 1 == 0 {
+                return low
+            }
+            return high
+    }
+}
+
+/* boards without chr rom use the ppu's memory as chr ram */
+func (mapper *Mapper24) ReadPPU(ppu *PPUState, address uint16) byte {
+    if address >= 0x2000 {
+        return ppu.LoadNametableMemory(address)
+    }
+
+    if len(mapper.CharacterRom) == 0 {
+        return ppu.VideoMemory[address]
+    }
+
+    offset := int(mapper.chrPage(address)) * 0x400 + int(address & 0x3ff)
+    return mapper.CharacterRom[offset % len(mapper.CharacterRom)]
+}
+
+func (mapper *Mapper24) WritePPU(ppu *PPUState, address uint16, value byte){
+    if address >= 0x2000 {
+        ppu.StoreNametableMemory(address, value)
+        return
+    }
+
+    if len(mapper.CharacterRom) == 0 {
+        ppu.VideoMemory[address] = value
+    }
+}
+
+func (mapper *Mapper24) setMirroring(ppu *PPUState){
+    switch (mapper.BankingMode >> 2) & 0x3 {
+        case 0: ppu.SetVerticalMirror()
+        case 1: ppu.SetHorizontalMirror()
+        case 2: ppu.SetScreenAMirror()
+        case 3: ppu.SetScreenBMirror()
+    }
+}
+
+func (mapper *Mapper24) Write(cpu *CPUState, address uint16, value byte) error {
+    if address >= 0x6000 && address < 0x8000 {
+        if mapper.prgRamEnabled() {
+            mapper.PRGRam[address - 0x6000] = value
+        }
+        return nil
+    }
+
+    /* only A0 and A1 are decoded within each 4k region */
+    address = address & 0xf003
+
+    if mapper.Audio.HandleWrite(address, value) {
+        return nil
+    }
+
+    switch address {
+        case 0x8000, 0x8001, 0x8002, 0x8003:
+            mapper.PrgBank16 = value & 0xf
+        case 0xb003:
+            mapper.BankingMode = value
+            mapper.setMirroring(&cpu.PPU)
+        case 0xc000, 0xc001, 0xc002, 0xc003:
+            mapper.PrgBank8 = value & 0x1f
+        case 0xd000, 0xd001, 0xd002, 0xd003:
+            mapper.ChrRegister[address & 0x3] = value
+        case 0xe000, 0xe001, 0xe002, 0xe003:
+            mapper.ChrRegister[4 + address & 0x3] = value
+        case 0xf000:
+            mapper.Irq.WriteLatch(value)
+        case 0xf001:
+            mapper.Irq.WriteControl(value)
+        case 0xf002:
+            mapper.Irq.Acknowledge()
+    }
+
+    return nil
+}
+
+func (mapper *Mapper26) Write(cpu *CPUState, address uint16, value byte) error {
+    if address >= 0x8000 {
+        address = (address &^ 0x3) | ((address & 0x1) << 1) | ((address >> 1) & 0x1)
+    }
+    return mapper.Mapper24.Write(cpu, address, value)
+}
+
+func makeVRC6Mapper(programRom []byte, chrMemory []byte) Mapper24 {
+    return Mapper24{
+        ProgramRom: programRom,
+        CharacterRom: chrMemory,
+        PRGRam: make([]byte, 0x2000),
+        Audio: MakeVRC6Audio(),
+    }
+}
+
+func MakeMapper24(programRom []byte, chrMemory []byte) Mapper {
+    mapper := makeVRC6Mapper(programRom, chrMemory)
+    return &mapper
+}
+
+func MakeMapper26(programRom []byte, chrMemory []byte) Mapper {
+    return &Mapper26{Mapper24: makeVRC6Mapper(programRom, chrMemory)}
+}
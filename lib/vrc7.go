@@ -0,0 +1,680 @@
+package lib
+
+import (
+    "fmt"
+    "math"
+)
+
+/* The VRC7's audio is a cut down YM2413 (OPLL) with 6 fm channels and its own set of
+ * built in instruments.
+ * https://www.nesdev.org/wiki/VRC7_audio
+ *
+ * Each channel has a modulator and a carrier operator. The modulator's output shifts the phase of
+ * the carrier, and the carrier's output is what is heard. Both operators have their own
+ * envelope, frequency multiplier and can have tremolo (am) or vibrato (fm) applied. Instrument 0
+ * is defined by registers $00-$07, the other 15 are fixed.
+ *
+ * The chip produces one sample every 36 cpu cycles. Attenuation is kept in decibels like the
+ * real chip, but the log/exp tables are replaced with floating point math.
+ */
+
+const VRC7RegisterSelect = 0x9010
+const VRC7RegisterWrite = 0x9030
+
+/* cpu cycles per vrc7 sample */
+const vrc7SampleCycles = 36
+
+/* the envelope is 7 bits of 0.375db */
+const vrc7MaxAttenuation = 48.0
+
+/* instrument 0 is the custom instrument, these are 1-15 */
+var vrc7Patches = [15][8]byte{
+    {0x03, 0x21, 0x05, 0x06, 0xe8, 0x81, 0x42, 0x27}, // buzzy bell
+    {0x13, 0x41, 0x14, 0x0d, 0xd8, 0xf6, 0x23, 0x12}, // guitar
+    {0x11, 0x11, 0x08, 0x08, 0xfa, 0xb2, 0x20, 0x12}, // wurly
+    {0x31, 0x61, 0x0c, 0x07, 0xa8, 0x64, 0x61, 0x27}, // flute
+    {0x32, 0x21, 0x1e, 0x06, 0xe1, 0x76, 0x01, 0x28}, // clarinet
+    {0x02, 0x01, 0x06, 0x00, 0xa3, 0xe2, 0xf4, 0xf4}, // synth
+    {0x21, 0x61, 0x1d, 0x07, 0x82, 0x81, 0x11, 0x07}, // trumpet
+    {0x23, 0x21, 0x22, 0x17, 0xa2, 0x72, 0x01, 0x17}, // organ
+    {0x35, 0x11, 0x25, 0x00, 0x40, 0x73, 0x72, 0x01}, // bells
+    {0xb5, 0x01, 0x0f, 0x0f, 0xa8, 0xa5, 0x51, 0x02}, // vibes
+    {0x17, 0xc1, 0x24, 0x07, 0xf8, 0xf8, 0x22, 0x12}, // vibraphone
+    {0x71, 0x23, 0x11, 0x06, 0x65, 0x74, 0x18, 0x16}, // tutti
+    {0x01, 0x02, 0xd3, 0x05, 0xc9, 0x95, 0x03, 0x02}, // fretless
+    {0x61, 0x63, 0x0c, 0x00, 0x94, 0xc0, 0x33, 0xf6}, // synth bass
+    {0x21, 0x72, 0x0d, 0x00, 0xc1, 0xd5, 0x56, 0x06}, // sweep
+}
+
+/* frequency multiplier times 2 */
+var vrc7Multiplier = [16]float64{1, 2, 4, 6, 8, 10, 12, 14, 16, 18, 20, 20, 24, 24, 30, 30}
+
+/* attenuation in db for each octave's worth of the top 4 bits of the frequency, at 6db per octave */
+var vrc7KeyScale = [16]float64{0, 18, 24, 27.75, 30, 32.25, 33.75, 35.25, 36, 37.5, 38.25, 39, 39.75, 40.5, 41.25, 42}
+
+/* how much of vrc7KeyScale applies for the 4 key scale settings: 0, 1.5, 3 and 6 db per octave */
+var vrc7KeyScaleAmount = [4]float64{0, 0.25, 0.5, 1}
+
+/* feedback in cycles of the modulator's phase */
+var vrc7Feedback = [8]float64{0, 1.0/32, 1.0/16, 1.0/8, 1.0/4, 1.0/2, 1, 2}
+
+var vrc7Sine = func() [1024]float64 {
+    var table [1024]float64
+    for i := range table {
+        table[i] = math.Sin(2 * math.Pi * float64(i) / float64(len(table)))
+    }
+    return table
+}()
+
+const (
+    VRC7EnvelopeOff = iota
+    VRC7EnvelopeAttack
+    VRC7EnvelopeDecay
+    VRC7EnvelopeSustain
+    VRC7EnvelopeRelease
+)
+
+/* the settings of one operator, taken from an instrument */
+type vrc7OperatorPatch struct {
+    AM bool
+    FM bool
+    /* if false the envelope keeps decaying at the release rate after reaching the sustain level */
+    Sustained bool
+    KeyScaleRate bool
+    Multiplier byte
+    KeyScaleLevel byte
+    Rectify bool
+    Attack byte
+    Decay byte
+    SustainLevel byte
+    Release byte
+}
+
+/* the byte at offset 0 (modulator) or 1 (carrier) of an instrument */
+func makeVRC7OperatorPatch(patch [8]byte, carrier bool) vrc7OperatorPatch {
+    index := 0
+    if carrier {
+        index = 1
+    }
+
+    out := vrc7OperatorPatch{
+        AM: patch[index] & 0x80 == 0x80,
+        FM: patch[index] & 0x40 == 0x40,
+        Sustained: patch[index] & 0x20 == 0x20,
+        KeyScaleRate: patch[index] & 0x10 == 0x10,
+        Multiplier: patch[index] & 0xf,
+        KeyScaleLevel: patch[2 + index] >> 6,
+        Attack: patch[4 + index] >> 4,
+        Decay: patch[4 + index] & 0xf,
+        SustainLevel: patch[6 + index] >> 4,
+        Release: patch[6 + index] & 0xf,
+    }
+
+    if carrier {
+        out.Rectify = patch[3] & 0x10 == 0x10
+    } else {
+        out.Rectify = patch[3] & 0x8 == 0x8
+    }
+
+    return out
+}
+
+type VRC7Operator struct {
+    /* in cycles, 0 to 1 */
+    Phase float64 `json:"phase"`
+    /* attenuation from the envelope in db */
+    Envelope float64 `json:"envelope"`
+    State byte `json:"state"`
+}
+
+type VRC7Channel struct {
+    /* 9 bits */
+    Frequency uint16 `json:"frequency"`
+    Octave byte `json:"octave"`
+    Sustain bool `json:"sustain"`
+    Key bool `json:"key"`
+    Instrument byte `json:"instrument"`
+    Volume byte `json:"volume"`
+
+    Modulator VRC7Operator `json:"modulator"`
+    Carrier VRC7Operator `json:"carrier"`
+    /* the last two outputs of the modulator, used for feedback */
+    Feedback [2]float64 `json:"feedback"`
+}
+
+type VRC7Audio struct {
+    /* the register selected by $9010 */
+    Register byte `json:"register"`
+    Custom [8]byte `json:"custom"`
+    Channels [6]VRC7Channel `json:"channels"`
+
+    /* cpu cycles until the next sample */
+    Cycles float64 `json:"cycles"`
+    /* the am and fm lfos, in cycles */
+    AMPhase float64 `json:"amphase"`
+    FMPhase float64 `json:"fmphase"`
+    Output float32 `json:"output"`
+    /* set by the mapper's silence bit */
+    Mute bool `json:"mute"`
+}
+
+func MakeVRC7Audio() *VRC7Audio {
+    audio := &VRC7Audio{}
+    for i := range audio.Channels {
+        audio.Channels[i].Modulator.Envelope = vrc7MaxAttenuation
+        audio.Channels[i].Carrier.Envelope = vrc7MaxAttenuation
+    }
+    return audio
+}
+
+func (operator *VRC7Operator) SaveBinary(writer *StateWriter){
+    writer.Float64(operator.Phase)
+    writer.Float64(operator.Envelope)
+    writer.Byte(operator.State)
+}
+
+func (operator *VRC7Operator) LoadBinary(reader *StateReader){
+    operator.Phase = reader.Float64()
+    operator.Envelope = reader.Float64()
+    operator.State = reader.Byte()
+}
+
+func (channel *VRC7Channel) SaveBinary(writer *StateWriter){
+    writer.Uint16(channel.Frequency)
+    writer.Byte(channel.Octave)
+    writer.Bool(channel.Sustain)
+    writer.Bool(channel.Key)
+    writer.Byte(channel.Instrument)
+    writer.Byte(channel.Volume)
+    channel.Modulator.SaveBinary(writer)
+    channel.Carrier.SaveBinary(writer)
+    writer.Float64(channel.Feedback[0])
+    writer.Float64(channel.Feedback[1])
+}
+
+func (channel *VRC7Channel) LoadBinary(reader *StateReader){
+    channel.Frequency = reader.Uint16()
+    channel.Octave = reader.Byte()
+    channel.Sustain = reader.Bool()
+    channel.Key = reader.Bool()
+    channel.Instrument = reader.Byte()
+    channel.Volume = reader.Byte()
+    channel.Modulator.LoadBinary(reader)
+    channel.Carrier.LoadBinary(reader)
+    channel.Feedback[0] = reader.Float64()
+    channel.Feedback[1] = reader.Float64()
+}
+
+func (vrc7 *VRC7Audio) SaveBinary(writer *StateWriter){
+    writer.Byte(vrc7.Register)
+    writer.Bytes(vrc7.Custom[:])
+    for i := range vrc7.Channels {
+        vrc7.Channels[i].SaveBinary(writer)
+    }
+    writer.Float64(vrc7.Cycles)
+    writer.Float64(vrc7.AMPhase)
+    writer.Float64(vrc7.FMPhase)
+    writer.Float32(vrc7.Output)
+    writer.Bool(vrc7.Mute)
+}
+
+func (vrc7 *VRC7Audio) LoadBinary(reader *StateReader){
+    vrc7.Register = reader.Byte()
+    copy(vrc7.Custom[:], reader.Bytes())
+    for i := range vrc7.Channels {
+        vrc7.Channels[i].LoadBinary(reader)
+    }
+    vrc7.Cycles = reader.Float64()
+    vrc7.AMPhase = reader.Float64()
+    vrc7.FMPhase = reader.Float64()
+    vrc7.Output = reader.Float32()
+    vrc7.Mute = reader.Bool()
+}
+
+func (vrc7 *VRC7Audio) patch(instrument byte) [8]byte {
+    if instrument == 0 {
+        return vrc7.Custom
+    }
+    return vrc7Patches[instrument - 1]
+}
+
+// returns true if the address is a VRC7 audio address
+func (vrc7 *VRC7Audio) HandleWrite(address uint16, value byte) bool {
+    switch address {
+        case VRC7RegisterSelect:
+            vrc7.Register = value
+            return true
+        case VRC7RegisterWrite:
+            vrc7.WriteRegister(vrc7.Register, value)
+            return true
+    }
+
+    return false
+}
+
+func (vrc7 *VRC7Audio) WriteRegister(register byte, value byte){
+    if register < 0x8 {
+        vrc7.Custom[register] = value
+        return
+    }
+
+    index := int(register & 0xf)
+    if index >= len(vrc7.Channels) {
+        return
+    }
+    channel := &vrc7.Channels[index]
+
+    switch register & 0xf0 {
+        case 0x10:
+            channel.Frequency = (channel.Frequency & 0x100) | uint16(value)
+        case 0x20:
+            channel.Frequency = (channel.Frequency & 0xff) | (uint16(value & 0x1) << 8)
+            channel.Octave = (value >> 1) & 0x7
+            channel.Sustain = value & 0x20 == 0x20
+
+            key := value & 0x10 == 0x10
+            if key && !channel.Key {
+                channel.Modulator.keyOn()
+                channel.Carrier.keyOn()
+            } else if !key && channel.Key {
+                channel.Modulator.State = VRC7EnvelopeRelease
+                channel.Carrier.State = VRC7EnvelopeRelease
+            }
+            channel.Key = key
+        case 0x30:
+            channel.Instrument = value >> 4
+            channel.Volume = value & 0xf
+    }
+}
+
+/* silence every channel, used when the mapper resets the sound chip */
+func (vrc7 *VRC7Audio) Reset(){
+    for i := range vrc7.Channels {
+        channel := &vrc7.Channels[i]
+        channel.Key = false
+        channel.Modulator = VRC7Operator{Envelope: vrc7MaxAttenuation}
+        channel.Carrier = VRC7Operator{Envelope: vrc7MaxAttenuation}
+        channel.Feedback = [2]float64{}
+    }
+    vrc7.Output = 0
+}
+
+func (operator *VRC7Operator) keyOn(){
+    operator.Phase = 0
+    operator.State = VRC7EnvelopeAttack
+}
+
+/* the rate index, 0-63, for a 4-bit rate */
+func vrc7RateIndex(rate byte, channel *VRC7Channel, patch vrc7OperatorPatch) int {
+    if rate == 0 {
+        return 0
+    }
+
+    keyScale := int(channel.Octave) * 2 + int(channel.Frequency >> 8)
+    if !patch.KeyScaleRate {
+        keyScale = keyScale >> 2
+    }
+
+    return min(63, int(rate) * 4 + keyScale)
+}
+
+/* db per sample that the envelope changes when decaying or releasing. rate index 4 takes
+ * about 39 seconds to decay by 96db and every 4 steps is twice as fast
+ */
+func vrc7DecayStep(index int) float64 {
+    if index == 0 {
+        return 0
+    }
+    seconds := 39.28 * math.Pow(2, -float64(index - 4) / 4)
+    return 96 / (seconds * CPUSpeed / vrc7SampleCycles)
+}
+
+func (operator *VRC7Operator) runEnvelope(channel *VRC7Channel, patch vrc7OperatorPatch){
+    switch operator.State {
+        case VRC7EnvelopeAttack:
+            index := vrc7RateIndex(patch.Attack, channel, patch)
+            if index >= 60 {
+                operator.Envelope = 0
+            } else if index > 0 {
+                /* the attack is exponential. rate index 4 takes about 2.8 seconds */
+                seconds := 2.826 * math.Pow(2, -float64(index - 4) / 4)
+                operator.Envelope -= operator.Envelope * math.Log(480) / (seconds * CPUSpeed / vrc7SampleCycles)
+                if operator.Envelope < 0.1 {
+                    operator.Envelope = 0
+                }
+            }
+
+            if operator.Envelope <= 0 {
+                operator.Envelope = 0
+                operator.State = VRC7EnvelopeDecay
+            }
+        case VRC7EnvelopeDecay:
+            operator.Envelope += vrc7DecayStep(vrc7RateIndex(patch.Decay, channel, patch))
+            sustain := float64(patch.SustainLevel) * 3
+            if operator.Envelope >= sustain {
+                operator.Envelope = sustain
+                operator.State = VRC7EnvelopeSustain
+            }
+        case VRC7EnvelopeSustain:
+            if !patch.Sustained {
+                operator.Envelope += vrc7DecayStep(vrc7RateIndex(patch.Release, channel, patch))
+            }
+        case VRC7EnvelopeRelease:
+            var rate byte = 7
+            if channel.Sustain {
+                rate = 5
+            } else if patch.Sustained {
+                rate = patch.Release
+            }
+            operator.Envelope += vrc7DecayStep(vrc7RateIndex(rate, channel, patch))
+    }
+
+    if operator.Envelope >= vrc7MaxAttenuation {
+        operator.Envelope = vrc7MaxAttenuation
+        if operator.State == VRC7EnvelopeRelease {
+            operator.State = VRC7EnvelopeOff
+        }
+    }
+}
+
+/* advance the operator by one sample and return its output, -1 to 1. modulation is in cycles */
+func (operator *VRC7Operator) run(channel *VRC7Channel, patch vrc7OperatorPatch, attenuation float64, modulation float64, vibrato float64) float64 {
+    operator.runEnvelope(channel, patch)
+
+    frequency := float64(channel.Frequency) * float64(int(1) << channel.Octave)
+    if patch.FM {
+        frequency *= 1 + vibrato
+    }
+    operator.Phase += frequency * vrc7Multiplier[patch.Multiplier] / (1 << 20)
+    operator.Phase -= math.Floor(operator.Phase)
+
+    phase := operator.Phase + modulation
+    phase -= math.Floor(phase)
+    if patch.Rectify && phase >= 0.5 {
+        return 0
+    }
+
+    keyScale := vrc7KeyScale[channel.Frequency >> 5] - 6 * float64(7 - channel.Octave)
+    attenuation += operator.Envelope + max(0, keyScale) * vrc7KeyScaleAmount[patch.KeyScaleLevel]
+    if attenuation >= 96 || operator.State == VRC7EnvelopeOff {
+        return 0
+    }
+
+    return vrc7Sine[int(phase * float64(len(vrc7Sine)))] * math.Pow(10, -attenuation / 20)
+}
+
+/* produce one sample */
+func (vrc7 *VRC7Audio) sample() float32 {
+    sampleRate := CPUSpeed / vrc7SampleCycles
+
+    /* tremolo is 4.8db at 3.7hz and vibrato is about 14 cents at 6.4hz */
+    vrc7.AMPhase += 3.7 / sampleRate
+    vrc7.AMPhase -= math.Floor(vrc7.AMPhase)
+    vrc7.FMPhase += 6.4 / sampleRate
+    vrc7.FMPhase -= math.Floor(vrc7.FMPhase)
+
+    tremolo := 4.8 * (1 - math.Abs(vrc7.AMPhase * 2 - 1))
+    vibrato := 0.008 * math.Sin(2 * math.Pi * vrc7.FMPhase)
+
+    var total float64
+    for i := range vrc7.Channels {
+        channel := &vrc7.Channels[i]
+        patch := vrc7.patch(channel.Instrument)
+        modulator := makeVRC7OperatorPatch(patch, false)
+        carrier := makeVRC7OperatorPatch(patch, true)
+
+        modulatorAttenuation := float64(patch[2] & 0x3f) * 0.75
+        if modulator.AM {
+            modulatorAttenuation += tremolo
+        }
+        feedback := (channel.Feedback[0] + channel.Feedback[1]) / 2 * vrc7Feedback[patch[3] & 0x7]
+        modulation := channel.Modulator.run(channel, modulator, modulatorAttenuation, feedback, vibrato)
+        channel.Feedback[1] = channel.Feedback[0]
+        channel.Feedback[0] = modulation
+
+        carrierAttenuation := float64(channel.Volume) * 3
+        if carrier.AM {
+            carrierAttenuation += tremolo
+        }
+        total += channel.Carrier.run(channel, carrier, carrierAttenuation, modulation * 2, vibrato)
+    }
+
+    return float32(total * 0.15)
+}
+
+/* cycles is in cpu cycles */
+func (vrc7 *VRC7Audio) Run(cycles float64){
+    if vrc7.Mute {
+        return
+    }
+
+    vrc7.Cycles -= cycles
+    for vrc7.Cycles <= 0 {
+        vrc7.Cycles += vrc7SampleCycles
+        vrc7.Output = vrc7.sample()
+    }
+}
+
+func (vrc7 *VRC7Audio) GenerateSample() float32 {
+    if vrc7.Mute {
+        return 0
+    }
+    return vrc7.Output
+}
+
+/* The VRC7 board, used by lagrange point and tiny toon adventures 2 (mapper 85).
+ * https://www.nesdev.org/wiki/VRC7
+ *
+ * The second register of each pair is at $x010 on the vrc7b (submapper 2) and $x008 on the
+ * vrc7a (submapper 1). Both are accepted when there is no submapper.
+ */
+type Mapper85 struct {
+    ProgramRom []byte `json:"programrom"`
+    CharacterRom []byte `json:"characterrom"`
+    PRGRam []byte `json:"prgram"`
+
+    /* the cpu address line of the second register in each pair */
+    SecondLine uint16 `json:"secondline"`
+    /* 8k banks at $8000, $a000 and $c000 */
+    PrgRegister [3]byte `json:"prgregister"`
+    ChrRegister [8]byte `json:"chrregister"`
+    /* $e000: mirroring, audio silence and prg ram enable */
+    Control byte `json:"control"`
+
+    Irq VRCIrq `json:"irq"`
+    Audio *VRC7Audio `json:"audio"`
+}
+
+func (mapper *Mapper85) IsNSF() bool {
+    return false
+}
+
+func (mapper *Mapper85) Kind() int {
+    return 85
+}
+
+func (mapper *Mapper85) Compare(other Mapper) error {
+    return fmt.Errorf("mapper85 compare unimplemented")
+}
+
+func (mapper *Mapper85) Copy() Mapper {
+    out := *mapper
+    out.ProgramRom = copySlice(mapper.ProgramRom)
+    out.CharacterRom = copySlice(mapper.CharacterRom)
+    out.PRGRam = copySlice(mapper.PRGRam)
+    audio := *mapper.Audio
+    out.Audio = &audio
+    return &out
+}
+
+func (mapper *Mapper85) SaveBinary(writer *StateWriter){
+    writer.Bytes(mapper.ProgramRom)
+    writer.Bytes(mapper.CharacterRom)
+    writer.Bytes(mapper.PRGRam)
+    writer.Uint16(mapper.SecondLine)
+    for _, value := range mapper.PrgRegister {
+        writer.Byte(value)
+    }
+    for _, value := range mapper.ChrRegister {
+        writer.Byte(value)
+    }
+    writer.Byte(mapper.Control)
+    mapper.Irq.SaveBinary(writer)
+    mapper.Audio.SaveBinary(writer)
+}
+
+func (mapper *Mapper85) LoadBinary(reader *StateReader){
+    mapper.ProgramRom = reader.Bytes()
+    mapper.CharacterRom = reader.Bytes()
+    mapper.PRGRam = reader.Bytes()
+    mapper.SecondLine = reader.Uint16()
+    for i := range mapper.PrgRegister {
+        mapper.PrgRegister[i] = reader.Byte()
+    }
+    for i := range mapper.ChrRegister {
+        mapper.ChrRegister[i] = reader.Byte()
+    }
+    mapper.Control = reader.Byte()
+    mapper.Irq.LoadBinary(reader)
+    mapper.Audio = MakeVRC7Audio()
+    mapper.Audio.LoadBinary(reader)
+}
+
+func (mapper *Mapper85) IsIRQAsserted() bool {
+    return mapper.Irq.Pending
+}
+
+func (mapper *Mapper85) GetPRGRam() []byte {
+    return mapper.PRGRam
+}
+
+func (mapper *Mapper85) RunCycles(cycles uint64){
+    mapper.Irq.Run(cycles)
+}
+
+func (mapper *Mapper85) RunAudio(cycles float64, cyclesPerSample float64){
+    mapper.Audio.Run(cycles)
+}
+
+func (mapper *Mapper85) AudioOutput() float32 {
+    return mapper.Audio.GenerateSample()
+}
+
+func (mapper *Mapper85) prgRamEnabled() bool {
+    return mapper.Control & 0x80 == 0x80
+}
+
+func (mapper *Mapper85) readProgram(bank int, offset uint16) byte {
+    pages := len(mapper.ProgramRom) / 0x2000
+    return mapper.ProgramRom[(bank % pages) * 0x2000 + int(offset)]
+}
+
+func (mapper *Mapper85) Read(address uint16) byte {
+    switch {
+        case address >= 0x6000 && address < 0x8000:
+            if mapper.prgRamEnabled() {
+                return mapper.PRGRam[address - 0x6000]
+            }
+            return 0
+        case address >= 0x8000 && address < 0xe000:
+            index := (address - 0x8000) / 0x2000
+            return mapper.readProgram(int(mapper.PrgRegister[index]), address & 0x1fff)
+        case address >= 0xe000:
+            return mapper.readProgram(len(mapper.ProgramRom) / 0x2000 - 1, address & 0x1fff)
+    }
+
+    return 0
+}
+
+/* eight 1k chr banks */
+func (mapper *Mapper85) ReadPPU(ppu *PPUState, address uint16) byte {
+    var bank int
+    if address < 0x2000 {
+        bank = int(mapper.ChrRegister[address / 0x400])
+    }
+    return readChrBank(ppu, mapper.CharacterRom, address, bank, 0x400)
+}
+
+func (mapper *Mapper85) WritePPU(ppu *PPUState, address uint16, value byte){
+    writeChrBank(ppu, mapper.CharacterRom, address, value)
+}
+
+func (mapper *Mapper85) setMirroring(ppu *PPUState){
+    switch mapper.Control & 0x3 {
+        case 0: ppu.SetVerticalMirror()
+        case 1: ppu.SetHorizontalMirror()
+        case 2: ppu.SetScreenAMirror()
+        case 3: ppu.SetScreenBMirror()
+    }
+}
+
+func (mapper *Mapper85) Write(cpu *CPUState, address uint16, value byte) error {
+    if address >= 0x6000 && address < 0x8000 {
+        if mapper.prgRamEnabled() {
+            mapper.PRGRam[address - 0x6000] = value
+        }
+        return nil
+    }
+
+    /* the audio registers are only on the vrc7b */
+    if address & 0xf030 == VRC7RegisterSelect || address & 0xf030 == VRC7RegisterWrite {
+        mapper.Audio.HandleWrite(address & 0xf030, value)
+        return nil
+    }
+
+    second := address & mapper.SecondLine != 0
+    switch address & 0xf000 {
+        case 0x8000:
+            if second {
+                mapper.PrgRegister[1] = value & 0x3f
+            } else {
+                mapper.PrgRegister[0] = value & 0x3f
+            }
+        case 0x9000:
+            if !second {
+                mapper.PrgRegister[2] = value & 0x3f
+            }
+        case 0xa000, 0xb000, 0xc000, 0xd000:
+            index := (address - 0xa000) / 0x1000 * 2
+            if second {
+                index += 1
+            }
+            mapper.ChrRegister[index] = value
+        case 0xe000:
+            if second {
+                mapper.Irq.WriteLatch(value)
+            } else {
+                mute := value & 0x40 == 0x40
+                if mute && !mapper.Audio.Mute {
+                    mapper.Audio.Reset()
+                }
+                mapper.Audio.Mute = mute
+                mapper.Control = value
+                mapper.setMirroring(&cpu.PPU)
+            }
+        case 0xf000:
+            if second {
+                mapper.Irq.Acknowledge()
+            } else {
+                mapper.Irq.WriteControl(value)
+            }
+    }
+
+    return nil
+}
+
+func MakeMapper85(info MapperInfo, programRom []byte, chrMemory []byte) Mapper {
+    var line uint16 = 0x18
+    switch info.Submapper {
+        case 1: line = 0x08
+        case 2: line = 0x10
+    }
+
+    return &Mapper85{
+        ProgramRom: programRom,
+        CharacterRom: chrMemory,
+        PRGRam: make([]byte, 0x2000),
+        SecondLine: line,
+        Audio: MakeVRC7Audio(),
+    }
+}
@@ -0,0 +1,72 @@
+package lib
+
+import (
+    "testing"
+)
+
+func TestVRC7Audio(test *testing.T){
+    audio := MakeVRC7Audio()
+
+    /* play an A440 flute at full volume */
+    audio.HandleWrite(VRC7RegisterSelect, 0x30)
+    audio.HandleWrite(VRC7RegisterWrite, 0x40)
+    audio.HandleWrite(VRC7RegisterSelect, 0x10)
+    audio.HandleWrite(VRC7RegisterWrite, 0x22)
+    audio.HandleWrite(VRC7RegisterSelect, 0x20)
+    audio.HandleWrite(VRC7RegisterWrite, 0x19)
+
+    var loudest float32
+    for range 2000 {
+        audio.Run(vrc7SampleCycles)
+        loudest = max(loudest, audio.GenerateSample())
+    }
+    if loudest < 0.05 {
+        test.Fatalf("a keyed channel should make sound, loudest sample was %v", loudest)
+    }
+
+    /* key off and let the release finish */
+    audio.HandleWrite(VRC7RegisterWrite, 0x09)
+    for range 200000 {
+        audio.Run(vrc7SampleCycles)
+    }
+    if audio.Channels[0].Carrier.State != VRC7EnvelopeOff || audio.GenerateSample() != 0 {
+        test.Fatalf("the channel should be silent after its release, state %v sample %v", audio.Channels[0].Carrier.State, audio.GenerateSample())
+    }
+}
+
+func TestVRC7Registers(test *testing.T){
+    for _, submapper := range []byte{0, 1, 2} {
+        second := uint16(0x10)
+        if submapper == 1 {
+            second = 0x08
+        }
+
+        mapper := MakeMapper85(MapperInfo{Mapper: 85, Submapper: submapper}, makeMapperTestRom(0x20000, nil), makeBankedChr(0x20000)).(*Mapper85)
+        cpu := StartupState()
+        cpu.SetMapper(mapper)
+
+        cpu.StoreMemory(0x8000, 3)
+        cpu.StoreMemory(0x8000 | second, 4)
+        cpu.StoreMemory(0x9000, 5)
+        for i, expected := range []byte{3, 4, 5, 15} {
+            if value := cpu.LoadMemory(0x9000 + uint16(i) * 0x2000); value != expected {
+                test.Fatalf("submapper %v: expected page %v in prg bank %v but got %v", submapper, expected, i, value)
+            }
+        }
+
+        cpu.StoreMemory(0xd000 | second, 9)
+        if mapper.ChrRegister[7] != 9 {
+            test.Fatalf("submapper %v: expected chr bank 7 to be set: %v", submapper, mapper.ChrRegister)
+        }
+        if value := readPPUData(&cpu, 0x1c00); value != 9 {
+            test.Fatalf("submapper %v: expected bank 9 at $1c00 but got %v", submapper, value)
+        }
+
+        cpu.StoreMemory(0xe000 | second, 0xfe)
+        cpu.StoreMemory(0xf000, 0x6)
+        cpu.StoreMemory(0xf000 | second, 0)
+        if mapper.Irq.Latch != 0xfe || !mapper.Irq.CycleMode {
+            test.Fatalf("submapper %v: irq registers were not set", submapper)
+        }
+    }
+}
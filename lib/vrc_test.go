@@ -0,0 +1,296 @@
+package lib
+
+import (
+    "compress/gzip"
+    "io"
+    "os"
+    "testing"
+)
+
+func TestVRCIrq(test *testing.T){
+    var irq VRCIrq
+
+    /* cycle mode, 16 cycles until the counter overflows */
+    irq.WriteLatch(0xf0)
+    irq.WriteControl(0x7)
+    irq.Run(15)
+    if irq.Pending {
+        test.Fatalf("irq raised too early")
+    }
+    irq.Run(1)
+    if !irq.Pending || irq.Counter != 0xf0 {
+        test.Fatalf("irq should be raised and the counter reloaded, pending %v counter 0x%x", irq.Pending, irq.Counter)
+    }
+
+    irq.Acknowledge()
+    if irq.Pending || !irq.Enabled {
+        test.Fatalf("acknowledging should clear the irq and keep it enabled")
+    }
+
+    /* scanline mode, 3 scanlines of 341 ppu dots is 341 cpu cycles */
+    irq.WriteLatch(0xfd)
+    irq.WriteControl(0x2)
+    irq.Run(340)
+    if irq.Pending {
+        test.Fatalf("irq raised too early in scanline mode")
+    }
+    irq.Run(1)
+    if !irq.Pending {
+        test.Fatalf("irq should be raised after 3 scanlines")
+    }
+
+    irq.Acknowledge()
+    if irq.Enabled {
+        test.Fatalf("irq should be disabled after acknowledging when the E bit is clear")
+    }
+}
+
+func TestVRC6Banking(test *testing.T){
+    for _, kind := range []uint32{24, 26} {
+        program := makeMapperTestRom(0x20000, nil)
+        mapper, err := MakeMapper(MapperInfo{Mapper: kind}, program, makeMapperTestChr(0x20000))
+        if err != nil {
+            test.Fatalf("could not make mapper %v: %v", kind, err)
+        }
+
+        cpu := StartupState()
+        cpu.SetMapper(mapper)
+
+        /* each 8k page of the test rom has its page number at 0x1000 */
+        cpu.StoreMemory(0x8000, 3)
+        if value := cpu.LoadMemory(0x9000); value != 6 {
+            test.Fatalf("mapper %v: expected page 6 at 0x8000 but got %v", kind, value)
+        }
+        if value := cpu.LoadMemory(0xb000); value != 7 {
+            test.Fatalf("mapper %v: expected page 7 at 0xa000 but got %v", kind, value)
+        }
+
+        cpu.StoreMemory(0xc000, 9)
+        if value := cpu.LoadMemory(0xd000); value != 9 {
+            test.Fatalf("mapper %v: expected page 9 at 0xc000 but got %v", kind, value)
+        }
+        if value := cpu.LoadMemory(0xf000); value != 15 {
+            test.Fatalf("mapper %v: expected the last page at 0xe000 but got %v", kind, value)
+        }
+
+        /* $d001 is the second chr register on mapper 24 and the third on mapper 26 */
+        cpu.StoreMemory(0xd001, 5)
+        switch kind {
+            case 24:
+                registers := mapper.(*Mapper24).ChrRegister
+                if registers[1] != 5 {
+                    test.Fatalf("mapper 24: expected chr register 1 to be set: %v", registers)
+                }
+            case 26:
+                registers := mapper.(*Mapper26).ChrRegister
+                if registers[2] != 5 {
+                    test.Fatalf("mapper 26: expected chr register 2 to be set: %v", registers)
+                }
+        }
+
+        /* prg ram is enabled by bit 7 of $b003 */
+        cpu.StoreMemory(0xb003, 0x80)
+        cpu.StoreMemory(0x6000, 0x42)
+        if value := cpu.LoadMemory(0x6000); value != 0x42 {
+            test.Fatalf("mapper %v: expected 0x42 in prg ram but got %v", kind, value)
+        }
+    }
+}
+
+func TestVRC6ChrBanking(test *testing.T){
+    cpu := StartupState()
+    cpu.SetMapper(MakeMapper24(makeMapperTestRom(0x20000, nil), makeBankedChr(0x40000)))
+
+    /* mode 0 has eight 1k banks */
+    cpu.StoreMemory(0xd001, 0x21)
+    cpu.StoreMemory(0xe003, 0x87)
+    if value := readPPUData(&cpu, 0x0400); value != 0x21 {
+        test.Fatalf("expected bank 0x21 at $0400 but got 0x%x", value)
+    }
+    if value := readPPUData(&cpu, 0x1c00); value != 0x87 {
+        test.Fatalf("expected bank 0x87 at $1c00 but got 0x%x", value)
+    }
+
+    /* mode 1 has four 2k banks, with ppu A10 replacing the low bit of the register */
+    cpu.StoreMemory(0xb003, 0x1)
+    cpu.StoreMemory(0xd003, 0x41)
+    if value := readPPUData(&cpu, 0x1800); value != 0x40 {
+        test.Fatalf("expected bank 0x40 at $1800 but got 0x%x", value)
+    }
+    if value := readPPUData(&cpu, 0x1c00); value != 0x41 {
+        test.Fatalf("expected bank 0x41 at $1c00 but got 0x%x", value)
+    }
+
+    /* mode 2 has four 1k banks then two 2k banks */
+    cpu.StoreMemory(0xb003, 0x2)
+    cpu.StoreMemory(0xe001, 0x30)
+    if value := readPPUData(&cpu, 0x0c00); value != 0x41 {
+        test.Fatalf("expected bank 0x41 at $0c00 but got 0x%x", value)
+    }
+    if value := readPPUData(&cpu, 0x1c00); value != 0x31 {
+        test.Fatalf("expected bank 0x31 at $1c00 but got 0x%x", value)
+    }
+}
+
+/* binary states with mapper 24 saved by older versions of the emulator. the version 3 states from
+ * before vrc7 support also saved the vrc6 sample cycles
+ */
+func TestVRC6OldStates(test *testing.T){
+    for _, path := range []string{"testdata/state-3-mapper24-samplecycles.bin.gz", "testdata/state-3-mapper24.bin.gz", "testdata/state-8-mapper24.bin.gz"} {
+        file, err := os.Open(path)
+        if err != nil {
+            test.Fatalf("could not open %v: %v", path, err)
+        }
+
+        decompress, err := gzip.NewReader(file)
+        if err != nil {
+            test.Fatalf("could not decompress %v: %v", path, err)
+        }
+        data, err := io.ReadAll(decompress)
+        file.Close()
+        if err != nil {
+            test.Fatalf("could not read %v: %v", path, err)
+        }
+
+        cpu, err := DecodeBinaryState(data)
+        if err != nil {
+            test.Fatalf("could not load %v: %v", path, err)
+        }
+
+        mapper, ok := cpu.Mapper.Mapper.(*Mapper24)
+        if !ok {
+            test.Fatalf("%v: expected mapper 24 but got %v", path, cpu.Mapper.Kind)
+        }
+        if mapper.PrgBank16 != 3 || mapper.ChrRegister[1] != 5 {
+            test.Fatalf("%v: wrong banks %v %v", path, mapper.PrgBank16, mapper.ChrRegister)
+        }
+        if mapper.Audio.Saw.Rate != 0x2a || !mapper.Audio.Saw.Enabled || mapper.Audio.Halt || !mapper.Audio.X16 || !mapper.Audio.X256 {
+            test.Fatalf("%v: the vrc6 audio was misread: %+v", path, mapper.Audio)
+        }
+    }
+}
+
+func TestVRC4Wiring(test *testing.T){
+    /* the address of the register that sets the high nibble of chr bank 1 on each board */
+    boards := []struct {
+        Mapper uint32
+        Submapper byte
+        Address uint16
+    }{
+        {21, 1, 0xb006},
+        {21, 2, 0xb0c0},
+        {21, 0, 0xb0c0},
+        {22, 0, 0xb003},
+        {23, 1, 0xb003},
+        {23, 2, 0xb00c},
+        {23, 0, 0xb00c},
+        {25, 1, 0xb003},
+        {25, 2, 0xb00c},
+        {25, 0, 0xb003},
+    }
+
+    for _, board := range boards {
+        info := MapperInfo{Mapper: board.Mapper, Submapper: board.Submapper, Nes2: true}
+        mapper := MakeMapperVRC4(info, makeMapperTestRom(0x20000, nil), makeMapperTestChr(0x20000)).(*MapperVRC4)
+
+        cpu := StartupState()
+        cpu.SetMapper(mapper)
+        cpu.StoreMemory(board.Address, 0x3)
+        if mapper.ChrRegister[1] != 0x30 {
+            test.Fatalf("mapper %v submapper %v: writing 0x%x should set chr bank 1 but the banks are %v", board.Mapper, board.Submapper, board.Address, mapper.ChrRegister)
+        }
+    }
+
+    /* a vrc2 without prg ram has a 1-bit latch at $6000 */
+    mapper := MakeMapperVRC4(MapperInfo{Mapper: 23, Submapper: 3, Nes2: true}, makeMapperTestRom(0x20000, nil), nil)
+    cpu := StartupState()
+    cpu.SetMapper(mapper)
+    cpu.StoreMemory(0x6000, 0xff)
+    if value := cpu.LoadMemory(0x6000); value != 0x1 {
+        test.Fatalf("expected the latch to hold 1 but got 0x%x", value)
+    }
+
+    /* prg swap mode moves the switchable bank to $c000 */
+    mapper = MakeMapperVRC4(MapperInfo{Mapper: 25, Submapper: 1, Nes2: true}, makeMapperTestRom(0x20000, nil), nil)
+    cpu = StartupState()
+    cpu.SetMapper(mapper)
+    cpu.StoreMemory(0x8000, 4)
+    cpu.StoreMemory(0x9001, 0x2)
+    if value := cpu.LoadMemory(0xd000); value != 4 {
+        test.Fatalf("expected page 4 at $c000 in swap mode but got %v", value)
+    }
+    if value := cpu.LoadMemory(0x9000); value != 14 {
+        test.Fatalf("expected the second to last page at $8000 in swap mode but got %v", value)
+    }
+}
+
+func TestVRC4ChrBanking(test *testing.T){
+    cpu := StartupState()
+    cpu.SetMapper(MakeMapperVRC4(MapperInfo{Mapper: 23, Submapper: 1, Nes2: true}, makeMapperTestRom(0x20000, nil), makeBankedChr(0x40000)))
+
+    /* 1k bank 0x93 at $0400 and bank 0x2c at $1c00, each set a nibble at a time */
+    cpu.StoreMemory(0xb002, 0x3)
+    cpu.StoreMemory(0xb003, 0x9)
+    cpu.StoreMemory(0xe002, 0xc)
+    cpu.StoreMemory(0xe003, 0x2)
+
+    if value := readPPUData(&cpu, 0x0400); value != 0x93 {
+        test.Fatalf("expected bank 0x93 at $0400 but got 0x%x", value)
+    }
+    if value := readPPUData(&cpu, 0x1fff); value != 0x2c {
+        test.Fatalf("expected bank 0x2c at $1c00 but got 0x%x", value)
+    }
+
+    /* the vrc2a drops the low bit of the bank */
+    cpu = StartupState()
+    cpu.SetMapper(MakeMapperVRC4(MapperInfo{Mapper: 22}, makeMapperTestRom(0x20000, nil), makeBankedChr(0x20000)))
+    cpu.StoreMemory(0xb000, 0x7)
+    if value := readPPUData(&cpu, 0x0000); value != 3 {
+        test.Fatalf("expected bank 3 at $0000 on the vrc2a but got %v", value)
+    }
+
+    /* without chr rom the pattern tables are chr ram */
+    cpu = StartupState()
+    cpu.SetMapper(MakeMapperVRC4(MapperInfo{Mapper: 23}, makeMapperTestRom(0x20000, nil), nil))
+    cpu.PPU.VideoAddress = 0x1234
+    cpu.PPU.WriteVideoMemory(0x5a, cpu.Mapper.Mapper)
+    if value := readPPUData(&cpu, 0x1234); value != 0x5a {
+        test.Fatalf("expected 0x5a in chr ram but got 0x%x", value)
+    }
+}
+
+func TestVRC4PrgRam(test *testing.T){
+    /* an ines vrc2 without a battery gets the latch */
+    mapper := MakeMapperVRC4(MapperInfo{Mapper: 22, PRGRam: 0x2000}, makeMapperTestRom(0x20000, nil), nil).(*MapperVRC4)
+    if mapper.PRGRam != nil {
+        test.Fatalf("an ines header without a battery should not have prg ram")
+    }
+    cpu := StartupState()
+    cpu.SetMapper(mapper)
+    cpu.StoreMemory(0x6000, 0x3)
+    if value := cpu.LoadMemory(0x6fff); value != 0x1 {
+        test.Fatalf("expected the latch at $6fff but got 0x%x", value)
+    }
+
+    mapper = MakeMapperVRC4(MapperInfo{Mapper: 21, PRGNVRam: 0x2000, Battery: true}, makeMapperTestRom(0x20000, nil), nil).(*MapperVRC4)
+    if len(mapper.PRGRam) != 0x2000 {
+        test.Fatalf("an ines header with a battery should have 8k of prg ram")
+    }
+    cpu = StartupState()
+    cpu.SetMapper(mapper)
+    cpu.StoreMemory(0x6000, 0x42)
+    if value := cpu.LoadMemory(0x6000); value != 0x42 {
+        test.Fatalf("expected 0x42 in prg ram but got 0x%x", value)
+    }
+
+    /* bit 0 of $9002 disables the ram */
+    cpu.StoreMemory(0x9004, 0x0)
+    cpu.StoreMemory(0x6000, 0x13)
+    if value := cpu.LoadMemory(0x6000); value != 0 {
+        test.Fatalf("prg ram should not be readable when disabled but got 0x%x", value)
+    }
+    cpu.StoreMemory(0x9004, 0x1)
+    if value := cpu.LoadMemory(0x6000); value != 0x42 {
+        test.Fatalf("prg ram should not be writable when disabled but got 0x%x", value)
+    }
+}
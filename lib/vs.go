@@ -0,0 +1,345 @@
+package lib
+
+import (
+    "fmt"
+)
+
+/* The VS. UniSystem arcade boards and the PlayChoice-10. Both use RGB ppus instead of the
+ * 2c02, and the VS. System adds coin slots and dip switches to the controller ports.
+ * https://www.nesdev.org/wiki/Vs._System
+ * https://www.nesdev.org/wiki/PPU_palettes#2C03_and_2C05
+ */
+
+type PPUModel byte
+const (
+    PPU2C02 PPUModel = iota
+    PPU2C03
+    PPU2C04_0001
+    PPU2C04_0002
+    PPU2C04_0003
+    PPU2C04_0004
+    PPU2C05_01
+    PPU2C05_02
+    PPU2C05_03
+    PPU2C05_04
+    PPU2C05_05
+)
+
+func (model PPUModel) String() string {
+    switch model {
+        case PPU2C02: return "2C02"
+        case PPU2C03: return "2C03"
+        case PPU2C04_0001: return "2C04-0001"
+        case PPU2C04_0002: return "2C04-0002"
+        case PPU2C04_0003: return "2C04-0003"
+        case PPU2C04_0004: return "2C04-0004"
+        case PPU2C05_01: return "2C05-01"
+        case PPU2C05_02: return "2C05-02"
+        case PPU2C05_03: return "2C05-03"
+        case PPU2C05_04: return "2C05-04"
+        case PPU2C05_05: return "2C05-05"
+    }
+
+    return "unknown"
+}
+
+/* the ppu from the vs ppu type in byte 13 of a nes 2.0 header */
+func VsPPUModel(vsPPUType byte) PPUModel {
+    switch vsPPUType {
+        /* RP2C03B, RP2C03G, RC2C03B and RC2C03C all have the same palette */
+        case 0, 1, 6, 7: return PPU2C03
+        case 2: return PPU2C04_0001
+        case 3: return PPU2C04_0002
+        case 4: return PPU2C04_0003
+        case 5: return PPU2C04_0004
+        case 8: return PPU2C05_01
+        case 9: return PPU2C05_02
+        case 10: return PPU2C05_03
+        case 11: return PPU2C05_04
+        case 12: return PPU2C05_05
+    }
+
+    return PPU2C03
+}
+
+/* the 2c05 has PPUCTRL at $2001 and PPUMASK at $2000 */
+func (model PPUModel) SwapsControlRegisters() bool {
+    return model >= PPU2C05_01 && model <= PPU2C05_05
+}
+
+/* the 2c05 returns an id in the low bits of PPUSTATUS that games check for protection */
+func (model PPUModel) statusID() byte {
+    switch model {
+        case PPU2C05_01, PPU2C05_04: return 0x1b
+        case PPU2C05_02: return 0x3d
+        case PPU2C05_03: return 0x1c
+    }
+
+    return 0
+}
+
+/* the rgb ppus have 3 bits per channel, written here as octal */
+var rgbPPUPalette = []uint16{
+    0333, 0014, 0006, 0326, 0403, 0503, 0510, 0420, 0320, 0120, 0031, 0040, 0022, 0111, 0003, 0020,
+    0555, 0036, 0027, 0407, 0507, 0704, 0700, 0630, 0430, 0140, 0040, 0053, 0044, 0222, 0200, 0310,
+    0777, 0357, 0447, 0637, 0707, 0737, 0740, 0750, 0660, 0360, 0070, 0276, 0077, 0444, 0000, 0000,
+    0777, 0567, 0657, 0757, 0747, 0755, 0764, 0770, 0773, 0572, 0473, 0276, 0467, 0666, 0653, 0760,
+}
+
+/* the 2c04 variants have the same colors as the 2c03 but in a scrambled order, so that a
+ * game only looks right on its own ppu. each entry is an index into rgbPPUPalette
+ */
+var ppu2c04Order = map[PPUModel][]byte{
+    PPU2C04_0001: []byte{
+        0x35, 0x23, 0x16, 0x22, 0x1c, 0x09, 0x1d, 0x15, 0x20, 0x00, 0x27, 0x05, 0x04, 0x28, 0x08, 0x20,
+        0x21, 0x3e, 0x1f, 0x29, 0x3c, 0x32, 0x36, 0x12, 0x3f, 0x2b, 0x2e, 0x1e, 0x3d, 0x2d, 0x24, 0x01,
+        0x0e, 0x31, 0x33, 0x2a, 0x2c, 0x0c, 0x1b, 0x14, 0x2e, 0x07, 0x34, 0x06, 0x13, 0x02, 0x26, 0x2e,
+        0x2e, 0x19, 0x10, 0x0a, 0x39, 0x03, 0x37, 0x17, 0x0f, 0x11, 0x0b, 0x0d, 0x38, 0x25, 0x18, 0x3a,
+    },
+    PPU2C04_0002: []byte{
+        0x2e, 0x27, 0x18, 0x39, 0x3a, 0x25, 0x1c, 0x31, 0x16, 0x13, 0x38, 0x34, 0x20, 0x23, 0x3c, 0x0b,
+        0x0f, 0x21, 0x06, 0x3d, 0x1b, 0x29, 0x1e, 0x22, 0x1d, 0x24, 0x0e, 0x2b, 0x32, 0x08, 0x2e, 0x03,
+        0x04, 0x36, 0x26, 0x33, 0x11, 0x1f, 0x10, 0x02, 0x14, 0x3f, 0x00, 0x09, 0x12, 0x2e, 0x28, 0x20,
+        0x3e, 0x0d, 0x2a, 0x17, 0x0c, 0x01, 0x15, 0x19, 0x2e, 0x2c, 0x07, 0x37, 0x35, 0x05, 0x0a, 0x2d,
+    },
+    PPU2C04_0003: []byte{
+        0x14, 0x25, 0x3a, 0x10, 0x0b, 0x20, 0x31, 0x09, 0x01, 0x2e, 0x36, 0x08, 0x15, 0x3d, 0x3e, 0x3c,
+        0x22, 0x1c, 0x05, 0x12, 0x19, 0x18, 0x17, 0x1b, 0x00, 0x03, 0x2e, 0x02, 0x16, 0x06, 0x34, 0x35,
+        0x23, 0x0f, 0x0e, 0x37, 0x0d, 0x27, 0x26, 0x20, 0x29, 0x04, 0x21, 0x24, 0x11, 0x2d, 0x2e, 0x1f,
+        0x2c, 0x1e, 0x39, 0x33, 0x07, 0x2a, 0x28, 0x1d, 0x0a, 0x2e, 0x32, 0x38, 0x13, 0x2b, 0x3f, 0x0c,
+    },
+    PPU2C04_0004: []byte{
+        0x18, 0x03, 0x1c, 0x28, 0x2e, 0x35, 0x01, 0x17, 0x10, 0x1f, 0x2a, 0x0e, 0x36, 0x37, 0x1a, 0x39,
+        0x25, 0x1e, 0x12, 0x34, 0x2e, 0x1d, 0x06, 0x26, 0x3e, 0x1b, 0x22, 0x19, 0x04, 0x2e, 0x3a, 0x21,
+        0x05, 0x0a, 0x07, 0x02, 0x13, 0x14, 0x00, 0x15, 0x0c, 0x3d, 0x11, 0x0f, 0x0d, 0x38, 0x2d, 0x24,
+        0x33, 0x20, 0x08, 0x16, 0x3f, 0x2b, 0x20, 0x3c, 0x2e, 0x27, 0x23, 0x31, 0x29, 0x32, 0x2c, 0x09,
+    },
+}
+
+func rgbPPUColor(value uint16) []uint8 {
+    scale := func(level uint16) uint8 {
+        return uint8(level * 255 / 7)
+    }
+
+    return []uint8{scale((value >> 6) & 7), scale((value >> 3) & 7), scale(value & 7)}
+}
+
+func (model PPUModel) Palette() [][]uint8 {
+    if model == PPU2C02 {
+        return get2c02Palette()
+    }
+
+    out := make([][]uint8, len(rgbPPUPalette))
+    order, ok := ppu2c04Order[model]
+    for i := range out {
+        if ok {
+            out[i] = rgbPPUColor(rgbPPUPalette[order[i]])
+        } else {
+            out[i] = rgbPPUColor(rgbPPUPalette[i])
+        }
+    }
+
+    return out
+}
+
+/* which ppu the game was made for */
+func (file *NESFile) PPUModel() PPUModel {
+    switch file.Console {
+        case ConsoleVsSystem: return VsPPUModel(file.VsPPUType)
+        /* the playchoice-10 uses the RP2C03B */
+        case ConsolePlaychoice: return PPU2C03
+    }
+
+    return PPU2C02
+}
+
+/* a coin drops through the slot over a few frames. games look for the coin bit to
+ * change, so it has to stay set long enough for them to see it
+ */
+const vsCoinCycles = 4 * 29781
+
+/* the coin slots and dip switches of a vs. unisystem cabinet, which are read through the
+ * controller ports
+ *
+ * $4016 read: bit 0 controller, bit 2 service, bits 3-4 dip switches 1-2, bits 5-6 coin slots
+ * $4017 read: bit 0 controller, bits 2-7 dip switches 3-8
+ */
+type VsSystem struct {
+    /* dip switch 1 is bit 0 */
+    DipSwitches byte `json:"dipswitches"`
+    /* some games expect player 1 on $4017 and player 2 on $4016 */
+    SwapControllers bool `json:"swapcontrollers"`
+    /* the cpu cycle until which each coin slot reads as having a coin */
+    Coin [2]uint64 `json:"coin"`
+    /* last value written to $4020, which drives the coin counter */
+    CoinCounter byte `json:"coincounter"`
+}
+
+func (vs *VsSystem) Copy() *VsSystem {
+    if vs == nil {
+        return nil
+    }
+
+    out := *vs
+    return &out
+}
+
+/* slot is 0 or 1 */
+func (vs *VsSystem) InsertCoin(slot int, cycle uint64){
+    if slot >= 0 && slot < len(vs.Coin) {
+        vs.Coin[slot] = cycle + vsCoinCycles
+    }
+}
+
+func (vs *VsSystem) Read(address uint16, controller byte, cycle uint64) byte {
+    out := controller & 0x1
+    switch address {
+        case JOYPAD1:
+            out |= (vs.DipSwitches & 0x3) << 3
+            for slot, until := range vs.Coin {
+                if cycle < until {
+                    out |= 1 << (5 + slot)
+                }
+            }
+        case JOYPAD2:
+            out |= vs.DipSwitches & 0xfc
+    }
+
+    return out
+}
+
+func (vs *VsSystem) SaveBinary(writer *StateWriter){
+    writer.Byte(vs.DipSwitches)
+    writer.Bool(vs.SwapControllers)
+    for _, coin := range vs.Coin {
+        writer.Uint64(coin)
+    }
+    writer.Byte(vs.CoinCounter)
+}
+
+func (vs *VsSystem) LoadBinary(reader *StateReader){
+    vs.DipSwitches = reader.Byte()
+    vs.SwapControllers = reader.Bool()
+    for i := range vs.Coin {
+        vs.Coin[i] = reader.Uint64()
+    }
+    vs.CoinCounter = reader.Byte()
+}
+
+/* VS. UniSystem (mapper 99). Bit 2 of writes to $4016 selects the 8k chr bank, and for the
+ * one 40k game, the 8k prg bank at $8000. The cabinet has 2k of ram at $6000-$7fff.
+ */
+type Mapper99 struct {
+    ProgramRom []byte `json:"programrom"`
+    CharacterRom []byte `json:"characterrom"`
+    PRGRam []byte `json:"prgram"`
+    Bank byte `json:"bank"`
+}
+
+func (mapper *Mapper99) IsNSF() bool {
+    return false
+}
+
+func (mapper *Mapper99) Kind() int {
+    return 99
+}
+
+func (mapper *Mapper99) Compare(other Mapper) error {
+    him, ok := other.(*Mapper99)
+    if !ok {
+        return fmt.Errorf("other was not a mapper99")
+    }
+
+    if mapper.Bank != him.Bank {
+        return fmt.Errorf("banks differ: me=%v him=%v", mapper.Bank, him.Bank)
+    }
+
+    err := compareSlice(mapper.PRGRam, him.PRGRam)
+    if err != nil {
+        return err
+    }
+
+    return compareSlice(mapper.ProgramRom, him.ProgramRom)
+}
+
+func (mapper *Mapper99) Copy() Mapper {
+    return &Mapper99{
+        ProgramRom: copySlice(mapper.ProgramRom),
+        CharacterRom: copySlice(mapper.CharacterRom),
+        PRGRam: copySlice(mapper.PRGRam),
+        Bank: mapper.Bank,
+    }
+}
+
+func (mapper *Mapper99) SaveBinary(writer *StateWriter){
+    writer.Bytes(mapper.ProgramRom)
+    writer.Bytes(mapper.CharacterRom)
+    writer.Bytes(mapper.PRGRam)
+    writer.Byte(mapper.Bank)
+}
+
+func (mapper *Mapper99) LoadBinary(reader *StateReader){
+    mapper.ProgramRom = reader.Bytes()
+    mapper.CharacterRom = reader.Bytes()
+    mapper.PRGRam = reader.Bytes()
+    mapper.Bank = reader.Byte()
+}
+
+func (mapper *Mapper99) IsIRQAsserted() bool {
+    return false
+}
+
+func (mapper *Mapper99) GetPRGRam() []byte {
+    return mapper.PRGRam
+}
+
+func (mapper *Mapper99) Read(address uint16) byte {
+    if address >= 0x6000 && address < 0x8000 {
+        return mapper.PRGRam[int(address) % len(mapper.PRGRam)]
+    }
+
+    if address >= 0x8000 {
+        /* only the 40k game has more than the 32k that fits */
+        if len(mapper.ProgramRom) > 0x8000 && address < 0xa000 {
+            return readBank(mapper.ProgramRom, int(mapper.Bank) * 4, 0x2000, address - 0x8000)
+        }
+
+        return readBank(mapper.ProgramRom, 0, 0x8000, address - 0x8000)
+    }
+
+    return 0
+}
+
+func (mapper *Mapper99) Write(cpu *CPUState, address uint16, value byte) error {
+    if address >= 0x6000 && address < 0x8000 {
+        mapper.PRGRam[int(address) % len(mapper.PRGRam)] = value
+        return nil
+    }
+
+    /* the rom can't be written, but some games do it anyway */
+    if address >= 0x8000 {
+        return nil
+    }
+
+    return fmt.Errorf("invalid mapper99 write address=0x%x value=0x%x", address, value)
+}
+
+func (mapper *Mapper99) WriteInputPoll(cpu *CPUState, value byte){
+    mapper.Bank = (value >> 2) & 0x1
+}
+
+func (mapper *Mapper99) ReadPPU(ppu *PPUState, address uint16) byte {
+    return readChrBank(ppu, mapper.CharacterRom, address, int(mapper.Bank), 0x2000)
+}
+
+func (mapper *Mapper99) WritePPU(ppu *PPUState, address uint16, value byte){
+    writeChrBank(ppu, mapper.CharacterRom, address, value)
+}
+
+func MakeMapper99(programRom []byte, chrMemory []byte) Mapper {
+    return &Mapper99{
+        ProgramRom: programRom,
+        CharacterRom: chrMemory,
+        PRGRam: make([]byte, 0x800),
+    }
+}
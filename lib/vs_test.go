@@ -0,0 +1,136 @@
+package lib
+
+import (
+    "slices"
+    "testing"
+)
+
+func TestVsPalettes(test *testing.T){
+    colors := func(palette [][]uint8) map[[3]uint8]bool {
+        out := make(map[[3]uint8]bool)
+        for _, color := range palette {
+            out[[3]uint8(color)] = true
+        }
+        return out
+    }
+
+    rgb := colors(PPU2C03.Palette())
+    for _, model := range []PPUModel{PPU2C04_0001, PPU2C04_0002, PPU2C04_0003, PPU2C04_0004} {
+        palette := model.Palette()
+        if len(palette) != 64 {
+            test.Fatalf("%v: expected 64 colors but got %v", model, len(palette))
+        }
+
+        /* the same colors in a different order */
+        scrambled := colors(palette)
+        if len(scrambled) != len(rgb) {
+            test.Fatalf("%v: expected %v distinct colors but got %v", model, len(rgb), len(scrambled))
+        }
+        for color := range scrambled {
+            if !rgb[color] {
+                test.Fatalf("%v: color %v is not in the 2c03 palette", model, color)
+            }
+        }
+
+        if slices.EqualFunc(palette, PPU2C03.Palette(), slices.Equal) {
+            test.Fatalf("%v: palette should not be in the 2c03 order", model)
+        }
+    }
+
+    white := PPU2C03.Palette()[0x20]
+    if white[0] != 255 || white[1] != 255 || white[2] != 255 {
+        test.Fatalf("expected white but got %v", white)
+    }
+}
+
+func TestVs2C05(test *testing.T){
+    cpu := StartupState()
+    cpu.SetMapper(MakeMapper99(make([]byte, 0x8000), make([]byte, 0x4000)))
+    cpu.PPU.SetModel(VsPPUModel(8))
+    cpu.Cycle = 100000
+
+    /* nmi enable goes to $2001 on the 2c05 */
+    cpu.StoreMemory(0x2001, 0x80)
+    cpu.StoreMemory(0x2000, 0x1e)
+    if cpu.PPU.Flags != 0x80 || cpu.PPU.Mask != 0x1e {
+        test.Fatalf("PPUCTRL and PPUMASK should be swapped: ctrl=0x%x mask=0x%x", cpu.PPU.Flags, cpu.PPU.Mask)
+    }
+
+    if cpu.LoadMemory(0x2002) & 0x3f != 0x1b {
+        test.Fatalf("expected the 2c05-01 id in PPUSTATUS")
+    }
+
+    cpu.PPU.SetModel(VsPPUModel(9))
+    cpu.PPU.SetVerticalBlankFlag(true)
+    if value := cpu.LoadMemory(0x2002); value != 0xbd {
+        test.Fatalf("expected vblank and the 2c05-02 id in PPUSTATUS but got 0x%x", value)
+    }
+}
+
+type vsTestButtons struct {
+    buttons ButtonMapping
+}
+
+func (buttons *vsTestButtons) Get() ButtonMapping {
+    return buttons.buttons
+}
+
+func TestVsSystemPorts(test *testing.T){
+    cpu := StartupState()
+    mapper := MakeMapper99(make([]byte, 0x8000), makeBankedChr(0x4000)).(*Mapper99)
+    cpu.SetMapper(mapper)
+    cpu.Input = MakeInput(&vsTestButtons{buttons: ButtonMapping{ButtonIndexA: true}})
+    cpu.Input2 = MakeInput(&vsTestButtons{buttons: ButtonMapping{}})
+    cpu.Vs = &VsSystem{DipSwitches: 0xa5}
+
+    cpu.StoreMemory(0x4016, 0x1)
+    cpu.StoreMemory(0x4016, 0x0)
+
+    /* the a button and dip switch 1 */
+    if value := cpu.LoadMemory(0x4016); value != 0x09 {
+        test.Fatalf("unexpected $4016 value 0x%x", value)
+    }
+    if value := cpu.LoadMemory(0x4017); value != 0xa4 {
+        test.Fatalf("unexpected $4017 value 0x%x", value)
+    }
+
+    cpu.Vs.InsertCoin(1, cpu.Cycle)
+    if cpu.LoadMemory(0x4016) & 0x40 == 0 {
+        test.Fatalf("coin 2 should be inserted")
+    }
+    cpu.Cycle += vsCoinCycles
+    if cpu.LoadMemory(0x4016) & 0x60 != 0 {
+        test.Fatalf("coin should have dropped")
+    }
+
+    /* player 1 moves to $4017 */
+    cpu.Vs.SwapControllers = true
+    cpu.StoreMemory(0x4016, 0x1)
+    cpu.StoreMemory(0x4016, 0x0)
+    if cpu.LoadMemory(0x4016) & 0x1 != 0 || cpu.LoadMemory(0x4017) & 0x1 != 1 {
+        test.Fatalf("controllers should be swapped")
+    }
+
+    /* bit 2 of the strobe selects the chr bank */
+    cpu.StoreMemory(0x4016, 0x4)
+    if mapper.Bank != 1 {
+        test.Fatalf("expected chr bank 1 but got %v", mapper.Bank)
+    }
+    if value := readPPUData(&cpu, 0x0400); value != 9 {
+        test.Fatalf("expected the second 8k of chr at $0400 but got %v", value)
+    }
+
+    data, err := EncodeBinaryState(&cpu)
+    if err != nil {
+        test.Fatalf("could not save state: %v", err)
+    }
+
+    loaded, err := DecodeBinaryState(data)
+    if err != nil {
+        test.Fatalf("could not load state: %v", err)
+    }
+
+    if loaded.Vs == nil || *loaded.Vs != *cpu.Vs {
+        test.Fatalf("vs system state was not restored: %+v", loaded.Vs)
+    }
+}
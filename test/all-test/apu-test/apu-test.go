@@ -24,7 +24,7 @@ func doTest(rom string, passAddress uint16, failAddress uint16) (bool, error) {
 
     cpu := nes.StartupState()
 
-    mapper, err := nes.MakeMapper(nesFile.Mapper, nesFile.ProgramRom, nesFile.CharacterRom)
+    mapper, err := nes.MakeMapper(nesFile.MapperInfo(), nesFile.ProgramRom, nesFile.CharacterRom)
     if err != nil {
         return false, err
     }
@@ -32,28 +32,13 @@ func doTest(rom string, passAddress uint16, failAddress uint16) (bool, error) {
 
     cpu.Reset()
 
-    screen := nes.MakeVirtualScreen(256, 240)
-    instructionTable := nes.MakeInstructionDescriptiontable()
-    baseCyclesPerSample := 100.0
+    machine := nes.MakeMachine(&cpu, 44100)
 
     for cpu.PC != passAddress && cpu.PC != failAddress {
-        cycles := cpu.Cycle
-        err := cpu.Run(instructionTable)
+        _, err := machine.StepInstruction()
         if err != nil {
             return false, err
         }
-        usedCycles := cpu.Cycle
-
-        cpu.APU.Run((float64(usedCycles) - float64(cycles)) / 2.0, baseCyclesPerSample, &cpu)
-
-        nmi, _ := cpu.PPU.Run((usedCycles - cycles) * 3, screen, mapper)
-
-        if nmi {
-            if cpu.Debug > 0 {
-                log.Printf("Cycle %v Do NMI\n", cpu.Cycle)
-            }
-            cpu.NMI()
-        }
     }
 
     switch cpu.PC {
@@ -25,7 +25,7 @@ func doTest(rom string) (bool, error) {
 
     cpu := nes.StartupState()
 
-    mapper, err := nes.MakeMapper(nesFile.Mapper, nesFile.ProgramRom, nesFile.CharacterRom)
+    mapper, err := nes.MakeMapper(nesFile.MapperInfo(), nesFile.ProgramRom, nesFile.CharacterRom)
     if err != nil {
         return false, err
     }
@@ -33,32 +33,13 @@ func doTest(rom string) (bool, error) {
 
     cpu.Reset()
 
-    screen := nes.MakeVirtualScreen(256, 240)
-    instructionTable := nes.MakeInstructionDescriptiontable()
-    baseCyclesPerSample := 100.0
+    machine := nes.MakeMachine(&cpu, 44100)
 
-    var lastCycle uint64 = 0
     for totalCycles := uint32(0); totalCycles < 150000; totalCycles++ {
-        err := cpu.Run(instructionTable)
+        _, err := machine.StepInstruction()
         if err != nil {
             return false, err
         }
-        usedCycles := cpu.Cycle
-
-        cycleDiff := usedCycles - lastCycle
-
-        cpu.APU.Run(float64(cycleDiff) / 2.0, baseCyclesPerSample, &cpu)
-
-        nmi, _ := cpu.PPU.Run(cycleDiff * 3, screen, mapper)
-
-        if nmi {
-            if cpu.Debug > 0 {
-                log.Printf("Cycle %v Do NMI\n", cpu.Cycle)
-            }
-            cpu.NMI()
-        }
-
-        lastCycle = usedCycles
     }
 
     result := cpu.LoadMemory(ResultAddress)
@@ -5,6 +5,7 @@ import (
     aputest "github.com/kazzmir/nes/test/all-test/apu-test"
     branch "github.com/kazzmir/nes/test/all-test/branch"
     screenshot "github.com/kazzmir/nes/test/all-test/screenshot"
+    sprite "github.com/kazzmir/nes/test/all-test/sprite"
     test_utils "github.com/kazzmir/nes/test/all-test/utils"
     "log"
 )
@@ -37,6 +38,14 @@ func main(){
         log.Printf("branch tests failed")
     }
 
+    ok, err = sprite.Run(false)
+    if err != nil {
+        log.Printf("sprite failed with an error: %v", err)
+    }
+    if !ok {
+        log.Printf("sprite tests failed")
+    }
+
     ok, err = screenshot.Run(false)
     if err != nil {
         log.Printf("screenshot failed with an error: %v", err)
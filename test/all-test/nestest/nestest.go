@@ -122,7 +122,7 @@ func Run(debug bool) (bool, error){
 
     cpu := nes.StartupState()
 
-    mapper, err := nes.MakeMapper(nesFile.Mapper, nesFile.ProgramRom, nesFile.CharacterRom)
+    mapper, err := nes.MakeMapper(nesFile.MapperInfo(), nesFile.ProgramRom, nesFile.CharacterRom)
     if err != nil {
         return false, err
     }
@@ -0,0 +1,96 @@
+package sprite
+
+import (
+    nes "github.com/kazzmir/nes/lib"
+    "log"
+    "path/filepath"
+    test_utils "github.com/kazzmir/nes/test/all-test/utils"
+)
+
+/* Run blargg's sprite overflow and sprite 0 hit tests. Unzip them into 'test-roms' such that
+ * 'test-roms/sprite_overflow_tests' and 'test-roms/sprite_hit_tests_2005.10.05' exist.
+ * Each rom writes its result to address 0xf8, where 1 means the test passed and anything
+ * else is the number of the check that failed.
+ */
+
+const ResultAddress = 0xf8
+
+var overflowTests = []string{
+    "1.Basics.nes",
+    "2.Details.nes",
+    "3.Timing.nes",
+    "4.Obscure.nes",
+    "5.Emulator.nes",
+}
+
+var hitTests = []string{
+    "01.basics.nes",
+    "02.alignment.nes",
+    "03.corners.nes",
+    "04.flip.nes",
+    "05.left_clip.nes",
+    "06.right_edge.nes",
+    "07.screen_bottom.nes",
+    "08.double_height.nes",
+    "09.timing_basics.nes",
+    "10.timing_order.nes",
+    "11.edge_timing.nes",
+}
+
+/* the tests take a few seconds to run, so give each one 6 million instructions, about 10 seconds of emulated time */
+func doTest(rom string) (byte, error) {
+    nesFile, err := nes.ParseNesFile(rom, false)
+    if err != nil {
+        return 0, err
+    }
+
+    cpu := nes.StartupState()
+
+    mapper, err := nes.MakeMapper(nesFile.MapperInfo(), nesFile.ProgramRom, nesFile.CharacterRom)
+    if err != nil {
+        return 0, err
+    }
+    cpu.SetMapper(mapper)
+
+    cpu.Reset()
+
+    machine := nes.MakeMachine(&cpu, 44100)
+
+    for instructions := 0; instructions < 6000000; instructions++ {
+        _, err := machine.StepInstruction()
+        if err != nil {
+            return 0, err
+        }
+    }
+
+    return cpu.LoadMemory(ResultAddress), nil
+}
+
+/* every rom is run and reported, so one missing or broken rom doesn't hide the results of the others */
+func runTests(directory string, roms []string) bool {
+    ok := true
+    for _, rom := range roms {
+        result, err := doTest(filepath.Join(directory, rom))
+        if err != nil {
+            log.Printf("%v: %v", test_utils.Failure(rom), err)
+            ok = false
+            continue
+        }
+
+        if result == 1 {
+            log.Print(test_utils.Success(rom))
+        } else {
+            log.Printf("%v result %v", test_utils.Failure(rom), result)
+            ok = false
+        }
+    }
+
+    return ok
+}
+
+func Run(debug bool) (bool, error) {
+    overflow := runTests("test-roms/sprite_overflow_tests", overflowTests)
+    hit := runTests("test-roms/sprite_hit_tests_2005.10.05", hitTests)
+
+    return overflow && hit, nil
+}
@@ -41,6 +41,9 @@ func Run(rom string, maxCycles int64) (nes.VirtualScreen, error) {
     if nesFile.VerticalMirror {
         cpu.PPU.SetVerticalMirror()
     }
+    if nesFile.FourScreen {
+        cpu.PPU.SetFourScreenMirror()
+    }
     /*
     cpu.PPU.SetHorizontalMirror(nesFile.HorizontalMirror)
     cpu.PPU.SetVerticalMirror(nesFile.VerticalMirror)
@@ -52,7 +55,7 @@ func Run(rom string, maxCycles int64) (nes.VirtualScreen, error) {
     }
     cpu.PPU.CopyCharacterRom(0x0000, nesFile.CharacterRom[:maxCharacterRomLength])
 
-    mapper, err := nes.MakeMapper(nesFile.Mapper, nesFile.ProgramRom, nesFile.CharacterRom)
+    mapper, err := nes.MakeMapper(nesFile.MapperInfo(), nesFile.ProgramRom, nesFile.CharacterRom)
     if err != nil {
         return nes.VirtualScreen{}, err
     }
@@ -61,38 +64,16 @@ func Run(rom string, maxCycles int64) (nes.VirtualScreen, error) {
     cpu.Reset()
     cpu.Input = nes.MakeInput(&FakeButtons{})
 
-    screen := nes.MakeVirtualScreen(256, 240)
-    instructionTable := nes.MakeInstructionDescriptiontable()
-    baseCyclesPerSample := 100.0
-
     buffer := nes.MakeVirtualScreen(256, 240)
 
-    var lastCycle uint64 = 0
-    totalCycles := int64(0)
-    for totalCycles < maxCycles {
-        err := cpu.Run(instructionTable)
-        if err != nil {
-            return nes.VirtualScreen{}, err
-        }
-        usedCycles := cpu.Cycle
-
-        cycleDiff := usedCycles - lastCycle
-
-        totalCycles += int64(cycleDiff)
-
-        cpu.APU.Run(float64(cycleDiff) / 2.0, baseCyclesPerSample, &cpu)
-
-        nmi, drawn := cpu.PPU.Run(cycleDiff * 3, screen, mapper)
-
-        if drawn {
-            buffer.CopyFrom(&screen)
-        }
-
-        if nmi {
-            cpu.NMI()
-        }
+    machine := nes.MakeMachine(&cpu, 44100)
+    machine.FrameComplete = func(screen nes.VirtualScreen){
+        buffer.CopyFrom(&screen)
+    }
 
-        lastCycle = usedCycles
+    err = machine.RunCycles(float64(maxCycles))
+    if err != nil {
+        return nes.VirtualScreen{}, err
     }
 
     return buffer, nil